@@ -0,0 +1,604 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/downloader"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/helmpath"
+	"helm.sh/helm/v3/pkg/repo"
+	"sigs.k8s.io/yaml"
+)
+
+// legacyHelmChartContentMediaType is the layer media type of charts pushed by helm before 3.7
+const legacyHelmChartContentMediaType = "application/tar+gzip"
+
+// DependencyRepositoryConfig declares a chart repository the dependencies of the charts are fetched from, the
+// credentials are read from the environment variables with the given names
+type DependencyRepositoryConfig struct {
+	Name        string `yaml:"name"`
+	URL         string `yaml:"url"`
+	UserEnv     string `yaml:"user_env,omitempty"`
+	PasswordEnv string `yaml:"password_env,omitempty"`
+	PlainHTTP   bool   `yaml:"plain_http,omitempty"`
+	// PassCredentials sends the credentials to chart URLs of the index on other hosts than the repository as well
+	PassCredentials bool `yaml:"pass_credentials,omitempty"`
+}
+
+type dependencyConfig struct {
+	offline  *bool
+	cacheDir *string
+}
+
+// dependencyRepository is a declared repository with its credentials
+type dependencyRepository struct {
+	name      string
+	url       string
+	user      string
+	password  string
+	plainHTTP bool
+	// passCredentials sends the credentials to URLs on other hosts than the repository
+	passCredentials bool
+}
+
+// dependencyManager fetches the dependencies of a chart into its charts directory like helm dependency build, the
+// Chart.lock is honored and written if the chart has none
+type dependencyManager struct {
+	out          io.Writer
+	repositories []dependencyRepository
+	offline      bool
+	cacheDir     string
+}
+
+// newDependencyManager returns a manager for the repositories of the ci_config.yaml and of the helm repositories.yaml
+// if it exists, the ci_config.yaml takes precedence
+func (conf *DeploymentConfig) newDependencyManager(out io.Writer, config dependencyConfig) (*dependencyManager, error) {
+	manager := &dependencyManager{out: out, offline: *config.offline, cacheDir: *config.cacheDir}
+	for _, declared := range conf.DependencyRepositories {
+		repository := dependencyRepository{name: declared.Name, url: strings.TrimSuffix(declared.URL, "/"), plainHTTP: declared.PlainHTTP, passCredentials: declared.PassCredentials}
+		for _, credential := range []struct {
+			env    string
+			target *string
+		}{{declared.UserEnv, &repository.user}, {declared.PasswordEnv, &repository.password}} {
+			if credential.env == "" {
+				continue
+			}
+			value, ok := os.LookupEnv(credential.env)
+			if !ok {
+				return nil, fmt.Errorf("Environment variable %v with the credentials of dependency repository %v is not set", credential.env, declared.Name)
+			}
+			*credential.target = value
+		}
+		manager.repositories = append(manager.repositories, repository)
+	}
+
+	helmRepositories, err := repo.LoadFile(helmpath.ConfigPath("repositories.yaml"))
+	if err == nil {
+		for _, entry := range helmRepositories.Repositories {
+			manager.repositories = append(manager.repositories, dependencyRepository{name: entry.Name, url: strings.TrimSuffix(entry.URL, "/"), user: entry.Username, password: entry.Password, passCredentials: entry.PassCredentialsAll})
+		}
+	}
+	return manager, nil
+}
+
+// repository returns the repository of the repository field of a dependency, @name and alias:name refer to the name of
+// a repository. Unknown URLs are used without credentials.
+func (m *dependencyManager) repository(reference string) (dependencyRepository, error) {
+	name := ""
+	if strings.HasPrefix(reference, "@") {
+		name = strings.TrimPrefix(reference, "@")
+	} else if strings.HasPrefix(reference, "alias:") {
+		name = strings.TrimPrefix(reference, "alias:")
+	}
+	reference = strings.TrimSuffix(reference, "/")
+
+	for _, repository := range m.repositories {
+		if name != "" && repository.name == name {
+			return repository, nil
+		}
+		if name == "" && (repository.url == reference || strings.HasPrefix(reference, "oci://") && strings.HasPrefix(reference, repository.url+"/")) {
+			return repository, nil
+		}
+	}
+	if name != "" {
+		return dependencyRepository{}, fmt.Errorf("Dependency repository %v is not declared in the dependency_repositories of the ci_config.yaml", name)
+	}
+	return dependencyRepository{url: reference}, nil
+}
+
+// hashDependencies returns the digest of the Chart.lock like helm does
+func hashDependencies(requirements []*chart.Dependency, locked []*chart.Dependency) (string, error) {
+	data, err := json.Marshal([2][]*chart.Dependency{requirements, locked})
+	if err != nil {
+		return "", fmt.Errorf("Could not marshal dependencies: %v", err)
+	}
+	return sha256Digest(data), nil
+}
+
+// isRemoteDependency returns false for dependencies in the charts directory and on the local file system
+func isRemoteDependency(dependency *chart.Dependency) bool {
+	return dependency.Repository != "" && !strings.HasPrefix(dependency.Repository, "file://")
+}
+
+// build fetches the locked dependencies of the chart, the versions are resolved and locked if there is no Chart.lock.
+// Dependencies from helm repositories are fetched by the dependency manager of helm, OCI registries which helm 3.6 can
+// not resolve and locked dependencies which are vendored or cached are handled here.
+func (m *dependencyManager) build(chartPath string) error {
+	loaded, err := loader.LoadDir(chartPath)
+	if err != nil {
+		return fmt.Errorf("Could not load chart %v: %v", chartPath, err)
+	}
+	requirements := loaded.Metadata.Dependencies
+	if len(requirements) == 0 {
+		return nil
+	}
+
+	// helm locks the URL of repositories which are referred to by name
+	references := []string{}
+	ociDependencies := 0
+	for _, requirement := range requirements {
+		if isRemoteDependency(requirement) {
+			repository, err := m.repository(requirement.Repository)
+			if err != nil {
+				return err
+			}
+			references = append(references, requirement.Repository)
+			requirement.Repository = repository.url
+			if strings.HasPrefix(repository.url, "oci://") {
+				ociDependencies++
+			}
+		}
+	}
+	if ociDependencies > 0 && ociDependencies < len(references) {
+		return fmt.Errorf("The dependencies of %v can not be fetched from OCI registries and helm repositories at the same time", chartPath)
+	}
+
+	lock := loaded.Lock
+	if lock != nil {
+		digest, err := hashDependencies(requirements, lock.Dependencies)
+		if err != nil {
+			return err
+		}
+		if digest != lock.Digest {
+			return fmt.Errorf("The Chart.lock of %v is out of sync with the dependencies in its Chart.yaml, run helm dependency update", chartPath)
+		}
+	} else if m.offline {
+		return fmt.Errorf("%v has no Chart.lock, it is required to build the dependencies offline", chartPath)
+	}
+
+	if ociDependencies == 0 {
+		restorable, err := m.restorable(chartPath, lock)
+		if err != nil {
+			return err
+		}
+		if !restorable {
+			return m.buildWithHelm(chartPath, references)
+		}
+	}
+
+	if lock == nil {
+		lock, err = m.resolve(chartPath, requirements)
+		if err != nil {
+			return err
+		}
+	}
+	for _, dependency := range lock.Dependencies {
+		if dependency.Repository == "" {
+			continue
+		}
+		if err := m.fetch(chartPath, dependency); err != nil {
+			return err
+		}
+	}
+
+	if loaded.Lock == nil {
+		content, err := yaml.Marshal(lock)
+		if err != nil {
+			return fmt.Errorf("Could not marshal Chart.lock: %v", err)
+		}
+		return ioutil.WriteFile(filepath.Join(chartPath, "Chart.lock"), content, 0644)
+	}
+	return nil
+}
+
+// restorable returns whether every locked remote dependency is vendored or cached, offline they have to be
+func (m *dependencyManager) restorable(chartPath string, lock *chart.Lock) (bool, error) {
+	if lock == nil {
+		return false, nil
+	}
+	if m.offline {
+		return true, nil
+	}
+	vendored, err := vendoredCharts(filepath.Join(chartPath, "charts"))
+	if err != nil {
+		return false, err
+	}
+	for _, dependency := range lock.Dependencies {
+		if !isRemoteDependency(dependency) || vendored[dependency.Name][dependency.Version] != "" {
+			continue
+		}
+		if cacheFile := m.cacheFile(dependency); cacheFile == "" {
+			return false, nil
+		} else if _, err := os.Stat(cacheFile); err != nil {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// buildWithHelm builds the dependencies with the dependency manager of helm, which checks the Chart.lock or writes it.
+// The repositories the dependencies refer to are passed with their credentials in a temporary repositories.yaml.
+func (m *dependencyManager) buildWithHelm(chartPath string, references []string) error {
+	dir, err := ioutil.TempDir("", "helm_repositories")
+	if err != nil {
+		return fmt.Errorf("Could not create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	repositories := repo.NewFile()
+	for _, reference := range references {
+		repository, err := m.repository(reference)
+		if err != nil {
+			return err
+		}
+		name := repository.name
+		if name == "" {
+			name = fmt.Sprintf("dependency-%v", len(repositories.Repositories))
+		} else if repositories.Has(name) {
+			continue
+		}
+		repositories.Add(&repo.Entry{
+			Name:               name,
+			URL:                repository.url,
+			Username:           repository.user,
+			Password:           repository.password,
+			PassCredentialsAll: repository.passCredentials,
+		})
+	}
+	repositoryConfig := filepath.Join(dir, "repositories.yaml")
+	if err := repositories.WriteFile(repositoryConfig, 0600); err != nil {
+		return fmt.Errorf("Could not write %v: %v", repositoryConfig, err)
+	}
+
+	// the manager of helm 3.6 downloads the indexes to the cache of the user instead of its repository cache
+	getters := getter.Providers{{Schemes: []string{"http", "https"}, New: getter.NewHTTPGetter}}
+	repositoryCache := filepath.Join(dir, "cache")
+	for _, entry := range repositories.Repositories {
+		chartRepository, err := repo.NewChartRepository(entry, getters)
+		if err != nil {
+			return fmt.Errorf("Invalid dependency repository %v: %v", entry.URL, err)
+		}
+		chartRepository.CachePath = repositoryCache
+		if _, err := chartRepository.DownloadIndexFile(); err != nil {
+			return fmt.Errorf("Could not download index of %v: %v", entry.URL, err)
+		}
+	}
+
+	manager := &downloader.Manager{
+		Out:              m.out,
+		ChartPath:        chartPath,
+		RepositoryConfig: repositoryConfig,
+		RepositoryCache:  repositoryCache,
+		Getters:          getters,
+		SkipUpdate:       true,
+	}
+	if err := manager.Build(); err != nil {
+		return fmt.Errorf("Could not build the dependencies of %v: %v", chartPath, err)
+	}
+	return m.cacheVendored(chartPath)
+}
+
+// cacheVendored copies the remote dependencies helm downloaded into the charts directory to the cache directory
+func (m *dependencyManager) cacheVendored(chartPath string) error {
+	if m.cacheDir == "" {
+		return nil
+	}
+	loaded, err := loader.LoadDir(chartPath)
+	if err != nil {
+		return fmt.Errorf("Could not load chart %v: %v", chartPath, err)
+	}
+	vendored, err := vendoredCharts(filepath.Join(chartPath, "charts"))
+	if err != nil {
+		return err
+	}
+	for _, dependency := range loaded.Lock.Dependencies {
+		file := vendored[dependency.Name][dependency.Version]
+		if !isRemoteDependency(dependency) || file == "" {
+			continue
+		}
+		archive, err := ioutil.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("Could not read dependency %v: %v", file, err)
+		}
+		if err := m.store(dependency, archive); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolve locks the highest version of every dependency which satisfies its version constraint
+func (m *dependencyManager) resolve(chartPath string, requirements []*chart.Dependency) (*chart.Lock, error) {
+	lock := &chart.Lock{Generated: time.Now()}
+	for _, requirement := range requirements {
+		constraint, err := semver.NewConstraint(requirement.Version)
+		if err != nil {
+			return nil, fmt.Errorf("Dependency %v has an invalid version constraint: %v", requirement.Name, err)
+		}
+
+		version := requirement.Version
+		switch {
+		case requirement.Repository == "":
+		case strings.HasPrefix(requirement.Repository, "file://"):
+			local, err := loader.LoadDir(localDependencyPath(chartPath, requirement))
+			if err != nil {
+				return nil, fmt.Errorf("Could not load dependency %v: %v", requirement.Name, err)
+			}
+			version = local.Metadata.Version
+		default:
+			versions, err := m.versions(requirement)
+			if err != nil {
+				return nil, err
+			}
+			version = ""
+			for _, candidate := range versions {
+				if constraint.Check(candidate) {
+					version = candidate.Original()
+					break
+				}
+			}
+		}
+		if parsed, err := semver.NewVersion(version); requirement.Repository != "" && (err != nil || !constraint.Check(parsed)) {
+			return nil, fmt.Errorf("No version of dependency %v in %v satisfies %v", requirement.Name, requirement.Repository, requirement.Version)
+		}
+		lock.Dependencies = append(lock.Dependencies, &chart.Dependency{Name: requirement.Name, Repository: requirement.Repository, Version: version})
+	}
+
+	digest, err := hashDependencies(requirements, lock.Dependencies)
+	if err != nil {
+		return nil, err
+	}
+	lock.Digest = digest
+	return lock, nil
+}
+
+// versions returns the versions of the chart of the dependency in its OCI registry, the highest first
+func (m *dependencyManager) versions(dependency *chart.Dependency) ([]*semver.Version, error) {
+	registry, err := m.ociRepository(dependency.Repository)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := registry.Tags(dependency.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := []*semver.Version{}
+	for _, tag := range tags {
+		if version, err := semver.NewVersion(strings.ReplaceAll(tag, "_", "+")); err == nil {
+			versions = append(versions, version)
+		}
+	}
+	sort.Sort(sort.Reverse(semver.Collection(versions)))
+	return versions, nil
+}
+
+// fetch stores the archive of the locked dependency in the charts directory unless it is vendored there already, a
+// remote archive is taken from the cache directory if possible
+func (m *dependencyManager) fetch(chartPath string, dependency *chart.Dependency) error {
+	chartsDir := filepath.Join(chartPath, "charts")
+	vendored, err := vendoredCharts(chartsDir)
+	if err != nil {
+		return err
+	}
+
+	// dependencies on the local file system are packaged again as they might have changed
+	var archive []byte
+	if strings.HasPrefix(dependency.Repository, "file://") {
+		archive, err = packageLocalDependency(localDependencyPath(chartPath, dependency))
+	} else if vendored[dependency.Name][dependency.Version] != "" {
+		return nil
+	} else {
+		archive, err = m.archive(dependency)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, outdated := range vendored[dependency.Name] {
+		if err := os.Remove(outdated); err != nil {
+			return fmt.Errorf("Could not delete outdated dependency %v: %v", outdated, err)
+		}
+	}
+	if err := os.MkdirAll(chartsDir, 0755); err != nil {
+		return fmt.Errorf("Could not create %v: %v", chartsDir, err)
+	}
+	return ioutil.WriteFile(filepath.Join(chartsDir, fmt.Sprintf("%v-%v.tgz", dependency.Name, dependency.Version)), archive, 0644)
+}
+
+// cacheFile returns the path of the dependency in the cache directory or an empty string without cache directory
+func (m *dependencyManager) cacheFile(dependency *chart.Dependency) string {
+	if m.cacheDir == "" {
+		return ""
+	}
+	return filepath.Join(m.cacheDir, strings.TrimPrefix(sha256Digest([]byte(dependency.Repository)), "sha256:")[:16], fmt.Sprintf("%v-%v.tgz", dependency.Name, dependency.Version))
+}
+
+// archive returns the cached archive of the dependency or pulls it from its OCI registry and caches it
+func (m *dependencyManager) archive(dependency *chart.Dependency) ([]byte, error) {
+	cacheFile := m.cacheFile(dependency)
+	if cacheFile != "" {
+		if archive, err := ioutil.ReadFile(cacheFile); err == nil {
+			return archive, nil
+		}
+	}
+	if m.offline {
+		return nil, fmt.Errorf("Dependency %v %v from %v is neither vendored nor cached and can not be fetched offline", dependency.Name, dependency.Version, dependency.Repository)
+	}
+
+	registry, err := m.ociRepository(dependency.Repository)
+	if err != nil {
+		return nil, err
+	}
+	archive, err := registry.Pull(dependency.Name, dependency.Version)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(m.out, "Downloaded dependency %v %v from %v\n", dependency.Name, dependency.Version, dependency.Repository)
+	return archive, m.store(dependency, archive)
+}
+
+// store writes the archive of the dependency to the cache directory if there is one
+func (m *dependencyManager) store(dependency *chart.Dependency, archive []byte) error {
+	cacheFile := m.cacheFile(dependency)
+	if cacheFile == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(cacheFile), 0755); err != nil {
+		return fmt.Errorf("Could not create dependency cache: %v", err)
+	}
+	if err := ioutil.WriteFile(cacheFile, archive, 0644); err != nil {
+		return fmt.Errorf("Could not cache dependency %v: %v", dependency.Name, err)
+	}
+	return nil
+}
+
+// ociRepository returns the registry of an oci:// dependency with the credentials of its repository
+func (m *dependencyManager) ociRepository(reference string) (*ociRepository, error) {
+	repository, err := m.repository(reference)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(repository.url, "oci://") {
+		return nil, fmt.Errorf("Dependency repository %v is no OCI registry", reference)
+	}
+	return newOCIRepository(reference, repository.client(), repository.plainHTTP)
+}
+
+func (repository dependencyRepository) client() *registryClient {
+	return &registryClient{user: repository.user, password: repository.password, client: &http.Client{Timeout: 5 * time.Minute}}
+}
+
+// vendoredCharts returns the archives in the charts directory keyed by chart name and version
+func vendoredCharts(chartsDir string) (map[string]map[string]string, error) {
+	archives := map[string]map[string]string{}
+	files, err := filepath.Glob(filepath.Join(chartsDir, "*.tgz"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		vendored, err := loader.Load(file)
+		if err != nil {
+			return nil, fmt.Errorf("Could not load dependency %v: %v", file, err)
+		}
+		if archives[vendored.Metadata.Name] == nil {
+			archives[vendored.Metadata.Name] = map[string]string{}
+		}
+		archives[vendored.Metadata.Name][vendored.Metadata.Version] = file
+	}
+	return archives, nil
+}
+
+// localDependencyPath returns the directory of a file:// dependency, relative paths refer to the chart directory
+func localDependencyPath(chartPath string, dependency *chart.Dependency) string {
+	dependencyPath := strings.TrimPrefix(dependency.Repository, "file://")
+	if filepath.IsAbs(dependencyPath) {
+		return dependencyPath
+	}
+	return filepath.Join(chartPath, dependencyPath)
+}
+
+// packageLocalDependency packages a dependency from the local file system
+func packageLocalDependency(dependencyPath string) ([]byte, error) {
+	local, err := loader.LoadDir(dependencyPath)
+	if err != nil {
+		return nil, fmt.Errorf("Could not load dependency %v: %v", dependencyPath, err)
+	}
+	dir, err := ioutil.TempDir("", "chart_dependency")
+	if err != nil {
+		return nil, fmt.Errorf("Could not create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	file, err := chartutil.Save(local, dir)
+	if err != nil {
+		return nil, fmt.Errorf("Could not package dependency %v: %v", dependencyPath, err)
+	}
+	return ioutil.ReadFile(file)
+}
+
+// Tags returns the tags of the chart in the registry
+func (r *ociRepository) Tags(name string) ([]string, error) {
+	response, err := r.client.do(http.MethodGet, fmt.Sprintf("%v/v2/%v/tags/list", r.registry, path.Join(r.namespace, name)), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, expect(response, "list tags of "+name, http.StatusOK)
+	}
+	defer response.Body.Close()
+
+	tags := struct {
+		Tags []string `json:"tags"`
+	}{}
+	if err := json.NewDecoder(response.Body).Decode(&tags); err != nil {
+		return nil, fmt.Errorf("Could not parse tags of %v: %v", name, err)
+	}
+	return tags.Tags, nil
+}
+
+// Pull downloads the chart archive of the version from the registry
+func (r *ociRepository) Pull(name string, version string) ([]byte, error) {
+	repository := path.Join(r.namespace, name)
+	header := http.Header{"Accept": []string{ociManifestMediaType}}
+	response, err := r.client.do(http.MethodGet, fmt.Sprintf("%v/v2/%v/manifests/%v", r.registry, repository, ociTag(version)), header, nil)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, expect(response, fmt.Sprintf("pull manifest of %v %v", name, version), http.StatusOK)
+	}
+	manifest := ociManifest{}
+	err = json.NewDecoder(response.Body).Decode(&manifest)
+	response.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse manifest of %v %v: %v", name, version, err)
+	}
+
+	for _, layer := range manifest.Layers {
+		if layer.MediaType != helmChartContentMediaType && layer.MediaType != legacyHelmChartContentMediaType {
+			continue
+		}
+		response, err := r.client.do(http.MethodGet, fmt.Sprintf("%v/v2/%v/blobs/%v", r.registry, repository, layer.Digest), nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		if response.StatusCode != http.StatusOK {
+			return nil, expect(response, fmt.Sprintf("pull chart %v %v", name, version), http.StatusOK)
+		}
+		archive, err := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Could not pull chart %v %v: %v", name, version, err)
+		}
+		if sha256Digest(archive) != layer.Digest {
+			return nil, fmt.Errorf("Digest of chart %v %v does not match its manifest", name, version)
+		}
+		return archive, nil
+	}
+	return nil, fmt.Errorf("Manifest of %v %v contains no chart", name, version)
+}
@@ -0,0 +1,320 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"gotest.tools/assert"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/downloader"
+	"helm.sh/helm/v3/pkg/repo"
+	"sigs.k8s.io/yaml"
+)
+
+// newDependentChart creates the chart frontend with the dependencies in a temporary directory
+func newDependentChart(t *testing.T, dependencies string) string {
+	dir := filepath.Join(t.TempDir(), "frontend")
+	assert.NilError(t, os.MkdirAll(dir, 0755))
+	chartYaml := "apiVersion: v2\nname: frontend\nversion: 0.1.0\ndependencies:\n" + dependencies
+	assert.NilError(t, ioutil.WriteFile(filepath.Join(dir, "Chart.yaml"), []byte(chartYaml), 0644))
+	return dir
+}
+
+// newTestDependencyManager returns a manager which does not read the repositories.yaml of the user
+func newTestDependencyManager(t *testing.T, conf DeploymentConfig, offline bool, cacheDir string) *dependencyManager {
+	t.Setenv("HELM_REPOSITORY_CONFIG", filepath.Join(t.TempDir(), "repositories.yaml"))
+	manager, err := conf.newDependencyManager(ioutil.Discard, dependencyConfig{offline: &offline, cacheDir: &cacheDir})
+	assert.NilError(t, err)
+	return manager
+}
+
+// testHelmRepository is a helm repository which requires basic auth and serves versions of the chart carts, charts
+// can be uploaded with the API of ChartMuseum which rejects existing versions
+type testHelmRepository struct {
+	sync.Mutex
+	server    *httptest.Server
+	archives  map[string][]byte
+	downloads int
+	uploads   int
+}
+
+func newTestHelmRepository(t *testing.T, versions ...string) *testHelmRepository {
+	repository := &testHelmRepository{archives: map[string][]byte{}}
+	repository.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		repository.Lock()
+		defer repository.Unlock()
+
+		user, password, _ := r.BasicAuth()
+		if user != "jenkins" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Method == http.MethodPost && r.URL.Path == "/api/charts" {
+			archive, err := ioutil.ReadAll(r.Body)
+			assert.NilError(t, err)
+			uploaded, err := loader.LoadArchive(strings.NewReader(string(archive)))
+			assert.NilError(t, err)
+			if _, ok := repository.archives[uploaded.Metadata.Version]; ok {
+				w.WriteHeader(http.StatusConflict)
+				fmt.Fprint(w, `{"error":"file already exists"}`)
+				return
+			}
+			repository.archives[uploaded.Metadata.Version] = archive
+			repository.uploads++
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		if r.URL.Path == "/index.yaml" {
+			index := repo.NewIndexFile()
+			for version, archive := range repository.archives {
+				metadata, err := loader.LoadArchive(strings.NewReader(string(archive)))
+				assert.NilError(t, err)
+				assert.NilError(t, index.MustAdd(metadata.Metadata, fmt.Sprintf("carts-%v.tgz", version), "", sha256Digest(archive)))
+			}
+			content, err := yaml.Marshal(index)
+			assert.NilError(t, err)
+			w.Write(content)
+			return
+		}
+		archive, ok := repository.archives[strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/carts-"), ".tgz")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		repository.downloads++
+		w.Write(archive)
+	}))
+	for _, version := range versions {
+		repository.add(t, version)
+	}
+	return repository
+}
+
+func (repository *testHelmRepository) add(t *testing.T, version string) {
+	_, archive, err := packageChart(newTestChart(t), version)
+	assert.NilError(t, err)
+	repository.Lock()
+	defer repository.Unlock()
+	repository.archives[version] = archive
+}
+
+func privateRepositoryConfig(t *testing.T, url string) DeploymentConfig {
+	t.Setenv("PRIVATE_REPOSITORY_USER", "jenkins")
+	t.Setenv("PRIVATE_REPOSITORY_PASSWORD", "secret")
+	return DeploymentConfig{DependencyRepositories: []DependencyRepositoryConfig{{
+		Name:        "private",
+		URL:         url,
+		UserEnv:     "PRIVATE_REPOSITORY_USER",
+		PasswordEnv: "PRIVATE_REPOSITORY_PASSWORD",
+		PlainHTTP:   true,
+	}}}
+}
+
+// vendoredVersion returns the version of the chart carts in the charts directory
+func vendoredVersion(t *testing.T, chartPath string) string {
+	vendored, err := vendoredCharts(filepath.Join(chartPath, "charts"))
+	assert.NilError(t, err)
+	assert.Equal(t, len(vendored["carts"]), 1)
+	for version := range vendored["carts"] {
+		return version
+	}
+	return ""
+}
+
+func TestBuildDependencies_HelmRepository(t *testing.T) {
+	repository := newTestHelmRepository(t, "1.1.0", "1.1.1", "1.2.0")
+	defer repository.server.Close()
+	manager := newTestDependencyManager(t, privateRepositoryConfig(t, repository.server.URL+"/"), false, "")
+	chartPath := newDependentChart(t, "- name: carts\n  version: ~1.1.0\n  repository: \"@private\"\n")
+
+	assert.NilError(t, manager.build(chartPath))
+	assert.Equal(t, vendoredVersion(t, chartPath), "1.1.1")
+
+	loaded, err := loader.LoadDir(chartPath)
+	assert.NilError(t, err)
+	assert.Equal(t, loaded.Lock.Dependencies[0].Version, "1.1.1")
+	assert.Equal(t, loaded.Lock.Dependencies[0].Repository, repository.server.URL)
+
+	// the locked version is used although a newer one satisfies the constraint
+	repository.add(t, "1.1.2")
+	assert.NilError(t, os.RemoveAll(filepath.Join(chartPath, "charts")))
+	assert.NilError(t, manager.build(chartPath))
+	assert.Equal(t, vendoredVersion(t, chartPath), "1.1.1")
+	assert.Equal(t, repository.downloads, 2)
+
+	// vendored dependencies are not downloaded again
+	assert.NilError(t, manager.build(chartPath))
+	assert.Equal(t, repository.downloads, 2)
+}
+
+// newTestOCIRepository publishes the versions of the chart carts to a registry and returns the URL of the repository
+func newTestOCIRepository(t *testing.T, versions ...string) string {
+	registry := newTestRegistry(t)
+	t.Cleanup(registry.server.Close)
+	repositoryURL := "oci://" + strings.TrimPrefix(registry.server.URL, "http://") + "/charts"
+	for _, version := range versions {
+		_, err := newChartRepositoryConfig("jenkins", "secret").publishChart(ioutil.Discard, repositoryURL, newTestChart(t), version, false)
+		assert.NilError(t, err)
+	}
+	return repositoryURL
+}
+
+func TestBuildDependencies_OCI(t *testing.T) {
+	repositoryURL := newTestOCIRepository(t, "1.2.0", "1.2.1", "1.3.0+build.1", "2.0.0", "2.1.0-rc.1")
+	manager := newTestDependencyManager(t, privateRepositoryConfig(t, repositoryURL), false, "")
+
+	for constraint, version := range map[string]string{
+		"^1.2.0":   "1.3.0+build.1",
+		"~1.2.0":   "1.2.1",
+		">=2.0.0":  "2.0.0",
+		"1.2.0":    "1.2.0",
+		"<1.3.0":   "1.2.1",
+		"^2.1.0-0": "2.1.0-rc.1",
+	} {
+		chartPath := newDependentChart(t, fmt.Sprintf("- name: carts\n  version: %q\n  repository: %v\n", constraint, repositoryURL))
+		assert.NilError(t, manager.build(chartPath))
+		assert.Equal(t, vendoredVersion(t, chartPath), version, constraint)
+
+		loaded, err := loader.LoadDir(chartPath)
+		assert.NilError(t, err)
+		assert.Equal(t, loaded.Lock.Dependencies[0].Version, version, constraint)
+	}
+
+	chartPath := newDependentChart(t, fmt.Sprintf("- name: carts\n  version: ^3.0.0\n  repository: %v\n", repositoryURL))
+	err := manager.build(chartPath)
+	assert.Error(t, err, fmt.Sprintf("No version of dependency carts in %v satisfies ^3.0.0", repositoryURL))
+}
+
+func TestBuildDependencies_OCILock(t *testing.T) {
+	repositoryURL := newTestOCIRepository(t, "1.2.0")
+	manager := newTestDependencyManager(t, privateRepositoryConfig(t, repositoryURL), false, "")
+	chartPath := newDependentChart(t, fmt.Sprintf("- name: carts\n  version: ^1.2.0\n  repository: %v\n", repositoryURL))
+	assert.NilError(t, manager.build(chartPath))
+
+	// the locked version is pulled although a newer one satisfies the constraint
+	_, err := newChartRepositoryConfig("jenkins", "secret").publishChart(ioutil.Discard, repositoryURL, newTestChart(t), "1.3.0", false)
+	assert.NilError(t, err)
+	assert.NilError(t, os.RemoveAll(filepath.Join(chartPath, "charts")))
+	assert.NilError(t, manager.build(chartPath))
+	assert.Equal(t, vendoredVersion(t, chartPath), "1.2.0")
+
+	chartYaml := fmt.Sprintf("apiVersion: v2\nname: frontend\nversion: 0.1.0\ndependencies:\n- name: carts\n  version: ^1.3.0\n  repository: %v\n", repositoryURL)
+	assert.NilError(t, ioutil.WriteFile(filepath.Join(chartPath, "Chart.yaml"), []byte(chartYaml), 0644))
+	err = manager.build(chartPath)
+	assert.Error(t, err, "The Chart.lock of "+chartPath+" is out of sync with the dependencies in its Chart.yaml, run helm dependency update")
+	assert.Equal(t, vendoredVersion(t, chartPath), "1.2.0")
+}
+
+func TestBuildDependencies_MixedRepositories(t *testing.T) {
+	repositoryURL := newTestOCIRepository(t)
+	manager := newTestDependencyManager(t, DeploymentConfig{}, false, "")
+	chartPath := newDependentChart(t, fmt.Sprintf("- name: carts\n  version: 1.2.0\n  repository: %v\n- name: orders\n  version: 1.2.0\n  repository: https://charts.example.com\n", repositoryURL))
+
+	err := manager.build(chartPath)
+	assert.Error(t, err, "The dependencies of "+chartPath+" can not be fetched from OCI registries and helm repositories at the same time")
+}
+
+func TestBuildDependencies_Offline(t *testing.T) {
+	repository := newTestHelmRepository(t, "1.1.0")
+	defer repository.server.Close()
+	conf := privateRepositoryConfig(t, repository.server.URL)
+	cacheDir := t.TempDir()
+	chartPath := newDependentChart(t, "- name: carts\n  version: 1.1.0\n  repository: \"@private\"\n")
+
+	err := newTestDependencyManager(t, conf, true, cacheDir).build(chartPath)
+	assert.Error(t, err, chartPath+" has no Chart.lock, it is required to build the dependencies offline")
+
+	assert.NilError(t, newTestDependencyManager(t, conf, false, cacheDir).build(chartPath))
+	assert.NilError(t, os.RemoveAll(filepath.Join(chartPath, "charts")))
+
+	// the dependency is taken from the cache
+	assert.NilError(t, newTestDependencyManager(t, conf, true, cacheDir).build(chartPath))
+	assert.Equal(t, vendoredVersion(t, chartPath), "1.1.0")
+	assert.Equal(t, repository.downloads, 1)
+
+	// the dependency is vendored
+	assert.NilError(t, newTestDependencyManager(t, conf, true, "").build(chartPath))
+
+	assert.NilError(t, os.RemoveAll(filepath.Join(chartPath, "charts")))
+	err = newTestDependencyManager(t, conf, true, "").build(chartPath)
+	assert.Error(t, err, fmt.Sprintf("Dependency carts 1.1.0 from %v is neither vendored nor cached and can not be fetched offline", repository.server.URL))
+}
+
+// TestBuildDependencies_HelmLock verifies that a Chart.lock written by helm dependency update is honored
+func TestBuildDependencies_HelmLock(t *testing.T) {
+	chartPath := newDependentChart(t, "- name: carts\n  version: 0.1.0\n  repository: file://../carts\n")
+	local, err := loader.LoadDir(newTestChart(t))
+	assert.NilError(t, err)
+	assert.NilError(t, chartutil.SaveDir(local, filepath.Dir(chartPath)))
+
+	helmManager := &downloader.Manager{
+		Out:              ioutil.Discard,
+		ChartPath:        chartPath,
+		RepositoryConfig: filepath.Join(t.TempDir(), "repositories.yaml"),
+		RepositoryCache:  t.TempDir(),
+	}
+	assert.NilError(t, helmManager.Update())
+	assert.NilError(t, os.RemoveAll(filepath.Join(chartPath, "charts")))
+
+	manager := newTestDependencyManager(t, DeploymentConfig{}, true, "")
+	assert.NilError(t, manager.build(chartPath))
+	assert.Equal(t, vendoredVersion(t, chartPath), "0.1.0")
+
+	chartYaml := "apiVersion: v2\nname: frontend\nversion: 0.1.0\ndependencies:\n- name: carts\n  version: 0.2.0\n  repository: file://../carts\n"
+	assert.NilError(t, ioutil.WriteFile(filepath.Join(chartPath, "Chart.yaml"), []byte(chartYaml), 0644))
+	err = manager.build(chartPath)
+	assert.Error(t, err, "The Chart.lock of "+chartPath+" is out of sync with the dependencies in its Chart.yaml, run helm dependency update")
+}
+
+func TestNewDependencyManager_MissingCredentials(t *testing.T) {
+	conf := DeploymentConfig{DependencyRepositories: []DependencyRepositoryConfig{{Name: "private", URL: "https://charts.example.com", UserEnv: "MISSING_REPOSITORY_USER"}}}
+	offline, cacheDir := false, ""
+
+	_, err := conf.newDependencyManager(ioutil.Discard, dependencyConfig{offline: &offline, cacheDir: &cacheDir})
+	assert.Error(t, err, "Environment variable MISSING_REPOSITORY_USER with the credentials of dependency repository private is not set")
+}
+
+func TestBuildDependencies_CredentialsOnlyForRepositoryHost(t *testing.T) {
+	_, archive, err := packageChart(newTestChart(t), "1.2.0")
+	assert.NilError(t, err)
+	authorizations := []string{}
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		w.Write(archive)
+	}))
+	defer mirror.Close()
+
+	repository := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, _ := r.BasicAuth()
+		if user != "jenkins" || password != "secret" || r.URL.Path != "/index.yaml" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		metadata, err := loader.LoadArchive(strings.NewReader(string(archive)))
+		assert.NilError(t, err)
+		index := repo.NewIndexFile()
+		assert.NilError(t, index.MustAdd(metadata.Metadata, "carts-1.2.0.tgz", mirror.URL, sha256Digest(archive)))
+		content, err := yaml.Marshal(index)
+		assert.NilError(t, err)
+		w.Write(content)
+	}))
+	defer repository.Close()
+
+	for _, passCredentials := range []bool{false, true} {
+		conf := privateRepositoryConfig(t, repository.URL)
+		conf.DependencyRepositories[0].PassCredentials = passCredentials
+		manager := newTestDependencyManager(t, conf, false, "")
+		chartPath := newDependentChart(t, fmt.Sprintf("- name: carts\n  version: 1.2.0\n  repository: %v\n", repository.URL))
+		assert.NilError(t, manager.build(chartPath))
+		assert.Equal(t, vendoredVersion(t, chartPath), "1.2.0")
+	}
+	assert.DeepEqual(t, authorizations, []string{"", "Basic amVua2luczpzZWNyZXQ="})
+}
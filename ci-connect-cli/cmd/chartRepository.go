@@ -0,0 +1,402 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spf13/afero"
+	"helm.sh/helm/v3/pkg/chart"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	helmChartConfigMediaType  = "application/vnd.cncf.helm.config.v1+json"
+	helmChartContentMediaType = "application/vnd.cncf.helm.chart.content.v1.tar+gzip"
+	ociManifestMediaType      = "application/vnd.oci.image.manifest.v1+json"
+)
+
+// ChartReference locates a packaged chart, it is written into the deployment metadata and the umbrella chart which
+// replaces the chart
+type ChartReference struct {
+	Repository string `yaml:"repository"`
+	Name       string `yaml:"name"`
+	Version    string `yaml:"version"`
+	Digest     string `yaml:"digest"`
+}
+
+type chartRepositoryConfig struct {
+	user      *string
+	password  *string
+	plainHTTP *bool
+	// published contains the charts pushed by this run keyed by repository, name and version, a deployment repeated
+	// after a rejected git push must not push them again as repositories like ChartMuseum reject existing versions
+	published map[string]*ChartReference
+}
+
+// chartRepository stores chart archives, either an OCI registry or a ChartMuseum compatible repository
+type chartRepository interface {
+	// Reference returns the reference of the chart archive without pushing it
+	Reference(metadata *chart.Metadata, archive []byte) (ChartReference, error)
+	Push(metadata *chart.Metadata, archive []byte) (ChartReference, error)
+}
+
+// newChartRepository returns the repository for oci:// or http(s):// URLs
+func (config chartRepositoryConfig) newChartRepository(repositoryURL string) (chartRepository, error) {
+	client := &registryClient{
+		user:     *config.user,
+		password: *config.password,
+		client:   &http.Client{Timeout: 5 * time.Minute},
+	}
+
+	switch {
+	case strings.HasPrefix(repositoryURL, "oci://"):
+		return newOCIRepository(repositoryURL, client, *config.plainHTTP)
+	case strings.HasPrefix(repositoryURL, "http://"), strings.HasPrefix(repositoryURL, "https://"):
+		return &chartMuseumRepository{repositoryURL: strings.TrimSuffix(repositoryURL, "/"), client: client}, nil
+	}
+	return nil, fmt.Errorf("Chart repository %v has to start with oci://, http:// or https://", repositoryURL)
+}
+
+// newOCIRepository returns the registry of an oci:// URL, the path of the URL is the namespace of the charts
+func newOCIRepository(repositoryURL string, client *registryClient, plainHTTP bool) (*ociRepository, error) {
+	parsed, err := url.Parse(repositoryURL)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid chart repository %v: %v", repositoryURL, err)
+	}
+	scheme := "https"
+	if plainHTTP {
+		scheme = "http"
+	}
+	return &ociRepository{
+		repositoryURL: strings.TrimSuffix(repositoryURL, "/"),
+		registry:      scheme + "://" + parsed.Host,
+		namespace:     strings.Trim(parsed.Path, "/"),
+		client:        client,
+	}, nil
+}
+
+func sha256Digest(content []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(content))
+}
+
+// registryClient sends requests with basic auth or with the bearer token of the token service the registry refers to
+type registryClient struct {
+	user     string
+	password string
+	token    string
+	client   *http.Client
+}
+
+var bearerParameter = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// do sends the request, it is sent again with credentials if the registry requires them
+func (c *registryClient) do(method string, requestURL string, header http.Header, body []byte) (*http.Response, error) {
+	send := func() (*http.Response, error) {
+		request, err := http.NewRequest(method, requestURL, bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("Could not create request: %v", err)
+		}
+		for name, values := range header {
+			request.Header[name] = values
+		}
+		if c.token != "" {
+			request.Header.Set("Authorization", "Bearer "+c.token)
+		} else if c.user != "" {
+			request.SetBasicAuth(c.user, c.password)
+		}
+		response, err := c.client.Do(request)
+		if err != nil {
+			return nil, fmt.Errorf("Could not reach chart repository: %v", err)
+		}
+		return response, nil
+	}
+
+	response, err := send()
+	if err != nil || response.StatusCode != http.StatusUnauthorized {
+		return response, err
+	}
+	challenge := response.Header.Get("WWW-Authenticate")
+	response.Body.Close()
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+		return nil, fmt.Errorf("Chart repository denied access to %v, check the credentials", requestURL)
+	}
+	if err := c.requestToken(challenge); err != nil {
+		return nil, err
+	}
+	return send()
+}
+
+// requestToken gets a bearer token for the scope of the challenge from the token service of the registry
+func (c *registryClient) requestToken(challenge string) error {
+	parameters := map[string]string{}
+	for _, match := range bearerParameter.FindAllStringSubmatch(challenge, -1) {
+		parameters[match[1]] = match[2]
+	}
+	if parameters["realm"] == "" {
+		return fmt.Errorf("Chart repository requested a token without a realm")
+	}
+
+	query := url.Values{}
+	for _, name := range []string{"service", "scope"} {
+		if parameters[name] != "" {
+			query.Set(name, parameters[name])
+		}
+	}
+	request, err := http.NewRequest(http.MethodGet, parameters["realm"]+"?"+query.Encode(), nil)
+	if err != nil {
+		return fmt.Errorf("Could not create token request: %v", err)
+	}
+	if c.user != "" {
+		request.SetBasicAuth(c.user, c.password)
+	}
+	response, err := c.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("Could not reach token service of chart repository: %v", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("Token service of chart repository responded with %v, check the credentials", response.Status)
+	}
+
+	token := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := json.NewDecoder(response.Body).Decode(&token); err != nil {
+		return fmt.Errorf("Could not parse token of chart repository: %v", err)
+	}
+	c.token = token.Token
+	if c.token == "" {
+		c.token = token.AccessToken
+	}
+	return nil
+}
+
+// expect closes the response and returns an error if its status is not one of the expected ones
+func expect(response *http.Response, action string, statusCodes ...int) error {
+	defer response.Body.Close()
+	for _, statusCode := range statusCodes {
+		if response.StatusCode == statusCode {
+			return nil
+		}
+	}
+	body, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+	return fmt.Errorf("Could not %v, chart repository responded with %v: %v", action, response.Status, strings.TrimSpace(string(body)))
+}
+
+// ociRepository pushes charts to an OCI registry like helm push, the chart is stored in <namespace>/<chart>:<version>
+type ociRepository struct {
+	repositoryURL string
+	registry      string
+	namespace     string
+	client        *registryClient
+}
+
+type ociDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int    `json:"size"`
+}
+
+type ociManifest struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	Config        ociDescriptor   `json:"config"`
+	Layers        []ociDescriptor `json:"layers"`
+}
+
+// ociTag returns the tag of the version, OCI tags can not contain + so helm replaces it with _
+func ociTag(version string) string {
+	return strings.ReplaceAll(version, "+", "_")
+}
+
+// manifest returns the config blob and the manifest of the chart
+func (r *ociRepository) manifest(metadata *chart.Metadata, archive []byte) ([]byte, []byte, error) {
+	config, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not marshal chart metadata: %v", err)
+	}
+	manifest, err := json.Marshal(ociManifest{
+		SchemaVersion: 2,
+		Config:        ociDescriptor{MediaType: helmChartConfigMediaType, Digest: sha256Digest(config), Size: len(config)},
+		Layers:        []ociDescriptor{{MediaType: helmChartContentMediaType, Digest: sha256Digest(archive), Size: len(archive)}},
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not marshal chart manifest: %v", err)
+	}
+	return config, manifest, nil
+}
+
+func (r *ociRepository) Reference(metadata *chart.Metadata, archive []byte) (ChartReference, error) {
+	_, manifest, err := r.manifest(metadata, archive)
+	if err != nil {
+		return ChartReference{}, err
+	}
+	return ChartReference{Repository: r.repositoryURL, Name: metadata.Name, Version: metadata.Version, Digest: sha256Digest(manifest)}, nil
+}
+
+func (r *ociRepository) Push(metadata *chart.Metadata, archive []byte) (ChartReference, error) {
+	config, manifest, err := r.manifest(metadata, archive)
+	if err != nil {
+		return ChartReference{}, err
+	}
+	repository := path.Join(r.namespace, metadata.Name)
+
+	for _, blob := range [][]byte{config, archive} {
+		if err := r.pushBlob(repository, blob); err != nil {
+			return ChartReference{}, err
+		}
+	}
+
+	header := http.Header{"Content-Type": []string{ociManifestMediaType}}
+	response, err := r.client.do(http.MethodPut, fmt.Sprintf("%v/v2/%v/manifests/%v", r.registry, repository, ociTag(metadata.Version)), header, manifest)
+	if err != nil {
+		return ChartReference{}, err
+	}
+	if err := expect(response, "push chart manifest", http.StatusCreated, http.StatusOK); err != nil {
+		return ChartReference{}, err
+	}
+	return ChartReference{Repository: r.repositoryURL, Name: metadata.Name, Version: metadata.Version, Digest: sha256Digest(manifest)}, nil
+}
+
+// pushBlob uploads the blob in a single request unless the registry has it already
+func (r *ociRepository) pushBlob(repository string, blob []byte) error {
+	digest := sha256Digest(blob)
+	response, err := r.client.do(http.MethodHead, fmt.Sprintf("%v/v2/%v/blobs/%v", r.registry, repository, digest), nil, nil)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	response, err = r.client.do(http.MethodPost, fmt.Sprintf("%v/v2/%v/blobs/uploads/", r.registry, repository), nil, nil)
+	if err != nil {
+		return err
+	}
+	location := response.Header.Get("Location")
+	if err := expect(response, "start blob upload", http.StatusAccepted); err != nil {
+		return err
+	}
+
+	uploadURL, err := url.Parse(r.registry + "/")
+	if err == nil {
+		uploadURL, err = uploadURL.Parse(location)
+	}
+	if err != nil || location == "" {
+		return fmt.Errorf("Chart repository returned an invalid upload location '%v'", location)
+	}
+	query := uploadURL.Query()
+	query.Set("digest", digest)
+	uploadURL.RawQuery = query.Encode()
+
+	header := http.Header{"Content-Type": []string{"application/octet-stream"}}
+	response, err = r.client.do(http.MethodPut, uploadURL.String(), header, blob)
+	if err != nil {
+		return err
+	}
+	return expect(response, "upload blob", http.StatusCreated)
+}
+
+// publishChart packages the chart with the version and pushes it to the repository unless it was pushed with the
+// config before, in a dry-run only the reference of the package is returned
+func (config chartRepositoryConfig) publishChart(out io.Writer, repositoryURL string, chartPath string, version string, dryRun bool) (*ChartReference, error) {
+	repository, err := config.newChartRepository(repositoryURL)
+	if err != nil {
+		return nil, err
+	}
+	metadata, archive, err := packageChart(chartPath, version)
+	if err != nil {
+		return nil, err
+	}
+
+	reference, err := repository.Reference(metadata, archive)
+	if err != nil {
+		return nil, err
+	}
+	if dryRun {
+		fmt.Fprintf(out, "Would push chart %v version %v to %v\n", reference.Name, reference.Version, reference.Repository)
+		return &reference, nil
+	}
+	key := fmt.Sprintf("%v/%v:%v", reference.Repository, reference.Name, reference.Version)
+	if published, ok := config.published[key]; ok {
+		fmt.Fprintf(out, "Chart %v version %v was already pushed to %v, digest %v\n", published.Name, published.Version, published.Repository, published.Digest)
+		return published, nil
+	}
+	reference, err = repository.Push(metadata, archive)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(out, "Pushed chart %v version %v to %v, digest %v\n", reference.Name, reference.Version, reference.Repository, reference.Digest)
+	if config.published != nil {
+		config.published[key] = &reference
+	}
+	return &reference, nil
+}
+
+// chartMuseumRepository uploads chart archives with the API of ChartMuseum
+type chartMuseumRepository struct {
+	repositoryURL string
+	client        *registryClient
+}
+
+func (r *chartMuseumRepository) Reference(metadata *chart.Metadata, archive []byte) (ChartReference, error) {
+	return ChartReference{Repository: r.repositoryURL, Name: metadata.Name, Version: metadata.Version, Digest: sha256Digest(archive)}, nil
+}
+
+func (r *chartMuseumRepository) Push(metadata *chart.Metadata, archive []byte) (ChartReference, error) {
+	header := http.Header{"Content-Type": []string{"application/octet-stream"}}
+	response, err := r.client.do(http.MethodPost, r.repositoryURL+"/api/charts", header, archive)
+	if err != nil {
+		return ChartReference{}, err
+	}
+	if err := expect(response, "upload chart", http.StatusCreated, http.StatusOK); err != nil {
+		return ChartReference{}, err
+	}
+	return r.Reference(metadata, archive)
+}
+
+// writeUmbrellaChart writes a chart into chartPath which only depends on the referenced chart package, the values of
+// the package are set below its name in the values.yaml so stage values can be merged into them
+func writeUmbrellaChart(fs afero.Fs, chartPath string, serviceName string, reference *ChartReference) error {
+	chartYaml, err := yaml.Marshal(chart.Metadata{
+		APIVersion: chart.APIVersionV2,
+		Name:       serviceName,
+		Version:    reference.Version,
+		Dependencies: []*chart.Dependency{{
+			Name:       reference.Name,
+			Version:    reference.Version,
+			Repository: reference.Repository,
+		}},
+	})
+	if err != nil {
+		return fmt.Errorf("Could not marshal the chart of %v: %v", serviceName, err)
+	}
+	valuesYaml, err := yaml.Marshal(map[string]interface{}{reference.Name: map[string]interface{}{}})
+	if err != nil {
+		return fmt.Errorf("Could not marshal the values of %v: %v", serviceName, err)
+	}
+
+	err = fs.MkdirAll(chartPath, 0755)
+	if err != nil {
+		return fmt.Errorf("Could not create directory %v: %v", chartPath, err)
+	}
+	for file, content := range map[string][]byte{"Chart.yaml": chartYaml, "values.yaml": valuesYaml} {
+		err = afero.WriteFile(fs, filepath.Join(chartPath, file), content, 0644)
+		if err != nil {
+			return fmt.Errorf("Could not write %v: %v", filepath.Join(chartPath, file), err)
+		}
+	}
+	return nil
+}
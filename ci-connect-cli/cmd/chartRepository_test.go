@@ -0,0 +1,327 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/spf13/afero"
+	"gotest.tools/assert"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+const testChartYaml = `apiVersion: v2
+name: carts
+version: 0.1.0
+appVersion: "1.0.0"
+`
+
+// newTestChart creates a chart in a temporary directory
+func newTestChart(t *testing.T) string {
+	dir := filepath.Join(t.TempDir(), "carts")
+	for file, content := range map[string]string{
+		"Chart.yaml":                testChartYaml,
+		"values.yaml":               "replicas: 1\n",
+		"templates/deployment.yaml": "kind: Deployment\n",
+	} {
+		assert.NilError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, file)), 0755))
+		assert.NilError(t, ioutil.WriteFile(filepath.Join(dir, file), []byte(content), 0644))
+	}
+	return dir
+}
+
+func newChartRepositoryConfig(user string, password string) chartRepositoryConfig {
+	plainHTTP := true
+	return chartRepositoryConfig{user: &user, password: &password, plainHTTP: &plainHTTP, published: map[string]*ChartReference{}}
+}
+
+// testRegistry is a stand-in for an OCI registry which requires a bearer token from its token service
+type testRegistry struct {
+	sync.Mutex
+	server    *httptest.Server
+	blobs     map[string][]byte
+	manifests map[string][]byte
+}
+
+func newTestRegistry(t *testing.T) *testRegistry {
+	registry := &testRegistry{blobs: map[string][]byte{}, manifests: map[string][]byte{}}
+	registry.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		registry.Lock()
+		defer registry.Unlock()
+
+		if r.URL.Path == "/token" {
+			user, password, ok := r.BasicAuth()
+			if !ok || user != "jenkins" || password != "secret" || r.URL.Query().Get("scope") != "repository:charts/carts:pull,push" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, `{"token": "registry-token"}`)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer registry-token" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%v/token",service="registry",scope="repository:charts/carts:pull,push"`, registry.server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		assert.NilError(t, err)
+		switch {
+		case r.Method == http.MethodHead && strings.HasPrefix(r.URL.Path, "/v2/charts/carts/blobs/sha256:"):
+			if _, ok := registry.blobs[strings.TrimPrefix(r.URL.Path, "/v2/charts/carts/blobs/")]; !ok {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/charts/carts/blobs/uploads/":
+			w.Header().Set("Location", "/v2/charts/carts/blobs/uploads/1234?state=abc")
+			w.WriteHeader(http.StatusAccepted)
+		case r.Method == http.MethodPut && r.URL.Path == "/v2/charts/carts/blobs/uploads/1234":
+			digest := r.URL.Query().Get("digest")
+			if r.URL.Query().Get("state") != "abc" || digest != fmt.Sprintf("sha256:%x", sha256.Sum256(body)) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			registry.blobs[digest] = body
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/v2/charts/carts/manifests/"):
+			if r.Header.Get("Content-Type") != ociManifestMediaType {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			registry.manifests[strings.TrimPrefix(r.URL.Path, "/v2/charts/carts/manifests/")] = body
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/charts/carts/tags/list":
+			tags := []string{}
+			for tag := range registry.manifests {
+				tags = append(tags, tag)
+			}
+			assert.NilError(t, json.NewEncoder(w).Encode(map[string]interface{}{"name": "charts/carts", "tags": tags}))
+		case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/v2/charts/carts/manifests/"):
+			manifest, ok := registry.manifests[strings.TrimPrefix(r.URL.Path, "/v2/charts/carts/manifests/")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", ociManifestMediaType)
+			w.Write(manifest)
+		case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/v2/charts/carts/blobs/sha256:"):
+			blob, ok := registry.blobs[strings.TrimPrefix(r.URL.Path, "/v2/charts/carts/blobs/")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(blob)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return registry
+}
+
+func TestPackageChart(t *testing.T) {
+	metadata, archive, err := packageChart(newTestChart(t), "1.2.0")
+	assert.NilError(t, err)
+	assert.Equal(t, metadata.Name, "carts")
+	assert.Equal(t, metadata.Version, "1.2.0")
+	assert.Equal(t, metadata.AppVersion, "1.0.0")
+
+	file := filepath.Join(t.TempDir(), "carts-1.2.0.tgz")
+	assert.NilError(t, ioutil.WriteFile(file, archive, 0644))
+	packaged, err := loader.Load(file)
+	assert.NilError(t, err)
+	assert.Equal(t, packaged.Metadata.Version, "1.2.0")
+	assert.Equal(t, len(packaged.Templates), 1)
+
+	_, _, err = packageChart(newTestChart(t), "1634567890")
+	assert.Error(t, err, "Version 1634567890 is not a semantic version which is required to package the chart")
+}
+
+func TestPublishChart_OCI(t *testing.T) {
+	registry := newTestRegistry(t)
+	defer registry.server.Close()
+	repositoryURL := "oci://" + strings.TrimPrefix(registry.server.URL, "http://") + "/charts"
+
+	out := &strings.Builder{}
+	reference, err := newChartRepositoryConfig("jenkins", "secret").publishChart(out, repositoryURL, newTestChart(t), "1.2.0+build.7", false)
+	assert.NilError(t, err)
+	assert.Equal(t, reference.Repository, repositoryURL)
+	assert.Equal(t, reference.Name, "carts")
+	assert.Equal(t, reference.Version, "1.2.0+build.7")
+
+	manifest, ok := registry.manifests["1.2.0_build.7"]
+	assert.Assert(t, ok, "the chart is tagged with the version")
+	assert.Equal(t, reference.Digest, fmt.Sprintf("sha256:%x", sha256.Sum256(manifest)))
+
+	parsed := ociManifest{}
+	assert.NilError(t, json.Unmarshal(manifest, &parsed))
+	assert.Equal(t, parsed.Config.MediaType, helmChartConfigMediaType)
+	assert.Equal(t, parsed.Layers[0].MediaType, helmChartContentMediaType)
+	assert.Equal(t, len(registry.blobs[parsed.Layers[0].Digest]), parsed.Layers[0].Size)
+	assert.Equal(t, out.String(), fmt.Sprintf("Pushed chart carts version 1.2.0+build.7 to %v, digest %v\n", repositoryURL, reference.Digest))
+}
+
+func TestPublishChart_OCIDenied(t *testing.T) {
+	registry := newTestRegistry(t)
+	defer registry.server.Close()
+	repositoryURL := "oci://" + strings.TrimPrefix(registry.server.URL, "http://") + "/charts"
+
+	_, err := newChartRepositoryConfig("jenkins", "wrong").publishChart(ioutil.Discard, repositoryURL, newTestChart(t), "1.2.0", false)
+	assert.Error(t, err, "Token service of chart repository responded with 401 Unauthorized, check the credentials")
+}
+
+func TestPublishChart_DryRun(t *testing.T) {
+	out := &strings.Builder{}
+	reference, err := newChartRepositoryConfig("", "").publishChart(out, "oci://registry.invalid/charts", newTestChart(t), "1.2.0", true)
+	assert.NilError(t, err)
+	assert.Equal(t, reference.Name, "carts")
+	assert.Assert(t, strings.HasPrefix(reference.Digest, "sha256:"))
+	assert.Equal(t, out.String(), "Would push chart carts version 1.2.0 to oci://registry.invalid/charts\n")
+}
+
+func TestPublishChart_ChartMuseum(t *testing.T) {
+	uploaded := map[string][]byte{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, _ := r.BasicAuth()
+		if user != "jenkins" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodPost || r.URL.Path != "/museum/api/charts" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		body, err := ioutil.ReadAll(r.Body)
+		assert.NilError(t, err)
+		if _, ok := uploaded["carts"]; ok {
+			w.WriteHeader(http.StatusConflict)
+			fmt.Fprint(w, `{"error":"file already exists"}`)
+			return
+		}
+		uploaded["carts"] = body
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	config := newChartRepositoryConfig("jenkins", "secret")
+	reference, err := config.publishChart(ioutil.Discard, server.URL+"/museum/", newTestChart(t), "1.2.0", false)
+	assert.NilError(t, err)
+	assert.Equal(t, reference.Repository, server.URL+"/museum")
+	assert.Equal(t, reference.Digest, fmt.Sprintf("sha256:%x", sha256.Sum256(uploaded["carts"])))
+
+	// the same config does not push the chart again, another run fails because the version exists already
+	again, err := config.publishChart(ioutil.Discard, server.URL+"/museum", newTestChart(t), "1.2.0", false)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, again, reference)
+	_, err = newChartRepositoryConfig("jenkins", "secret").publishChart(ioutil.Discard, server.URL+"/museum", newTestChart(t), "1.2.0", false)
+	assert.Error(t, err, `Could not upload chart, chart repository responded with 409 Conflict: {"error":"file already exists"}`)
+
+	_, err = newChartRepositoryConfig("jenkins", "wrong").publishChart(ioutil.Discard, server.URL+"/museum", newTestChart(t), "1.2.0", false)
+	assert.Error(t, err, "Chart repository denied access to "+server.URL+"/museum/api/charts, check the credentials")
+}
+
+func TestNewChartRepository_InvalidURL(t *testing.T) {
+	_, err := newChartRepositoryConfig("", "").newChartRepository("s3://charts")
+	assert.Error(t, err, "Chart repository s3://charts has to start with oci://, http:// or https://")
+}
+
+// newChartWorkspace creates a git workspace with the chart carts in .keptn/base/carts/helm/carts
+func newChartWorkspace(t *testing.T) string {
+	workspace := t.TempDir()
+	sourceRepository, err := git.PlainInit(workspace, false)
+	assert.NilError(t, err)
+	w, err := sourceRepository.Worktree()
+	assert.NilError(t, err)
+	_, err = w.Commit("Update carts", &git.CommitOptions{Author: &object.Signature{Name: "jenkins", Email: "keptn@keptn.sh", When: time.Now()}})
+	assert.NilError(t, err)
+	assert.NilError(t, CopyDir(afero.NewOsFs(), newTestChart(t), filepath.Join(workspace, ".keptn", "base", "carts", "helm", "carts")))
+	return workspace
+}
+
+func TestUpdateRepository_ChartRepository(t *testing.T) {
+	repository := newTestHelmRepository(t)
+	defer repository.server.Close()
+	fs := afero.NewOsFs()
+	workspace := newChartWorkspace(t)
+
+	params := *triggerDeployParams
+	t.Cleanup(func() { *triggerDeployParams = params })
+	service, version, dryRun := "carts", "1.2.0", false
+	triggerDeployParams.BaseDirectory = filepath.Join(workspace, ".keptn")
+	triggerDeployParams.Workspace = &workspace
+	triggerDeployParams.Service = &service
+	triggerDeployParams.Version = &version
+	triggerDeployParams.DryRun = &dryRun
+	triggerDeployParams.Charts = newChartRepositoryConfig("jenkins", "secret")
+
+	conf := privateRepositoryConfig(t, repository.server.URL)
+	conf.Services = []ServiceConfig{{ServiceName: "carts", ChartRepository: repository.server.URL}}
+	dir := t.TempDir()
+	assert.NilError(t, conf.UpdateRepository(fs, dir, "dev", "delivery"))
+
+	// the promotion deploys the umbrella chart, its dependency is fetched from the chart repository
+	chartPath := filepath.Join(dir, "base", "carts", "helm", "carts")
+	assert.NilError(t, newTestDependencyManager(t, conf, false, "").build(chartPath))
+	assert.Equal(t, vendoredVersion(t, chartPath), "1.2.0")
+
+	umbrella, err := loader.LoadDir(chartPath)
+	assert.NilError(t, err)
+	assert.Equal(t, umbrella.Metadata.Version, "1.2.0")
+	assert.Equal(t, len(umbrella.Dependencies()), 1)
+	assert.Equal(t, umbrella.Dependencies()[0].Metadata.Version, "1.2.0")
+	// stage values are set below the name of the package and merged with the values of the package
+	values, err := chartutil.CoalesceValues(umbrella, map[string]interface{}{"carts": map[string]interface{}{"image": "carts:1.2.0"}})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, values["carts"], map[string]interface{}{"global": map[string]interface{}{}, "image": "carts:1.2.0", "replicas": float64(1)})
+
+	metadata, err := ioutil.ReadFile(filepath.Join(dir, "base", "carts", "metadata", "deployment.yaml"))
+	assert.NilError(t, err)
+	assert.Assert(t, strings.Contains(string(metadata), "repository: "+repository.server.URL))
+}
+
+func TestTriggerDeployment_RetryAfterGitPushError(t *testing.T) {
+	repository := newTestHelmRepository(t)
+	defer repository.server.Close()
+	workspace := newChartWorkspace(t)
+	conf := DeploymentConfig{Services: []ServiceConfig{{ServiceName: "carts", ChartRepository: repository.server.URL}}}
+
+	// the first deployment pushes the chart and is rejected by the git push, the repetition has to reuse the chart
+	attempts := 0
+	deployment := createDeploymentMock(t)
+	deployment.EXPECT().RunDeployment().Times(2).DoAndReturn(func() error {
+		attempts++
+		if err := conf.UpdateRepository(afero.NewOsFs(), t.TempDir(), "dev", "delivery"); err != nil {
+			return err
+		}
+		if attempts == 1 {
+			return GitPushError{Msg: "Couldn't push commit", Err: fmt.Errorf("non-fast-forward update")}
+		}
+		return nil
+	})
+
+	commands, params := rootCmd.Commands(), triggerDeployParams
+	t.Cleanup(func() {
+		triggerDeployParams = params
+		rootCmd.ResetCommands()
+		rootCmd.AddCommand(commands...)
+	})
+	rootCmd.ResetCommands()
+	rootCmd.AddCommand(NewTriggerDeployCmd(deployment))
+
+	_, err := executeCommand(rootCmd, "trigger-deployment", "--workspace", workspace, "--service", "carts", "--version", "1.2.0",
+		"--git-repo", "https://github.com/example/config", "--git-user", "jenkins", "--git-token", "token",
+		"--chart-repository-user", "jenkins", "--chart-repository-password", "secret")
+	assert.NilError(t, err)
+	assert.Equal(t, attempts, 2)
+	assert.Equal(t, repository.uploads, 1)
+}
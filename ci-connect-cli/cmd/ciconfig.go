@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// CiConfigAPIVersion is the version of the ci_config.yaml format, the schema of the format is published in
+	// schema/ci_config.schema.json
+	CiConfigAPIVersion = "ci-connect.keptn.sh/v1"
+	CiConfigKind       = "CIConfig"
+)
+
+// ciConfigHeader identifies the format of a ci_config.yaml
+type ciConfigHeader struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+}
+
+// legacyServiceConfig is a service in the unversioned format which used camelCase keys next to snake_case keys
+type legacyServiceConfig struct {
+	ServiceConfig          `yaml:",inline"`
+	UpdateHelmDependencies *bool `yaml:"updateHelmDependencies"`
+	UseChartVersion        *bool `yaml:"useChartVersion"`
+	UseChartAppVersion     *bool `yaml:"useChartAppVersion"`
+	IgnoreDuplicateGitTag  *bool `yaml:"ignoreDuplicateGitTag"`
+}
+
+// legacyDeploymentConfig is the unversioned format of the ci_config.yaml
+type legacyDeploymentConfig struct {
+	Services               []legacyServiceConfig        `yaml:"services"`
+	GitConfig              GitConfig                    `yaml:"git_config"`
+	StageVariables         StageVariables               `yaml:"stage_variables,omitempty"`
+	DependencyRepositories []DependencyRepositoryConfig `yaml:"dependency_repositories,omitempty"`
+	SettingsConfig         `yaml:",inline"`
+}
+
+type ConfigMigrateCmdParams struct {
+	Workspace *string
+}
+
+var configMigrateParams *ConfigMigrateCmdParams
+
+// parseCiConfig strictly decodes a ci_config.yaml, unknown keys are reported with their line, and returns the
+// warnings for deprecated content
+func parseCiConfig(content []byte) (DeploymentConfig, []string, error) {
+	header := ciConfigHeader{}
+	if err := yaml.Unmarshal(content, &header); err != nil {
+		return DeploymentConfig{}, nil, err
+	}
+
+	conf := DeploymentConfig{}
+	warnings := []string{}
+	switch header.APIVersion {
+	case CiConfigAPIVersion:
+		if err := yaml.UnmarshalStrict(content, &conf); err != nil {
+			return DeploymentConfig{}, nil, err
+		}
+		if conf.Kind != CiConfigKind {
+			return DeploymentConfig{}, nil, fmt.Errorf("kind has to be %v, not '%v'", CiConfigKind, conf.Kind)
+		}
+	case "":
+		if header.Kind != "" {
+			return DeploymentConfig{}, nil, fmt.Errorf("apiVersion is missing, use %v", CiConfigAPIVersion)
+		}
+		legacy := legacyDeploymentConfig{}
+		if err := yaml.UnmarshalStrict(content, &legacy); err != nil {
+			return DeploymentConfig{}, nil, err
+		}
+		warnings = append(warnings, fmt.Sprintf("the file has no apiVersion, the unversioned format is deprecated, run 'ci-connect-cli config migrate' to use %v", CiConfigAPIVersion))
+		conf, warnings = legacy.migrate(warnings)
+	default:
+		return DeploymentConfig{}, nil, fmt.Errorf("unsupported apiVersion '%v', use %v", header.APIVersion, CiConfigAPIVersion)
+	}
+
+	return conf, warnings, conf.validate()
+}
+
+// migrate converts the unversioned format and warns about every camelCase key
+func (legacy legacyDeploymentConfig) migrate(warnings []string) (DeploymentConfig, []string) {
+	conf := DeploymentConfig{
+		APIVersion:             CiConfigAPIVersion,
+		Kind:                   CiConfigKind,
+		GitConfig:              legacy.GitConfig,
+		StageVariables:         legacy.StageVariables,
+		DependencyRepositories: legacy.DependencyRepositories,
+		SettingsConfig:         legacy.SettingsConfig,
+	}
+	for i, legacyService := range legacy.Services {
+		service := legacyService.ServiceConfig
+		for _, key := range []struct {
+			legacy string
+			key    string
+			value  *bool
+			target *bool
+		}{
+			{"updateHelmDependencies", "update_helm_dependencies", legacyService.UpdateHelmDependencies, &service.UpdateHelmDependencies},
+			{"useChartVersion", "use_chart_version", legacyService.UseChartVersion, &service.UseChartVersion},
+			{"useChartAppVersion", "use_chart_app_version", legacyService.UseChartAppVersion, &service.UseChartAppVersion},
+			{"ignoreDuplicateGitTag", "ignore_duplicate_git_tag", legacyService.IgnoreDuplicateGitTag, &service.IgnoreDuplicateGitTag},
+		} {
+			if key.value == nil {
+				continue
+			}
+			warnings = append(warnings, fmt.Sprintf("services[%v].%v is deprecated, use %v", i, key.legacy, key.key))
+			*key.target = *key.value
+		}
+		conf.Services = append(conf.Services, service)
+	}
+	return conf, warnings
+}
+
+// validate checks the constraints of the schema which strict decoding does not cover
+func (conf DeploymentConfig) validate() error {
+	known := map[string]bool{}
+	for i, service := range conf.Services {
+		if service.ServiceName == "" {
+			return fmt.Errorf("services[%v].name is required", i)
+		}
+		if known[service.ServiceName] {
+			return fmt.Errorf("service '%v' is configured twice", service.ServiceName)
+		}
+		known[service.ServiceName] = true
+	}
+
+	repositories := map[string]bool{}
+	for i, repository := range conf.DependencyRepositories {
+		if repository.Name == "" || repository.URL == "" {
+			return fmt.Errorf("dependency_repositories[%v] requires a name and an url", i)
+		}
+		if repositories[repository.Name] {
+			return fmt.Errorf("dependency repository '%v' is configured twice", repository.Name)
+		}
+		repositories[repository.Name] = true
+	}
+	return nil
+}
+
+// migrateCiConfig returns the content of the ci_config.yaml in the current format, or nil if it is already current
+func migrateCiConfig(content []byte) ([]byte, []string, error) {
+	header := ciConfigHeader{}
+	if err := yaml.Unmarshal(content, &header); err != nil {
+		return nil, nil, err
+	}
+	if header.APIVersion == CiConfigAPIVersion {
+		return nil, nil, nil
+	}
+
+	conf, warnings, err := parseCiConfig(content)
+	if err != nil {
+		return nil, nil, err
+	}
+	migrated, err := yaml.Marshal(conf)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not marshal CI Configuration: %v", err)
+	}
+	return migrated, warnings, nil
+}
+
+func runConfigMigrate(out io.Writer) error {
+	config := projectSettingsFile(*configMigrateParams.Workspace)
+	content, err := ioutil.ReadFile(config)
+	if err != nil {
+		return fmt.Errorf("Could not read CI Configuration file %v: %v", config, err)
+	}
+	migrated, warnings, err := migrateCiConfig(content)
+	if err != nil {
+		return fmt.Errorf("Invalid CI Configuration file %v: %v", config, err)
+	}
+	if migrated == nil {
+		fmt.Fprintf(out, "%v already uses %v\n", config, CiConfigAPIVersion)
+		return nil
+	}
+	if err := ioutil.WriteFile(config, migrated, 0644); err != nil {
+		return fmt.Errorf("Could not write CI Configuration file %v: %v", config, err)
+	}
+	// the first warning is about the missing apiVersion which was fixed
+	for _, warning := range warnings[1:] {
+		fmt.Fprintln(out, "Fixed: "+warning)
+	}
+	fmt.Fprintf(out, "Migrated %v to %v, comments are not preserved\n", config, CiConfigAPIVersion)
+	return nil
+}
+
+func NewConfigMigrateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: `Migrate the ci_config.yaml of the workspace to the current apiVersion`,
+		Long: `Rewrites a ci_config.yaml in the deprecated unversioned format with apiVersion ` + CiConfigAPIVersion + ` and
+snake_case keys, e.g. useChartVersion becomes use_chart_version.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runConfigMigrate(cmd.OutOrStdout())
+		},
+	}
+
+	configMigrateParams = &ConfigMigrateCmdParams{}
+	configMigrateParams.Workspace = cmd.Flags().StringP("workspace", "w", "", "The path to the directory where the .keptn directory resides in")
+
+	err := cmd.MarkFlagRequired("workspace")
+	if err != nil {
+		fmt.Println("Could not mark field required", err)
+	}
+
+	return cmd
+}
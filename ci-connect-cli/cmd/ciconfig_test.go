@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+const versionedCiConfig = `
+apiVersion: ci-connect.keptn.sh/v1
+kind: CIConfig
+services:
+  - name: carts
+    chart_base: helm/carts
+    use_chart_version: true
+git_config:
+  user_email: keptn@keptn.sh
+  user_name: jenkins
+settings:
+  dry-run: true
+`
+
+const legacyCiConfig = `
+services:
+  - name: carts
+    chart_base: helm/carts
+    useChartVersion: true
+  - name: orders
+    updateHelmDependencies: true
+    ignore_duplicate_git_tag: true
+git_config:
+  user_email: keptn@keptn.sh
+  user_name: jenkins
+`
+
+func TestParseCiConfig(t *testing.T) {
+	conf, warnings, err := parseCiConfig([]byte(versionedCiConfig))
+	assert.NilError(t, err)
+	assert.Equal(t, len(warnings), 0)
+	assert.DeepEqual(t, conf.Services, []ServiceConfig{{ServiceName: "carts", ChartBaseDirectory: "helm/carts", UseChartVersion: true}})
+	assert.Equal(t, conf.GitConfig.UserName, "jenkins")
+	assert.Equal(t, conf.Settings["dry-run"], "true")
+}
+
+func TestParseCiConfig_Legacy(t *testing.T) {
+	conf, warnings, err := parseCiConfig([]byte(legacyCiConfig))
+	assert.NilError(t, err)
+	assert.Equal(t, conf.APIVersion, CiConfigAPIVersion)
+	assert.Equal(t, conf.Kind, CiConfigKind)
+	assert.DeepEqual(t, conf.Services, []ServiceConfig{
+		{ServiceName: "carts", ChartBaseDirectory: "helm/carts", UseChartVersion: true},
+		{ServiceName: "orders", UpdateHelmDependencies: true, IgnoreDuplicateGitTag: true},
+	})
+	assert.DeepEqual(t, warnings, []string{
+		"the file has no apiVersion, the unversioned format is deprecated, run 'ci-connect-cli config migrate' to use ci-connect.keptn.sh/v1",
+		"services[0].useChartVersion is deprecated, use use_chart_version",
+		"services[1].updateHelmDependencies is deprecated, use update_helm_dependencies",
+	})
+}
+
+func TestParseCiConfig_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{
+			name:    "unknown key",
+			config:  "apiVersion: ci-connect.keptn.sh/v1\nkind: CIConfig\nservices:\n  - name: carts\n    chartBase: helm/carts\n",
+			wantErr: "line 5: field chartBase not found",
+		},
+		{
+			name:    "camelCase key in the current format",
+			config:  "apiVersion: ci-connect.keptn.sh/v1\nkind: CIConfig\nservices:\n  - name: carts\n    useChartVersion: true\n",
+			wantErr: "line 5: field useChartVersion not found",
+		},
+		{
+			name:    "unknown key in the unversioned format",
+			config:  "services:\n  - name: carts\n    update_helm_dependency: true\n",
+			wantErr: "line 3: field update_helm_dependency not found",
+		},
+		{
+			name:    "wrong type",
+			config:  "apiVersion: ci-connect.keptn.sh/v1\nkind: CIConfig\nservices:\n  - name: carts\n    use_chart_version: yes please\n",
+			wantErr: "line 5: cannot unmarshal !!str `yes please` into bool",
+		},
+		{
+			name:    "unsupported apiVersion",
+			config:  "apiVersion: ci-connect.keptn.sh/v2\nkind: CIConfig\n",
+			wantErr: "unsupported apiVersion 'ci-connect.keptn.sh/v2', use ci-connect.keptn.sh/v1",
+		},
+		{
+			name:    "wrong kind",
+			config:  "apiVersion: ci-connect.keptn.sh/v1\nkind: Config\n",
+			wantErr: "kind has to be CIConfig, not 'Config'",
+		},
+		{
+			name:    "missing apiVersion",
+			config:  "kind: CIConfig\n",
+			wantErr: "apiVersion is missing, use ci-connect.keptn.sh/v1",
+		},
+		{
+			name:    "missing name",
+			config:  "apiVersion: ci-connect.keptn.sh/v1\nkind: CIConfig\nservices:\n  - chart_base: helm/carts\n",
+			wantErr: "services[0].name is required",
+		},
+		{
+			name:    "duplicate service",
+			config:  "apiVersion: ci-connect.keptn.sh/v1\nkind: CIConfig\nservices:\n  - name: carts\n  - name: carts\n",
+			wantErr: "service 'carts' is configured twice",
+		},
+		{
+			name:    "dependency repository without url",
+			config:  "apiVersion: ci-connect.keptn.sh/v1\nkind: CIConfig\ndependency_repositories:\n  - name: private\n",
+			wantErr: "dependency_repositories[0] requires a name and an url",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := parseCiConfig([]byte(tt.config))
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestMigrateCiConfig(t *testing.T) {
+	migrated, warnings, err := migrateCiConfig([]byte(legacyCiConfig))
+	assert.NilError(t, err)
+	assert.Equal(t, len(warnings), 3)
+
+	conf, warnings, err := parseCiConfig(migrated)
+	assert.NilError(t, err)
+	assert.Equal(t, len(warnings), 0)
+	assert.Equal(t, conf.Services[1].UpdateHelmDependencies, true)
+
+	migrated, _, err = migrateCiConfig([]byte(versionedCiConfig))
+	assert.NilError(t, err)
+	assert.Assert(t, migrated == nil)
+}
+
+// TestCiConfigSchema verifies that the published schema describes the keys of the current format
+func TestCiConfigSchema(t *testing.T) {
+	content, err := ioutil.ReadFile("../schema/ci_config.schema.json")
+	assert.NilError(t, err)
+
+	type schema struct {
+		Const      string            `json:"const"`
+		Properties map[string]schema `json:"properties"`
+		Items      *schema           `json:"items"`
+	}
+	root := schema{}
+	assert.NilError(t, json.Unmarshal(content, &root))
+
+	assert.Equal(t, root.Properties["apiVersion"].Const, CiConfigAPIVersion)
+	assert.Equal(t, root.Properties["kind"].Const, CiConfigKind)
+	assert.DeepEqual(t, schemaKeys(root.Properties), yamlKeys(reflect.TypeOf(DeploymentConfig{})))
+	assert.DeepEqual(t, schemaKeys(root.Properties["services"].Items.Properties), yamlKeys(reflect.TypeOf(ServiceConfig{})))
+	assert.DeepEqual(t, schemaKeys(root.Properties["git_config"].Properties), yamlKeys(reflect.TypeOf(GitConfig{})))
+	assert.DeepEqual(t, schemaKeys(root.Properties["dependency_repositories"].Items.Properties), yamlKeys(reflect.TypeOf(DependencyRepositoryConfig{})))
+}
+
+func schemaKeys(properties interface{}) []string {
+	keys := []string{}
+	for _, key := range reflect.ValueOf(properties).MapKeys() {
+		keys = append(keys, key.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// yamlKeys returns the yaml keys of the struct including the keys of inlined structs
+func yamlKeys(structType reflect.Type) []string {
+	keys := []string{}
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		tag := strings.Split(field.Tag.Get("yaml"), ",")
+		if len(tag) > 1 && tag[1] == "inline" {
+			keys = append(keys, yamlKeys(field.Type)...)
+			continue
+		}
+		keys = append(keys, tag[0])
+	}
+	sort.Strings(keys)
+	return keys
+}
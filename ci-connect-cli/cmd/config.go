@@ -0,0 +1,295 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// profileFlag selects the profile of the config files, it can also be set with CI_CONNECT_PROFILE
+	profileFlag = "profile"
+	// userConfigEnv overrides the location of the user config file
+	userConfigEnv = "ci-connect-config"
+	redacted      = "********"
+)
+
+// SettingsConfig contains flag values, keyed by the flag name, and named profiles of flag values which overwrite them
+type SettingsConfig struct {
+	Settings map[string]string            `yaml:"settings,omitempty"`
+	Profiles map[string]map[string]string `yaml:"profiles,omitempty"`
+}
+
+// settingsLayer are the flag values read from one source, e.g. the profile of the user config file
+type settingsLayer struct {
+	Source string
+	Values map[string]string
+}
+
+// settings resolves the value of a flag which is not given on the command line, the environment takes precedence over
+// the layers which are ordered by precedence
+type settings struct {
+	Profile string
+	Files   []string
+	Layers  []settingsLayer
+}
+
+type ConfigViewCmdParams struct {
+	Workspace *string
+}
+
+var configViewParams *ConfigViewCmdParams
+
+// userSettingsFile returns the path of the user config file, $XDG_CONFIG_HOME/ci-connect/config.yaml or
+// ~/.config/ci-connect/config.yaml unless CI_CONNECT_CONFIG is set
+func userSettingsFile() string {
+	if file := viper.GetString(userConfigEnv); file != "" {
+		return file
+	}
+	if configHome := os.Getenv("XDG_CONFIG_HOME"); configHome != "" {
+		return filepath.Join(configHome, "ci-connect", "config.yaml")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "ci-connect", "config.yaml")
+}
+
+// projectSettingsFile returns the path of the ci_config.yaml of the workspace
+func projectSettingsFile(workspace string) string {
+	if workspace == "" {
+		return ""
+	}
+	return filepath.Join(workspace, ".keptn", "ci_config.yaml")
+}
+
+// selectedProfile returns the profile given with --profile or CI_CONNECT_PROFILE
+func selectedProfile(cmd *cobra.Command) string {
+	if flag := cmd.Flags().Lookup(profileFlag); flag != nil && flag.Value.String() != "" {
+		return flag.Value.String()
+	}
+	return viper.GetString("ci-connect-" + profileFlag)
+}
+
+// loadSettings reads the project and the user config file, missing files are skipped. The selected profile overwrites
+// the settings of its file and the project file overwrites the user file: project profile > project settings > user
+// profile > user settings.
+func loadSettings(projectFile string, userFile string, profile string) (*settings, error) {
+	result := &settings{Profile: profile}
+	profileFound := false
+
+	for _, file := range []struct {
+		path   string
+		source string
+		read   func(string) (SettingsConfig, error)
+	}{{projectFile, "project file", readProjectSettings}, {userFile, "user file", readUserSettings}} {
+		if file.path == "" {
+			continue
+		}
+		if _, err := os.Stat(file.path); os.IsNotExist(err) {
+			continue
+		}
+
+		conf, err := file.read(file.path)
+		if err != nil {
+			return nil, err
+		}
+		result.Files = append(result.Files, file.path)
+
+		if values, ok := conf.Profiles[profile]; ok && profile != "" {
+			profileFound = true
+			result.Layers = append(result.Layers, settingsLayer{Source: fmt.Sprintf("%v (profile %v)", file.source, profile), Values: values})
+		}
+		result.Layers = append(result.Layers, settingsLayer{Source: file.source, Values: conf.Settings})
+	}
+
+	if profile != "" && !profileFound {
+		if len(result.Files) == 0 {
+			return nil, fmt.Errorf("Could not find profile '%v', no config file found", profile)
+		}
+		return nil, fmt.Errorf("Could not find profile '%v' in the config files %v", profile, strings.Join(result.Files, ", "))
+	}
+	return result, nil
+}
+
+func readProjectSettings(file string) (SettingsConfig, error) {
+	conf := DeploymentConfig{}
+	err := conf.GetCiConfig(file)
+	return conf.SettingsConfig, err
+}
+
+// readUserSettings reads the user config file which contains only settings and profiles
+func readUserSettings(file string) (SettingsConfig, error) {
+	conf := SettingsConfig{}
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return conf, fmt.Errorf("Could not read config file %v: %v", file, err)
+	}
+	if err := yaml.UnmarshalStrict(content, &conf); err != nil {
+		return conf, fmt.Errorf("Invalid config file %v: %v", file, err)
+	}
+	return conf, nil
+}
+
+// lookup returns the value of the flag from the environment or the config files and where it was found, the source is
+// empty if the flag is not set anywhere
+func (s *settings) lookup(name string) (string, string) {
+	if value := viper.GetString(name); value != "" {
+		return value, "env " + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+	}
+	for _, layer := range s.Layers {
+		if value := layer.Values[name]; value != "" {
+			return value, layer.Source
+		}
+	}
+	return "", ""
+}
+
+// commandSettings loads the config files for the command, the project file is found in the workspace given with
+// --workspace or WORKSPACE
+func commandSettings(cmd *cobra.Command) (*settings, error) {
+	workspace := viper.GetString("workspace")
+	if flag := cmd.Flags().Lookup("workspace"); flag != nil && flag.Changed {
+		workspace = flag.Value.String()
+	}
+	return loadSettings(projectSettingsFile(workspace), userSettingsFile(), selectedProfile(cmd))
+}
+
+// presetFlags sets the flags which are not given on the command line from the environment or the config files, so the
+// precedence is flag > env > project profile > user profile > project settings > user settings
+func presetFlags(cmd *cobra.Command) error {
+	s, err := commandSettings(cmd)
+	if err != nil {
+		return err
+	}
+
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if f.Changed || f.Name == profileFlag {
+			return
+		}
+		if value, source := s.lookup(f.Name); source != "" {
+			err := cmd.Flags().Set(f.Name, value)
+			if err != nil {
+				fmt.Println("Could not set flags", err)
+			}
+		}
+	})
+	return nil
+}
+
+func isSecretSetting(name string) bool {
+	for _, secret := range []string{"token", "passphrase", "password", "secret"} {
+		if strings.Contains(name, secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// settingNames returns the names of all flags of the commands
+func settingNames(commands []*cobra.Command) []string {
+	names := map[string]bool{}
+	var collect func(commands []*cobra.Command)
+	collect = func(commands []*cobra.Command) {
+		for _, cmd := range commands {
+			cmd.Flags().VisitAll(func(f *pflag.Flag) {
+				if f.Name != "help" && f.Name != profileFlag {
+					names[f.Name] = true
+				}
+			})
+			collect(cmd.Commands())
+		}
+	}
+	collect(commands)
+
+	sorted := []string{}
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// printSettings prints every setting which is set in the environment or the config files, secrets are redacted
+func printSettings(out io.Writer, s *settings, names []string) error {
+	if s.Profile != "" {
+		fmt.Fprintf(out, "Profile: %v\n", s.Profile)
+	}
+	fmt.Fprintf(out, "Config files: %v\n\n", orDash(strings.Join(s.Files, ", ")))
+
+	writer := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "SETTING\tVALUE\tSOURCE")
+	for _, name := range names {
+		value, source := s.lookup(name)
+		if source == "" {
+			continue
+		}
+		if isSecretSetting(name) {
+			value = redacted
+		}
+		fmt.Fprintf(writer, "%v\t%v\t%v\n", name, value, source)
+	}
+	return writer.Flush()
+}
+
+func runConfigView(out io.Writer, profile string) error {
+	s, err := loadSettings(projectSettingsFile(*configViewParams.Workspace), userSettingsFile(), profile)
+	if err != nil {
+		return err
+	}
+	return printSettings(out, s, settingNames(rootCmd.Commands()))
+}
+
+func NewConfigCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: `Show the configuration of the CI Connect CLI`,
+		Long: `Flags which are not given on the command line are read from, in this order of precedence:
+* the environment, e.g. export GIT_USER=<user>
+* the project file $WORKSPACE/.keptn/ci_config.yaml
+* the user file ~/.config/ci-connect/config.yaml ($XDG_CONFIG_HOME or CI_CONNECT_CONFIG are respected)
+
+Both files can contain profiles which are selected with --profile or CI_CONNECT_PROFILE, the selected profile
+overwrites the settings of the same file, e.g.
+
+settings:
+  git-user: jenkins
+profiles:
+  prod:
+    git-repo: https://github.com/example/prod-config`,
+	}
+	cmd.AddCommand(NewConfigViewCmd())
+	cmd.AddCommand(NewConfigMigrateCmd())
+	return cmd
+}
+
+func NewConfigViewCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "view",
+		Short: `Print the effective settings and where they are set, secrets are redacted`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runConfigView(cmd.OutOrStdout(), selectedProfile(cmd))
+		},
+	}
+
+	configViewParams = &ConfigViewCmdParams{}
+	configViewParams.Workspace = cmd.Flags().StringP("workspace", "w", "", "The path to the directory where the .keptn directory resides in")
+
+	return cmd
+}
+
+func init() {
+	rootCmd.PersistentFlags().String(profileFlag, "", "The profile of the config files, e.g. prod")
+	rootCmd.AddCommand(NewConfigCmd())
+}
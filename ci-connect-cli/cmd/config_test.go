@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+const settingsProjectFile = `
+apiVersion: ci-connect.keptn.sh/v1
+kind: CIConfig
+services:
+- name: carts
+git_config:
+  user_email: keptn@keptn.sh
+  user_name: jenkins
+settings:
+  git-repo: https://github.com/example/config
+  stage-branch: project-branch
+profiles:
+  prod:
+    git-repo: https://github.com/example/prod-config
+`
+
+const settingsUserFile = `
+settings:
+  git-repo: https://github.com/example/user-config
+  git-user: jane
+  git-token: secret-token
+profiles:
+  prod:
+    git-user: prod-user
+    stage-branch: prod-user-branch
+`
+
+// writeSettingsFiles creates a workspace with the project file and a user file and returns their paths
+func writeSettingsFiles(t *testing.T) (string, string) {
+	dir := t.TempDir()
+	projectFile := projectSettingsFile(filepath.Join(dir, "workspace"))
+	userFile := filepath.Join(dir, "config", "ci-connect", "config.yaml")
+	for file, content := range map[string]string{projectFile: settingsProjectFile, userFile: settingsUserFile} {
+		assert.NilError(t, os.MkdirAll(filepath.Dir(file), 0755))
+		assert.NilError(t, ioutil.WriteFile(file, []byte(content), 0600))
+	}
+	return projectFile, userFile
+}
+
+func TestLoadSettings_Precedence(t *testing.T) {
+	os.Clearenv()
+	projectFile, userFile := writeSettingsFiles(t)
+
+	s, err := loadSettings(projectFile, userFile, "")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, s.Files, []string{projectFile, userFile})
+
+	value, source := s.lookup("git-repo")
+	assert.Equal(t, value, "https://github.com/example/config")
+	assert.Equal(t, source, "project file")
+	value, source = s.lookup("git-user")
+	assert.Equal(t, value, "jane")
+	assert.Equal(t, source, "user file")
+	_, source = s.lookup("keptn-api")
+	assert.Equal(t, source, "")
+	value, source = s.lookup("stage-branch")
+	assert.Equal(t, value, "project-branch")
+	assert.Equal(t, source, "project file")
+
+	os.Setenv("GIT_REPO", "https://github.com/example/env-config")
+	defer os.Unsetenv("GIT_REPO")
+	value, source = s.lookup("git-repo")
+	assert.Equal(t, value, "https://github.com/example/env-config")
+	assert.Equal(t, source, "env GIT_REPO")
+}
+
+func TestLoadSettings_Profile(t *testing.T) {
+	os.Clearenv()
+	projectFile, userFile := writeSettingsFiles(t)
+
+	s, err := loadSettings(projectFile, userFile, "prod")
+	assert.NilError(t, err)
+
+	value, source := s.lookup("git-repo")
+	assert.Equal(t, value, "https://github.com/example/prod-config")
+	assert.Equal(t, source, "project file (profile prod)")
+	value, source = s.lookup("git-user")
+	assert.Equal(t, value, "prod-user")
+	assert.Equal(t, source, "user file (profile prod)")
+	value, _ = s.lookup("git-token")
+	assert.Equal(t, value, "secret-token")
+	// the profile of the user file does not overwrite the settings of the project file
+	value, source = s.lookup("stage-branch")
+	assert.Equal(t, value, "project-branch")
+	assert.Equal(t, source, "project file")
+
+	_, err = loadSettings(projectFile, userFile, "staging")
+	assert.Error(t, err, "Could not find profile 'staging' in the config files "+projectFile+", "+userFile)
+}
+
+func TestLoadSettings_MissingFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := loadSettings(filepath.Join(dir, "ci_config.yaml"), "", "")
+	assert.NilError(t, err)
+	assert.Equal(t, len(s.Layers), 0)
+}
+
+func TestPrintSettings(t *testing.T) {
+	os.Clearenv()
+	projectFile, userFile := writeSettingsFiles(t)
+	s, err := loadSettings(projectFile, userFile, "")
+	assert.NilError(t, err)
+
+	out := &bytes.Buffer{}
+	assert.NilError(t, printSettings(out, s, []string{"git-repo", "git-token", "git-user", "keptn-api"}))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Equal(t, lines[0], "Config files: "+projectFile+", "+userFile)
+	assert.Equal(t, len(lines), 6)
+	assert.Equal(t, strings.Join(strings.Fields(lines[3]), " "), "git-repo https://github.com/example/config project file")
+	assert.Equal(t, strings.Join(strings.Fields(lines[4]), " "), "git-token ******** user file")
+	assert.Equal(t, strings.Join(strings.Fields(lines[5]), " "), "git-user jane user file")
+	assert.Assert(t, !strings.Contains(out.String(), "secret-token"))
+}
+
+func TestTriggerDeployment_FlagByConfigFile(t *testing.T) {
+	os.Clearenv()
+	projectFile, userFile := writeSettingsFiles(t)
+	os.Setenv("CI_CONNECT_CONFIG", userFile)
+	commands, params := rootCmd.Commands(), triggerDeployParams
+	setupRootCmdWithDeploymentMock(t)
+	t.Cleanup(func() {
+		triggerDeployParams = params
+		assert.NilError(t, rootCmd.PersistentFlags().Set(profileFlag, ""))
+		rootCmd.ResetCommands()
+		rootCmd.AddCommand(commands...)
+	})
+
+	workspace := filepath.Dir(filepath.Dir(projectFile))
+	output, err := executeCommand(rootCmd, "trigger-deployment", "--workspace", workspace, "--service", "carts", "--git-token", "flag-token", "--profile", "prod")
+	assertCommandNoOutputAndError(t, output, err)
+	assert.Equal(t, *triggerDeployParams.Repository.remoteURI, "https://github.com/example/prod-config")
+	assert.Equal(t, *triggerDeployParams.Repository.user, "prod-user")
+	assert.Equal(t, *triggerDeployParams.Repository.token, "flag-token")
+}
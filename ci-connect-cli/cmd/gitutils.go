@@ -10,6 +10,7 @@ import (
 	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/storage/memory"
 )
 
 type GitPushError struct {
@@ -27,9 +28,11 @@ func (e GitPushError) Is(target error) bool {
 }
 
 type gitRepositoryConfig struct {
-	remoteURI *string
-	user      *string
-	token     *string
+	remoteURI            *string
+	user                 *string
+	token                *string
+	signingKeyFile       *string
+	signingKeyPassphrase *string
 }
 
 type gitCommitOptions struct {
@@ -62,6 +65,22 @@ func (repositoryConfig *gitRepositoryConfig) CheckOutGitRepo(dir string, branch
 	return repo, nil
 }
 
+// CloneReadOnly clones all branches and tags into memory, nothing is written to disk or pushed
+func (repositoryConfig *gitRepositoryConfig) CloneReadOnly() (*git.Repository, error) {
+	repo, err := git.Clone(memory.NewStorage(), nil, &git.CloneOptions{
+		URL: *repositoryConfig.remoteURI,
+		Auth: &http.BasicAuth{
+			Username: *repositoryConfig.user,
+			Password: *repositoryConfig.token,
+		},
+		Tags: git.AllTags,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Could not clone %v: %v", *repositoryConfig.remoteURI, err)
+	}
+	return repo, nil
+}
+
 func (repositoryConfig *gitRepositoryConfig) CommitAndPushGitRepo(repository *git.Repository, deploymentConfig DeploymentConfig, gitCommitOptions gitCommitOptions, ignoreDuplicateGitTag bool) error {
 	authentication := &http.BasicAuth{
 		Username: *repositoryConfig.user,
@@ -89,25 +108,43 @@ func (repositoryConfig *gitRepositoryConfig) CommitAndPushGitRepo(repository *gi
 		return fmt.Errorf("Could not add files: %v", err)
 	}
 
+	signer, err := repositoryConfig.getSigner()
+	if err != nil {
+		return err
+	}
+
 	_, err = w.Commit(gitCommitOptions.commitMessage, &commitOptions)
 	if err != nil {
 		return fmt.Errorf("Could not commit: %v", err)
 	}
 
+	if signer != nil {
+		_, err = signHeadCommit(repository, signer)
+		if err != nil {
+			return fmt.Errorf("Could not sign commit: %v", err)
+		}
+	}
+
 	h, err := repository.Head()
 	if err != nil {
 		return fmt.Errorf("Couldn't get tag: %v", err)
 	}
 
 	if gitCommitOptions.tag != "" {
-		_, err = repository.CreateTag(gitCommitOptions.tag, h.Hash(), &git.CreateTagOptions{
-			Tagger: &object.Signature{
-				Name:  "Keptn CI-Connect CLI",
-				Email: "ci-connect@keptn.sh",
-				When:  time.Now(),
-			},
-			Message: gitCommitOptions.tagMessage,
-		})
+		tagger := object.Signature{
+			Name:  deploymentConfig.GitConfig.getTaggerName(),
+			Email: deploymentConfig.GitConfig.getTaggerEmail(),
+			When:  time.Now(),
+		}
+
+		if signer != nil {
+			err = createSignedTag(repository, gitCommitOptions.tag, h.Hash(), tagger, gitCommitOptions.tagMessage, signer)
+		} else {
+			_, err = repository.CreateTag(gitCommitOptions.tag, h.Hash(), &git.CreateTagOptions{
+				Tagger:  &tagger,
+				Message: gitCommitOptions.tagMessage,
+			})
+		}
 		if err != nil {
 			return fmt.Errorf("Couldn't create a tag: %v", err)
 		}
@@ -141,3 +178,16 @@ func (repositoryConfig *gitRepositoryConfig) CommitAndPushGitRepo(repository *gi
 
 	return nil
 }
+
+// getSigner returns the signer for commits and tags or nil if no signing key is configured
+func (repositoryConfig *gitRepositoryConfig) getSigner() (Signer, error) {
+	if repositoryConfig.signingKeyFile == nil || *repositoryConfig.signingKeyFile == "" {
+		return nil, nil
+	}
+
+	passphrase := ""
+	if repositoryConfig.signingKeyPassphrase != nil {
+		passphrase = *repositoryConfig.signingKeyPassphrase
+	}
+	return NewSignerFromFile(*repositoryConfig.signingKeyFile, passphrase)
+}
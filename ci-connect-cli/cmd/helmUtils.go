@@ -2,14 +2,16 @@ package cmd
 
 import (
 	"fmt"
+	"github.com/Masterminds/semver/v3"
+	"github.com/spf13/afero"
 	"gopkg.in/yaml.v3"
-	"helm.sh/helm/v3/pkg/cli"
-	"helm.sh/helm/v3/pkg/downloader"
-	"helm.sh/helm/v3/pkg/getter"
-	"helm.sh/helm/v3/pkg/helmpath"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 type ChartMeta struct {
@@ -20,31 +22,6 @@ type ChartMeta struct {
 
 var appMeta ChartMeta
 
-func DependencyUpdate(chartPath string) error {
-	// Garbage collect before the dependency update so that
-	// anonymous files from previous runs are cleared, with
-	// a safe guard time offset to not touch any files in
-	// use.
-	repositoryConfig := helmpath.ConfigPath("repositories.yaml")
-	repositoryCache  := helmpath.CachePath("repository")
-
-	fmt.Println(repositoryConfig)
-	fmt.Println(repositoryCache)
-
-	man := &downloader.Manager{
-		Out: os.Stderr,
-		ChartPath:        chartPath,
-		RepositoryConfig: repositoryConfig,
-		RepositoryCache: repositoryCache,
-		Getters: getter.All(&cli.EnvSettings{
-			RepositoryConfig: repositoryConfig,
-			RepositoryCache:  repositoryCache,
-		}),
-
-	}
-	return man.Update()
-}
-
 func getHelmChartVersion(chartPath string) (string, error) {
 	config := filepath.Join(chartPath, "Chart.yaml")
 	configFile, err := ioutil.ReadFile(config)
@@ -69,4 +46,252 @@ func getHelmChartAppVersion(chartPath string) (string, error) {
 		return "", fmt.Errorf("Could not unmarshal file: %v", err)
 	}
 	return appMeta.AppVersion, nil
-}
\ No newline at end of file
+}
+
+// packageChart packages the chart with the version like helm package and returns the metadata and the archive
+func packageChart(chartPath string, version string) (*chart.Metadata, []byte, error) {
+	if _, err := semver.StrictNewVersion(version); err != nil {
+		return nil, nil, fmt.Errorf("Version %v is not a semantic version which is required to package the chart", version)
+	}
+	packaged, err := loader.LoadDir(chartPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not load chart %v: %v", chartPath, err)
+	}
+	packaged.Metadata.Version = version
+
+	dir, err := ioutil.TempDir("", "chart_package")
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	file, err := chartutil.Save(packaged, dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not package chart %v: %v", chartPath, err)
+	}
+	archive, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not read chart package: %v", err)
+	}
+	return packaged.Metadata, archive, nil
+}
+
+// setChartVersion writes the version into the Chart.yaml and the values of the copied chart as configured for the
+// service, formatting and comments of the files are preserved
+func setChartVersion(fs afero.Fs, chartPath string, service ServiceConfig, version string) error {
+	chartPaths := []string{}
+	if service.SetChartVersion {
+		if _, err := semver.NewVersion(version); err != nil {
+			return fmt.Errorf("Version %v is not a semantic version which is required for the version of the chart", version)
+		}
+		chartPaths = append(chartPaths, "version")
+	}
+	if service.SetChartAppVersion {
+		chartPaths = append(chartPaths, "appVersion")
+	}
+
+	if len(chartPaths) > 0 {
+		err := setYamlFileValues(fs, filepath.Join(chartPath, "Chart.yaml"), chartPaths, version)
+		if err != nil {
+			return err
+		}
+	}
+	if len(service.SetVersionValues) > 0 {
+		return setYamlFileValues(fs, filepath.Join(chartPath, "values.yaml"), service.SetVersionValues, version)
+	}
+	return nil
+}
+
+// setYamlFileValues sets the values at the dot separated paths, e.g. image.tag, missing mappings are created. Only the
+// changed scalars are replaced and missing keys are inserted, the rest of the file is preserved byte by byte.
+func setYamlFileValues(fs afero.Fs, file string, paths []string, value string) error {
+	content, err := afero.ReadFile(fs, file)
+	if err != nil {
+		return fmt.Errorf("Could not read file: %v", err)
+	}
+
+	for _, path := range paths {
+		content, err = setYamlValue(content, strings.Split(path, "."), value)
+		if err != nil {
+			return fmt.Errorf("Could not set %v in %v: %v", path, file, err)
+		}
+	}
+	return afero.WriteFile(fs, file, content, 0644)
+}
+
+// setYamlValue returns the content with the string value set at the path
+func setYamlValue(content []byte, path []string, value string) ([]byte, error) {
+	document := yaml.Node{}
+	err := yaml.Unmarshal(content, &document)
+	if err != nil {
+		return nil, fmt.Errorf("could not unmarshal the file: %v", err)
+	}
+	lines := strings.SplitAfter(string(content), "\n")
+	if document.Kind == 0 {
+		return insertYamlKeys(lines, len(lines), 0, 2, path, value)
+	}
+
+	node := document.Content[0]
+	if node.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("the file is not a mapping")
+	}
+	step := yamlIndent(string(content))
+	for depth, key := range path {
+		child := yamlMappingValue(node, key)
+		if child == nil {
+			if node.Style&yaml.FlowStyle != 0 || len(node.Content) == 0 {
+				return nil, fmt.Errorf("%v can not be added to a flow mapping", key)
+			}
+			indent := node.Content[0].Column - 1
+			return insertYamlKeys(lines, yamlMappingEnd(lines, node, indent), indent, step, path[depth:], value)
+		}
+		if depth < len(path)-1 {
+			if child.Kind != yaml.MappingNode {
+				return nil, fmt.Errorf("%v is not a mapping", key)
+			}
+			node = child
+			continue
+		}
+		if child.Kind != yaml.ScalarNode {
+			return nil, fmt.Errorf("%v is not a scalar", key)
+		}
+		return replaceYamlScalar(lines, child, key, value)
+	}
+	return content, nil
+}
+
+// yamlMappingValue returns the value of the key in the mapping, nil if the key is missing
+func yamlMappingValue(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// yamlMappingEnd returns the number of the last line which belongs to the mapping, lines following the last key which
+// are indented deeper than the keys belong to the value of the last key. The top level mapping ends with the file.
+func yamlMappingEnd(lines []string, node *yaml.Node, indent int) int {
+	if indent == 0 {
+		return len(lines)
+	}
+	end := node.Line
+	var last func(node *yaml.Node)
+	last = func(node *yaml.Node) {
+		if node.Line > end {
+			end = node.Line
+		}
+		for _, child := range node.Content {
+			last(child)
+		}
+	}
+	last(node)
+
+	for line := end + 1; line <= len(lines); line++ {
+		trimmed := strings.TrimLeft(lines[line-1], " ")
+		if strings.TrimSpace(trimmed) == "" {
+			continue
+		}
+		if len(lines[line-1])-len(trimmed) <= indent {
+			break
+		}
+		end = line
+	}
+	return end
+}
+
+// insertYamlKeys inserts the nested keys with the value after the line with the given number
+func insertYamlKeys(lines []string, after int, indent int, step int, path []string, value string) ([]byte, error) {
+	scalar, err := yamlScalar(value, 0)
+	if err != nil {
+		return nil, err
+	}
+	inserted := ""
+	for depth, key := range path {
+		inserted += strings.Repeat(" ", indent+depth*step) + key + ":"
+		if depth == len(path)-1 {
+			inserted += " " + scalar
+		}
+		inserted += "\n"
+	}
+
+	before := strings.Join(lines[:after], "")
+	if before != "" && !strings.HasSuffix(before, "\n") {
+		before += "\n"
+	}
+	return []byte(before + inserted + strings.Join(lines[after:], "")), nil
+}
+
+// replaceYamlScalar replaces the text of the scalar in its line, its anchor, tag and quoting style are kept
+func replaceYamlScalar(lines []string, scalar *yaml.Node, key string, value string) ([]byte, error) {
+	line := lines[scalar.Line-1]
+	// the column counts characters, not bytes
+	start := len(string([]rune(line)[:scalar.Column-1]))
+	for start < len(line) && (line[start] == '&' || line[start] == '!') {
+		start += strings.IndexAny(line[start:]+" ", " \t\n")
+		start += len(line[start:]) - len(strings.TrimLeft(line[start:], " \t"))
+	}
+
+	style := scalar.Style &^ yaml.TaggedStyle
+	end := -1
+	switch style {
+	case yaml.DoubleQuotedStyle:
+		for i := start + 1; i < len(line); i++ {
+			if line[i] == '\\' {
+				i++
+			} else if line[i] == '"' {
+				end = i + 1
+				break
+			}
+		}
+	case yaml.SingleQuotedStyle:
+		for i := start + 1; i < len(line); i++ {
+			if line[i] == '\'' && i+1 < len(line) && line[i+1] == '\'' {
+				i++
+			} else if line[i] == '\'' {
+				end = i + 1
+				break
+			}
+		}
+	case 0:
+		if strings.HasPrefix(line[start:], scalar.Value) {
+			end = start + len(scalar.Value)
+		}
+	}
+	if end < 0 {
+		return nil, fmt.Errorf("%v is a multi-line scalar", key)
+	}
+
+	replacement, err := yamlScalar(value, style)
+	if err != nil {
+		return nil, err
+	}
+	if scalar.Value == "" && end == start {
+		// the value of the key is empty
+		replacement = " " + replacement
+	}
+	lines[scalar.Line-1] = line[:start] + replacement + line[end:]
+	return []byte(strings.Join(lines, "")), nil
+}
+
+// yamlScalar returns the value as a YAML string in the style, plain values are quoted if they would not be a string
+func yamlScalar(value string, style yaml.Style) (string, error) {
+	out, err := yaml.Marshal(&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Style: style, Value: value})
+	if err != nil {
+		return "", fmt.Errorf("could not marshal %v: %v", value, err)
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+// yamlIndent returns the indentation of the first nested mapping of the file, 2 if it has none
+func yamlIndent(content string) int {
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		indent := len(line) - len(trimmed)
+		if indent > 0 && trimmed != "" && !strings.HasPrefix(trimmed, "#") && !strings.HasPrefix(trimmed, "- ") {
+			return indent
+		}
+	}
+	return 2
+}
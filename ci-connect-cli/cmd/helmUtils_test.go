@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+	"gotest.tools/assert"
+)
+
+const versionChartYaml = `apiVersion: v2
+name: carts
+# bumped by the pipeline
+version: 0.1.0
+appVersion: "1.0.0" # the image tag
+`
+
+const versionValuesYaml = `replicas: 1
+image:
+    # the image of carts
+    repository: docker.io/keptnexamples/carts
+    tag: latest
+`
+
+func newVersionChart(t *testing.T) afero.Fs {
+	fs := afero.NewMemMapFs()
+	createFile(t, fs, "base/carts/helm/carts", "Chart.yaml", versionChartYaml)
+	createFile(t, fs, "base/carts/helm/carts", "values.yaml", versionValuesYaml)
+	return fs
+}
+
+func TestSetChartVersion(t *testing.T) {
+	fs := newVersionChart(t)
+	service := ServiceConfig{
+		ServiceName:        "carts",
+		SetChartVersion:    true,
+		SetChartAppVersion: true,
+		SetVersionValues:   []string{"image.tag", "podAnnotations.version"},
+	}
+
+	err := setChartVersion(fs, "base/carts/helm/carts", service, "1.20")
+	assert.NilError(t, err)
+
+	content, err := afero.ReadFile(fs, "base/carts/helm/carts/Chart.yaml")
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), `apiVersion: v2
+name: carts
+# bumped by the pipeline
+version: "1.20"
+appVersion: "1.20" # the image tag
+`)
+
+	content, err = afero.ReadFile(fs, "base/carts/helm/carts/values.yaml")
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), `replicas: 1
+image:
+    # the image of carts
+    repository: docker.io/keptnexamples/carts
+    tag: "1.20"
+podAnnotations:
+    version: "1.20"
+`)
+}
+
+func TestSetChartVersion_Disabled(t *testing.T) {
+	fs := newVersionChart(t)
+
+	err := setChartVersion(fs, "base/carts/helm/carts", ServiceConfig{ServiceName: "carts"}, "1.2.0")
+	assert.NilError(t, err)
+
+	content, err := afero.ReadFile(fs, "base/carts/helm/carts/Chart.yaml")
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), versionChartYaml)
+}
+
+func TestSetChartVersion_Invalid(t *testing.T) {
+	fs := newVersionChart(t)
+
+	err := setChartVersion(fs, "base/carts/helm/carts", ServiceConfig{ServiceName: "carts", SetChartVersion: true}, "latest")
+	assert.Error(t, err, "Version latest is not a semantic version which is required for the version of the chart")
+
+	err = setChartVersion(fs, "base/carts/helm/carts", ServiceConfig{ServiceName: "carts", SetVersionValues: []string{"image.tag.name"}}, "1.2.0")
+	assert.Error(t, err, "Could not set image.tag.name in base/carts/helm/carts/values.yaml: tag is not a mapping")
+}
+
+const formattedValuesYaml = `# values of carts
+
+replicas: 1
+
+image:
+   repository: 'docker.io/keptnexamples/carts'   # single quoted
+   tag: "latest"
+
+podAnnotations:   {version: 0.1.0, team: sockshop}
+podLabels:
+   version:
+sidecar:
+   tag: &sidecar latest
+
+   # the proxy of the sidecar
+   proxy:
+      tag: 'v1'
+
+# end of the values
+`
+
+func TestSetYamlFileValues_PreservesFormatting(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	createFile(t, fs, "carts", "values.yaml", formattedValuesYaml)
+
+	paths := []string{"image.tag", "podAnnotations.version", "podLabels.version", "sidecar.tag", "sidecar.proxy.tag", "sidecar.proxy.version", "resources.version"}
+	assert.NilError(t, setYamlFileValues(fs, "carts/values.yaml", paths, "1.20"))
+
+	content, err := afero.ReadFile(fs, "carts/values.yaml")
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), `# values of carts
+
+replicas: 1
+
+image:
+   repository: 'docker.io/keptnexamples/carts'   # single quoted
+   tag: "1.20"
+
+podAnnotations:   {version: "1.20", team: sockshop}
+podLabels:
+   version: "1.20"
+sidecar:
+   tag: &sidecar "1.20"
+
+   # the proxy of the sidecar
+   proxy:
+      tag: '1.20'
+      version: "1.20"
+
+# end of the values
+resources:
+   version: "1.20"
+`)
+}
+
+func TestSetYamlFileValues_Unsupported(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	createFile(t, fs, "carts", "values.yaml", "image: {repository: carts}\nnotes: |\n  multi\n  line\n")
+
+	err := setYamlFileValues(fs, "carts/values.yaml", []string{"image.tag"}, "1.2.0")
+	assert.Error(t, err, "Could not set image.tag in carts/values.yaml: tag can not be added to a flow mapping")
+	err = setYamlFileValues(fs, "carts/values.yaml", []string{"notes"}, "1.2.0")
+	assert.Error(t, err, "Could not set notes in carts/values.yaml: notes is a multi-line scalar")
+}
+
+func TestSetYamlFileValues_MissingKeys(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	createFile(t, fs, "carts", "empty.yaml", "")
+	createFile(t, fs, "carts", "values.yaml", "größe: 1\nimage:\n  tag: latest")
+
+	assert.NilError(t, setYamlFileValues(fs, "carts/empty.yaml", []string{"image.tag"}, "1.2.0"))
+	content, err := afero.ReadFile(fs, "carts/empty.yaml")
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), "image:\n  tag: 1.2.0\n")
+
+	assert.NilError(t, setYamlFileValues(fs, "carts/values.yaml", []string{"größe", "image.version"}, "1.2.0"))
+	content, err = afero.ReadFile(fs, "carts/values.yaml")
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), "größe: 1.2.0\nimage:\n  tag: latest\n  version: 1.2.0\n")
+}
@@ -0,0 +1,276 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+type InitCmdParams struct {
+	Workspace   *string
+	Services    *[]string
+	ChartBases  *map[string]string
+	AuthorName  *string
+	AuthorEmail *string
+	Force       *bool
+	Repository  gitRepositoryConfig
+}
+
+// scaffoldFile is a file created by the init command, the path is relative to the workspace
+type scaffoldFile struct {
+	path    string
+	content []byte
+}
+
+var initParams *InitCmdParams
+
+func runInit(in io.Reader, out io.Writer) error {
+	services := *initParams.Services
+	chartBases := *initParams.ChartBases
+	if len(services) == 0 {
+		var err error
+		services, chartBases, err = promptServices(in, out, chartBases)
+		if err != nil {
+			return err
+		}
+	}
+
+	conf, err := newInitialCiConfig(services, chartBases, *initParams.AuthorName, *initParams.AuthorEmail)
+	if err != nil {
+		return err
+	}
+
+	dirMain, err := ioutil.TempDir("", "temp_dir_master")
+	if err != nil {
+		return fmt.Errorf("Could not create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dirMain)
+
+	_, err = initParams.Repository.CheckOutGitRepo(dirMain, "")
+	if err != nil {
+		return err
+	}
+
+	shipyardConfig, err := readShipyardConfigFromFile(afero.NewOsFs(), dirMain)
+	if err != nil {
+		return err
+	}
+
+	files, err := scaffoldWorkspace(afero.NewOsFs(), *initParams.Workspace, shipyardConfig, conf, *initParams.Force)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		fmt.Fprintln(out, "Created "+file)
+	}
+	return nil
+}
+
+// promptServices asks for the services and the chart locations of services which have no --chart-base
+func promptServices(in io.Reader, out io.Writer, chartBases map[string]string) ([]string, map[string]string, error) {
+	scanner := bufio.NewScanner(in)
+	readLine := func(prompt string) (string, error) {
+		fmt.Fprint(out, prompt)
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return "", fmt.Errorf("Could not read input: %v", err)
+			}
+			return "", nil
+		}
+		return strings.TrimSpace(scanner.Text()), nil
+	}
+
+	line, err := readLine("Services (comma separated): ")
+	if err != nil {
+		return nil, nil, err
+	}
+	services := []string{}
+	for _, service := range strings.Split(line, ",") {
+		if service = strings.TrimSpace(service); service != "" {
+			services = append(services, service)
+		}
+	}
+
+	result := map[string]string{}
+	for service, chartBase := range chartBases {
+		result[service] = chartBase
+	}
+	for _, service := range services {
+		if _, ok := result[service]; ok {
+			continue
+		}
+		chartBase, err := readLine(fmt.Sprintf("Chart of %v relative to the workspace (empty to create .keptn/base/%v/helm/%v): ", service, service, service))
+		if err != nil {
+			return nil, nil, err
+		}
+		if chartBase != "" {
+			result[service] = chartBase
+		}
+	}
+	return services, result, nil
+}
+
+func newInitialCiConfig(services []string, chartBases map[string]string, authorName string, authorEmail string) (DeploymentConfig, error) {
+	if len(services) == 0 {
+		return DeploymentConfig{}, fmt.Errorf("No services given")
+	}
+
+	conf := DeploymentConfig{
+		APIVersion: CiConfigAPIVersion,
+		Kind:       CiConfigKind,
+		GitConfig: GitConfig{
+			UserName:  authorName,
+			UserEmail: authorEmail,
+		},
+	}
+	known := map[string]bool{}
+	for _, service := range services {
+		if service == "" || strings.ContainsAny(service, `/\`) || service == "." || service == ".." {
+			return DeploymentConfig{}, fmt.Errorf("Invalid service name '%v'", service)
+		}
+		if known[service] {
+			return DeploymentConfig{}, fmt.Errorf("Service '%v' is given twice", service)
+		}
+		known[service] = true
+
+		chartBase := chartBases[service]
+		if chartBase != "" && (path.IsAbs(chartBase) || strings.HasPrefix(path.Clean(chartBase), "..")) {
+			return DeploymentConfig{}, fmt.Errorf("Chart of service '%v' has to be relative to the workspace: %v", service, chartBase)
+		}
+		conf.Services = append(conf.Services, ServiceConfig{ServiceName: service, ChartBaseDirectory: chartBase})
+	}
+
+	for service := range chartBases {
+		if !known[service] {
+			return DeploymentConfig{}, fmt.Errorf("Chart given for unknown service '%v'", service)
+		}
+	}
+	return conf, nil
+}
+
+// scaffoldWorkspace creates the .keptn directory of the workspace: the ci_config.yaml, a Helm chart for services whose
+// chart is not copied from chart_base, and stage-specific values for every stage of the shipyard. Existing files are
+// only overwritten if forced, nothing is written otherwise.
+func scaffoldWorkspace(fs afero.Fs, workspace string, shipyardConfig ShipyardConfig, conf DeploymentConfig, force bool) ([]string, error) {
+	if len(shipyardConfig.Spec.Stages) == 0 {
+		return nil, fmt.Errorf("No stage defined in shipyard.yaml")
+	}
+
+	ciConfig, err := yaml.Marshal(conf)
+	if err != nil {
+		return nil, fmt.Errorf("Could not marshal CI configuration: %v", err)
+	}
+	files := []scaffoldFile{{path: filepath.Join(".keptn", "ci_config.yaml"), content: ciConfig}}
+
+	for _, service := range conf.Services {
+		name := service.ServiceName
+		if service.ChartBaseDirectory == "" {
+			chartDir := filepath.Join(".keptn", "base", name, "helm", name)
+			files = append(files,
+				scaffoldFile{path: filepath.Join(chartDir, "Chart.yaml"), content: []byte(fmt.Sprintf(chartTemplate, name))},
+				scaffoldFile{path: filepath.Join(chartDir, "values.yaml"), content: []byte(fmt.Sprintf(baseValuesTemplate, name))},
+			)
+		}
+		for _, stage := range shipyardConfig.Spec.Stages {
+			files = append(files, scaffoldFile{
+				path:    filepath.Join(".keptn", "stages", stage.Name, name, "helm", name, "values.yaml"),
+				content: []byte(fmt.Sprintf(stageValuesTemplate, name, stage.Name)),
+			})
+		}
+	}
+
+	if !force {
+		existing := []string{}
+		for _, file := range files {
+			if _, err := fs.Stat(filepath.Join(workspace, file.path)); err == nil {
+				existing = append(existing, file.path)
+			}
+		}
+		if len(existing) > 0 {
+			sort.Strings(existing)
+			return nil, fmt.Errorf("Files already exist, use --force to overwrite them: %v", strings.Join(existing, ", "))
+		}
+	}
+
+	created := []string{}
+	for _, file := range files {
+		destination := filepath.Join(workspace, file.path)
+		err := fs.MkdirAll(filepath.Dir(destination), 0755)
+		if err != nil {
+			return created, fmt.Errorf("Could not create directory %v: %v", filepath.Dir(destination), err)
+		}
+		err = afero.WriteFile(fs, destination, file.content, 0644)
+		if err != nil {
+			return created, fmt.Errorf("Could not write %v: %v", destination, err)
+		}
+		created = append(created, file.path)
+	}
+	return created, nil
+}
+
+const chartTemplate = `apiVersion: v2
+name: %v
+description: A Helm chart deployed with the Keptn CI Connect CLI
+type: application
+version: 0.1.0
+appVersion: "0.1.0"
+`
+
+const baseValuesTemplate = `# Values of %v in all stages, stage-specific values are merged into them
+`
+
+const stageValuesTemplate = `# Values of %v in stage %v, merged into the base values
+`
+
+func NewInitCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "init",
+		Short: `Create the .keptn directory of a workspace for the stages of a keptn project`,
+		Long: `Reads the stages from the shipyard.yaml of the keptn configuration repository and creates the
+$WORKSPACE/.keptn directory used by trigger-deployment:
+* ci_config.yaml with the given services
+* base/<service>/helm/<service> with an empty Helm chart for services without --chart-base
+* stages/<stage>/<service>/helm/<service>/values.yaml for the stage-specific values
+
+The services and the locations of their charts are asked for if --services is not set.
+Existing files are only overwritten with --force.
+
+All flags can also be set with environment variables instead e.g.
+* --workspace <workspace> or
+* export WORKSPACE=<workspace>`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runInit(cmd.InOrStdin(), cmd.OutOrStdout())
+		},
+	}
+
+	initParams = &InitCmdParams{}
+	initParams.Workspace = cmd.Flags().StringP("workspace", "w", "", "The path to the directory where the .keptn directory is created")
+	initParams.Services = cmd.Flags().StringSlice("services", nil, "The services deployed from the workspace, e.g. carts,orders")
+	initParams.ChartBases = cmd.Flags().StringToString("chart-base", nil, "The Helm chart of a service relative to the workspace, e.g. carts=helm/carts")
+	initParams.AuthorName = cmd.Flags().String("author-name", "Keptn CI-Connect CLI", "The name used as author of deployment commits")
+	initParams.AuthorEmail = cmd.Flags().String("author-email", "ci-connect@keptn.sh", "The email used as author of deployment commits")
+	initParams.Force = cmd.Flags().BoolP("force", "f", false, "Overwrite existing files")
+
+	err := cmd.MarkFlagRequired("workspace")
+	if err != nil {
+		fmt.Println("Could not mark field required", err)
+	}
+
+	prepareGitRepoCmd(&initParams.Repository, cmd)
+
+	return cmd
+}
+
+func init() {
+	rootCmd.AddCommand(NewInitCmd())
+}
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v2"
+	"gotest.tools/assert"
+)
+
+func TestScaffoldWorkspace(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	createFile(t, fs, "", "shipyard.yaml", validShipyardConfig)
+	shipyardConfig, err := readShipyardConfigFromFile(fs, "")
+	assert.NilError(t, err)
+
+	conf, err := newInitialCiConfig([]string{"carts", "orders"}, map[string]string{"orders": "charts/orders"}, "jenkins", "keptn@keptn.sh")
+	assert.NilError(t, err)
+
+	created, err := scaffoldWorkspace(fs, "workspace", shipyardConfig, conf, false)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, created, []string{
+		".keptn/ci_config.yaml",
+		".keptn/base/carts/helm/carts/Chart.yaml",
+		".keptn/base/carts/helm/carts/values.yaml",
+		".keptn/stages/one/carts/helm/carts/values.yaml",
+		".keptn/stages/two/carts/helm/carts/values.yaml",
+		".keptn/stages/one/orders/helm/orders/values.yaml",
+		".keptn/stages/two/orders/helm/orders/values.yaml",
+	})
+
+	written := DeploymentConfig{}
+	content, err := afero.ReadFile(fs, filepath.Join("workspace", ".keptn", "ci_config.yaml"))
+	assert.NilError(t, err)
+	assert.NilError(t, yaml.Unmarshal(content, &written))
+	assert.DeepEqual(t, written, conf)
+	assert.Equal(t, written.Services[1].ChartBaseDirectory, "charts/orders")
+
+	chart := ChartMeta{}
+	content, err = afero.ReadFile(fs, filepath.Join("workspace", ".keptn", "base", "carts", "helm", "carts", "Chart.yaml"))
+	assert.NilError(t, err)
+	assert.NilError(t, yaml.Unmarshal(content, &chart))
+	assert.Equal(t, chart.Name, "carts")
+
+	_, err = fs.Stat(filepath.Join("workspace", ".keptn", "base", "orders"))
+	assert.Assert(t, err != nil, "the chart of orders is copied from chart_base")
+}
+
+func TestScaffoldWorkspace_ExistingFiles(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	shipyardConfig := ShipyardConfig{Spec: SpecConfig{Stages: []StageConfig{{Name: "dev"}}}}
+	conf, err := newInitialCiConfig([]string{"carts"}, nil, "jenkins", "keptn@keptn.sh")
+	assert.NilError(t, err)
+
+	stageValues := filepath.Join("workspace", ".keptn", "stages", "dev", "carts", "helm", "carts")
+	createFile(t, fs, stageValues, "values.yaml", "replicas: 3\n")
+
+	_, err = scaffoldWorkspace(fs, "workspace", shipyardConfig, conf, false)
+	assert.Error(t, err, "Files already exist, use --force to overwrite them: .keptn/stages/dev/carts/helm/carts/values.yaml")
+	_, err = fs.Stat(filepath.Join("workspace", ".keptn", "ci_config.yaml"))
+	assert.Assert(t, err != nil, "nothing is written if files exist")
+
+	created, err := scaffoldWorkspace(fs, "workspace", shipyardConfig, conf, true)
+	assert.NilError(t, err)
+	assert.Equal(t, len(created), 4)
+	content, err := afero.ReadFile(fs, filepath.Join(stageValues, "values.yaml"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), "# Values of carts in stage dev, merged into the base values\n")
+}
+
+func TestScaffoldWorkspace_NoStages(t *testing.T) {
+	conf, err := newInitialCiConfig([]string{"carts"}, nil, "jenkins", "keptn@keptn.sh")
+	assert.NilError(t, err)
+
+	_, err = scaffoldWorkspace(afero.NewMemMapFs(), "workspace", ShipyardConfig{}, conf, false)
+	assert.Error(t, err, "No stage defined in shipyard.yaml")
+}
+
+func TestNewInitialCiConfig_Invalid(t *testing.T) {
+	tests := []struct {
+		name       string
+		services   []string
+		chartBases map[string]string
+		wantErr    string
+	}{
+		{name: "no services", wantErr: "No services given"},
+		{name: "invalid name", services: []string{"../carts"}, wantErr: "Invalid service name '../carts'"},
+		{name: "duplicate", services: []string{"carts", "carts"}, wantErr: "Service 'carts' is given twice"},
+		{name: "unknown chart", services: []string{"carts"}, chartBases: map[string]string{"orders": "helm/orders"}, wantErr: "Chart given for unknown service 'orders'"},
+		{name: "chart outside workspace", services: []string{"carts"}, chartBases: map[string]string{"carts": "../helm/carts"}, wantErr: "Chart of service 'carts' has to be relative to the workspace: ../helm/carts"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newInitialCiConfig(tt.services, tt.chartBases, "jenkins", "keptn@keptn.sh")
+			assert.Error(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestPromptServices(t *testing.T) {
+	in := strings.NewReader("carts, orders\n\nhelm/orders\n")
+	out := &bytes.Buffer{}
+
+	services, chartBases, err := promptServices(in, out, map[string]string{})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, services, []string{"carts", "orders"})
+	assert.DeepEqual(t, chartBases, map[string]string{"orders": "helm/orders"})
+	assert.Assert(t, strings.Contains(out.String(), "Chart of orders relative to the workspace"))
+}
@@ -0,0 +1,248 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	keptnEventSource = "ci-connect-cli"
+	// keptnPollInterval is the delay between two requests for the outcome of a sequence
+	keptnPollInterval = 5 * time.Second
+)
+
+type keptnAPIConfig struct {
+	endpoint *string
+	token    *string
+}
+
+// KeptnEvent is a CloudEvent sent to or received from the Keptn API
+type KeptnEvent struct {
+	ID              string         `json:"id,omitempty"`
+	Type            string         `json:"type"`
+	Source          string         `json:"source"`
+	SpecVersion     string         `json:"specversion"`
+	DataContentType string         `json:"datacontenttype"`
+	Time            *time.Time     `json:"time,omitempty"`
+	KeptnContext    string         `json:"shkeptncontext,omitempty"`
+	TriggeredID     string         `json:"triggeredid,omitempty"`
+	Data            KeptnEventData `json:"data"`
+}
+
+// KeptnEventData contains the fields of the event data used by the CLI
+type KeptnEventData struct {
+	Project string            `json:"project"`
+	Stage   string            `json:"stage"`
+	Service string            `json:"service"`
+	Labels  map[string]string `json:"labels,omitempty"`
+	Status  string            `json:"status,omitempty"`
+	Result  string            `json:"result,omitempty"`
+	Message string            `json:"message,omitempty"`
+}
+
+type keptnEventContext struct {
+	KeptnContext string `json:"keptnContext"`
+}
+
+type keptnEvents struct {
+	Events []KeptnEvent `json:"events"`
+}
+
+// keptnAPI sends events to the Keptn API and reads events from its datastore
+type keptnAPI struct {
+	endpoint     string
+	token        string
+	client       *http.Client
+	pollInterval time.Duration
+}
+
+func (config keptnAPIConfig) newKeptnAPI() *keptnAPI {
+	return &keptnAPI{
+		endpoint:     strings.TrimSuffix(*config.endpoint, "/"),
+		token:        *config.token,
+		client:       &http.Client{Timeout: 30 * time.Second},
+		pollInterval: keptnPollInterval,
+	}
+}
+
+// newSequenceTriggeredEvent creates the event which triggers the sequence in the stage
+func newSequenceTriggeredEvent(stage string, sequence string, data KeptnEventData) KeptnEvent {
+	now := time.Now().UTC()
+	return KeptnEvent{
+		ID:              uuid.New().String(),
+		Type:            sequenceEventType(stage, sequence, "triggered"),
+		Source:          keptnEventSource,
+		SpecVersion:     "1.0",
+		DataContentType: "application/json",
+		Time:            &now,
+		Data:            data,
+	}
+}
+
+func sequenceEventType(stage string, sequence string, phase string) string {
+	return fmt.Sprintf("sh.keptn.event.%v.%v.%v", stage, sequence, phase)
+}
+
+func (api *keptnAPI) do(method string, path string, body interface{}, result interface{}) error {
+	var requestBody []byte
+	if body != nil {
+		var err error
+		requestBody, err = json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("Could not marshal request: %v", err)
+		}
+	}
+
+	request, err := http.NewRequest(method, api.endpoint+path, bytes.NewReader(requestBody))
+	if err != nil {
+		return fmt.Errorf("Could not create request: %v", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("x-token", api.token)
+
+	response, err := api.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("Could not reach Keptn API: %v", err)
+	}
+	defer response.Body.Close()
+
+	responseBody, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return fmt.Errorf("Could not read response of Keptn API: %v", err)
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("Keptn API responded with %v: %v", response.Status, strings.TrimSpace(string(responseBody)))
+	}
+	if result != nil {
+		if err := json.Unmarshal(responseBody, result); err != nil {
+			return fmt.Errorf("Could not parse response of Keptn API: %v", err)
+		}
+	}
+	return nil
+}
+
+// SendEvent sends the event to Keptn and returns the Keptn context it is processed in
+func (api *keptnAPI) SendEvent(event KeptnEvent) (string, error) {
+	eventContext := keptnEventContext{}
+	if err := api.do(http.MethodPost, "/v1/event", event, &eventContext); err != nil {
+		return "", err
+	}
+	return eventContext.KeptnContext, nil
+}
+
+// eventFilter selects events in the Keptn datastore, empty fields are not filtered on
+type eventFilter struct {
+	Project      string
+	Stage        string
+	Service      string
+	KeptnContext string
+	Type         string
+	FromTime     time.Time
+}
+
+// GetEvents returns the events matching the filter
+func (api *keptnAPI) GetEvents(filter eventFilter) ([]KeptnEvent, error) {
+	query := url.Values{}
+	for name, value := range map[string]string{
+		"project":      filter.Project,
+		"stage":        filter.Stage,
+		"service":      filter.Service,
+		"keptnContext": filter.KeptnContext,
+		"type":         filter.Type,
+	} {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+	if !filter.FromTime.IsZero() {
+		query.Set("fromTime", filter.FromTime.UTC().Format("2006-01-02T15:04:05.000Z"))
+	}
+
+	events := keptnEvents{}
+	if err := api.do(http.MethodGet, "/mongodb-datastore/event?"+query.Encode(), nil, &events); err != nil {
+		return nil, err
+	}
+	return events.Events, nil
+}
+
+// pollEvents requests the events matching the filter until accept returns an event or the deadline passes, nil is
+// returned if the deadline passed
+func (api *keptnAPI) pollEvents(filter eventFilter, deadline time.Time, accept func(events []KeptnEvent) *KeptnEvent) (*KeptnEvent, error) {
+	for {
+		events, err := api.GetEvents(filter)
+		if err != nil {
+			return nil, err
+		}
+		if event := accept(events); event != nil {
+			return event, nil
+		}
+
+		if time.Now().Add(api.pollInterval).After(deadline) {
+			return nil, nil
+		}
+		time.Sleep(api.pollInterval)
+	}
+}
+
+// WaitForSequence polls for the finished event of the sequence until it is received or the deadline passes
+func (api *keptnAPI) WaitForSequence(project string, stage string, sequence string, keptnContext string, deadline time.Time) (*KeptnEvent, error) {
+	filter := eventFilter{Project: project, KeptnContext: keptnContext, Type: sequenceEventType(stage, sequence, "finished")}
+	finished, err := api.pollEvents(filter, deadline, func(events []KeptnEvent) *KeptnEvent {
+		if len(events) > 0 {
+			return &events[0]
+		}
+		return nil
+	})
+	if err == nil && finished == nil {
+		err = fmt.Errorf("Sequence %v in stage %v did not finish in time", sequence, stage)
+	}
+	return finished, err
+}
+
+// FindTriggeredSequence polls for the triggered event of the sequence of the service which was sent after since and
+// has all the given labels, e.g. the event sent by the git-operator for a deployment
+func (api *keptnAPI) FindTriggeredSequence(project string, stage string, sequence string, service string, labels map[string]string, since time.Time, deadline time.Time) (*KeptnEvent, error) {
+	filter := eventFilter{Project: project, Stage: stage, Service: service, Type: sequenceEventType(stage, sequence, "triggered"), FromTime: since}
+	triggered, err := api.pollEvents(filter, deadline, func(events []KeptnEvent) *KeptnEvent {
+		for i, event := range events {
+			if event.Data.Service == service && hasLabels(event.Data.Labels, labels) {
+				return &events[i]
+			}
+		}
+		return nil
+	})
+	if err == nil && triggered == nil {
+		err = fmt.Errorf("Sequence %v in stage %v was not triggered for %v in time", sequence, stage, service)
+	}
+	return triggered, err
+}
+
+func hasLabels(labels map[string]string, expected map[string]string) bool {
+	for name, value := range expected {
+		if labels[name] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// sequenceOutcome describes the finished event of a sequence and returns an error if the sequence failed
+func sequenceOutcome(sequence string, finished *KeptnEvent) (string, error) {
+	data := finished.Data
+	outcome := fmt.Sprintf("Sequence %v in stage %v finished with result %v, status %v", sequence, data.Stage, data.Result, data.Status)
+	if data.Message != "" {
+		outcome += ": " + data.Message
+	}
+	if data.Result == "fail" || data.Status == "errored" || data.Status == "aborted" {
+		return outcome, fmt.Errorf("Sequence %v in stage %v failed", sequence, data.Stage)
+	}
+	return outcome, nil
+}
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+const testKeptnToken = "my-token"
+
+// newTestKeptnAPI serves the Keptn API, the datastore returns the events matching the query after the given number of
+// requests for their type
+func newTestKeptnAPI(t *testing.T, polls int, events ...KeptnEvent) (*keptnAPI, *[]KeptnEvent, func()) {
+	received := []KeptnEvent{}
+	requests := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-token") != testKeptnToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/api/v1/event":
+			event := KeptnEvent{}
+			assert.NilError(t, json.NewDecoder(r.Body).Decode(&event))
+			received = append(received, event)
+			assert.NilError(t, json.NewEncoder(w).Encode(keptnEventContext{KeptnContext: "my-context"}))
+		case r.Method == http.MethodGet && r.URL.Path == "/api/mongodb-datastore/event":
+			query := r.URL.Query()
+			requests[query.Get("type")]++
+			result := keptnEvents{Events: []KeptnEvent{}}
+			for _, event := range events {
+				if requests[query.Get("type")] > polls && event.Type == query.Get("type") &&
+					(query.Get("keptnContext") == "" || event.KeptnContext == query.Get("keptnContext")) &&
+					(query.Get("service") == "" || event.Data.Service == query.Get("service")) {
+					result.Events = append(result.Events, event)
+				}
+			}
+			assert.NilError(t, json.NewEncoder(w).Encode(result))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	endpoint := server.URL + "/api/"
+	token := testKeptnToken
+	api := keptnAPIConfig{endpoint: &endpoint, token: &token}.newKeptnAPI()
+	api.pollInterval = time.Millisecond
+	return api, &received, server.Close
+}
+
+// newTestFinishedEvent is the finished event of the sequence in the Keptn context my-context
+func newTestFinishedEvent(stage string, sequence string, result string) KeptnEvent {
+	return KeptnEvent{
+		Type:         sequenceEventType(stage, sequence, "finished"),
+		KeptnContext: "my-context",
+		Data:         KeptnEventData{Project: "sockshop", Stage: stage, Service: "carts", Result: result, Status: "succeeded"},
+	}
+}
+
+func TestKeptnAPI_SendEvent(t *testing.T) {
+	api, received, closeServer := newTestKeptnAPI(t, 0)
+	defer closeServer()
+
+	data := KeptnEventData{Project: "sockshop", Stage: "prod", Service: "carts", Labels: map[string]string{"version": "1.2.0"}}
+	keptnContext, err := api.SendEvent(newSequenceTriggeredEvent("prod", "delivery", data))
+	assert.NilError(t, err)
+	assert.Equal(t, keptnContext, "my-context")
+
+	assert.Equal(t, len(*received), 1)
+	event := (*received)[0]
+	assert.Equal(t, event.Type, "sh.keptn.event.prod.delivery.triggered")
+	assert.Equal(t, event.Source, keptnEventSource)
+	assert.Assert(t, event.ID != "")
+	assert.DeepEqual(t, event.Data, data)
+
+	api.token = "wrong"
+	_, err = api.SendEvent(newSequenceTriggeredEvent("prod", "delivery", data))
+	assert.Error(t, err, "Keptn API responded with 401 Unauthorized: ")
+}
+
+func TestKeptnAPI_WaitForSequence(t *testing.T) {
+	api, _, closeServer := newTestKeptnAPI(t, 2, newTestFinishedEvent("prod", "delivery", "pass"))
+	defer closeServer()
+
+	finished, err := api.WaitForSequence("sockshop", "prod", "delivery", "my-context", time.Now().Add(time.Minute))
+	assert.NilError(t, err)
+	assert.Equal(t, finished.Type, "sh.keptn.event.prod.delivery.finished")
+	assert.Equal(t, finished.Data.Result, "pass")
+}
+
+func TestKeptnAPI_WaitForSequence_Timeout(t *testing.T) {
+	api, _, closeServer := newTestKeptnAPI(t, 1000, newTestFinishedEvent("prod", "delivery", "pass"))
+	defer closeServer()
+
+	_, err := api.WaitForSequence("sockshop", "prod", "delivery", "my-context", time.Now().Add(10*time.Millisecond))
+	assert.Error(t, err, "Sequence delivery in stage prod did not finish in time")
+}
+
+func TestSequenceOutcome(t *testing.T) {
+	outcome, err := sequenceOutcome("delivery", &KeptnEvent{Data: KeptnEventData{Stage: "prod", Result: "pass", Status: "succeeded"}})
+	assert.NilError(t, err)
+	assert.Equal(t, outcome, "Sequence delivery in stage prod finished with result pass, status succeeded")
+
+	outcome, err = sequenceOutcome("delivery", &KeptnEvent{Data: KeptnEventData{Stage: "prod", Result: "fail", Status: "succeeded", Message: "evaluation failed"}})
+	assert.Error(t, err, "Sequence delivery in stage prod failed")
+	assert.Equal(t, outcome, "Sequence delivery in stage prod finished with result fail, status succeeded: evaluation failed")
+}
@@ -33,33 +33,67 @@ func (conf *DeploymentConfig) UpdateRepository(fs afero.Fs, dir string, stage st
 			}
 
 			if service.UpdateHelmDependencies {
-				err = DependencyUpdate(sourceHelmPath)
+				manager, err := conf.newDependencyManager(os.Stderr, triggerDeployParams.Dependencies)
+				if err != nil {
+					return err
+				}
+				err = manager.build(sourceHelmPath)
 				if err != nil {
 					return fmt.Errorf("Could not update Dependencies: %s", err)
 				}
 			}
 
+			*triggerDeployParams.Version, err = getImageVersion(service, sourceHelmPath)
+			if err != nil {
+				return err
+			}
+
 			err = copyBase(fs, sourceServicePath, destinationBaseServicePath)
 			if err != nil {
 				return err
 			}
 
+			destinationHelmPath := filepath.Join(destinationBaseServicePath, "helm", service.ServiceName)
+			err = setChartVersion(fs, destinationHelmPath, service, *triggerDeployParams.Version)
+			if err != nil {
+				return err
+			}
+
+			// the copied chart is replaced by an umbrella chart which depends on the pushed package
+			var chartReference *ChartReference
+			if service.ChartRepository != "" {
+				chartReference, err = triggerDeployParams.Charts.publishChart(os.Stdout, service.ChartRepository, destinationHelmPath, *triggerDeployParams.Version, *triggerDeployParams.DryRun)
+				if err != nil {
+					return err
+				}
+
+				err = fs.RemoveAll(destinationHelmPath)
+				if err != nil {
+					return fmt.Errorf("Could not delete the chart of %v: %v", service.ServiceName, err)
+				}
+
+				err = writeUmbrellaChart(fs, destinationHelmPath, service.ServiceName, chartReference)
+				if err != nil {
+					return err
+				}
+			}
+
 			err := copyStages(fs, dir, service)
 			if err != nil {
 				return err
 			}
 
-			err = modifyOperatorConfig(fs, dir, operatorConfig, service, stage, sequence)
+			err = conf.renderStageTemplates(fs, dir, service, *triggerDeployParams.Version)
 			if err != nil {
 				return err
 			}
 
-			*triggerDeployParams.Version, err = getImageVersion(service, sourceHelmPath)
+			err = modifyOperatorConfig(fs, dir, operatorConfig, service, stage, sequence)
 			if err != nil {
 				return err
 			}
 
-			err = createDeploymentMetadata(fs, dir, service)
+			err = createDeploymentMetadata(fs, dir, service, chartReference)
 			if err != nil {
 				return err
 			}
@@ -69,28 +103,14 @@ func (conf *DeploymentConfig) UpdateRepository(fs afero.Fs, dir string, stage st
 	return nil
 }
 
-func createDeploymentMetadata(fs afero.Fs, dir string, service ServiceConfig) error {
+func createDeploymentMetadata(fs afero.Fs, dir string, service ServiceConfig, chartReference *ChartReference) error {
 
-	sourceRepo, err := git.PlainOpen(*triggerDeployParams.Workspace)
+	commit, author, err := getWorkspaceCommit()
 	if err != nil {
-		return fmt.Errorf("could not open git repo: %s", err)
-	}
-
-	commit := ""
-	author := ""
-
-	head, err := sourceRepo.Head()
-	if err != nil {
-		return fmt.Errorf("could not get head: %s", err)
-	}
-	commit = head.Hash().String()
-	lastCommit, err := sourceRepo.CommitObject(head.Hash())
-	if err != nil {
-		return fmt.Errorf("could not get commit: %s", err)
+		return err
 	}
-	author = lastCommit.Author.Email
 
-	meta := createDeploymentManifest(commit, author)
+	meta := createDeploymentManifest(commit, author, chartReference)
 	out, err := yaml.Marshal(meta)
 	if err != nil {
 		return fmt.Errorf("Could not create deployment metadata file: %v", err)
@@ -109,6 +129,24 @@ func createDeploymentMetadata(fs afero.Fs, dir string, service ServiceConfig) er
 	return nil
 }
 
+// getWorkspaceCommit returns the hash and the author of the commit checked out in the workspace
+func getWorkspaceCommit() (string, string, error) {
+	sourceRepo, err := git.PlainOpen(*triggerDeployParams.Workspace)
+	if err != nil {
+		return "", "", fmt.Errorf("could not open git repo: %s", err)
+	}
+
+	head, err := sourceRepo.Head()
+	if err != nil {
+		return "", "", fmt.Errorf("could not get head: %s", err)
+	}
+	lastCommit, err := sourceRepo.CommitObject(head.Hash())
+	if err != nil {
+		return "", "", fmt.Errorf("could not get commit: %s", err)
+	}
+	return head.Hash().String(), lastCommit.Author.Email, nil
+}
+
 func modifyOperatorConfig(fs afero.Fs, dir string, operatorConfig KeptnConfig, service ServiceConfig, stage string, sequence string) error {
 	deploymentTrigger := fmt.Sprintf("sh.keptn.event.%v.%v.triggered", stage, sequence)
 	foundOperatorConfig := false
@@ -213,25 +251,37 @@ func readKeptnOperatorConfigFromFile(fs afero.Fs, dir string) (KeptnConfig, erro
 	return operatorConfig, nil
 }
 
-func createDeploymentManifest(gitCommit string, author string) DeploymentManifest {
+func createDeploymentManifest(gitCommit string, author string, chartReference *ChartReference) DeploymentManifest {
 	return DeploymentManifest{
 		Metadata: DeploymentMetadata{
 			ImageVersion: *triggerDeployParams.Version,
 			GitCommit:    gitCommit,
 			Author:       author,
+			Chart:        chartReference,
 		},
 	}
 }
 
+// warnedCiConfigs are the files whose warnings were printed, a file is read more than once for some commands
+var warnedCiConfigs = map[string]bool{}
+
+// GetCiConfig reads the ci_config.yaml, files in the unversioned format are migrated and a warning is printed for them
 func (conf *DeploymentConfig) GetCiConfig(config string) error {
 	configFile, err := ioutil.ReadFile(config)
 	if err != nil {
-		return fmt.Errorf("Could not read CI Configuration file from "+config, err)
+		return fmt.Errorf("Could not read CI Configuration file %v: %v", config, err)
 	}
-	err = yaml.Unmarshal(configFile, conf)
+	parsed, warnings, err := parseCiConfig(configFile)
 	if err != nil {
-		return fmt.Errorf("Could not unmarshal CI Configuration file "+config, err)
+		return fmt.Errorf("Invalid CI Configuration file %v: %v", config, err)
+	}
+	for _, warning := range warnings {
+		if !warnedCiConfigs[config] {
+			fmt.Fprintf(os.Stderr, "Warning: %v: %v\n", config, warning)
+		}
 	}
+	warnedCiConfigs[config] = true
+	*conf = parsed
 	return nil
 }
 
@@ -0,0 +1,266 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+// promotionTask is the task of the promotion-service, promote and rollback trigger the first sequence containing it
+const promotionTask = "promotion"
+
+type PromoteCmdParams struct {
+	Project    *string
+	Service    *string
+	Version    *string
+	Stage      *string
+	Sequence   *string
+	Wait       *time.Duration
+	KeptnAPI   keptnAPIConfig
+	Repository gitRepositoryConfig
+}
+
+type RollbackCmdParams struct {
+	Project        *string
+	Service        *string
+	Stage          *string
+	ToVersion      *string
+	Sequence       *string
+	StageBranch    *string
+	StageDirectory *string
+	Wait           *time.Duration
+	KeptnAPI       keptnAPIConfig
+	Repository     gitRepositoryConfig
+}
+
+var promoteParams *PromoteCmdParams
+var rollbackParams *RollbackCmdParams
+
+func runPromote(out io.Writer) error {
+	repository, err := promoteParams.Repository.CloneReadOnly()
+	if err != nil {
+		return err
+	}
+	shipyardConfig, err := readShipyardConfig(repository)
+	if err != nil {
+		return err
+	}
+	sequence, err := promotionSequence(shipyardConfig, *promoteParams.Stage, *promoteParams.Sequence)
+	if err != nil {
+		return err
+	}
+
+	data := KeptnEventData{
+		Project: *promoteParams.Project,
+		Stage:   *promoteParams.Stage,
+		Service: *promoteParams.Service,
+		Labels:  map[string]string{"version": *promoteParams.Version},
+	}
+	return triggerSequence(out, promoteParams.KeptnAPI.newKeptnAPI(), sequence, data, *promoteParams.Wait)
+}
+
+func runRollback(out io.Writer) error {
+	repository, err := rollbackParams.Repository.CloneReadOnly()
+	if err != nil {
+		return err
+	}
+	shipyardConfig, err := readShipyardConfig(repository)
+	if err != nil {
+		return err
+	}
+	sequence, err := promotionSequence(shipyardConfig, *rollbackParams.Stage, *rollbackParams.Sequence)
+	if err != nil {
+		return err
+	}
+
+	layout := stageLayout{Branch: *rollbackParams.StageBranch, Directory: *rollbackParams.StageDirectory}
+	history, err := readPromotionHistory(repository, layout, *rollbackParams.Stage, *rollbackParams.Service)
+	if err != nil {
+		return err
+	}
+	current, version, err := rollbackVersion(history, *rollbackParams.ToVersion)
+	if err != nil {
+		return fmt.Errorf("Could not roll back %v in stage %v: %v", *rollbackParams.Service, *rollbackParams.Stage, err)
+	}
+
+	labels := map[string]string{"version": version}
+	if current != "" {
+		labels["rollbackFrom"] = current
+	}
+	fmt.Fprintf(out, "Rolling back %v in stage %v from version %v to %v\n", *rollbackParams.Service, *rollbackParams.Stage, orDash(current), version)
+
+	data := KeptnEventData{
+		Project: *rollbackParams.Project,
+		Stage:   *rollbackParams.Stage,
+		Service: *rollbackParams.Service,
+		Labels:  labels,
+	}
+	return triggerSequence(out, rollbackParams.KeptnAPI.newKeptnAPI(), sequence, data, *rollbackParams.Wait)
+}
+
+func readShipyardConfig(repository *git.Repository) (ShipyardConfig, error) {
+	shipyardFile, err := readBranchFile(repository, "", "shipyard.yaml")
+	if err != nil {
+		return ShipyardConfig{}, fmt.Errorf("Could not find shipyard config: %v", err)
+	}
+	shipyardConfig := ShipyardConfig{}
+	if err := yaml.Unmarshal(shipyardFile, &shipyardConfig); err != nil {
+		return ShipyardConfig{}, fmt.Errorf("Could not unmarshal shipyard config")
+	}
+	return shipyardConfig, nil
+}
+
+// promotionSequence validates the stage and returns the given sequence or the first sequence of the stage containing
+// the promotion task
+func promotionSequence(shipyardConfig ShipyardConfig, stage string, sequence string) (string, error) {
+	for _, specStage := range shipyardConfig.Spec.Stages {
+		if specStage.Name != stage {
+			continue
+		}
+		for _, specSequence := range specStage.Sequences {
+			if sequence != "" && specSequence.Name == sequence {
+				return sequence, nil
+			}
+			if sequence == "" {
+				for _, task := range specSequence.Tasks {
+					if task.Name == promotionTask {
+						return specSequence.Name, nil
+					}
+				}
+			}
+		}
+		if sequence != "" {
+			return "", fmt.Errorf("Could not find sequence '%v' in stage '%v' in shipyard.yaml", sequence, stage)
+		}
+		return "", fmt.Errorf("No sequence with a %v task in stage '%v' in shipyard.yaml, use --sequence", promotionTask, stage)
+	}
+	return "", fmt.Errorf("Could not find stage '%v' in shipyard.yaml", stage)
+}
+
+// rollbackVersion returns the current version and the version to roll back to, which is the last promoted version
+// before the current one unless it is given
+func rollbackVersion(history promotionHistory, toVersion string) (string, string, error) {
+	current := ""
+	if len(history.Promotions) > 0 {
+		current = history.Promotions[len(history.Promotions)-1].Version
+	}
+
+	if toVersion != "" {
+		if toVersion == current {
+			return "", "", fmt.Errorf("version %v is already promoted", toVersion)
+		}
+		return current, toVersion, nil
+	}
+
+	for i := len(history.Promotions) - 2; i >= 0; i-- {
+		if history.Promotions[i].Version != current {
+			return current, history.Promotions[i].Version, nil
+		}
+	}
+	return "", "", fmt.Errorf("no previous version was promoted, use --to-version")
+}
+
+// triggerSequence sends the triggered event of the sequence and waits for its outcome if wait is set
+func triggerSequence(out io.Writer, api *keptnAPI, sequence string, data KeptnEventData, wait time.Duration) error {
+	keptnContext, err := api.SendEvent(newSequenceTriggeredEvent(data.Stage, sequence, data))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Triggered sequence %v in stage %v for %v version %v, Keptn context %v\n", sequence, data.Stage, data.Service, data.Labels["version"], keptnContext)
+
+	if wait <= 0 {
+		return nil
+	}
+	finished, err := api.WaitForSequence(data.Project, data.Stage, sequence, keptnContext, time.Now().Add(wait))
+	if err != nil {
+		return err
+	}
+	outcome, err := sequenceOutcome(sequence, finished)
+	fmt.Fprintln(out, outcome)
+	return err
+}
+
+func NewPromoteCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "promote",
+		Short: `Promote a version of a service into a stage`,
+		Long: `Validates the stage against the shipyard.yaml of the keptn configuration repository and triggers the
+sequence of the stage which contains the promotion task, or the given sequence, using the Keptn API.
+
+With --wait the command waits for the sequence to finish and fails if it failed.
+
+All flags can also be set with environment variables instead e.g.
+* --keptn-api-token <token> or
+* export KEPTN_API_TOKEN=<token>`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runPromote(cmd.OutOrStdout())
+		},
+	}
+
+	promoteParams = &PromoteCmdParams{}
+	promoteParams.Project = cmd.Flags().StringP("project", "p", "", "The keptn project")
+	promoteParams.Service = cmd.Flags().StringP("service", "s", "", "The service which should be promoted")
+	promoteParams.Version = cmd.Flags().StringP("version", "x", "", "The version which should be promoted")
+	promoteParams.Stage = cmd.Flags().StringP("stage", "g", "", "The stage into which the version should be promoted")
+	promoteParams.Sequence = cmd.Flags().StringP("sequence", "q", "", "The sequence which should be triggered, the first sequence of the stage with a promotion task by default")
+	promoteParams.Wait = cmd.Flags().Duration("wait", 0, "Wait up to this duration for the sequence to finish, e.g. 10m")
+
+	for _, flag := range []string{"project", "service", "version", "stage"} {
+		err := cmd.MarkFlagRequired(flag)
+		if err != nil {
+			fmt.Println("Could not mark field required", err)
+		}
+	}
+
+	prepareKeptnAPICmd(&promoteParams.KeptnAPI, cmd, true)
+	prepareGitRepoCmd(&promoteParams.Repository, cmd)
+
+	return cmd
+}
+
+func NewRollbackCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rollback",
+		Short: `Promote the previous version of a service into a stage again`,
+		Long: `Reads the promotion history of the service in the stage branch written by the promotion-service and
+promotes the version before the current one, or the version given with --to-version, like the promote command.
+
+All flags can also be set with environment variables instead e.g.
+* --keptn-api-token <token> or
+* export KEPTN_API_TOKEN=<token>`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runRollback(cmd.OutOrStdout())
+		},
+	}
+
+	rollbackParams = &RollbackCmdParams{}
+	rollbackParams.Project = cmd.Flags().StringP("project", "p", "", "The keptn project")
+	rollbackParams.Service = cmd.Flags().StringP("service", "s", "", "The service which should be rolled back")
+	rollbackParams.Stage = cmd.Flags().StringP("stage", "g", "", "The stage in which the service should be rolled back")
+	rollbackParams.ToVersion = cmd.Flags().String("to-version", "", "The version to roll back to, the previously promoted version by default")
+	rollbackParams.Sequence = cmd.Flags().StringP("sequence", "q", "", "The sequence which should be triggered, the first sequence of the stage with a promotion task by default")
+	rollbackParams.StageBranch = cmd.Flags().String("stage-branch", "{{ .Stage }}", "The template of the stage branches written by the promotion-service")
+	rollbackParams.StageDirectory = cmd.Flags().String("stage-directory", "", "The template of the directory containing the services in the stage branches")
+	rollbackParams.Wait = cmd.Flags().Duration("wait", 0, "Wait up to this duration for the sequence to finish, e.g. 10m")
+
+	for _, flag := range []string{"project", "service", "stage"} {
+		err := cmd.MarkFlagRequired(flag)
+		if err != nil {
+			fmt.Println("Could not mark field required", err)
+		}
+	}
+
+	prepareKeptnAPICmd(&rollbackParams.KeptnAPI, cmd, true)
+	prepareGitRepoCmd(&rollbackParams.Repository, cmd)
+
+	return cmd
+}
+
+func init() {
+	rootCmd.AddCommand(NewPromoteCmd())
+	rootCmd.AddCommand(NewRollbackCmd())
+}
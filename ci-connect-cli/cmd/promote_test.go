@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+	"gotest.tools/assert"
+)
+
+const promotionShipyardConfig = `
+spec:
+  stages:
+    - name: "dev"
+      sequences:
+        - name: "delivery"
+          tasks:
+            - name: "deployment"
+    - name: "prod"
+      sequences:
+        - name: "delivery"
+          tasks:
+            - name: "deployment"
+        - name: "promote"
+          tasks:
+            - name: "approval"
+            - name: "promotion"
+`
+
+func TestPromotionSequence(t *testing.T) {
+	shipyardConfig := ShipyardConfig{}
+	assert.NilError(t, yaml.Unmarshal([]byte(promotionShipyardConfig), &shipyardConfig))
+
+	tests := []struct {
+		name     string
+		stage    string
+		sequence string
+		want     string
+		wantErr  string
+	}{
+		{name: "sequence with promotion task", stage: "prod", want: "promote"},
+		{name: "given sequence", stage: "prod", sequence: "delivery", want: "delivery"},
+		{name: "unknown stage", stage: "staging", wantErr: "Could not find stage 'staging' in shipyard.yaml"},
+		{name: "unknown sequence", stage: "prod", sequence: "rollback", wantErr: "Could not find sequence 'rollback' in stage 'prod' in shipyard.yaml"},
+		{name: "no promotion task", stage: "dev", wantErr: "No sequence with a promotion task in stage 'dev' in shipyard.yaml, use --sequence"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sequence, err := promotionSequence(shipyardConfig, tt.stage, tt.sequence)
+			if tt.wantErr != "" {
+				assert.Error(t, err, tt.wantErr)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, sequence, tt.want)
+		})
+	}
+}
+
+func TestRollbackVersion(t *testing.T) {
+	history := promotionHistory{}
+	assert.NilError(t, yaml.Unmarshal([]byte(`
+promotions:
+  - version: "1.0.0"
+  - version: "1.1.0"
+  - version: "1.2.0"
+  - version: "1.2.0"
+`), &history))
+
+	current, version, err := rollbackVersion(history, "")
+	assert.NilError(t, err)
+	assert.Equal(t, current, "1.2.0")
+	assert.Equal(t, version, "1.1.0")
+
+	current, version, err = rollbackVersion(history, "1.0.0")
+	assert.NilError(t, err)
+	assert.Equal(t, current, "1.2.0")
+	assert.Equal(t, version, "1.0.0")
+
+	_, _, err = rollbackVersion(history, "1.2.0")
+	assert.Error(t, err, "version 1.2.0 is already promoted")
+
+	_, _, err = rollbackVersion(promotionHistory{}, "")
+	assert.Error(t, err, "no previous version was promoted, use --to-version")
+}
+
+func TestTriggerSequence(t *testing.T) {
+	api, received, closeServer := newTestKeptnAPI(t, 1, newTestFinishedEvent("prod", "promote", "fail"))
+	defer closeServer()
+
+	out := &bytes.Buffer{}
+	data := KeptnEventData{Project: "sockshop", Stage: "prod", Service: "carts", Labels: map[string]string{"version": "1.1.0", "rollbackFrom": "1.2.0"}}
+	err := triggerSequence(out, api, "promote", data, time.Minute)
+	assert.Error(t, err, "Sequence promote in stage prod failed")
+
+	assert.Equal(t, (*received)[0].Type, "sh.keptn.event.prod.promote.triggered")
+	assert.DeepEqual(t, (*received)[0].Data.Labels, data.Labels)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.DeepEqual(t, lines, []string{
+		"Triggered sequence promote in stage prod for carts version 1.1.0, Keptn context my-context",
+		"Sequence promote in stage prod finished with result fail, status succeeded",
+	})
+}
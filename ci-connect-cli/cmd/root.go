@@ -3,9 +3,7 @@ package cmd
 import (
 	"fmt"
 	"github.com/spf13/cobra"
-	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
-	"log"
 	"strings"
 )
 
@@ -14,6 +12,9 @@ var rootCmd = &cobra.Command{
 	Short: "Keptn CI Connect CLI",
 	Long: `Keptn CI Connect CLI copies configuration files for keptn services to the
 keptn configuration repository and enriches them with metadata.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return presetFlags(cmd)
+	},
 }
 
 func Execute() {
@@ -21,42 +22,17 @@ func Execute() {
 }
 
 func init() {
-	cobra.OnInitialize(func() {
-		viper.AutomaticEnv()
-		replacer := strings.NewReplacer("-", "_")
-		viper.SetEnvKeyReplacer(replacer)
-		postInitCommands(rootCmd.Commands())
-	})
-}
-
-func postInitCommands(commands []*cobra.Command) {
-	for _, cmd := range commands {
-		presetRequiredFlags(cmd)
-		if cmd.HasSubCommands() {
-			postInitCommands(cmd.Commands())
-		}
-	}
-}
-
-func presetRequiredFlags(cmd *cobra.Command) {
-	err := viper.BindPFlags(cmd.Flags())
-	if err != nil {
-		log.Fatal("could not bind flags", err)
-	}
-	cmd.Flags().VisitAll(func(f *pflag.Flag) {
-		if viper.IsSet(f.Name) && viper.GetString(f.Name) != "" {
-			err := cmd.Flags().Set(f.Name, viper.GetString(f.Name))
-			if err != nil {
-				fmt.Println("Could not set flags", err)
-			}
-		}
-	})
+	viper.AutomaticEnv()
+	replacer := strings.NewReplacer("-", "_")
+	viper.SetEnvKeyReplacer(replacer)
 }
 
 func prepareGitRepoCmd(repository *gitRepositoryConfig, cmd *cobra.Command) {
 	repository.remoteURI = cmd.Flags().StringP("git-repo", "r", "", "The keptn git repository uri for the service")
 	repository.user = cmd.Flags().StringP("git-user", "u", "", "The git user that has access to the specified git-repo")
 	repository.token = cmd.Flags().StringP("git-token", "t", "", "The git token that will be used by the git-user to access the git-repo")
+	repository.signingKeyFile = cmd.Flags().String("signing-key-file", "", "A GPG or SSH private key file used to sign commits and tags")
+	repository.signingKeyPassphrase = cmd.Flags().String("signing-key-passphrase", "", "The passphrase of the signing key")
 
 	err := cmd.MarkFlagRequired("git-repo")
 	if err != nil {
@@ -74,3 +50,21 @@ func prepareGitRepoCmd(repository *gitRepositoryConfig, cmd *cobra.Command) {
 	}
 
 }
+
+func prepareKeptnAPICmd(api *keptnAPIConfig, cmd *cobra.Command, required bool) {
+	api.endpoint = cmd.Flags().String("keptn-api", "", "The URL of the Keptn API, e.g. https://keptn.example.com/api")
+	api.token = cmd.Flags().String("keptn-api-token", "", "The Keptn API token")
+	if !required {
+		return
+	}
+
+	err := cmd.MarkFlagRequired("keptn-api")
+	if err != nil {
+		fmt.Println("Could not mark field required", err)
+	}
+
+	err = cmd.MarkFlagRequired("keptn-api-token")
+	if err != nil {
+		fmt.Println("Could not mark field required", err)
+	}
+}
@@ -0,0 +1,248 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	sshSignatureNamespace = "git"
+	sshSignatureHash      = "sha512"
+)
+
+// Signer creates the armored signature of a commit or tag
+type Signer interface {
+	Sign(content []byte) (string, error)
+}
+
+// NewSignerFromFile reads a GPG or OpenSSH private key from a file
+func NewSignerFromFile(file string, passphrase string) (Signer, error) {
+	key, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read signing key: %v", err)
+	}
+	return NewSigner(key, passphrase)
+}
+
+// NewSigner creates a GPG signer for armored PGP keys and an SSH signer for everything else
+func NewSigner(key []byte, passphrase string) (Signer, error) {
+	if bytes.Contains(key, []byte("BEGIN PGP PRIVATE KEY BLOCK")) {
+		return newGPGSigner(key, passphrase)
+	}
+	return newSSHSigner(key, passphrase)
+}
+
+type gpgSigner struct {
+	entity *openpgp.Entity
+}
+
+func newGPGSigner(key []byte, passphrase string) (*gpgSigner, error) {
+	entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(key))
+	if err != nil {
+		return nil, fmt.Errorf("Could not read GPG key: %v", err)
+	}
+	if len(entities) == 0 || entities[0].PrivateKey == nil {
+		return nil, errors.New("GPG key does not contain a private key")
+	}
+
+	entity := entities[0]
+	if entity.PrivateKey.Encrypted {
+		err = entity.PrivateKey.Decrypt([]byte(passphrase))
+		if err != nil {
+			return nil, fmt.Errorf("Could not decrypt GPG key: %v", err)
+		}
+	}
+	for _, subkey := range entity.Subkeys {
+		if subkey.PrivateKey != nil && subkey.PrivateKey.Encrypted {
+			err = subkey.PrivateKey.Decrypt([]byte(passphrase))
+			if err != nil {
+				return nil, fmt.Errorf("Could not decrypt GPG subkey: %v", err)
+			}
+		}
+	}
+	return &gpgSigner{entity: entity}, nil
+}
+
+func (signer *gpgSigner) Sign(content []byte) (string, error) {
+	var signature bytes.Buffer
+	err := openpgp.ArmoredDetachSign(&signature, signer.entity, bytes.NewReader(content), nil)
+	if err != nil {
+		return "", err
+	}
+	return signature.String(), nil
+}
+
+type sshSigner struct {
+	signer ssh.Signer
+}
+
+func newSSHSigner(key []byte, passphrase string) (*sshSigner, error) {
+	var signer ssh.Signer
+	var err error
+	if passphrase != "" {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(passphrase))
+	} else {
+		signer, err = ssh.ParsePrivateKey(key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Could not read SSH key: %v", err)
+	}
+	return &sshSigner{signer: signer}, nil
+}
+
+// Sign creates a signature in the SSHSIG format which git verifies with gpg.format=ssh
+func (signer *sshSigner) Sign(content []byte) (string, error) {
+	var signature *ssh.Signature
+	var err error
+	if algorithmSigner, ok := signer.signer.(ssh.AlgorithmSigner); ok && signer.signer.PublicKey().Type() == ssh.KeyAlgoRSA {
+		signature, err = algorithmSigner.SignWithAlgorithm(rand.Reader, sshSignedData(content), ssh.SigAlgoRSASHA2512)
+	} else {
+		signature, err = signer.signer.Sign(rand.Reader, sshSignedData(content))
+	}
+	if err != nil {
+		return "", err
+	}
+
+	blob := ssh.Marshal(struct {
+		Magic         [6]byte
+		Version       uint32
+		PublicKey     string
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Signature     string
+	}{
+		Magic:         [6]byte{'S', 'S', 'H', 'S', 'I', 'G'},
+		Version:       1,
+		PublicKey:     string(signer.signer.PublicKey().Marshal()),
+		Namespace:     sshSignatureNamespace,
+		HashAlgorithm: sshSignatureHash,
+		Signature:     string(ssh.Marshal(signature)),
+	})
+
+	encoded := base64.StdEncoding.EncodeToString(blob)
+	var armored strings.Builder
+	armored.WriteString("-----BEGIN SSH SIGNATURE-----\n")
+	for len(encoded) > 70 {
+		armored.WriteString(encoded[:70] + "\n")
+		encoded = encoded[70:]
+	}
+	armored.WriteString(encoded + "\n-----END SSH SIGNATURE-----\n")
+	return armored.String(), nil
+}
+
+// sshSignedData returns the data an SSHSIG signature is computed over
+func sshSignedData(content []byte) []byte {
+	hash := sha512.Sum512(content)
+	return ssh.Marshal(struct {
+		Magic         [6]byte
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Hash          string
+	}{
+		Magic:         [6]byte{'S', 'S', 'H', 'S', 'I', 'G'},
+		Namespace:     sshSignatureNamespace,
+		HashAlgorithm: sshSignatureHash,
+		Hash:          string(hash[:]),
+	})
+}
+
+// signHeadCommit replaces the commit HEAD points to with a signed copy
+func signHeadCommit(repository *git.Repository, signer Signer) (plumbing.Hash, error) {
+	head, err := repository.Head()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	commit, err := repository.CommitObject(head.Hash())
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	unsigned := repository.Storer.NewEncodedObject()
+	err = commit.EncodeWithoutSignature(unsigned)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	commit.PGPSignature, err = signEncodedObject(unsigned, signer)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("Could not sign commit: %v", err)
+	}
+
+	signed := repository.Storer.NewEncodedObject()
+	err = commit.Encode(signed)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	hash, err := repository.Storer.SetEncodedObject(signed)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return hash, repository.Storer.SetReference(plumbing.NewHashReference(head.Name(), hash))
+}
+
+// createSignedTag creates an annotated tag signed by the signer
+func createSignedTag(repository *git.Repository, name string, target plumbing.Hash, tagger object.Signature, message string, signer Signer) error {
+	_, err := repository.Reference(plumbing.NewTagReferenceName(name), false)
+	if err == nil {
+		return git.ErrTagExists
+	}
+
+	tag := &object.Tag{
+		Name:       name,
+		Tagger:     tagger,
+		Message:    strings.TrimSpace(message) + "\n",
+		TargetType: plumbing.CommitObject,
+		Target:     target,
+	}
+
+	unsigned := repository.Storer.NewEncodedObject()
+	err = tag.EncodeWithoutSignature(unsigned)
+	if err != nil {
+		return err
+	}
+	tag.PGPSignature, err = signEncodedObject(unsigned, signer)
+	if err != nil {
+		return fmt.Errorf("Could not sign tag: %v", err)
+	}
+
+	signed := repository.Storer.NewEncodedObject()
+	err = tag.Encode(signed)
+	if err != nil {
+		return err
+	}
+	hash, err := repository.Storer.SetEncodedObject(signed)
+	if err != nil {
+		return err
+	}
+
+	return repository.Storer.SetReference(plumbing.NewHashReference(plumbing.NewTagReferenceName(name), hash))
+}
+
+func signEncodedObject(encoded plumbing.EncodedObject, signer Signer) (string, error) {
+	reader, err := encoded.Reader()
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	content, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
+	return signer.Sign(content)
+}
@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"golang.org/x/crypto/ssh"
+	"gotest.tools/assert"
+)
+
+func createCommittedRepository(t *testing.T) *git.Repository {
+	repository, err := git.Init(memory.NewStorage(), memfs.New())
+	assert.NilError(t, err)
+
+	w, err := repository.Worktree()
+	assert.NilError(t, err)
+	_, err = w.Commit("Update service carts to version 1.0.0", &git.CommitOptions{
+		Author: &object.Signature{Name: "keptn", Email: "keptn@example.com", When: time.Now()},
+	})
+	assert.NilError(t, err)
+	return repository
+}
+
+func createGPGKey(t *testing.T) (string, string) {
+	entity, err := openpgp.NewEntity("Keptn CI-Connect CLI", "", "ci-connect@keptn.sh", nil)
+	assert.NilError(t, err)
+
+	var privateKey bytes.Buffer
+	w, err := armor.Encode(&privateKey, openpgp.PrivateKeyType, nil)
+	assert.NilError(t, err)
+	assert.NilError(t, entity.SerializePrivate(w, nil))
+	assert.NilError(t, w.Close())
+
+	var publicKey bytes.Buffer
+	w, err = armor.Encode(&publicKey, openpgp.PublicKeyType, nil)
+	assert.NilError(t, err)
+	assert.NilError(t, entity.Serialize(w))
+	assert.NilError(t, w.Close())
+
+	return privateKey.String(), publicKey.String()
+}
+
+func TestSignHeadCommit_GPG(t *testing.T) {
+	privateKey, publicKey := createGPGKey(t)
+	signer, err := NewSigner([]byte(privateKey), "")
+	assert.NilError(t, err)
+
+	repository := createCommittedRepository(t)
+	hash, err := signHeadCommit(repository, signer)
+	assert.NilError(t, err)
+
+	head, err := repository.Head()
+	assert.NilError(t, err)
+	assert.Equal(t, head.Hash(), hash)
+
+	commit, err := repository.CommitObject(hash)
+	assert.NilError(t, err)
+	_, err = commit.Verify(publicKey)
+	assert.NilError(t, err)
+}
+
+func TestCreateSignedTag_GPG(t *testing.T) {
+	privateKey, publicKey := createGPGKey(t)
+	signer, err := NewSigner([]byte(privateKey), "")
+	assert.NilError(t, err)
+
+	repository := createCommittedRepository(t)
+	head, err := repository.Head()
+	assert.NilError(t, err)
+
+	tagger := object.Signature{Name: GitConfig{}.getTaggerName(), Email: GitConfig{}.getTaggerEmail(), When: time.Now()}
+	err = createSignedTag(repository, "carts-1.0.0", head.Hash(), tagger, "The Version carts-1.0.0", signer)
+	assert.NilError(t, err)
+
+	ref, err := repository.Reference(plumbing.NewTagReferenceName("carts-1.0.0"), false)
+	assert.NilError(t, err)
+	tag, err := repository.TagObject(ref.Hash())
+	assert.NilError(t, err)
+	assert.Equal(t, tag.Target, head.Hash())
+	assert.Equal(t, tag.Tagger.Name, "Keptn CI-Connect CLI")
+	_, err = tag.Verify(publicKey)
+	assert.NilError(t, err)
+
+	err = createSignedTag(repository, "carts-1.0.0", head.Hash(), tagger, "The Version carts-1.0.0", signer)
+	assert.Equal(t, err, git.ErrTagExists)
+}
+
+func TestSignHeadCommit_SSH(t *testing.T) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NilError(t, err)
+	key, err := ssh.NewSignerFromKey(privateKey)
+	assert.NilError(t, err)
+
+	repository := createCommittedRepository(t)
+	hash, err := signHeadCommit(repository, &sshSigner{signer: key})
+	assert.NilError(t, err)
+
+	commit, err := repository.CommitObject(hash)
+	assert.NilError(t, err)
+	lines := strings.Split(strings.TrimSpace(commit.PGPSignature), "\n")
+	assert.Equal(t, lines[0], "-----BEGIN SSH SIGNATURE-----")
+	assert.Equal(t, lines[len(lines)-1], "-----END SSH SIGNATURE-----")
+
+	blob, err := base64.StdEncoding.DecodeString(strings.Join(lines[1:len(lines)-1], ""))
+	assert.NilError(t, err)
+	var parsed struct {
+		Magic         [6]byte
+		Version       uint32
+		PublicKey     string
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Signature     string
+	}
+	assert.NilError(t, ssh.Unmarshal(blob, &parsed))
+	assert.Equal(t, parsed.Namespace, "git")
+
+	signature := &ssh.Signature{}
+	assert.NilError(t, ssh.Unmarshal([]byte(parsed.Signature), signature))
+
+	unsigned := repository.Storer.NewEncodedObject()
+	assert.NilError(t, commit.EncodeWithoutSignature(unsigned))
+	reader, err := unsigned.Reader()
+	assert.NilError(t, err)
+	var content bytes.Buffer
+	_, err = content.ReadFrom(reader)
+	assert.NilError(t, err)
+	assert.NilError(t, key.PublicKey().Verify(sshSignedData(content.Bytes()), signature))
+}
+
+func TestGitConfig_TaggerIdentity(t *testing.T) {
+	gitConfig := GitConfig{TaggerName: "Release Bot", TaggerEmail: "release@example.com"}
+	assert.Equal(t, gitConfig.getTaggerName(), "Release Bot")
+	assert.Equal(t, gitConfig.getTaggerEmail(), "release@example.com")
+}
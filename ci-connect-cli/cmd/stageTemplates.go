@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/afero"
+)
+
+// stageTemplateSuffix marks the files in .keptn/stages-templates/<service> which are rendered for every stage
+const stageTemplateSuffix = ".tmpl"
+
+// StageVariables are custom template variables keyed by the stage name
+type StageVariables map[string]map[string]interface{}
+
+// stageTemplateData is passed to the stage templates
+type stageTemplateData struct {
+	Stage     string
+	Service   string
+	Version   string
+	Variables map[string]interface{}
+}
+
+// stageVariables merges the variables of the stage for all services with the variables of the service
+func (conf *DeploymentConfig) stageVariables(service ServiceConfig, stage string) map[string]interface{} {
+	variables := map[string]interface{}{}
+	for name, value := range conf.StageVariables[stage] {
+		variables[name] = value
+	}
+	for name, value := range service.StageVariables[stage] {
+		variables[name] = value
+	}
+	return variables
+}
+
+// readStageTemplates parses the templates of the service keyed by their path relative to the templates directory
+func readStageTemplates(fs afero.Fs, templatesDir string) (map[string]*template.Template, error) {
+	templates := map[string]*template.Template{}
+	if _, err := fs.Stat(templatesDir); os.IsNotExist(err) {
+		return templates, nil
+	}
+
+	err := afero.Walk(fs, templatesDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(path, stageTemplateSuffix) {
+			return nil
+		}
+		relativePath, err := filepath.Rel(templatesDir, path)
+		if err != nil {
+			return err
+		}
+		content, err := afero.ReadFile(fs, path)
+		if err != nil {
+			return err
+		}
+		parsed, err := template.New(relativePath).Option("missingkey=error").Parse(string(content))
+		if err != nil {
+			return fmt.Errorf("Could not parse stage template %v: %v", path, err)
+		}
+		templates[strings.TrimSuffix(relativePath, stageTemplateSuffix)] = parsed
+		return nil
+	})
+	return templates, err
+}
+
+// renderStageTemplates renders the templates of the service in .keptn/stages-templates/<service> once per stage of the
+// shipyard into stages/<stage>/<service> of the config repository. Files of the stage folder in the workspace are
+// copied by copyStages and can not be rendered from a template as well.
+func (conf *DeploymentConfig) renderStageTemplates(fs afero.Fs, dir string, service ServiceConfig, version string) error {
+	templates, err := readStageTemplates(fs, filepath.Join(triggerDeployParams.BaseDirectory, "stages-templates", service.ServiceName))
+	if err != nil {
+		return err
+	}
+	if len(templates) == 0 {
+		return nil
+	}
+	shipyardConfig, err := readShipyardConfigFromFile(fs, dir)
+	if err != nil {
+		return err
+	}
+
+	files := []string{}
+	for file := range templates {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	for _, stage := range shipyardConfig.Spec.Stages {
+		sourceDir := filepath.Join(triggerDeployParams.BaseDirectory, "stages", stage.Name, service.ServiceName)
+		destinationDir := filepath.Join(dir, "stages", stage.Name, service.ServiceName)
+		if _, err := fs.Stat(sourceDir); os.IsNotExist(err) {
+			// the stage folder is only rendered, remove the files rendered by the previous deployment
+			err = fs.RemoveAll(destinationDir)
+			if err != nil {
+				return fmt.Errorf("Could not delete %v: %v", destinationDir, err)
+			}
+		}
+
+		data := stageTemplateData{
+			Stage:     stage.Name,
+			Service:   service.ServiceName,
+			Version:   version,
+			Variables: conf.stageVariables(service, stage.Name),
+		}
+		for _, file := range files {
+			if _, err := fs.Stat(filepath.Join(sourceDir, file)); err == nil {
+				return fmt.Errorf("%v is rendered from a template and can not exist in %v as well", file, sourceDir)
+			}
+
+			rendered := &bytes.Buffer{}
+			if err := templates[file].Execute(rendered, data); err != nil {
+				return fmt.Errorf("Could not render stage template %v for stage %v: %v", file+stageTemplateSuffix, stage.Name, err)
+			}
+			destination := filepath.Join(destinationDir, file)
+			if err := fs.MkdirAll(filepath.Dir(destination), 0755); err != nil {
+				return fmt.Errorf("Could not create %v: %v", filepath.Dir(destination), err)
+			}
+			if err := afero.WriteFile(fs, destination, rendered.Bytes(), 0644); err != nil {
+				return fmt.Errorf("Could not write %v: %v", destination, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v2"
+	"gotest.tools/assert"
+)
+
+const stageTemplatesConfig = `
+apiVersion: ci-connect.keptn.sh/v1
+kind: CIConfig
+services:
+  - name: carts
+    stage_variables:
+      two:
+        replicas: 3
+stage_variables:
+  one:
+    domain: one.example.com
+    replicas: 1
+  two:
+    domain: two.example.com
+    replicas: 2
+`
+
+const stageTemplateValues = `replicas: {{ .Variables.replicas }}
+image:
+  tag: "{{ .Version }}"
+ingress:
+  host: {{ .Service }}.{{ .Variables.domain }}
+`
+
+func newStageTemplatesTest(t *testing.T) (afero.Fs, DeploymentConfig) {
+	fs := afero.NewMemMapFs()
+	createFile(t, fs, "myDirForPush", "shipyard.yaml", validShipyardConfig)
+	createFile(t, fs, ".keptn/stages-templates/carts/helm/carts", "values.yaml.tmpl", stageTemplateValues)
+	createFile(t, fs, ".keptn/stages-templates/carts", "README.md", "not a template")
+	triggerDeployParams.BaseDirectory = ".keptn"
+
+	conf := DeploymentConfig{}
+	assert.NilError(t, yaml.UnmarshalStrict([]byte(stageTemplatesConfig), &conf))
+	return fs, conf
+}
+
+func TestRenderStageTemplates(t *testing.T) {
+	fs, conf := newStageTemplatesTest(t)
+	createFile(t, fs, ".keptn/stages/one/carts/locust", "health.py", "My smoke test")
+	createFile(t, fs, "myDirForPush/stages/two/carts/helm/carts", "deployment.yaml", "rendered by the previous deployment")
+
+	err := conf.renderStageTemplates(fs, "myDirForPush", conf.Services[0], "1.2.0")
+	assert.NilError(t, err)
+
+	content, err := afero.ReadFile(fs, "myDirForPush/stages/one/carts/helm/carts/values.yaml")
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), "replicas: 1\nimage:\n  tag: \"1.2.0\"\ningress:\n  host: carts.one.example.com\n")
+	content, err = afero.ReadFile(fs, "myDirForPush/stages/two/carts/helm/carts/values.yaml")
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), "replicas: 3\nimage:\n  tag: \"1.2.0\"\ningress:\n  host: carts.two.example.com\n")
+
+	_, err = fs.Stat("myDirForPush/stages/one/carts/README.md")
+	assert.Assert(t, err != nil, "only templates are rendered")
+	_, err = fs.Stat("myDirForPush/stages/two/carts/helm/carts/deployment.yaml")
+	assert.Assert(t, err != nil, "stage folders which are only rendered are replaced")
+}
+
+func TestRenderStageTemplates_NoTemplates(t *testing.T) {
+	fs, conf := newStageTemplatesTest(t)
+	conf.Services[0].ServiceName = "orders"
+
+	err := conf.renderStageTemplates(fs, "myDirForPush", conf.Services[0], "1.2.0")
+	assert.NilError(t, err)
+	_, err = fs.Stat("myDirForPush/stages")
+	assert.Assert(t, err != nil)
+}
+
+func TestRenderStageTemplates_Invalid(t *testing.T) {
+	fs, conf := newStageTemplatesTest(t)
+	createFile(t, fs, ".keptn/stages/one/carts/helm/carts", "values.yaml", "replicas: 1")
+
+	err := conf.renderStageTemplates(fs, "myDirForPush", conf.Services[0], "1.2.0")
+	assert.Error(t, err, "helm/carts/values.yaml is rendered from a template and can not exist in .keptn/stages/one/carts as well")
+
+	fs, conf = newStageTemplatesTest(t)
+	delete(conf.StageVariables["two"], "domain")
+
+	err = conf.renderStageTemplates(fs, "myDirForPush", conf.Services[0], "1.2.0")
+	assert.ErrorContains(t, err, "Could not render stage template helm/carts/values.yaml.tmpl for stage two")
+	assert.ErrorContains(t, err, `map has no entry for key "domain"`)
+}
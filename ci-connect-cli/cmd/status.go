@@ -0,0 +1,393 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	OutputTable = "table"
+	OutputJSON  = "json"
+)
+
+// promotionHistoryFile is the file in which the promotion-service records the promotions of a service into a stage
+const promotionHistoryFile = ".promotion-history.yaml"
+
+type StatusCmdParams struct {
+	Workspace        *string
+	Service          *string
+	DeploymentBranch *string
+	StageBranch      *string
+	StageDirectory   *string
+	Output           *string
+	Repository       gitRepositoryConfig
+}
+
+// ServiceStatus is the version of a service in a stage, the version is empty if the service was never deployed into it
+type ServiceStatus struct {
+	Service string     `json:"service"`
+	Stage   string     `json:"stage"`
+	Branch  string     `json:"branch"`
+	Version string     `json:"version"`
+	Commit  string     `json:"commit,omitempty"`
+	Author  string     `json:"author,omitempty"`
+	Date    *time.Time `json:"date,omitempty"`
+}
+
+// stageLayout locates the stages in the branches written by the promotion-service
+type stageLayout struct {
+	Branch    string
+	Directory string
+}
+
+type promotionHistory struct {
+	Promotions []struct {
+		Version   string    `yaml:"version"`
+		Timestamp time.Time `yaml:"timestamp"`
+	} `yaml:"promotions"`
+}
+
+var statusParams *StatusCmdParams
+
+func runStatus(out io.Writer) error {
+	if *statusParams.Output != OutputTable && *statusParams.Output != OutputJSON {
+		return fmt.Errorf("Unknown output format '%v', use %v or %v", *statusParams.Output, OutputTable, OutputJSON)
+	}
+
+	deploymentBranch := *statusParams.DeploymentBranch
+	if deploymentBranch == "" && *statusParams.Workspace != "" {
+		conf := DeploymentConfig{}
+		err := conf.GetCiConfig(filepath.Join(*statusParams.Workspace, ".keptn", "ci_config.yaml"))
+		if err != nil {
+			return err
+		}
+		deploymentBranch = conf.GitConfig.DeploymentBranch
+	}
+
+	repository, err := statusParams.Repository.CloneReadOnly()
+	if err != nil {
+		return err
+	}
+
+	layout := stageLayout{Branch: *statusParams.StageBranch, Directory: *statusParams.StageDirectory}
+	statuses, err := getServiceStatus(repository, deploymentBranch, layout, *statusParams.Service)
+	if err != nil {
+		return err
+	}
+
+	if *statusParams.Output == OutputJSON {
+		return printStatusJSON(out, statuses)
+	}
+	return printStatusTable(out, statuses)
+}
+
+// getServiceStatus reads the version of every service in every stage of the shipyard: the stage in which deployments
+// are triggered runs the version on the deployment branch, the other stages the version last promoted into their stage
+// branch
+func getServiceStatus(repository *git.Repository, deploymentBranch string, layout stageLayout, serviceFilter string) ([]ServiceStatus, error) {
+	shipyardConfig, err := readShipyardConfig(repository)
+	if err != nil {
+		return nil, err
+	}
+
+	operatorConfig := KeptnConfig{}
+	operatorFile, err := readBranchFile(repository, deploymentBranch, filepath.Join(".keptn", "config.yaml"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(operatorFile, &operatorConfig); err != nil {
+		return nil, fmt.Errorf("Could not unmarshal operator config")
+	}
+
+	deploymentBranchName := deploymentBranch
+	if deploymentBranchName == "" {
+		head, err := repository.Head()
+		if err != nil {
+			return nil, fmt.Errorf("Could not get head: %v", err)
+		}
+		deploymentBranchName = head.Name().Short()
+	}
+
+	statuses := []ServiceStatus{}
+	foundService := false
+	for _, service := range operatorConfig.Services {
+		if serviceFilter != "" && service.Name != serviceFilter {
+			continue
+		}
+		foundService = true
+
+		for _, stage := range shipyardConfig.Spec.Stages {
+			var status ServiceStatus
+			if stage.Name == triggerStage(service.DeploymentTrigger) {
+				status, err = getDeployedStatus(repository, deploymentBranch, service.Name)
+				status.Branch = deploymentBranchName
+			} else {
+				status, err = getPromotedStatus(repository, layout, stage.Name, service.Name)
+			}
+			if err != nil {
+				return nil, err
+			}
+			status.Service = service.Name
+			status.Stage = stage.Name
+			statuses = append(statuses, status)
+		}
+	}
+
+	if serviceFilter != "" && !foundService {
+		return nil, fmt.Errorf("Could not find service '%v' in .keptn/config.yaml", serviceFilter)
+	}
+	return statuses, nil
+}
+
+// triggerStage returns the stage of a trigger event like sh.keptn.event.<stage>.<sequence>.triggered
+func triggerStage(deploymentTrigger string) string {
+	parts := strings.Split(deploymentTrigger, ".")
+	if len(parts) != 6 {
+		return ""
+	}
+	return parts[3]
+}
+
+// getDeployedStatus reads the deployment metadata of the service on the deployment branch, the date is the date of the
+// version tag
+func getDeployedStatus(repository *git.Repository, deploymentBranch string, service string) (ServiceStatus, error) {
+	manifest, err := readDeploymentManifest(repository, deploymentBranch, path.Join("base", service))
+	if err != nil || manifest == nil {
+		return ServiceStatus{}, err
+	}
+
+	status := ServiceStatus{
+		Version: manifest.Metadata.ImageVersion,
+		Commit:  manifest.Metadata.GitCommit,
+		Author:  manifest.Metadata.Author,
+	}
+	if date, err := tagDate(repository, service+"-"+manifest.Metadata.ImageVersion); err == nil {
+		status.Date = &date
+	}
+	return status, nil
+}
+
+// getPromotedStatus reads the last promotion of the service from its promotion history in the stage branch
+func getPromotedStatus(repository *git.Repository, layout stageLayout, stage string, service string) (ServiceStatus, error) {
+	branch, serviceDir, err := layout.serviceLocation(stage, service)
+	if err != nil {
+		return ServiceStatus{}, err
+	}
+	status := ServiceStatus{Branch: branch}
+
+	history, err := readPromotionHistory(repository, layout, stage, service)
+	if err != nil || len(history.Promotions) == 0 {
+		return status, err
+	}
+
+	last := history.Promotions[len(history.Promotions)-1]
+	status.Version = last.Version
+	status.Date = &last.Timestamp
+
+	// the deployment metadata is promoted together with the base of the service
+	manifest, err := readDeploymentManifest(repository, branch, serviceDir)
+	if err != nil {
+		return ServiceStatus{}, err
+	}
+	if manifest != nil {
+		status.Commit = manifest.Metadata.GitCommit
+		status.Author = manifest.Metadata.Author
+	}
+	return status, nil
+}
+
+// serviceLocation returns the stage branch and the directory of the service in it
+func (layout stageLayout) serviceLocation(stage string, service string) (string, string, error) {
+	branch, err := executeStageTemplate(layout.Branch, stage)
+	if err != nil {
+		return "", "", err
+	}
+	directory, err := executeStageTemplate(layout.Directory, stage)
+	if err != nil {
+		return "", "", err
+	}
+	return branch, path.Join(directory, service), nil
+}
+
+// readPromotionHistory returns an empty history if the service was never promoted into the stage
+func readPromotionHistory(repository *git.Repository, layout stageLayout, stage string, service string) (promotionHistory, error) {
+	history := promotionHistory{}
+	branch, serviceDir, err := layout.serviceLocation(stage, service)
+	if err != nil {
+		return history, err
+	}
+
+	historyFile, err := readBranchFile(repository, branch, path.Join(serviceDir, promotionHistoryFile))
+	if os.IsNotExist(err) {
+		return history, nil
+	} else if err != nil {
+		return history, err
+	}
+	if err := yaml.Unmarshal(historyFile, &history); err != nil {
+		return history, fmt.Errorf("Could not unmarshal promotion history of %v in stage %v: %v", service, stage, err)
+	}
+	return history, nil
+}
+
+// readDeploymentManifest returns nil if there is no metadata/deployment.yaml in the service directory
+func readDeploymentManifest(repository *git.Repository, branch string, serviceDir string) (*DeploymentManifest, error) {
+	content, err := readBranchFile(repository, branch, path.Join(serviceDir, "metadata", "deployment.yaml"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	manifest := &DeploymentManifest{}
+	if err := yaml.Unmarshal(content, manifest); err != nil {
+		return nil, fmt.Errorf("Could not unmarshal deployment metadata in %v: %v", serviceDir, err)
+	}
+	return manifest, nil
+}
+
+// readBranchFile reads a file of a branch without checking it out, the default branch is read if branch is empty.
+// os.ErrNotExist is returned if the branch or the file does not exist.
+func readBranchFile(repository *git.Repository, branch string, file string) ([]byte, error) {
+	var reference *plumbing.Reference
+	var err error
+	if branch == "" {
+		reference, err = repository.Head()
+	} else {
+		reference, err = repository.Reference(plumbing.NewRemoteReferenceName("origin", branch), true)
+		if errors.Is(err, plumbing.ErrReferenceNotFound) {
+			reference, err = repository.Reference(plumbing.NewBranchReferenceName(branch), true)
+		}
+	}
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return nil, os.ErrNotExist
+	} else if err != nil {
+		return nil, fmt.Errorf("Could not resolve branch %v: %v", branch, err)
+	}
+
+	commit, err := repository.CommitObject(reference.Hash())
+	if err != nil {
+		return nil, fmt.Errorf("Could not get commit: %v", err)
+	}
+	treeFile, err := commit.File(filepath.ToSlash(file))
+	if errors.Is(err, object.ErrFileNotFound) {
+		return nil, os.ErrNotExist
+	} else if err != nil {
+		return nil, fmt.Errorf("Could not read %v: %v", file, err)
+	}
+
+	contents, err := treeFile.Contents()
+	if err != nil {
+		return nil, fmt.Errorf("Could not read %v: %v", file, err)
+	}
+	return []byte(contents), nil
+}
+
+// tagDate returns the date of an annotated tag or the commit date of a lightweight tag
+func tagDate(repository *git.Repository, tag string) (time.Time, error) {
+	reference, err := repository.Tag(tag)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if tagObject, err := repository.TagObject(reference.Hash()); err == nil {
+		return tagObject.Tagger.When, nil
+	}
+	commit, err := repository.CommitObject(reference.Hash())
+	if err != nil {
+		return time.Time{}, err
+	}
+	return commit.Committer.When, nil
+}
+
+func executeStageTemplate(text string, stage string) (string, error) {
+	tmpl, err := template.New("stage").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("Could not parse template %v: %v", text, err)
+	}
+	result := &bytes.Buffer{}
+	if err := tmpl.Execute(result, struct{ Stage string }{Stage: stage}); err != nil {
+		return "", fmt.Errorf("Could not execute template %v: %v", text, err)
+	}
+	return result.String(), nil
+}
+
+func printStatusJSON(out io.Writer, statuses []ServiceStatus) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(statuses)
+}
+
+func printStatusTable(out io.Writer, statuses []ServiceStatus) error {
+	writer := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "SERVICE\tSTAGE\tVERSION\tCOMMIT\tAUTHOR\tDATE\tBRANCH")
+	for _, status := range statuses {
+		date := ""
+		if status.Date != nil {
+			date = status.Date.UTC().Format(time.RFC3339)
+		}
+		commit := status.Commit
+		if len(commit) > 12 {
+			commit = commit[:12]
+		}
+		fmt.Fprintf(writer, "%v\t%v\t%v\t%v\t%v\t%v\t%v\n", status.Service, status.Stage, orDash(status.Version),
+			orDash(commit), orDash(status.Author), orDash(date), status.Branch)
+	}
+	return writer.Flush()
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+func NewStatusCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: `Show which version of each service runs in which stage`,
+		Long: `Reads the keptn configuration repository without changing it and prints the version, source commit,
+author and date of every service in every stage of the shipyard.
+
+The stage in which deployments are triggered runs the version on the deployment branch, the other stages
+the version last promoted into their stage branch by the promotion-service.
+
+All flags can also be set with environment variables instead e.g.
+* --output json or
+* export OUTPUT=json`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runStatus(cmd.OutOrStdout())
+		},
+	}
+
+	statusParams = &StatusCmdParams{}
+	statusParams.Workspace = cmd.Flags().StringP("workspace", "w", "", "The path to the directory where the .keptn directory resides in, used to find the deployment branch")
+	statusParams.Service = cmd.Flags().StringP("service", "s", "", "Show only this service")
+	statusParams.DeploymentBranch = cmd.Flags().String("deployment-branch", "", "The branch deployments are pushed to, overwrites the deployment_branch of the ci_config.yaml")
+	statusParams.StageBranch = cmd.Flags().String("stage-branch", "{{ .Stage }}", "The template of the stage branches written by the promotion-service")
+	statusParams.StageDirectory = cmd.Flags().String("stage-directory", "", "The template of the directory containing the services in the stage branches")
+	statusParams.Output = cmd.Flags().StringP("output", "o", OutputTable, "The output format, table or json")
+
+	prepareGitRepoCmd(&statusParams.Repository, cmd)
+
+	return cmd
+}
+
+func init() {
+	rootCmd.AddCommand(NewStatusCmd())
+}
@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"gotest.tools/assert"
+)
+
+const statusShipyardConfig = `
+spec:
+  stages:
+    - name: "dev"
+    - name: "staging"
+    - name: "prod"
+`
+
+const statusOperatorConfig = `
+services:
+- name: "carts"
+  triggerevent: "sh.keptn.event.dev.delivery.triggered"
+- name: "orders"
+  triggerevent: "sh.keptn.event.dev.delivery.triggered"
+`
+
+const statusCartsMetadata = `
+metadata:
+  imageVersion: "1.2.0"
+  gitCommit: "3f1c2e9a7b5d4c3e2f1a0b9c8d7e6f5a4b3c2d1e"
+  author: "jane@example.com"
+`
+
+const statusCartsStagingMetadata = `
+metadata:
+  imageVersion: "1.1.0"
+  gitCommit: "9e8d7c6b5a4f3e2d1c0b9a8f7e6d5c4b3a2f1e0d"
+  author: "john@example.com"
+`
+
+const statusCartsStagingHistory = `
+promotions:
+  - version: "1.0.0"
+    timestamp: 2021-09-01T10:00:00Z
+  - version: "1.1.0"
+    timestamp: 2021-09-02T12:30:00Z
+`
+
+var statusTagDate = time.Date(2021, 9, 3, 8, 0, 0, 0, time.UTC)
+
+// newStatusTestRepository creates a configuration repository with the deployment branch master and the stage branch staging
+func newStatusTestRepository(t *testing.T) *git.Repository {
+	fs := memfs.New()
+	repository, err := git.Init(memory.NewStorage(), fs)
+	assert.NilError(t, err)
+	w, err := repository.Worktree()
+	assert.NilError(t, err)
+
+	commit := func(files map[string]string, when time.Time) plumbing.Hash {
+		for file, content := range files {
+			assert.NilError(t, util.WriteFile(fs, file, []byte(content), 0644))
+			_, err := w.Add(file)
+			assert.NilError(t, err)
+		}
+		hash, err := w.Commit("update", &git.CommitOptions{Author: &object.Signature{Name: "jenkins", Email: "keptn@keptn.sh", When: when}})
+		assert.NilError(t, err)
+		return hash
+	}
+
+	hash := commit(map[string]string{
+		"shipyard.yaml":                       statusShipyardConfig,
+		".keptn/config.yaml":                  statusOperatorConfig,
+		"base/carts/metadata/deployment.yaml": statusCartsMetadata,
+		"base/carts/helm/carts/values.yaml":   "replicas: 1\n",
+	}, statusTagDate.Add(-time.Hour))
+	_, err = repository.CreateTag("carts-1.2.0", hash, &git.CreateTagOptions{
+		Tagger:  &object.Signature{Name: "Keptn CI-Connect CLI", Email: "ci-connect@keptn.sh", When: statusTagDate},
+		Message: "The Version carts-1.2.0",
+	})
+	assert.NilError(t, err)
+
+	assert.NilError(t, w.Checkout(&git.CheckoutOptions{Branch: plumbing.NewBranchReferenceName("staging"), Create: true}))
+	commit(map[string]string{
+		"carts/.promotion-history.yaml":  statusCartsStagingHistory,
+		"carts/metadata/deployment.yaml": statusCartsStagingMetadata,
+	}, statusTagDate)
+	assert.NilError(t, w.Checkout(&git.CheckoutOptions{Branch: plumbing.NewBranchReferenceName("master")}))
+
+	return repository
+}
+
+func TestGetServiceStatus(t *testing.T) {
+	repository := newStatusTestRepository(t)
+	stagingDate := time.Date(2021, 9, 2, 12, 30, 0, 0, time.UTC)
+
+	statuses, err := getServiceStatus(repository, "", stageLayout{Branch: "{{ .Stage }}"}, "")
+	assert.NilError(t, err)
+	assert.Equal(t, len(statuses), 6)
+
+	assert.Assert(t, statuses[0].Date.Equal(statusTagDate))
+	statuses[0].Date = nil
+	assert.DeepEqual(t, statuses[0], ServiceStatus{
+		Service: "carts",
+		Stage:   "dev",
+		Branch:  "master",
+		Version: "1.2.0",
+		Commit:  "3f1c2e9a7b5d4c3e2f1a0b9c8d7e6f5a4b3c2d1e",
+		Author:  "jane@example.com",
+	})
+	assert.DeepEqual(t, statuses[1], ServiceStatus{
+		Service: "carts",
+		Stage:   "staging",
+		Branch:  "staging",
+		Version: "1.1.0",
+		Commit:  "9e8d7c6b5a4f3e2d1c0b9a8f7e6d5c4b3a2f1e0d",
+		Author:  "john@example.com",
+		Date:    &stagingDate,
+	})
+	assert.DeepEqual(t, statuses[2], ServiceStatus{Service: "carts", Stage: "prod", Branch: "prod"})
+	assert.DeepEqual(t, statuses[3], ServiceStatus{Service: "orders", Stage: "dev", Branch: "master"})
+}
+
+func TestGetServiceStatus_Service(t *testing.T) {
+	repository := newStatusTestRepository(t)
+
+	statuses, err := getServiceStatus(repository, "", stageLayout{Branch: "{{ .Stage }}"}, "orders")
+	assert.NilError(t, err)
+	assert.Equal(t, len(statuses), 3)
+
+	_, err = getServiceStatus(repository, "", stageLayout{Branch: "{{ .Stage }}"}, "payment")
+	assert.Error(t, err, "Could not find service 'payment' in .keptn/config.yaml")
+}
+
+func TestGetServiceStatus_StageDirectory(t *testing.T) {
+	repository := newStatusTestRepository(t)
+
+	// the stage branch does not contain the services in stages-rendered/staging
+	statuses, err := getServiceStatus(repository, "", stageLayout{Branch: "{{ .Stage }}", Directory: "stages-rendered/{{ .Stage }}"}, "carts")
+	assert.NilError(t, err)
+	assert.Equal(t, statuses[1].Version, "")
+}
+
+func TestPrintStatus(t *testing.T) {
+	date := time.Date(2021, 9, 2, 12, 30, 0, 0, time.UTC)
+	statuses := []ServiceStatus{
+		{Service: "carts", Stage: "staging", Branch: "staging", Version: "1.1.0", Commit: "9e8d7c6b5a4f3e2d1c0b9a8f7e6d5c4b3a2f1e0d", Author: "john@example.com", Date: &date},
+		{Service: "carts", Stage: "prod", Branch: "prod"},
+	}
+
+	table := &bytes.Buffer{}
+	assert.NilError(t, printStatusTable(table, statuses))
+	lines := strings.Split(strings.TrimSpace(table.String()), "\n")
+	assert.Equal(t, len(lines), 3)
+	assert.Equal(t, strings.Join(strings.Fields(lines[1]), " "), "carts staging 1.1.0 9e8d7c6b5a4f john@example.com 2021-09-02T12:30:00Z staging")
+	assert.Equal(t, strings.Join(strings.Fields(lines[2]), " "), "carts prod - - - - prod")
+
+	output := &bytes.Buffer{}
+	assert.NilError(t, printStatusJSON(output, statuses))
+	parsed := []ServiceStatus{}
+	assert.NilError(t, json.Unmarshal(output.Bytes(), &parsed))
+	assert.DeepEqual(t, parsed, statuses)
+}
+
+func TestTriggerStage(t *testing.T) {
+	assert.Equal(t, triggerStage("sh.keptn.event.dev.delivery.triggered"), "dev")
+	assert.Equal(t, triggerStage(""), "")
+}
@@ -6,7 +6,9 @@ import (
 	"github.com/spf13/afero"
 	"io/ioutil"
 	"log"
+	"os"
 	"path"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -38,12 +40,32 @@ type StageConfig struct {
 }
 
 type SequenceConfig struct {
+	Name        string              `yaml:"name,omitempty"`
+	TriggeredOn []TriggeredOnConfig `yaml:"triggeredOn,omitempty"`
+	Tasks       []TaskConfig        `yaml:"tasks,omitempty"`
+}
+
+type TriggeredOnConfig struct {
+	Event    string         `yaml:"event,omitempty"`
+	Selector SelectorConfig `yaml:"selector,omitempty"`
+}
+
+type SelectorConfig struct {
+	Match map[string]string `yaml:"match,omitempty"`
+}
+
+type TaskConfig struct {
 	Name string `yaml:"name,omitempty"`
 }
 
 type DeploymentConfig struct {
-	Services  []ServiceConfig `yaml:"services"`
-	GitConfig GitConfig       `yaml:"git_config"`
+	APIVersion             string                       `yaml:"apiVersion"`
+	Kind                   string                       `yaml:"kind"`
+	Services               []ServiceConfig              `yaml:"services"`
+	GitConfig              GitConfig                    `yaml:"git_config"`
+	StageVariables         StageVariables               `yaml:"stage_variables,omitempty"`
+	DependencyRepositories []DependencyRepositoryConfig `yaml:"dependency_repositories,omitempty"`
+	SettingsConfig         `yaml:",inline"`
 }
 
 type DeploymentManifest struct {
@@ -51,26 +73,48 @@ type DeploymentManifest struct {
 }
 
 type DeploymentMetadata struct {
-	ImageVersion string `yaml:"imageVersion"`
-	GitCommit    string `yaml:"gitCommit"`
-	Author       string `yaml:"author"`
+	ImageVersion string          `yaml:"imageVersion"`
+	GitCommit    string          `yaml:"gitCommit"`
+	Author       string          `yaml:"author"`
+	Chart        *ChartReference `yaml:"chart,omitempty"`
 }
 
 type ServiceConfig struct {
-	ServiceName            string `yaml:"name"`
-	ChartBaseDirectory     string `yaml:"chart_base,omitempty"`
-	UpdateHelmDependencies bool   `yaml:"updateHelmDependencies,omitempty"`
-	UseChartVersion        bool   `yaml:"useChartVersion,omitempty"`
-	UseChartAppVersion     bool   `yaml:"useChartAppVersion,omitempty"`
-	IgnoreDuplicateGitTag  bool   `yaml:"ignoreDuplicateGitTag,omitempty"`
+	ServiceName            string         `yaml:"name"`
+	ChartBaseDirectory     string         `yaml:"chart_base,omitempty"`
+	UpdateHelmDependencies bool           `yaml:"update_helm_dependencies,omitempty"`
+	UseChartVersion        bool           `yaml:"use_chart_version,omitempty"`
+	UseChartAppVersion     bool           `yaml:"use_chart_app_version,omitempty"`
+	IgnoreDuplicateGitTag  bool           `yaml:"ignore_duplicate_git_tag,omitempty"`
+	StageVariables         StageVariables `yaml:"stage_variables,omitempty"`
+	ChartRepository        string         `yaml:"chart_repository,omitempty"`
+	SetChartVersion        bool           `yaml:"set_chart_version,omitempty"`
+	SetChartAppVersion     bool           `yaml:"set_chart_app_version,omitempty"`
+	SetVersionValues       []string       `yaml:"set_version_values,omitempty"`
 }
 
 type GitConfig struct {
 	UserEmail        string `yaml:"user_email"`
 	UserName         string `yaml:"user_name"`
+	TaggerEmail      string `yaml:"tagger_email,omitempty"`
+	TaggerName       string `yaml:"tagger_name,omitempty"`
 	DeploymentBranch string `yaml:"deployment_branch,omitempty"`
 }
 
+func (gitConfig GitConfig) getTaggerName() string {
+	if gitConfig.TaggerName == "" {
+		return "Keptn CI-Connect CLI"
+	}
+	return gitConfig.TaggerName
+}
+
+func (gitConfig GitConfig) getTaggerEmail() string {
+	if gitConfig.TaggerEmail == "" {
+		return "ci-connect@keptn.sh"
+	}
+	return gitConfig.TaggerEmail
+}
+
 type TriggerDeployCmdParams struct {
 	BaseDirectory string
 	Workspace     *string
@@ -80,7 +124,12 @@ type TriggerDeployCmdParams struct {
 	Sequence      *string
 	Stage         *string
 	DryRun        *bool
+	Wait          *time.Duration
+	Project       *string
 	Repository    gitRepositoryConfig
+	KeptnAPI      keptnAPIConfig
+	Charts        chartRepositoryConfig
+	Dependencies  dependencyConfig
 }
 
 type KeptnConfig struct {
@@ -152,10 +201,26 @@ func (deployment *deploymentImpl) RunDeployment() error {
 				ignoreDuplicateGitTag = service.IgnoreDuplicateGitTag
 			}
 		}
+		// the datastore filters on the time of the Keptn API, which may differ from the local clock
+		pushed := time.Now().Add(-time.Minute)
 		err = triggerDeployParams.Repository.CommitAndPushGitRepo(repoDeploy, conf, gitCommitOptions, ignoreDuplicateGitTag)
 		if err != nil {
 			return err
 		}
+
+		if *triggerDeployParams.Wait > 0 {
+			shipyardConfig, err := readShipyardConfigFromFile(fsMain, dirMain)
+			if err != nil {
+				return err
+			}
+			commit, _, err := getWorkspaceCommit()
+			if err != nil {
+				return err
+			}
+			labels := map[string]string{"version": *triggerDeployParams.Version, "sourceGitHash": commit}
+			return waitForDeployment(os.Stdout, triggerDeployParams.KeptnAPI.newKeptnAPI(), shipyardConfig, *triggerDeployParams.Project,
+				*triggerDeployParams.Service, stageSequence{Stage: stage, Sequence: sequence}, labels, pushed, *triggerDeployParams.Wait)
+		}
 	} else {
 		fmt.Println("Would Perform Git Update Now")
 	}
@@ -177,6 +242,9 @@ All flags can also be set with environment variables instead e.g.
 * --workspace <workspace> or 
 * export WORKSPACE=<workspace>`,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if *triggerDeployParams.Wait > 0 && (*triggerDeployParams.Project == "" || *triggerDeployParams.KeptnAPI.endpoint == "" || *triggerDeployParams.KeptnAPI.token == "") {
+				return fmt.Errorf("--project, --keptn-api and --keptn-api-token are required with --wait")
+			}
 			triggerDeployParams.BaseDirectory = path.Join(*triggerDeployParams.Workspace, ".keptn")
 			deploymentRepetitions := 0
 			err := deployment.RunDeployment()
@@ -202,6 +270,8 @@ All flags can also be set with environment variables instead e.g.
 	triggerDeployParams.Stage = cmd.Flags().StringP("stage", "g", "", "Which stage should the triggerevent use, overwrites value from shipyard config")
 	triggerDeployParams.Sequence = cmd.Flags().StringP("sequence", "q", "", "Which sequence should the triggerevent use, overwrites value from shipyard config")
 	triggerDeployParams.DryRun = cmd.Flags().BoolP("dry-run", "d", false, "Perform a dry-run")
+	triggerDeployParams.Wait = cmd.Flags().Duration("wait", 0, "Wait up to this duration for the deployment in all stages and fail if it failed, e.g. 30m")
+	triggerDeployParams.Project = cmd.Flags().StringP("project", "p", "", "The keptn project, required with --wait")
 
 	err := cmd.MarkFlagRequired("service")
 	if err != nil {
@@ -214,6 +284,14 @@ All flags can also be set with environment variables instead e.g.
 	}
 
 	prepareGitRepoCmd(&triggerDeployParams.Repository, cmd)
+	prepareKeptnAPICmd(&triggerDeployParams.KeptnAPI, cmd, false)
+
+	triggerDeployParams.Charts.user = cmd.Flags().String("chart-repository-user", "", "The user of the chart repository the charts of services with a chart_repository are pushed to")
+	triggerDeployParams.Charts.password = cmd.Flags().String("chart-repository-password", "", "The password or token of the chart repository")
+	triggerDeployParams.Charts.plainHTTP = cmd.Flags().Bool("plain-http", false, "Use HTTP instead of HTTPS for an oci:// chart repository, e.g. a local registry")
+	triggerDeployParams.Charts.published = map[string]*ChartReference{}
+	triggerDeployParams.Dependencies.offline = cmd.Flags().Bool("offline", false, "Do not fetch helm dependencies, fail if they are neither vendored in the charts directory nor cached")
+	triggerDeployParams.Dependencies.cacheDir = cmd.Flags().String("dependency-cache", "", "Directory in which fetched helm dependencies are cached")
 
 	return cmd
 }
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// stageSequence is a sequence of a stage in the shipyard
+type stageSequence struct {
+	Stage    string
+	Sequence string
+}
+
+// chainedSequences returns the sequences which Keptn triggers when the sequence finished with the given result, e.g.
+// the delivery into the next stage
+func chainedSequences(shipyardConfig ShipyardConfig, finished stageSequence, data KeptnEventData) []stageSequence {
+	finishedEvent := fmt.Sprintf("%v.%v.finished", finished.Stage, finished.Sequence)
+	fields := map[string]string{"result": data.Result, "status": data.Status}
+
+	chained := []stageSequence{}
+	for _, stage := range shipyardConfig.Spec.Stages {
+		for _, sequence := range stage.Sequences {
+			for _, trigger := range sequence.TriggeredOn {
+				if trigger.Event != finishedEvent || !selectorMatches(trigger.Selector, fields) {
+					continue
+				}
+				chained = append(chained, stageSequence{Stage: stage.Name, Sequence: sequence.Name})
+				break
+			}
+		}
+	}
+	return chained
+}
+
+func selectorMatches(selector SelectorConfig, fields map[string]string) bool {
+	for name, value := range selector.Match {
+		if !strings.EqualFold(fields[name], value) {
+			return false
+		}
+	}
+	return true
+}
+
+// waitForDeployment waits for the sequence the git-operator triggers for the pushed version and for all sequences
+// chained to it, prints the result of every stage and returns an error if any sequence failed
+func waitForDeployment(out io.Writer, api *keptnAPI, shipyardConfig ShipyardConfig, project string, service string, first stageSequence, labels map[string]string, since time.Time, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+
+	fmt.Fprintf(out, "Waiting up to %v for sequence %v in stage %v of %v\n", timeout, first.Sequence, first.Stage, service)
+	triggered, err := api.FindTriggeredSequence(project, first.Stage, first.Sequence, service, labels, since, deadline)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Sequence %v in stage %v was triggered, Keptn context %v\n", first.Sequence, first.Stage, triggered.KeptnContext)
+
+	failed := []string{}
+	pending := []stageSequence{first}
+	for len(pending) > 0 {
+		current := pending[0]
+		pending = pending[1:]
+
+		finished, err := api.WaitForSequence(project, current.Stage, current.Sequence, triggered.KeptnContext, deadline)
+		if err != nil {
+			return err
+		}
+		outcome, err := sequenceOutcome(current.Sequence, finished)
+		fmt.Fprintln(out, outcome)
+		if err != nil {
+			failed = append(failed, current.Stage)
+		}
+
+		pending = append(pending, chainedSequences(shipyardConfig, current, finished.Data)...)
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("Deployment of %v failed in stage %v", service, strings.Join(failed, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+	"gotest.tools/assert"
+)
+
+const chainedShipyardConfig = `
+spec:
+  stages:
+    - name: "dev"
+      sequences:
+        - name: "delivery"
+    - name: "staging"
+      sequences:
+        - name: "delivery"
+          triggeredOn:
+            - event: "dev.delivery.finished"
+        - name: "rollback"
+          triggeredOn:
+            - event: "staging.delivery.finished"
+              selector:
+                match:
+                  result: fail
+    - name: "prod"
+      sequences:
+        - name: "delivery"
+          triggeredOn:
+            - event: "staging.delivery.finished"
+              selector:
+                match:
+                  result: pass
+`
+
+func newChainedShipyardConfig(t *testing.T) ShipyardConfig {
+	shipyardConfig := ShipyardConfig{}
+	assert.NilError(t, yaml.Unmarshal([]byte(chainedShipyardConfig), &shipyardConfig))
+	return shipyardConfig
+}
+
+func TestChainedSequences(t *testing.T) {
+	shipyardConfig := newChainedShipyardConfig(t)
+
+	chained := chainedSequences(shipyardConfig, stageSequence{Stage: "dev", Sequence: "delivery"}, KeptnEventData{Result: "fail"})
+	assert.DeepEqual(t, chained, []stageSequence{{Stage: "staging", Sequence: "delivery"}})
+
+	chained = chainedSequences(shipyardConfig, stageSequence{Stage: "staging", Sequence: "delivery"}, KeptnEventData{Result: "pass"})
+	assert.DeepEqual(t, chained, []stageSequence{{Stage: "prod", Sequence: "delivery"}})
+
+	chained = chainedSequences(shipyardConfig, stageSequence{Stage: "staging", Sequence: "delivery"}, KeptnEventData{Result: "fail"})
+	assert.DeepEqual(t, chained, []stageSequence{{Stage: "staging", Sequence: "rollback"}})
+
+	chained = chainedSequences(shipyardConfig, stageSequence{Stage: "prod", Sequence: "delivery"}, KeptnEventData{Result: "pass"})
+	assert.Equal(t, len(chained), 0)
+}
+
+func TestWaitForDeployment(t *testing.T) {
+	labels := map[string]string{"version": "1.2.0", "sourceGitHash": "3f1c2e9"}
+	triggered := func(version string, keptnContext string) KeptnEvent {
+		return KeptnEvent{
+			Type:         sequenceEventType("dev", "delivery", "triggered"),
+			KeptnContext: keptnContext,
+			Data:         KeptnEventData{Project: "sockshop", Stage: "dev", Service: "carts", Labels: map[string]string{"version": version, "sourceGitHash": "3f1c2e9"}},
+		}
+	}
+
+	tests := []struct {
+		name        string
+		events      []KeptnEvent
+		wantErr     string
+		wantOutcome []string
+	}{
+		{
+			name: "all stages passed",
+			events: []KeptnEvent{
+				triggered("1.1.0", "other-context"),
+				triggered("1.2.0", "my-context"),
+				newTestFinishedEvent("dev", "delivery", "pass"),
+				newTestFinishedEvent("staging", "delivery", "pass"),
+				newTestFinishedEvent("prod", "delivery", "pass"),
+			},
+			wantOutcome: []string{
+				"Sequence delivery in stage dev finished with result pass, status succeeded",
+				"Sequence delivery in stage staging finished with result pass, status succeeded",
+				"Sequence delivery in stage prod finished with result pass, status succeeded",
+			},
+		},
+		{
+			name: "evaluation failed",
+			events: []KeptnEvent{
+				triggered("1.2.0", "my-context"),
+				newTestFinishedEvent("dev", "delivery", "pass"),
+				newTestFinishedEvent("staging", "delivery", "fail"),
+				newTestFinishedEvent("staging", "rollback", "pass"),
+			},
+			wantErr: "Deployment of carts failed in stage staging",
+			wantOutcome: []string{
+				"Sequence delivery in stage dev finished with result pass, status succeeded",
+				"Sequence delivery in stage staging finished with result fail, status succeeded",
+				"Sequence rollback in stage staging finished with result pass, status succeeded",
+			},
+		},
+		{
+			name:    "not triggered",
+			events:  []KeptnEvent{triggered("1.1.0", "other-context")},
+			wantErr: "Sequence delivery in stage dev was not triggered for carts in time",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api, _, closeServer := newTestKeptnAPI(t, 1, tt.events...)
+			defer closeServer()
+
+			out := &bytes.Buffer{}
+			err := waitForDeployment(out, api, newChainedShipyardConfig(t), "sockshop", "carts", stageSequence{Stage: "dev", Sequence: "delivery"},
+				labels, time.Now().Add(-time.Minute), 100*time.Millisecond)
+			if tt.wantErr != "" {
+				assert.Error(t, err, tt.wantErr)
+			} else {
+				assert.NilError(t, err)
+			}
+
+			outcome := []string{}
+			for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+				if strings.HasPrefix(line, "Sequence ") && strings.Contains(line, " finished ") {
+					outcome = append(outcome, line)
+				}
+			}
+			if len(tt.wantOutcome) > 0 {
+				assert.DeepEqual(t, outcome, tt.wantOutcome)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2" // make sure to use v2 cloudevents here
+	"github.com/keptn-sandbox/keptn-git-toolbox/promotion-service/config"
+	"github.com/keptn-sandbox/keptn-git-toolbox/promotion-service/deadletter"
+	"github.com/keptn-sandbox/keptn-git-toolbox/promotion-service/git"
+)
+
+// TokenHeader is the header containing the Keptn API token
+const TokenHeader = "x-token"
+
+// Promoter runs a promotion.triggered event through the same flow as events received from Keptn
+type Promoter func(ctx context.Context, event cloudevents.Event) error
+
+// API serves the REST API of the promotion-service:
+//
+//	GET  /projects/{project}/stages/{stage}/services/{service}          currently promoted version
+//	POST /projects/{project}/stages/{stage}/services/{service}          request a promotion
+//	GET  /projects/{project}/stages/{stage}/services/{service}/history  promotion history
+//	GET  /deadletters                                                   failed promotions
+//	GET  /deadletters/{id}                                              failed promotion
+//	POST /deadletters/{id}/replay                                       promote the failed promotion again
+//	DELETE /deadletters/{id}                                            discard the failed promotion
+//
+// All requests have to be authenticated with the Keptn API token in the x-token header.
+type API struct {
+	GitHandler git.GitHandlerInterface
+	// Namespace contains the git credentials of the projects
+	Namespace string
+	// Token is the Keptn API token, all requests are rejected if empty
+	Token string
+	// KeptnAPI receives manually requested promotions, which are delivered back to the service by Keptn in a Keptn
+	// context. Promotions are run by Promote if nil, their context is only known to the promotion history then.
+	KeptnAPI EventSender
+	// Promote runs manually requested promotions without KeptnAPI and replayed dead letters
+	Promote Promoter
+	// ConfigLoader reads the promotion.yaml of services to find their directory in the stage branches, the directory
+	// is the name of the service if nil
+	ConfigLoader config.Loader
+	// StageLayout defines the stage branches of projects which don't declare the stages in their promotion.yaml
+	StageLayout git.StageLayout
+	// DeadLetters are the failed promotions which can be replayed, the /deadletters endpoints respond with 404 if nil
+	DeadLetters deadletter.Store
+}
+
+type errorResponse struct {
+	Message string `json:"message"`
+}
+
+func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !a.authenticated(r) {
+		writeError(w, http.StatusUnauthorized, "Invalid or missing Keptn API token")
+		return
+	}
+
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if "/"+segments[0] == DeadLettersPath && len(segments) <= 3 {
+		id, resource := "", ""
+		if len(segments) > 1 {
+			id = segments[1]
+		}
+		if len(segments) > 2 {
+			resource = segments[2]
+		}
+		a.serveDeadLetters(w, r, id, resource)
+		return
+	}
+
+	if (len(segments) != 6 && len(segments) != 7) || segments[0] != "projects" || segments[2] != "stages" || segments[4] != "services" {
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	resource := ""
+	if len(segments) == 7 {
+		resource = segments[6]
+	}
+	a.serveService(w, r, segments[1], segments[3], segments[5], resource)
+}
+
+func (a *API) serveService(w http.ResponseWriter, r *http.Request, project string, stage string, service string, resource string) {
+	if project == "" || stage == "" || service == "" {
+		writeError(w, http.StatusBadRequest, "Project, stage and service are required")
+		return
+	}
+
+	switch {
+	case resource == "" && r.Method == http.MethodGet:
+		a.getStatus(r.Context(), w, project, stage, service)
+	case resource == "" && r.Method == http.MethodPost:
+		a.postPromotion(w, r, project, stage, service)
+	case resource == "history" && r.Method == http.MethodGet:
+		a.getHistory(r.Context(), w, project, stage, service)
+	case resource == "" || resource == "history":
+		writeError(w, http.StatusMethodNotAllowed, "Method "+r.Method+" is not allowed")
+	default:
+		writeError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+func (a *API) authenticated(r *http.Request) bool {
+	if a.Token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(r.Header.Get(TokenHeader)), []byte(a.Token)) == 1
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("Could not write response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, errorResponse{Message: message})
+}
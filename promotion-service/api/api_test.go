@@ -0,0 +1,96 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestAPI_Authentication(t *testing.T) {
+	tests := []struct {
+		name       string
+		apiToken   string
+		token      string
+		wantStatus int
+	}{
+		{
+			name:       "valid token",
+			apiToken:   testToken,
+			token:      testToken,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "invalid token",
+			apiToken:   testToken,
+			token:      "other-token",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "missing token",
+			apiToken:   testToken,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "no token configured",
+			apiToken:   "",
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestAPI(readTestHistory)
+			a.Token = tt.apiToken
+
+			request := httptest.NewRequest(http.MethodGet, "/projects/sockshop/stages/prod/services/carts/history", nil)
+			if tt.token != "" {
+				request.Header.Set(TokenHeader, tt.token)
+			}
+			recorder := httptest.NewRecorder()
+			a.ServeHTTP(recorder, request)
+
+			assert.Equal(t, recorder.Code, tt.wantStatus)
+		})
+	}
+}
+
+func TestAPI_Routing(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		url        string
+		wantStatus int
+	}{
+		{
+			name:       "unknown path",
+			method:     http.MethodGet,
+			url:        "/projects/sockshop/stages/prod",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "unknown resource",
+			method:     http.MethodGet,
+			url:        "/projects/sockshop/stages/prod/services/carts/logs",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "method not allowed",
+			method:     http.MethodDelete,
+			url:        "/projects/sockshop/stages/prod/services/carts",
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:       "history cannot be posted",
+			method:     http.MethodPost,
+			url:        "/projects/sockshop/stages/prod/services/carts/history",
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := serveTestRequest(newTestAPI(readTestHistory), tt.method, tt.url, "")
+			assert.Equal(t, recorder.Code, tt.wantStatus)
+		})
+	}
+}
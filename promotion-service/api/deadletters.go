@@ -0,0 +1,102 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/keptn-sandbox/keptn-git-toolbox/promotion-service/deadletter"
+)
+
+// DeadLettersPath is the path under which failed promotions are served, e.g. GET /deadletters
+const DeadLettersPath = "/deadletters"
+
+func (a *API) serveDeadLetters(w http.ResponseWriter, r *http.Request, id string, resource string) {
+	if a.DeadLetters == nil {
+		writeError(w, http.StatusNotFound, "Failed promotions are not recorded")
+		return
+	}
+
+	switch {
+	case id == "" && resource == "" && r.Method == http.MethodGet:
+		a.listDeadLetters(w)
+	case id != "" && resource == "" && r.Method == http.MethodGet:
+		a.getDeadLetter(w, id)
+	case id != "" && resource == "" && r.Method == http.MethodDelete:
+		a.deleteDeadLetter(w, id)
+	case id != "" && resource == "replay" && r.Method == http.MethodPost:
+		a.replayDeadLetter(w, id)
+	case resource == "" || resource == "replay":
+		writeError(w, http.StatusMethodNotAllowed, "Method "+r.Method+" is not allowed")
+	default:
+		writeError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+func (a *API) listDeadLetters(w http.ResponseWriter) {
+	entries, err := a.DeadLetters.List()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Could not read failed promotions: "+err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+// readDeadLetter writes an error response and returns nil if the entry could not be read
+func (a *API) readDeadLetter(w http.ResponseWriter, id string) *deadletter.Entry {
+	entry, err := a.DeadLetters.Get(id)
+	if err == deadletter.ErrNotFound {
+		writeError(w, http.StatusNotFound, err.Error())
+		return nil
+	} else if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return nil
+	}
+	return entry
+}
+
+func (a *API) getDeadLetter(w http.ResponseWriter, id string) {
+	if entry := a.readDeadLetter(w, id); entry != nil {
+		writeJSON(w, http.StatusOK, entry)
+	}
+}
+
+func (a *API) deleteDeadLetter(w http.ResponseWriter, id string) {
+	err := a.DeadLetters.Delete(id)
+	if err == deadletter.ErrNotFound {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	} else if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	log.Printf("Failed promotion %v deleted", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *API) replayDeadLetter(w http.ResponseWriter, id string) {
+	entry := a.readDeadLetter(w, id)
+	if entry == nil {
+		return
+	}
+
+	keptnContext := ""
+	if extension, err := entry.Event.Context.GetExtension("shkeptncontext"); err == nil {
+		keptnContext, _ = extension.(string)
+	}
+
+	log.Printf("Replay of failed promotion %v of %v/%v into stage %v requested", id, entry.Project, entry.Service, entry.Stage)
+
+	// the entry is removed once the promotion succeeds, or updated if it fails again
+	go func() {
+		if err := a.Promote(context.Background(), entry.Event); err != nil {
+			log.Printf("Replay of failed promotion %v failed: %v", id, err)
+		}
+	}()
+
+	writeJSON(w, http.StatusAccepted, PromotionResponse{
+		KeptnContext: keptnContext,
+		TriggeredID:  entry.Event.ID(),
+	})
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2" // make sure to use v2 cloudevents here
+	"github.com/keptn-sandbox/keptn-git-toolbox/promotion-service/deadletter"
+	"gotest.tools/assert"
+)
+
+func newTestDeadLetterAPI(t *testing.T) (*API, func()) {
+	dir, err := ioutil.TempDir("", "test_api_dead_letters")
+	assert.NilError(t, err)
+
+	a := newTestAPI(readTestHistory)
+	a.DeadLetters = &deadletter.FileStore{Dir: dir}
+
+	event, err := newPromotionTriggeredEvent("my-context", "sockshop", "prod", "carts", map[string]string{"version": "3"})
+	assert.NilError(t, err)
+	event.SetID("event-1")
+	assert.NilError(t, deadletter.Record(a.DeadLetters, event, errors.New("Could not push prod: timeout"), 2))
+
+	return a, func() { os.RemoveAll(dir) }
+}
+
+func TestAPI_DeadLetters(t *testing.T) {
+	a, cleanup := newTestDeadLetterAPI(t)
+	defer cleanup()
+
+	recorder := serveTestRequest(a, http.MethodGet, "/deadletters", "")
+	assert.Equal(t, recorder.Code, http.StatusOK)
+	entries := []deadletter.Entry{}
+	assert.NilError(t, json.Unmarshal(recorder.Body.Bytes(), &entries))
+	assert.Equal(t, len(entries), 1)
+	assert.Equal(t, entries[0].ID, "event-1")
+	assert.Equal(t, entries[0].Service, "carts")
+	assert.Equal(t, entries[0].Attempts, 2)
+	assert.Equal(t, entries[0].Error, "Could not push prod: timeout")
+
+	recorder = serveTestRequest(a, http.MethodGet, "/deadletters/event-1", "")
+	assert.Equal(t, recorder.Code, http.StatusOK)
+	entry := deadletter.Entry{}
+	assert.NilError(t, json.Unmarshal(recorder.Body.Bytes(), &entry))
+	assert.Equal(t, entry.Event.ID(), "event-1")
+
+	recorder = serveTestRequest(a, http.MethodGet, "/deadletters/event-2", "")
+	assert.Equal(t, recorder.Code, http.StatusNotFound)
+
+	recorder = serveTestRequest(a, http.MethodPut, "/deadletters/event-1", "")
+	assert.Equal(t, recorder.Code, http.StatusMethodNotAllowed)
+
+	recorder = serveTestRequest(a, http.MethodDelete, "/deadletters/event-1", "")
+	assert.Equal(t, recorder.Code, http.StatusNoContent)
+	recorder = serveTestRequest(a, http.MethodDelete, "/deadletters/event-1", "")
+	assert.Equal(t, recorder.Code, http.StatusNotFound)
+}
+
+func TestAPI_DeadLetters_Replay(t *testing.T) {
+	a, cleanup := newTestDeadLetterAPI(t)
+	defer cleanup()
+
+	events := make(chan cloudevents.Event, 1)
+	a.Promote = func(ctx context.Context, event cloudevents.Event) error {
+		events <- event
+		return nil
+	}
+
+	recorder := serveTestRequest(a, http.MethodPost, "/deadletters/event-1/replay", "")
+	assert.Equal(t, recorder.Code, http.StatusAccepted)
+	response := &PromotionResponse{}
+	assert.NilError(t, json.Unmarshal(recorder.Body.Bytes(), response))
+	assert.DeepEqual(t, response, &PromotionResponse{KeptnContext: "my-context", TriggeredID: "event-1"})
+
+	select {
+	case event := <-events:
+		assert.Equal(t, event.ID(), "event-1")
+	case <-time.After(5 * time.Second):
+		t.Fatal("Promotion was not replayed")
+	}
+
+	recorder = serveTestRequest(a, http.MethodPost, "/deadletters/event-2/replay", "")
+	assert.Equal(t, recorder.Code, http.StatusNotFound)
+}
+
+func TestAPI_DeadLetters_Disabled(t *testing.T) {
+	a := newTestAPI(readTestHistory)
+
+	recorder := serveTestRequest(a, http.MethodGet, "/deadletters", "")
+	assert.Equal(t, recorder.Code, http.StatusNotFound)
+}
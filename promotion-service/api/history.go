@@ -0,0 +1,152 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path"
+
+	"github.com/keptn-sandbox/keptn-git-toolbox/promotion-service/git"
+	"gopkg.in/yaml.v3"
+)
+
+// deploymentFile is the deployment metadata the ci-connect-cli writes into the service directory
+const deploymentFile = "metadata/deployment.yaml"
+
+// StatusResponse is the currently promoted version of a service in a stage
+type StatusResponse struct {
+	Project string `json:"project"`
+	Stage   string `json:"stage"`
+	Service string `json:"service"`
+	Version string `json:"version"`
+	// Promotion is the last entry of the promotion history, nil if the version is taken from the deployment metadata
+	Promotion *git.HistoryEntry `json:"promotion,omitempty"`
+}
+
+// deploymentManifest is the part of the deployment metadata containing the deployed version
+type deploymentManifest struct {
+	Metadata struct {
+		ImageVersion string `yaml:"imageVersion"`
+	} `yaml:"metadata"`
+}
+
+// serviceLocation is the location of a service in the stage branch
+type serviceLocation struct {
+	credentials git.GitCredentials
+	branch      string
+	serviceDir  string
+}
+
+func (a *API) getStatus(ctx context.Context, w http.ResponseWriter, project string, stage string, service string) {
+	location, ok := a.serviceLocation(ctx, w, project, stage, service)
+	if !ok {
+		return
+	}
+	history, ok := a.readHistory(w, location, project, stage, service)
+	if !ok {
+		return
+	}
+
+	status := StatusResponse{
+		Project: project,
+		Stage:   stage,
+		Service: service,
+	}
+	if len(history.Promotions) > 0 {
+		latest := history.Promotions[len(history.Promotions)-1]
+		status.Version = latest.Version
+		status.Promotion = &latest
+		writeJSON(w, http.StatusOK, status)
+		return
+	}
+
+	// stage branches written before the promotion history was introduced only contain the deployment metadata
+	content, err := a.GitHandler.ReadFile(location.credentials, location.branch, path.Join(location.serviceDir, deploymentFile))
+	if os.IsNotExist(err) {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("No promotion of service %v into stage %v recorded", service, stage))
+		return
+	} else if err != nil {
+		log.Printf("Could not read deployment metadata of %v/%v in stage %v: %v", project, service, stage, err)
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("Could not read deployment metadata: %v", err))
+		return
+	}
+
+	manifest := deploymentManifest{}
+	if err := yaml.Unmarshal(content, &manifest); err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("Could not parse deployment metadata: %v", err))
+		return
+	}
+	if manifest.Metadata.ImageVersion == "" {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("No version of service %v in stage %v recorded", service, stage))
+		return
+	}
+	status.Version = manifest.Metadata.ImageVersion
+	writeJSON(w, http.StatusOK, status)
+}
+
+func (a *API) getHistory(ctx context.Context, w http.ResponseWriter, project string, stage string, service string) {
+	location, ok := a.serviceLocation(ctx, w, project, stage, service)
+	if !ok {
+		return
+	}
+	history, ok := a.readHistory(w, location, project, stage, service)
+	if !ok {
+		return
+	}
+	if history.Promotions == nil {
+		history.Promotions = []git.HistoryEntry{}
+	}
+	writeJSON(w, http.StatusOK, history)
+}
+
+// serviceLocation returns the credentials of the project and the location of the service in the stage branch, an error
+// response is written if it cannot be determined
+func (a *API) serviceLocation(ctx context.Context, w http.ResponseWriter, project string, stage string, service string) (serviceLocation, bool) {
+	credentials, err := a.GitHandler.GetGitSecret(ctx, project, a.Namespace)
+	if err != nil {
+		log.Printf("Could not fetch the secret for project %v: %v", project, err)
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Could not fetch the secret for project %v", project))
+		return serviceLocation{}, false
+	}
+
+	target := git.ServiceTarget{Name: service}
+	layout := a.StageLayout
+	if a.ConfigLoader != nil {
+		serviceConfig, err := a.ConfigLoader.Load(project, stage, service)
+		if err != nil {
+			log.Printf("Could not load promotion settings of %v/%v in stage %v: %v", project, service, stage, err)
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return serviceLocation{}, false
+		}
+		target = serviceConfig.Target(service)
+		layout = serviceConfig.Layout(layout)
+	}
+
+	branch, stageDir, err := layout.Location(stage)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return serviceLocation{}, false
+	}
+	return serviceLocation{credentials: credentials, branch: branch, serviceDir: path.Join(stageDir, target.Dir())}, true
+}
+
+// readHistory reads the promotion history from the stage branch, an error response is written if it cannot be read
+func (a *API) readHistory(w http.ResponseWriter, location serviceLocation, project string, stage string, service string) (*git.History, bool) {
+	content, err := a.GitHandler.ReadFile(location.credentials, location.branch, path.Join(location.serviceDir, git.HistoryFileName))
+	if os.IsNotExist(err) {
+		return &git.History{}, true
+	} else if err != nil {
+		log.Printf("Could not read promotion history of %v/%v in stage %v: %v", project, service, stage, err)
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("Could not read promotion history: %v", err))
+		return nil, false
+	}
+
+	history, err := git.ParseHistory(content)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	return history, true
+}
@@ -0,0 +1,226 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/keptn-sandbox/keptn-git-toolbox/promotion-service/config"
+	githandler_mock "github.com/keptn-sandbox/keptn-git-toolbox/promotion-service/eventhandler/fake"
+	"github.com/keptn-sandbox/keptn-git-toolbox/promotion-service/git"
+	"gotest.tools/assert"
+)
+
+const testToken = "my-token"
+
+const testHistory = `promotions:
+  - version: "1"
+    source: tag
+    sourceCommit: abc
+    keptnContext: ctx-1
+    triggeredId: event-1
+    timestamp: 2021-06-01T12:00:00Z
+    labels:
+      approvedBy: jane@example.com
+  - version: "2"
+    source: tag
+    sourceCommit: def
+    keptnContext: ctx-2
+    triggeredId: event-2
+    timestamp: 2021-06-02T12:00:00Z
+`
+
+var testHistoryEntries = []git.HistoryEntry{
+	{
+		Version:      "1",
+		Source:       git.SourceTag,
+		SourceCommit: "abc",
+		KeptnContext: "ctx-1",
+		TriggeredID:  "event-1",
+		Timestamp:    time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC),
+		Labels:       map[string]string{"approvedBy": "jane@example.com"},
+	},
+	{
+		Version:      "2",
+		Source:       git.SourceTag,
+		SourceCommit: "def",
+		KeptnContext: "ctx-2",
+		TriggeredID:  "event-2",
+		Timestamp:    time.Date(2021, 6, 2, 12, 0, 0, 0, time.UTC),
+	},
+}
+
+func newTestAPI(readFile func(credentials git.GitCredentials, branch string, file string) ([]byte, error)) *API {
+	return &API{
+		GitHandler: &githandler_mock.GitHandlerInterfaceMock{
+			GetGitSecretFunc: func(ctx context.Context, project string, namespace string) (git.GitCredentials, error) {
+				return git.GitCredentials{}, nil
+			},
+			ReadFileFunc: readFile,
+		},
+		Namespace: "keptn",
+		Token:     testToken,
+	}
+}
+
+func readTestHistory(credentials git.GitCredentials, branch string, file string) ([]byte, error) {
+	if branch != "prod" || file != "carts/.promotion-history.yaml" {
+		return nil, os.ErrNotExist
+	}
+	return []byte(testHistory), nil
+}
+
+func serveTestRequest(a *API, method string, url string, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, url, strings.NewReader(body))
+	request.Header.Set(TokenHeader, testToken)
+
+	recorder := httptest.NewRecorder()
+	a.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestAPI_History(t *testing.T) {
+	tests := []struct {
+		name       string
+		url        string
+		readFile   func(credentials git.GitCredentials, branch string, file string) ([]byte, error)
+		wantStatus int
+		wantBody   *git.History
+	}{
+		{
+			name:       "history of a service",
+			url:        "/projects/sockshop/stages/prod/services/carts/history",
+			readFile:   readTestHistory,
+			wantStatus: http.StatusOK,
+			wantBody:   &git.History{Promotions: testHistoryEntries},
+		},
+		{
+			name:       "service without history",
+			url:        "/projects/sockshop/stages/prod/services/orders/history",
+			readFile:   readTestHistory,
+			wantStatus: http.StatusOK,
+			wantBody:   &git.History{Promotions: []git.HistoryEntry{}},
+		},
+		{
+			name:       "missing stage",
+			url:        "/projects/sockshop/stages//services/carts/history",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "query parameters are not served",
+			url:        "/history?project=sockshop&stage=prod&service=carts",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "stage branch cannot be read",
+			url:  "/projects/sockshop/stages/prod/services/carts/history",
+			readFile: func(credentials git.GitCredentials, branch string, file string) ([]byte, error) {
+				return nil, errors.New("reference not found")
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := serveTestRequest(newTestAPI(tt.readFile), http.MethodGet, tt.url, "")
+
+			assert.Equal(t, recorder.Code, tt.wantStatus)
+			if tt.wantBody != nil {
+				history := &git.History{}
+				assert.NilError(t, json.Unmarshal(recorder.Body.Bytes(), history))
+				assert.DeepEqual(t, history, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestAPI_Status(t *testing.T) {
+	a := newTestAPI(readTestHistory)
+
+	recorder := serveTestRequest(a, http.MethodGet, "/projects/sockshop/stages/prod/services/carts", "")
+	assert.Equal(t, recorder.Code, http.StatusOK)
+
+	status := &StatusResponse{}
+	assert.NilError(t, json.Unmarshal(recorder.Body.Bytes(), status))
+	assert.DeepEqual(t, status, &StatusResponse{
+		Project:   "sockshop",
+		Stage:     "prod",
+		Service:   "carts",
+		Version:   "2",
+		Promotion: &testHistoryEntries[1],
+	})
+
+	recorder = serveTestRequest(a, http.MethodGet, "/projects/sockshop/stages/prod/services/orders", "")
+	assert.Equal(t, recorder.Code, http.StatusNotFound)
+}
+
+func TestAPI_Status_DeploymentMetadata(t *testing.T) {
+	a := newTestAPI(func(credentials git.GitCredentials, branch string, file string) ([]byte, error) {
+		if branch != "prod" || file != "carts/metadata/deployment.yaml" {
+			return nil, os.ErrNotExist
+		}
+		return []byte("metadata:\n  imageVersion: 1.2.0\n  gitCommit: abc\n"), nil
+	})
+
+	recorder := serveTestRequest(a, http.MethodGet, "/projects/sockshop/stages/prod/services/carts", "")
+	assert.Equal(t, recorder.Code, http.StatusOK)
+
+	status := &StatusResponse{}
+	assert.NilError(t, json.Unmarshal(recorder.Body.Bytes(), status))
+	assert.DeepEqual(t, status, &StatusResponse{
+		Project: "sockshop",
+		Stage:   "prod",
+		Service: "carts",
+		Version: "1.2.0",
+	})
+}
+
+type testConfigLoader map[string]*config.Config
+
+func (l testConfigLoader) Load(project string, stage string, service string) (*config.Config, error) {
+	if serviceConfig, ok := l[service]; ok {
+		return serviceConfig, nil
+	}
+	return &config.Config{}, nil
+}
+
+func TestAPI_History_ConfiguredPath(t *testing.T) {
+	a := newTestAPI(func(credentials git.GitCredentials, branch string, file string) ([]byte, error) {
+		if file != "apps/carts/.promotion-history.yaml" {
+			return nil, os.ErrNotExist
+		}
+		return []byte(testHistory), nil
+	})
+	a.ConfigLoader = testConfigLoader{"carts": {Path: "apps/carts"}}
+
+	recorder := serveTestRequest(a, http.MethodGet, "/projects/sockshop/stages/prod/services/carts/history", "")
+	assert.Equal(t, recorder.Code, http.StatusOK)
+
+	history := &git.History{}
+	assert.NilError(t, json.Unmarshal(recorder.Body.Bytes(), history))
+	assert.DeepEqual(t, history, &git.History{Promotions: testHistoryEntries})
+}
+
+func TestAPI_History_StageLayout(t *testing.T) {
+	a := newTestAPI(func(credentials git.GitCredentials, branch string, file string) ([]byte, error) {
+		if branch != "main" || file != "stages-rendered/prod/carts/.promotion-history.yaml" {
+			return nil, os.ErrNotExist
+		}
+		return []byte(testHistory), nil
+	})
+	a.StageLayout = git.StageLayout{Branch: "env/{{ .Stage }}"}
+	a.ConfigLoader = testConfigLoader{"carts": {Stages: &git.StageLayout{Branch: "main", Directory: "stages-rendered/{{ .Stage }}"}}}
+
+	recorder := serveTestRequest(a, http.MethodGet, "/projects/sockshop/stages/prod/services/carts/history", "")
+	assert.Equal(t, recorder.Code, http.StatusOK)
+
+	history := &git.History{}
+	assert.NilError(t, json.Unmarshal(recorder.Body.Bytes(), history))
+	assert.DeepEqual(t, history, &git.History{Promotions: testHistoryEntries})
+}
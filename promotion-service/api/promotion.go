@@ -0,0 +1,138 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2" // make sure to use v2 cloudevents here
+	"github.com/google/uuid"
+	"github.com/keptn/go-utils/pkg/api/models"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+const eventSource = "promotion-service/api"
+
+// EventSender sends events to the Keptn API, e.g. the APIHandler of the Keptn go-utils
+type EventSender interface {
+	SendEvent(event models.KeptnContextExtendedCE) (*models.EventContext, *models.Error)
+}
+
+// PromotionRequest is the body of a manually requested promotion
+type PromotionRequest struct {
+	Version string `json:"version"`
+	// Labels are added to the promotion.triggered event, e.g. to select the promotion source or pass policy gates
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// PromotionResponse identifies the promotion.triggered event of an accepted promotion
+type PromotionResponse struct {
+	KeptnContext string `json:"keptnContext"`
+	TriggeredID  string `json:"triggeredId"`
+}
+
+func (a *API) postPromotion(w http.ResponseWriter, r *http.Request, project string, stage string, service string) {
+	request := PromotionRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "Could not parse promotion request: "+err.Error())
+		return
+	}
+
+	labels := map[string]string{}
+	for name, value := range request.Labels {
+		labels[name] = value
+	}
+	if request.Version != "" {
+		labels["version"] = request.Version
+	}
+	if labels["version"] == "" {
+		writeError(w, http.StatusBadRequest, "No version given")
+		return
+	}
+
+	if a.KeptnAPI != nil {
+		a.triggerPromotion(w, project, stage, service, labels)
+		return
+	}
+
+	keptnContext := uuid.New().String()
+	event, err := newPromotionTriggeredEvent(keptnContext, project, stage, service, labels)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	log.Printf("Promotion of %v/%v version %v into stage %v requested: %v", project, service, labels["version"], stage, keptnContext)
+
+	// without the Keptn API the context is unknown to Keptn, the promotion is only reported in the promotion history
+	go func() {
+		if err := a.Promote(context.Background(), event); err != nil {
+			log.Printf("Requested promotion %v failed: %v", keptnContext, err)
+		}
+	}()
+
+	writeJSON(w, http.StatusAccepted, PromotionResponse{
+		KeptnContext: keptnContext,
+		TriggeredID:  event.ID(),
+	})
+}
+
+// triggerPromotion sends the promotion.triggered event to the Keptn API, which delivers it to the promotion-service
+// in a new Keptn context
+func (a *API) triggerPromotion(w http.ResponseWriter, project string, stage string, service string, labels map[string]string) {
+	triggeredID := uuid.New().String()
+	eventType := keptnv2.GetTriggeredEventType("promotion")
+	source := eventSource
+	eventContext, keptnErr := a.KeptnAPI.SendEvent(models.KeptnContextExtendedCE{
+		Contenttype: cloudevents.ApplicationJSON,
+		Data: keptnv2.EventData{
+			Project: project,
+			Stage:   stage,
+			Service: service,
+			Labels:  labels,
+		},
+		ID:          triggeredID,
+		Source:      &source,
+		Specversion: "1.0",
+		Type:        &eventType,
+	})
+	if keptnErr != nil {
+		message := "unknown error"
+		if keptnErr.Message != nil {
+			message = *keptnErr.Message
+		}
+		log.Printf("Could not send promotion of %v/%v into stage %v to Keptn: %v", project, service, stage, message)
+		writeError(w, http.StatusBadGateway, "Could not send promotion to Keptn: "+message)
+		return
+	}
+	if eventContext == nil || eventContext.KeptnContext == nil {
+		writeError(w, http.StatusBadGateway, "Keptn did not return the context of the promotion")
+		return
+	}
+
+	log.Printf("Promotion of %v/%v version %v into stage %v requested: %v", project, service, labels["version"], stage, *eventContext.KeptnContext)
+
+	writeJSON(w, http.StatusAccepted, PromotionResponse{
+		KeptnContext: *eventContext.KeptnContext,
+		TriggeredID:  triggeredID,
+	})
+}
+
+func newPromotionTriggeredEvent(keptnContext string, project string, stage string, service string, labels map[string]string) (cloudevents.Event, error) {
+	event := cloudevents.NewEvent()
+	event.SetID(uuid.New().String())
+	event.SetType(keptnv2.GetTriggeredEventType("promotion"))
+	event.SetSource(eventSource)
+	event.SetTime(time.Now())
+	event.SetExtension("shkeptncontext", keptnContext)
+
+	err := event.SetData(cloudevents.ApplicationJSON, keptnv2.EventData{
+		Project: project,
+		Stage:   stage,
+		Service: service,
+		Labels:  labels,
+	})
+	return event, err
+}
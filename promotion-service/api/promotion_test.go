@@ -0,0 +1,113 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2" // make sure to use v2 cloudevents here
+	"github.com/keptn/go-utils/pkg/api/models"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"gotest.tools/assert"
+)
+
+func TestAPI_PostPromotion(t *testing.T) {
+	events := make(chan cloudevents.Event, 1)
+	a := newTestAPI(readTestHistory)
+	a.Promote = func(ctx context.Context, event cloudevents.Event) error {
+		events <- event
+		return nil
+	}
+
+	recorder := serveTestRequest(a, http.MethodPost, "/projects/sockshop/stages/prod/services/carts", `{"version": "3", "labels": {"approvedBy": "jane@example.com"}}`)
+	assert.Equal(t, recorder.Code, http.StatusAccepted)
+
+	response := &PromotionResponse{}
+	assert.NilError(t, json.Unmarshal(recorder.Body.Bytes(), response))
+
+	select {
+	case event := <-events:
+		assert.Equal(t, event.Type(), keptnv2.GetTriggeredEventType("promotion"))
+		assert.Equal(t, event.ID(), response.TriggeredID)
+
+		keptnContext, err := event.Context.GetExtension("shkeptncontext")
+		assert.NilError(t, err)
+		assert.Equal(t, keptnContext, response.KeptnContext)
+
+		eventData := &keptnv2.EventData{}
+		assert.NilError(t, event.DataAs(eventData))
+		assert.DeepEqual(t, eventData, &keptnv2.EventData{
+			Project: "sockshop",
+			Stage:   "prod",
+			Service: "carts",
+			Labels:  map[string]string{"version": "3", "approvedBy": "jane@example.com"},
+		})
+	case <-time.After(5 * time.Second):
+		t.Fatal("Promotion was not started")
+	}
+}
+
+// fakeKeptnAPI records the sent events and responds with keptnContext, or with message as error
+type fakeKeptnAPI struct {
+	events       []models.KeptnContextExtendedCE
+	keptnContext string
+	message      string
+}
+
+func (f *fakeKeptnAPI) SendEvent(event models.KeptnContextExtendedCE) (*models.EventContext, *models.Error) {
+	f.events = append(f.events, event)
+	if f.message != "" {
+		return nil, &models.Error{Code: http.StatusBadRequest, Message: &f.message}
+	}
+	return &models.EventContext{KeptnContext: &f.keptnContext}, nil
+}
+
+func TestAPI_PostPromotion_KeptnAPI(t *testing.T) {
+	keptnAPI := &fakeKeptnAPI{keptnContext: "keptn-context"}
+	a := newTestAPI(readTestHistory)
+	a.KeptnAPI = keptnAPI
+	a.Promote = func(ctx context.Context, event cloudevents.Event) error {
+		t.Error("Promotion must be sent to Keptn")
+		return nil
+	}
+
+	recorder := serveTestRequest(a, http.MethodPost, "/projects/sockshop/stages/prod/services/carts", `{"version": "3"}`)
+	assert.Equal(t, recorder.Code, http.StatusAccepted)
+
+	response := &PromotionResponse{}
+	assert.NilError(t, json.Unmarshal(recorder.Body.Bytes(), response))
+	assert.Equal(t, response.KeptnContext, "keptn-context")
+
+	assert.Equal(t, len(keptnAPI.events), 1)
+	event := keptnAPI.events[0]
+	assert.Equal(t, *event.Type, keptnv2.GetTriggeredEventType("promotion"))
+	assert.Equal(t, event.ID, response.TriggeredID)
+	assert.Equal(t, event.Shkeptncontext, "")
+	assert.DeepEqual(t, event.Data, keptnv2.EventData{
+		Project: "sockshop",
+		Stage:   "prod",
+		Service: "carts",
+		Labels:  map[string]string{"version": "3"},
+	})
+
+	keptnAPI.message = "project sockshop not found"
+	recorder = serveTestRequest(a, http.MethodPost, "/projects/sockshop/stages/prod/services/carts", `{"version": "3"}`)
+	assert.Equal(t, recorder.Code, http.StatusBadGateway)
+	assert.Equal(t, recorder.Body.String(), `{"message":"Could not send promotion to Keptn: project sockshop not found"}`+"\n")
+}
+
+func TestAPI_PostPromotion_InvalidRequest(t *testing.T) {
+	a := newTestAPI(readTestHistory)
+	a.Promote = func(ctx context.Context, event cloudevents.Event) error {
+		t.Error("Promotion must not be started")
+		return nil
+	}
+
+	recorder := serveTestRequest(a, http.MethodPost, "/projects/sockshop/stages/prod/services/carts", `{"labels": {"approvedBy": "jane@example.com"}}`)
+	assert.Equal(t, recorder.Code, http.StatusBadRequest)
+
+	recorder = serveTestRequest(a, http.MethodPost, "/projects/sockshop/stages/prod/services/carts", `{"version":`)
+	assert.Equal(t, recorder.Code, http.StatusBadRequest)
+}
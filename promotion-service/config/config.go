@@ -0,0 +1,102 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/keptn-sandbox/keptn-git-toolbox/promotion-service/git"
+	"github.com/keptn-sandbox/keptn-git-toolbox/promotion-service/notify"
+	"github.com/keptn-sandbox/keptn-git-toolbox/promotion-service/policy"
+	"gopkg.in/yaml.v3"
+)
+
+// FileName is the name of the Keptn resource containing the promotion settings of a service
+const FileName = "promotion.yaml"
+
+// Config contains the promotion settings of a service in a stage, all settings are optional
+type Config struct {
+	// Format of the service, overrides SERVICE_FORMATS and the detection
+	Format string `yaml:"format,omitempty"`
+	// Path is the directory of the service in the stage branches, the name of the service by default
+	Path string `yaml:"path,omitempty"`
+	// Source overrides PROMOTION_SOURCE_STAGES and VERIFY_PROMOTION_SOURCE, labels of the event still take precedence
+	Source *Source `yaml:"source,omitempty"`
+	// Gates replace the gates of the stage in promotion-policy.yaml
+	Gates *policy.Gates `yaml:"gates,omitempty"`
+	// Stages replaces STAGE_BRANCH_TEMPLATE and STAGE_DIRECTORY_TEMPLATE as a whole, usually set for the whole project
+	Stages *git.StageLayout `yaml:"stages,omitempty"`
+	// Notifications are sent when promotions start, succeed or fail, usually set for the whole project
+	Notifications []notify.Config `yaml:"notifications,omitempty"`
+}
+
+// Source defines where promotions into the stage are taken from by default
+type Source struct {
+	Type   git.PromotionSourceType `yaml:"type,omitempty"`
+	Stage  string                  `yaml:"stage,omitempty"`
+	Verify *bool                   `yaml:"verify,omitempty"`
+}
+
+// Parse reads a promotion.yaml and validates it
+func Parse(content []byte) (*Config, error) {
+	config := &Config{}
+	if err := yaml.Unmarshal(content, config); err != nil {
+		return nil, fmt.Errorf("Could not parse %v: %v", FileName, err)
+	}
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("Invalid %v: %v", FileName, err)
+	}
+	return config, nil
+}
+
+func (c *Config) validate() error {
+	if c.Format != "" {
+		if _, err := git.GetServiceFormat(c.Format); err != nil {
+			return err
+		}
+	}
+	if c.Path != "" && (path.IsAbs(c.Path) || path.Clean(c.Path) != c.Path || c.Path == "." || strings.HasPrefix(c.Path, "..")) {
+		return fmt.Errorf("path %v has to be a clean relative path within the stage branch", c.Path)
+	}
+	if c.Source != nil {
+		switch c.Source.Type {
+		case "", git.SourceTag:
+		case git.SourceStage:
+			if c.Source.Stage == "" {
+				return fmt.Errorf("no stage given for source %v", c.Source.Type)
+			}
+		default:
+			return fmt.Errorf("unsupported source %v, only %v and %v can be configured", c.Source.Type, git.SourceTag, git.SourceStage)
+		}
+	}
+	if c.Stages != nil {
+		if err := c.Stages.Validate(); err != nil {
+			return err
+		}
+	}
+	for i, notification := range c.Notifications {
+		if err := notification.Validate(); err != nil {
+			return fmt.Errorf("notification %v: %v", i+1, err)
+		}
+	}
+	if c.Gates != nil {
+		return c.Gates.Validate()
+	}
+	return nil
+}
+
+// Target returns where and how the service is promoted into the stage branches
+func (c *Config) Target(service string) git.ServiceTarget {
+	if c == nil {
+		return git.ServiceTarget{Name: service}
+	}
+	return git.ServiceTarget{Name: service, Path: c.Path, Format: c.Format}
+}
+
+// Layout returns the location of the stages in the repository, the given defaults if the settings don't declare it
+func (c *Config) Layout(defaults git.StageLayout) git.StageLayout {
+	if c == nil || c.Stages == nil {
+		return defaults
+	}
+	return *c.Stages
+}
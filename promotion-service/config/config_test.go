@@ -0,0 +1,115 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/keptn-sandbox/keptn-git-toolbox/promotion-service/git"
+	"github.com/keptn-sandbox/keptn-git-toolbox/promotion-service/policy"
+	"gotest.tools/assert"
+)
+
+const testConfig = `
+format: kustomize
+path: apps/carts
+source:
+  type: stage
+  stage: staging
+  verify: true
+gates:
+  requiredLabels:
+    - name: approvedBy
+`
+
+func TestParse(t *testing.T) {
+	config, err := Parse([]byte(testConfig))
+	assert.NilError(t, err)
+
+	verify := true
+	assert.DeepEqual(t, config, &Config{
+		Format: "kustomize",
+		Path:   "apps/carts",
+		Source: &Source{Type: git.SourceStage, Stage: "staging", Verify: &verify},
+		Gates:  &policy.Gates{RequiredLabels: []policy.RequiredLabel{{Name: "approvedBy"}}},
+	})
+	assert.Equal(t, config.Target("carts"), git.ServiceTarget{Name: "carts", Path: "apps/carts", Format: "kustomize"})
+}
+
+func TestParse_Empty(t *testing.T) {
+	config, err := Parse([]byte(""))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, config, &Config{})
+	assert.Equal(t, config.Target("carts").Dir(), "carts")
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "not yaml",
+			content: "format: [",
+			want:    "Could not parse promotion.yaml",
+		},
+		{
+			name:    "unknown format",
+			content: "format: jsonnet",
+			want:    "Invalid promotion.yaml: Unknown service format jsonnet",
+		},
+		{
+			name:    "absolute path",
+			content: "path: /apps/carts",
+			want:    "path /apps/carts has to be a clean relative path within the stage branch",
+		},
+		{
+			name:    "path outside of the stage branch",
+			content: "path: ../carts",
+			want:    "path ../carts has to be a clean relative path within the stage branch",
+		},
+		{
+			name:    "source stage missing",
+			content: "source:\n  type: stage",
+			want:    "no stage given for source stage",
+		},
+		{
+			name:    "commit source",
+			content: "source:\n  type: commit",
+			want:    "unsupported source commit",
+		},
+		{
+			name:    "invalid gates",
+			content: "gates:\n  freezeWindows:\n    - days: [Someday]",
+			want:    "unknown weekday Someday",
+		},
+		{
+			name:    "invalid notification",
+			content: "notifications:\n  - type: slack\n    url: https://hooks.slack.com/services/T0/B0/X\n  - type: email",
+			want:    "notification 2: unknown notification type 'email'",
+		},
+		{
+			name:    "stages in the same location",
+			content: "stages:\n  branch: main",
+			want:    "all stages would be stored in the same location",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.content))
+			assert.ErrorContains(t, err, tt.want)
+		})
+	}
+}
+
+func TestConfig_Layout(t *testing.T) {
+	defaults := git.StageLayout{Branch: "env/{{ .Stage }}"}
+
+	config, err := Parse([]byte("stages:\n  branch: main\n  directory: stages-rendered/{{ .Stage }}"))
+	assert.NilError(t, err)
+	assert.Equal(t, config.Layout(defaults), git.StageLayout{Branch: "main", Directory: "stages-rendered/{{ .Stage }}"})
+
+	assert.Equal(t, (&Config{}).Layout(defaults), defaults)
+
+	var empty *Config
+	assert.Equal(t, empty.Layout(defaults), defaults)
+}
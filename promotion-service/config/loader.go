@@ -0,0 +1,88 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/keptn/go-utils/pkg/api/models"
+	api "github.com/keptn/go-utils/pkg/api/utils"
+	"github.com/keptn/go-utils/pkg/lib/keptn"
+)
+
+// Loader reads the promotion settings of a service in a stage
+type Loader interface {
+	// Load returns the settings of the service in the stage, empty settings if there are none
+	Load(project string, stage string, service string) (*Config, error)
+}
+
+// NewLoader creates a loader reading from dir if local is set, from the Keptn configuration service otherwise
+func NewLoader(local bool, dir string, configurationServiceURL string) Loader {
+	if local {
+		return &LocalLoader{Dir: dir}
+	}
+	if configurationServiceURL == "" {
+		configurationServiceURL = keptn.ConfigurationServiceURL
+	}
+	return &ResourceLoader{Resources: api.NewResourceHandler(configurationServiceURL)}
+}
+
+// ResourceGetter reads Keptn resources, it is implemented by the resource handler of go-utils
+type ResourceGetter interface {
+	GetServiceResource(project string, stage string, service string, resourceURI string) (*models.Resource, error)
+	GetStageResource(project string, stage string, resourceURI string) (*models.Resource, error)
+	GetProjectResource(project string, resourceURI string) (*models.Resource, error)
+}
+
+// ResourceLoader reads promotion.yaml from the Keptn resources of the service, the stage or the project, the most
+// specific one is used
+type ResourceLoader struct {
+	Resources ResourceGetter
+}
+
+func (l *ResourceLoader) Load(project string, stage string, service string) (*Config, error) {
+	lookups := []func() (*models.Resource, error){
+		func() (*models.Resource, error) {
+			return l.Resources.GetServiceResource(project, stage, service, FileName)
+		},
+		func() (*models.Resource, error) { return l.Resources.GetStageResource(project, stage, FileName) },
+		func() (*models.Resource, error) { return l.Resources.GetProjectResource(project, FileName) },
+	}
+
+	for _, lookup := range lookups {
+		resource, err := lookup()
+		if err == api.ResourceNotFoundError {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("Could not read %v: %v", FileName, err)
+		}
+		return Parse([]byte(resource.ResourceContent))
+	}
+	return &Config{}, nil
+}
+
+// LocalLoader reads promotion.yaml from <Dir>/<project>/<stage>/<service>, <Dir>/<project>/<stage> or <Dir>/<project>,
+// the most specific one is used
+type LocalLoader struct {
+	Dir string
+}
+
+func (l *LocalLoader) Load(project string, stage string, service string) (*Config, error) {
+	files := []string{
+		filepath.Join(l.Dir, project, stage, service, FileName),
+		filepath.Join(l.Dir, project, stage, FileName),
+		filepath.Join(l.Dir, project, FileName),
+	}
+
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("Could not read %v: %v", file, err)
+		}
+		return Parse(content)
+	}
+	return &Config{}, nil
+}
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/keptn/go-utils/pkg/api/models"
+	api "github.com/keptn/go-utils/pkg/api/utils"
+	"gotest.tools/assert"
+)
+
+type fakeResources map[string]string
+
+func (r fakeResources) get(uri string) (*models.Resource, error) {
+	content, ok := r[uri]
+	if !ok {
+		return nil, api.ResourceNotFoundError
+	}
+	if content == "error" {
+		return nil, errors.New("configuration service unavailable")
+	}
+	return &models.Resource{ResourceContent: content}, nil
+}
+
+func (r fakeResources) GetServiceResource(project string, stage string, service string, resourceURI string) (*models.Resource, error) {
+	return r.get(project + "/" + stage + "/" + service + "/" + resourceURI)
+}
+
+func (r fakeResources) GetStageResource(project string, stage string, resourceURI string) (*models.Resource, error) {
+	return r.get(project + "/" + stage + "/" + resourceURI)
+}
+
+func (r fakeResources) GetProjectResource(project string, resourceURI string) (*models.Resource, error) {
+	return r.get(project + "/" + resourceURI)
+}
+
+func TestResourceLoader_Load(t *testing.T) {
+	loader := &ResourceLoader{Resources: fakeResources{
+		"sockshop/prod/carts/promotion.yaml": "path: apps/carts",
+		"sockshop/prod/promotion.yaml":       "format: raw",
+		"sockshop/promotion.yaml":            "format: helm",
+		"broken/promotion.yaml":              "error",
+	}}
+
+	config, err := loader.Load("sockshop", "prod", "carts")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, config, &Config{Path: "apps/carts"})
+
+	config, err = loader.Load("sockshop", "prod", "orders")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, config, &Config{Format: "raw"})
+
+	config, err = loader.Load("sockshop", "staging", "carts")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, config, &Config{Format: "helm"})
+
+	config, err = loader.Load("podtato", "prod", "carts")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, config, &Config{})
+
+	_, err = loader.Load("broken", "prod", "carts")
+	assert.ErrorContains(t, err, "Could not read promotion.yaml: configuration service unavailable")
+}
+
+func TestLocalLoader_Load(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test_config")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.NilError(t, os.MkdirAll(filepath.Join(dir, "sockshop", "prod", "carts"), 0755))
+	assert.NilError(t, ioutil.WriteFile(filepath.Join(dir, "sockshop", "prod", "carts", FileName), []byte("path: apps/carts"), 0644))
+	assert.NilError(t, ioutil.WriteFile(filepath.Join(dir, "sockshop", FileName), []byte("format: raw"), 0644))
+
+	loader := &LocalLoader{Dir: dir}
+
+	config, err := loader.Load("sockshop", "prod", "carts")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, config, &Config{Path: "apps/carts"})
+
+	config, err = loader.Load("sockshop", "prod", "orders")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, config, &Config{Format: "raw"})
+
+	config, err = loader.Load("podtato", "prod", "carts")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, config, &Config{})
+}
+
+func TestNewLoader(t *testing.T) {
+	assert.DeepEqual(t, NewLoader(true, "config", ""), &LocalLoader{Dir: "config"})
+
+	loader, ok := NewLoader(false, "", "").(*ResourceLoader)
+	assert.Assert(t, ok)
+	assert.Equal(t, loader.Resources.(*api.ResourceHandler).BaseURL, "configuration-service:8080")
+
+	loader = NewLoader(false, "", "http://localhost:8081/configuration-service").(*ResourceLoader)
+	assert.Equal(t, loader.Resources.(*api.ResourceHandler).BaseURL, "localhost:8081/configuration-service")
+}
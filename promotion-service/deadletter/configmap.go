@@ -0,0 +1,143 @@
+package deadletter
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// ConfigMapStore keeps every entry as key <ID>.json of the ConfigMap Name, which is created when the first entry is
+// saved. ConfigMaps are limited to 1 MiB, so old entries have to be replayed or deleted.
+type ConfigMapStore struct {
+	Client    kubernetes.Interface
+	Namespace string
+	Name      string
+}
+
+func (s *ConfigMapStore) get() (*corev1.ConfigMap, error) {
+	return s.Client.CoreV1().ConfigMaps(s.Namespace).Get(context.Background(), s.Name, metav1.GetOptions{})
+}
+
+// update applies the change to the ConfigMap and retries if it was modified concurrently, e.g. by another replica
+func (s *ConfigMapStore) update(change func(data map[string]string) error) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		configMaps := s.Client.CoreV1().ConfigMaps(s.Namespace)
+		configMap, err := s.get()
+		if k8serrors.IsNotFound(err) {
+			configMap = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      s.Name,
+					Namespace: s.Namespace,
+					Labels:    map[string]string{"app.kubernetes.io/managed-by": "promotion-service"},
+				},
+				Data: map[string]string{},
+			}
+			if err := change(configMap.Data); err != nil {
+				return err
+			}
+			_, err = configMaps.Create(context.Background(), configMap, metav1.CreateOptions{})
+			if k8serrors.IsAlreadyExists(err) {
+				// created concurrently, retried as conflict
+				return k8serrors.NewConflict(corev1.Resource("configmaps"), s.Name, err)
+			}
+			return err
+		} else if err != nil {
+			return err
+		}
+
+		if configMap.Data == nil {
+			configMap.Data = map[string]string{}
+		}
+		if err := change(configMap.Data); err != nil {
+			return err
+		}
+		_, err = configMaps.Update(context.Background(), configMap, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// Save adds or replaces the key of the entry
+func (s *ConfigMapStore) Save(entry Entry) error {
+	if err := checkID(entry.ID); err != nil {
+		return err
+	}
+	content, err := marshalEntry(entry)
+	if err != nil {
+		return err
+	}
+
+	return s.update(func(data map[string]string) error {
+		data[entry.ID+entryExtension] = string(content)
+		return nil
+	})
+}
+
+// Get reads the key of the entry
+func (s *ConfigMapStore) Get(id string) (*Entry, error) {
+	if err := checkID(id); err != nil {
+		return nil, err
+	}
+
+	configMap, err := s.get()
+	if k8serrors.IsNotFound(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	content, ok := configMap.Data[id+entryExtension]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return unmarshalEntry([]byte(content))
+}
+
+// List reads all keys of the ConfigMap
+func (s *ConfigMapStore) List() ([]Entry, error) {
+	configMap, err := s.get()
+	if k8serrors.IsNotFound(err) {
+		return []Entry{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	entries := []Entry{}
+	for _, content := range configMap.Data {
+		entry, err := unmarshalEntry([]byte(content))
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *entry)
+	}
+	sortEntries(entries)
+	return entries, nil
+}
+
+// Delete removes the key of the entry
+func (s *ConfigMapStore) Delete(id string) error {
+	if err := checkID(id); err != nil {
+		return err
+	}
+
+	configMap, err := s.get()
+	if k8serrors.IsNotFound(err) {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	if _, ok := configMap.Data[id+entryExtension]; !ok {
+		return ErrNotFound
+	}
+
+	return s.update(func(data map[string]string) error {
+		if _, ok := data[id+entryExtension]; !ok {
+			return ErrNotFound
+		}
+		delete(data, id+entryExtension)
+		return nil
+	})
+}
@@ -0,0 +1,105 @@
+package deadletter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const entryExtension = ".json"
+
+// FileStore keeps every entry in a JSON file <ID>.json in Dir
+type FileStore struct {
+	Dir   string
+	mutex sync.Mutex
+}
+
+// Save writes the entry to a temporary file and renames it, so that a crash never leaves a partial entry
+func (s *FileStore) Save(entry Entry) error {
+	if err := checkID(entry.ID); err != nil {
+		return err
+	}
+	content, err := marshalEntry(entry)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return err
+	}
+	file := filepath.Join(s.Dir, entry.ID+entryExtension)
+	if err := ioutil.WriteFile(file+".tmp", content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(file+".tmp", file)
+}
+
+// Get reads the entry with the ID
+func (s *FileStore) Get(id string) (*Entry, error) {
+	if err := checkID(id); err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	content, err := ioutil.ReadFile(filepath.Join(s.Dir, id+entryExtension))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return unmarshalEntry(content)
+}
+
+// List reads all entries in Dir
+func (s *FileStore) List() ([]Entry, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	files, err := ioutil.ReadDir(s.Dir)
+	if os.IsNotExist(err) {
+		return []Entry{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	entries := []Entry{}
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), entryExtension) {
+			continue
+		}
+		content, err := ioutil.ReadFile(filepath.Join(s.Dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		entry, err := unmarshalEntry(content)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *entry)
+	}
+	sortEntries(entries)
+	return entries, nil
+}
+
+// Delete removes the file of the entry
+func (s *FileStore) Delete(id string) error {
+	if err := checkID(id); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	err := os.Remove(filepath.Join(s.Dir, id+entryExtension))
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,126 @@
+package deadletter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2" // make sure to use v2 cloudevents here
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+const (
+	// StoreFile keeps the entries as JSON files in a directory, which should be a persistent volume
+	StoreFile = "file"
+	// StoreConfigMap keeps the entries in a ConfigMap in the namespace of the service
+	StoreConfigMap = "configmap"
+)
+
+// ErrNotFound is returned if there is no entry with the given ID
+var ErrNotFound = errors.New("Dead letter not found")
+
+// Entry is a promotion request which failed after promotion.started was sent
+type Entry struct {
+	// ID is the ID of the promotion.triggered event
+	ID      string `json:"id"`
+	Project string `json:"project"`
+	Stage   string `json:"stage"`
+	Service string `json:"service"`
+	// Event is the promotion.triggered event, it is processed again when the entry is replayed
+	Event cloudevents.Event `json:"event"`
+	// Error is the error of the last attempt
+	Error string `json:"error"`
+	// Attempts is the number of attempts to promote, including automatic retries and replays
+	Attempts     int       `json:"attempts"`
+	FirstFailure time.Time `json:"firstFailure"`
+	LastFailure  time.Time `json:"lastFailure"`
+}
+
+// Store persists failed promotion requests
+type Store interface {
+	// Save creates or replaces the entry with the ID of the entry
+	Save(entry Entry) error
+	// Get returns ErrNotFound if there is no entry with the ID
+	Get(id string) (*Entry, error)
+	// List returns all entries ordered by the time of their last failure
+	List() ([]Entry, error)
+	// Delete returns ErrNotFound if there is no entry with the ID
+	Delete(id string) error
+}
+
+// validID restricts IDs to characters which are safe in file names and ConfigMap keys
+var validID = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+func checkID(id string) error {
+	if !validID.MatchString(id) {
+		return fmt.Errorf("Invalid dead letter ID '%v'", id)
+	}
+	return nil
+}
+
+// Record stores the failed promotion of the event, the attempts are added to those of a previous failure of the same
+// event, e.g. if a dead letter failed again when it was replayed
+func Record(store Store, event cloudevents.Event, promotionErr error, attempts int) error {
+	if err := checkID(event.ID()); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	entry := Entry{
+		ID:           event.ID(),
+		Event:        event,
+		Error:        promotionErr.Error(),
+		Attempts:     attempts,
+		FirstFailure: now,
+		LastFailure:  now,
+	}
+
+	eventData := keptnv2.EventData{}
+	if err := event.DataAs(&eventData); err == nil {
+		entry.Project = eventData.Project
+		entry.Stage = eventData.Stage
+		entry.Service = eventData.Service
+	}
+
+	previous, err := store.Get(entry.ID)
+	if err == nil {
+		entry.Attempts += previous.Attempts
+		entry.FirstFailure = previous.FirstFailure
+	} else if err != ErrNotFound {
+		return err
+	}
+
+	return store.Save(entry)
+}
+
+// Remove deletes the entry of the event if there is one, e.g. after a replay succeeded
+func Remove(store Store, id string) error {
+	if checkID(id) != nil {
+		return nil
+	}
+	if err := store.Delete(id); err != nil && err != ErrNotFound {
+		return err
+	}
+	return nil
+}
+
+func marshalEntry(entry Entry) ([]byte, error) {
+	return json.Marshal(entry)
+}
+
+func unmarshalEntry(content []byte) (*Entry, error) {
+	entry := &Entry{}
+	if err := json.Unmarshal(content, entry); err != nil {
+		return nil, fmt.Errorf("Could not parse dead letter: %v", err)
+	}
+	return entry, nil
+}
+
+func sortEntries(entries []Entry) {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LastFailure.Before(entries[j].LastFailure)
+	})
+}
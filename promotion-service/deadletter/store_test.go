@@ -0,0 +1,98 @@
+package deadletter
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2" // make sure to use v2 cloudevents here
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"gotest.tools/assert"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestEvent(t *testing.T, id string) cloudevents.Event {
+	event := cloudevents.NewEvent()
+	event.SetID(id)
+	event.SetType(keptnv2.GetTriggeredEventType("promotion"))
+	event.SetSource("test")
+	event.SetExtension("shkeptncontext", "my-context")
+	assert.NilError(t, event.SetData(cloudevents.ApplicationJSON, keptnv2.EventData{
+		Project: "sockshop",
+		Stage:   "prod",
+		Service: "carts",
+		Labels:  map[string]string{"version": "1"},
+	}))
+	return event
+}
+
+// testStores runs the test against every store implementation
+func testStores(t *testing.T, test func(t *testing.T, store Store)) {
+	dir, err := ioutil.TempDir("", "test_dead_letters")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+
+	t.Run("file", func(t *testing.T) {
+		test(t, &FileStore{Dir: dir})
+	})
+	t.Run("configmap", func(t *testing.T) {
+		test(t, &ConfigMapStore{Client: fake.NewSimpleClientset(), Namespace: "keptn", Name: "promotion-dead-letters"})
+	})
+}
+
+func TestStore_RecordAndReplay(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		entries, err := store.List()
+		assert.NilError(t, err)
+		assert.Equal(t, len(entries), 0)
+
+		event := newTestEvent(t, "event-1")
+		assert.NilError(t, Record(store, event, errors.New("Could not push prod: timeout"), 3))
+
+		entry, err := store.Get("event-1")
+		assert.NilError(t, err)
+		assert.Equal(t, entry.Project, "sockshop")
+		assert.Equal(t, entry.Stage, "prod")
+		assert.Equal(t, entry.Service, "carts")
+		assert.Equal(t, entry.Error, "Could not push prod: timeout")
+		assert.Equal(t, entry.Attempts, 3)
+		assert.Equal(t, entry.Event.ID(), "event-1")
+		assert.DeepEqual(t, entry.Event.Data(), event.Data())
+		firstFailure := entry.FirstFailure
+
+		// a failed replay adds its attempts
+		assert.NilError(t, Record(store, event, errors.New("Could not push prod: rejected"), 1))
+		assert.NilError(t, Record(store, newTestEvent(t, "event-2"), errors.New("tag carts-2 not found"), 1))
+
+		entries, err = store.List()
+		assert.NilError(t, err)
+		assert.Equal(t, len(entries), 2)
+		assert.Equal(t, entries[0].ID, "event-1")
+		assert.Equal(t, entries[0].Attempts, 4)
+		assert.Equal(t, entries[0].Error, "Could not push prod: rejected")
+		assert.Assert(t, entries[0].FirstFailure.Equal(firstFailure))
+		assert.Equal(t, entries[1].ID, "event-2")
+
+		// a successful replay removes the entry
+		assert.NilError(t, Remove(store, "event-1"))
+		assert.NilError(t, Remove(store, "event-1"))
+		_, err = store.Get("event-1")
+		assert.Equal(t, err, ErrNotFound)
+		assert.Equal(t, store.Delete("event-1"), ErrNotFound)
+
+		assert.NilError(t, store.Delete("event-2"))
+		entries, err = store.List()
+		assert.NilError(t, err)
+		assert.Equal(t, len(entries), 0)
+	})
+}
+
+func TestStore_InvalidID(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		_, err := store.Get("../secrets")
+		assert.Error(t, err, "Invalid dead letter ID '../secrets'")
+		assert.Error(t, store.Delete("a/b"), "Invalid dead letter ID 'a/b'")
+		assert.Error(t, Record(store, newTestEvent(t, "../event"), errors.New("failed"), 1), "Invalid dead letter ID '../event'")
+	})
+}
@@ -1,12 +1,24 @@
 package eventhandler
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	cloudevents "github.com/cloudevents/sdk-go/v2" // make sure to use v2 cloudevents here
 	"github.com/keptn-sandbox/keptn-git-toolbox/promotion-service/common"
+	"github.com/keptn-sandbox/keptn-git-toolbox/promotion-service/config"
+	"github.com/keptn-sandbox/keptn-git-toolbox/promotion-service/deadletter"
 	"github.com/keptn-sandbox/keptn-git-toolbox/promotion-service/git"
+	"github.com/keptn-sandbox/keptn-git-toolbox/promotion-service/lock"
+	"github.com/keptn-sandbox/keptn-git-toolbox/promotion-service/metrics"
+	"github.com/keptn-sandbox/keptn-git-toolbox/promotion-service/notify"
+	"github.com/keptn-sandbox/keptn-git-toolbox/promotion-service/policy"
+	"github.com/keptn-sandbox/keptn-git-toolbox/promotion-service/tracing"
 	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"os"
+	"reflect"
+	"strconv"
+	"time"
 )
 
 const (
@@ -14,24 +26,76 @@ const (
 	defaultNamespace    = "keptn"
 	namespaceEnvVarName = "POD_NAMESPACE"
 	serviceName         = "promotion-service"
+
+	promotionSourceLabel       = "promotionSource"
+	promotionSourceStageLabel  = "promotionSourceStage"
+	promotionSourceCommitLabel = "promotionSourceCommit"
+	promotionVerifyLabel       = "promotionVerify"
 )
 
 type PromotionHandler struct {
 	Event        cloudevents.Event
 	KeptnHandler *keptnv2.Keptn
 	GitHandler   git.GitHandlerInterface
+	Locker       lock.Locker
+	// SourceStages maps a stage to the stage branch it is promoted from by default, stages without entry are promoted from the version tag
+	SourceStages map[string]string
+	// VerifySource enables the check of the promoted content against the version tag by default
+	VerifySource bool
+	// StageLayout defines the stage branches of projects which don't declare the stages in their promotion.yaml
+	StageLayout git.StageLayout
+	// ConfigLoader reads the promotion.yaml of the service, the defaults above apply if nil
+	ConfigLoader config.Loader
+	// Retries is the number of additional attempts to update the stage branch after transient git errors
+	Retries int
+	// RetryBackoff is the delay before the first retry, it doubles with every further retry
+	RetryBackoff time.Duration
+	// DeadLetters keeps promotions which failed after promotion.started was sent so that they can be replayed, failed
+	// promotions are only reported if nil
+	DeadLetters deadletter.Store
+	// DefaultNotifications are notified about promotions which fail before the promotion.yaml of all services was read
+	DefaultNotifications []notify.Config
+
+	// attempts counts the updates of the stage branch, including retries
+	attempts int
+	// transientErr is the transient error the last update of the stage branch failed with, only promotions failing
+	// with such an error are recorded as dead letters
+	transientErr error
+
+	// notifications declared by the services of the promotion, and the details of the promotion sent with them
+	notifications []notify.Config
+	notification  notify.Notification
 }
 
 // HandlePromotionTriggeredEvent handles promotion.triggered events
-func (eh *PromotionHandler) HandlePromotionTriggeredEvent() error {
+func (eh *PromotionHandler) HandlePromotionTriggeredEvent(ctx context.Context) (err error) {
+	ctx, span := tracing.StartSpan(ctx, "HandlePromotionTriggeredEvent")
+	defer func() { tracing.EndSpan(span, err) }()
+
 	eh.KeptnHandler.Logger.Info("Handling promotion.triggered event: " + eh.Event.Context.GetID())
 
-	eventData := &keptnv2.EventData{}
-	err := eh.Event.DataAs(eventData)
+	triggeredData := &PromotionTriggeredEventData{}
+	err = eh.Event.DataAs(triggeredData)
 	if err != nil {
 		eh.KeptnHandler.Logger.Error("Could not parse event payload: " + err.Error())
 		return err
 	}
+	eventData := &triggeredData.EventData
+	eh.notifications = eh.DefaultNotifications
+	eh.notification = notify.Notification{
+		Project:      eventData.Project,
+		Stage:        eventData.Stage,
+		KeptnContext: eh.KeptnHandler.KeptnContext,
+	}
+
+	span.SetAttributes(
+		tracing.ProjectKey.String(eventData.Project),
+		tracing.StageKey.String(eventData.Stage),
+		tracing.ServiceKey.String(eventData.Service),
+	)
+
+	finished := metrics.PromotionStarted(eventData.Project, eventData.Stage)
+	defer func() { finished(promotionResult(err)) }()
 
 	eh.KeptnHandler.Logger.Info("Sending promotion.started event")
 	if err := eh.sendPromotionStartedEvent(); err != nil {
@@ -39,25 +103,87 @@ func (eh *PromotionHandler) HandlePromotionTriggeredEvent() error {
 		return err
 	}
 
-	version, ok := eventData.Labels["version"]
-	if !ok {
-		err = errors.New("No version label given")
+	eh.attempts = 1
+	eh.transientErr = nil
+	defer func() { eh.recordDeadLetter(err) }()
+
+	services, err := getServices(triggeredData)
+	if err != nil {
+		eh.KeptnHandler.Logger.Error(err.Error())
+		sendErr := eh.sendPromotionFinishedWithErrorEvent(err.Error(), nil)
+		if sendErr != nil {
+			eh.KeptnHandler.Logger.Error("Could not send promotion.finished with error event: " + sendErr.Error())
+			return sendErr
+		}
+		return err
+	}
+	for _, service := range services {
+		eh.KeptnHandler.Logger.Info(fmt.Sprintf("Using version %v of service %v", service.Version, service.Service))
+	}
+	eh.notification.Services = notificationServices(services)
+	if len(services) == 1 {
+		span.SetAttributes(tracing.VersionKey.String(services[0].Version))
+	}
+
+	promotions := make([]git.ServicePromotion, len(services))
+	serviceConfigs := make([]*config.Config, len(services))
+	servicesErr := git.ServicesError{}
+	for i, service := range services {
+		serviceConfigs[i], promotions[i], err = eh.preparePromotion(eventData, service)
+		if err != nil {
+			servicesErr[service.Service] = err
+		} else {
+			eh.KeptnHandler.Logger.Info(fmt.Sprintf("Using promotion source %v for service %v", promotions[i].Source.Type, service.Service))
+		}
+	}
+	eh.notifications = projectNotifications(serviceConfigs)
+	if len(servicesErr) > 0 {
+		// the notifiers declared by the failed services are unknown
+		eh.notifications = appendNotifications(eh.notifications, eh.DefaultNotifications)
+		err = singleServiceError(servicesErr, services)
+		eh.KeptnHandler.Logger.Error(err.Error())
+		sendErr := eh.sendPromotionFinishedWithErrorEvent(err.Error(), serviceResults(services, servicesErr))
+		if sendErr != nil {
+			eh.KeptnHandler.Logger.Error("Could not send promotion.finished with error event: " + sendErr.Error())
+			return sendErr
+		}
+		return err
+	}
+
+	stage, branch, err := eh.promotionStage(eventData.Stage, services, serviceConfigs)
+	if err != nil {
 		eh.KeptnHandler.Logger.Error(err.Error())
-		sendErr := eh.sendPromotionFinishedWithErrorEvent(err.Error())
+		sendErr := eh.sendPromotionFinishedWithErrorEvent(err.Error(), nil)
 		if sendErr != nil {
 			eh.KeptnHandler.Logger.Error("Could not send promotion.finished with error event: " + sendErr.Error())
 			return sendErr
 		}
 		return err
-	} else {
-		eh.KeptnHandler.Logger.Info("Using version: " + version)
+	}
+
+	var release lock.ReleaseFunc
+	if eh.Locker != nil {
+		// stages sharing a branch are serialized as well, their pushes would conflict otherwise
+		key := lock.Key(eventData.Project, branch)
+		eh.KeptnHandler.Logger.Info("Waiting for promotion lock " + key)
+		release, err = eh.Locker.Acquire(key)
+		if err != nil {
+			eh.KeptnHandler.Logger.Error(fmt.Sprintf("Could not acquire promotion lock %v: %v", key, err.Error()))
+			sendErr := eh.sendPromotionFinishedWithErrorEvent(err.Error(), nil)
+			if sendErr != nil {
+				eh.KeptnHandler.Logger.Error("Could not send promotion.finished with error event: " + sendErr.Error())
+				return sendErr
+			}
+			return err
+		}
+		defer release()
 	}
 
 	namespaceSupplier := common.EnvBasedStringSupplier(namespaceEnvVarName, defaultNamespace)
-	mysecret, err := eh.GitHandler.GetGitSecret(eventData.Project, namespaceSupplier())
+	mysecret, err := eh.GitHandler.GetGitSecret(ctx, eventData.Project, namespaceSupplier())
 	if err != nil {
 		eh.KeptnHandler.Logger.Error(fmt.Sprintf("Could not fetch the secret for project %v: %v", eventData.Project, err.Error()))
-		sendErr := eh.sendPromotionFinishedWithErrorEvent(err.Error())
+		sendErr := eh.sendPromotionFinishedWithErrorEvent(err.Error(), nil)
 		if sendErr != nil {
 			eh.KeptnHandler.Logger.Error("Could not send promotion.finished with error event: " + sendErr.Error())
 			return sendErr
@@ -65,18 +191,62 @@ func (eh *PromotionHandler) HandlePromotionTriggeredEvent() error {
 		return err
 	}
 
-	err = eh.GitHandler.UpdateGitRepo(mysecret, eventData.Stage, eventData.Service, version)
+	err = eh.checkPromotionPolicies(mysecret, triggeredData, stage, services, serviceConfigs, servicesErr)
+	if errors.Is(err, policy.DeniedError{}) {
+		eh.KeptnHandler.Logger.Info(err.Error())
+		sendErr := eh.sendPromotionFinishedWithFailedEvent(err.Error(), serviceResults(services, servicesErr))
+		if sendErr != nil {
+			eh.KeptnHandler.Logger.Error("Could not send promotion.finished with failed event: " + sendErr.Error())
+			return sendErr
+		}
+		return err
+	} else if err != nil {
+		eh.KeptnHandler.Logger.Error(fmt.Sprintf("Could not check promotion policy for project %v: %v", eventData.Project, err.Error()))
+		sendErr := eh.sendPromotionFinishedWithErrorEvent(err.Error(), serviceResults(services, servicesErr))
+		if sendErr != nil {
+			eh.KeptnHandler.Logger.Error("Could not send promotion.finished with error event: " + sendErr.Error())
+			return sendErr
+		}
+		return err
+	}
+
+	metadata := git.PromotionMetadata{
+		KeptnContext: eh.KeptnHandler.KeptnContext,
+		TriggeredID:  eh.Event.ID(),
+		Labels:       eventData.Labels,
+	}
+
+	eh.notify(notify.PhaseStarted, "")
+
+	commit, err := eh.updateGitRepo(ctx, mysecret, stage, promotions, metadata)
 	if err != nil {
-		eh.KeptnHandler.Logger.Error(fmt.Sprintf("Could not update service %v/%v for stage %v: %v", eventData.Project, eventData.Service, eventData.Stage, err.Error()))
-		sendErr := eh.sendPromotionFinishedWithErrorEvent(err.Error())
+		eh.KeptnHandler.Logger.Error(fmt.Sprintf("Could not update services of project %v for stage %v: %v", eventData.Project, eventData.Stage, err.Error()))
+		if updateErr, ok := err.(git.ServicesError); ok {
+			servicesErr = updateErr
+		}
+		sendErr := eh.sendPromotionFinishedWithErrorEvent(err.Error(), serviceResults(services, servicesErr))
 		if sendErr != nil {
 			eh.KeptnHandler.Logger.Error("Could not send promotion.finished with error event: " + sendErr.Error())
 		}
 		return err
 	}
 
+	eh.notification.CommitURL = git.CommitURL(mysecret.RemoteURI, commit)
+
+	// another replica might have promoted into the branch concurrently if the lock was lost
+	if release != nil {
+		if err := release(); err != nil {
+			eh.KeptnHandler.Logger.Error(fmt.Sprintf("Promotion lock was lost during the promotion: %v", err.Error()))
+			sendErr := eh.sendPromotionFinishedWithErrorEvent(err.Error(), serviceResults(services, nil))
+			if sendErr != nil {
+				eh.KeptnHandler.Logger.Error("Could not send promotion.finished with error event: " + sendErr.Error())
+			}
+			return err
+		}
+	}
+
 	eh.KeptnHandler.Logger.Info("Sending promotion.finished event")
-	if err := eh.sendPromotionFinishedWithSuccessEvent(); err != nil {
+	if err := eh.sendPromotionFinishedWithSuccessEvent(serviceResults(services, nil)); err != nil {
 		eh.KeptnHandler.Logger.Error("Could not send promotion.finished event: " + err.Error())
 		return err
 	}
@@ -84,6 +254,349 @@ func (eh *PromotionHandler) HandlePromotionTriggeredEvent() error {
 	return nil
 }
 
+// getServices returns the services listed in the promotion data of the event, or the service of the event with the
+// version label
+func getServices(eventData *PromotionTriggeredEventData) ([]ServicePromotion, error) {
+	if eventData.Promotion == nil || len(eventData.Promotion.Services) == 0 {
+		version, ok := eventData.Labels["version"]
+		if !ok {
+			return nil, errors.New("No version label given")
+		}
+		return []ServicePromotion{{Service: eventData.Service, Version: version}}, nil
+	}
+
+	for _, service := range eventData.Promotion.Services {
+		if service.Service == "" || service.Version == "" {
+			return nil, errors.New("Service and version are required for every service of the promotion")
+		}
+	}
+	return eventData.Promotion.Services, nil
+}
+
+// preparePromotion loads the promotion.yaml of the service and determines its promotion source
+func (eh *PromotionHandler) preparePromotion(eventData *keptnv2.EventData, service ServicePromotion) (*config.Config, git.ServicePromotion, error) {
+	serviceConfig, err := eh.loadConfig(eventData, service.Service)
+	if err != nil {
+		return nil, git.ServicePromotion{}, err
+	}
+
+	source, err := eh.getPromotionSource(eventData, serviceConfig)
+	if err != nil {
+		return nil, git.ServicePromotion{}, err
+	}
+
+	return serviceConfig, git.ServicePromotion{
+		Target:  serviceConfig.Target(service.Service),
+		Version: service.Version,
+		Source:  source,
+	}, nil
+}
+
+// promotionStage returns the stage with the layout declared by the services, which all have to agree on it, and the
+// branch of the stage
+func (eh *PromotionHandler) promotionStage(stageName string, services []ServicePromotion, serviceConfigs []*config.Config) (git.Stage, string, error) {
+	stage := git.Stage{Name: stageName, Layout: serviceConfigs[0].Layout(eh.StageLayout)}
+	for i := range services[1:] {
+		if layout := serviceConfigs[i+1].Layout(eh.StageLayout); layout != stage.Layout {
+			return stage, "", fmt.Errorf("Services %v and %v declare different stage layouts", services[0].Service, services[i+1].Service)
+		}
+	}
+
+	branch, _, err := stage.Layout.Location(stageName)
+	return stage, branch, err
+}
+
+// updateGitRepo updates the stage branch and retries transient git errors with exponential backoff
+func (eh *PromotionHandler) updateGitRepo(ctx context.Context, credentials git.GitCredentials, stage git.Stage, promotions []git.ServicePromotion, metadata git.PromotionMetadata) (string, error) {
+	backoff := eh.RetryBackoff
+	for retry := 0; ; retry++ {
+		commit, err := eh.GitHandler.UpdateGitRepo(ctx, credentials, stage, promotions, metadata)
+		if err == nil || retry >= eh.Retries || !git.IsTransient(err) {
+			if git.IsTransient(err) {
+				eh.transientErr = err
+			}
+			return commit, err
+		}
+
+		eh.KeptnHandler.Logger.Info(fmt.Sprintf("Retrying promotion in %v after transient error: %v", backoff, err.Error()))
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return commit, err
+		}
+		eh.attempts++
+		backoff *= 2
+	}
+}
+
+// recordDeadLetter stores the event of a promotion which failed with a transient error updating the stage branch for a
+// replay, and removes a previously stored entry of the event once it was promoted or denied by the gates. Other errors,
+// e.g. invalid events or missing tags, are not recorded as a replay would fail the same way.
+func (eh *PromotionHandler) recordDeadLetter(err error) {
+	if eh.DeadLetters == nil {
+		return
+	}
+
+	if err == nil || errors.Is(err, policy.DeniedError{}) {
+		if removeErr := deadletter.Remove(eh.DeadLetters, eh.Event.ID()); removeErr != nil {
+			eh.KeptnHandler.Logger.Error(fmt.Sprintf("Could not remove dead letter %v: %v", eh.Event.ID(), removeErr.Error()))
+		}
+		return
+	}
+	if eh.transientErr == nil {
+		return
+	}
+
+	if recordErr := deadletter.Record(eh.DeadLetters, eh.Event, err, eh.attempts); recordErr != nil {
+		eh.KeptnHandler.Logger.Error(fmt.Sprintf("Could not store failed promotion %v: %v", eh.Event.ID(), recordErr.Error()))
+		return
+	}
+	eh.KeptnHandler.Logger.Info(fmt.Sprintf("Stored failed promotion %v for replay", eh.Event.ID()))
+}
+
+// projectNotifications returns the notifications declared by any of the services, notifications declared by several
+// services, usually in the promotion.yaml of the project, are only sent once
+func projectNotifications(serviceConfigs []*config.Config) []notify.Config {
+	var notifications []notify.Config
+	for _, serviceConfig := range serviceConfigs {
+		if serviceConfig != nil {
+			notifications = appendNotifications(notifications, serviceConfig.Notifications)
+		}
+	}
+	return notifications
+}
+
+// appendNotifications appends the notifiers which are not declared yet
+func appendNotifications(notifications []notify.Config, additional []notify.Config) []notify.Config {
+	for _, notification := range additional {
+		if !containsNotification(notifications, notification) {
+			notifications = append(notifications, notification)
+		}
+	}
+	return notifications
+}
+
+func containsNotification(notifications []notify.Config, notification notify.Config) bool {
+	for _, n := range notifications {
+		if reflect.DeepEqual(n, notification) {
+			return true
+		}
+	}
+	return false
+}
+
+func notificationServices(services []ServicePromotion) []notify.Service {
+	notificationServices := make([]notify.Service, len(services))
+	for i, service := range services {
+		notificationServices[i] = notify.Service{Service: service.Service, Version: service.Version}
+	}
+	return notificationServices
+}
+
+// notify sends the notification for the phase of the promotion to all notifiers declared by its services
+func (eh *PromotionHandler) notify(phase notify.Phase, message string) {
+	if len(eh.notifications) == 0 {
+		if phase == notify.PhaseFailed {
+			eh.KeptnHandler.Logger.Info("No notifier is configured, no notification about the failed promotion was sent")
+		}
+		return
+	}
+
+	notification := eh.notification
+	notification.Phase = phase
+	notification.Message = message
+	notify.Send(context.Background(), eh.notifications, notification)
+}
+
+// singleServiceError returns the error of the only service unchanged, the errors of all services otherwise
+func singleServiceError(servicesErr git.ServicesError, services []ServicePromotion) error {
+	if len(services) == 1 {
+		return servicesErr[services[0].Service]
+	}
+	return servicesErr
+}
+
+// serviceResults sets the outcome of every service, services without error are reported as failed as well if any
+// service failed, because the services are promoted all or nothing
+func serviceResults(services []ServicePromotion, servicesErr git.ServicesError) []ServicePromotion {
+	results := make([]ServicePromotion, len(services))
+	for i, service := range services {
+		results[i] = ServicePromotion{Service: service.Service, Version: service.Version, Result: keptnv2.ResultPass}
+		if err, ok := servicesErr[service.Service]; ok {
+			results[i].Result = keptnv2.ResultFailed
+			results[i].Message = err.Error()
+		} else if len(servicesErr) > 0 {
+			results[i].Result = keptnv2.ResultFailed
+			results[i].Message = "Not promoted because other services of the promotion failed"
+		}
+	}
+	return results
+}
+
+// promotionResult maps the outcome of a promotion to the result reported in the metrics
+func promotionResult(err error) string {
+	if err == nil {
+		return metrics.ResultPass
+	} else if errors.Is(err, policy.DeniedError{}) {
+		return metrics.ResultFail
+	}
+	return metrics.ResultError
+}
+
+// loadConfig reads the promotion.yaml of the service in the stage, empty settings if there is no loader
+func (eh *PromotionHandler) loadConfig(eventData *keptnv2.EventData, service string) (*config.Config, error) {
+	if eh.ConfigLoader == nil {
+		return &config.Config{}, nil
+	}
+	return eh.ConfigLoader.Load(eventData.Project, eventData.Stage, service)
+}
+
+// getPromotionSource determines the promotion source from the event labels, falling back to the source in the
+// promotion.yaml and the configured source of the stage
+func (eh *PromotionHandler) getPromotionSource(eventData *keptnv2.EventData, serviceConfig *config.Config) (git.PromotionSource, error) {
+	source := git.PromotionSource{
+		Type:             git.SourceTag,
+		VerifyAgainstTag: eh.VerifySource,
+	}
+
+	if sourceStage, ok := eh.SourceStages[eventData.Stage]; ok && sourceStage != "" {
+		source.Type = git.SourceStage
+		source.Stage = sourceStage
+	}
+
+	if configSource := serviceConfig.Source; configSource != nil {
+		if configSource.Type != "" {
+			source.Type = configSource.Type
+			source.Stage = configSource.Stage
+		}
+		if configSource.Verify != nil {
+			source.VerifyAgainstTag = *configSource.Verify
+		}
+	}
+
+	if sourceStage, ok := eventData.Labels[promotionSourceStageLabel]; ok {
+		source.Type = git.SourceStage
+		source.Stage = sourceStage
+	}
+
+	if sourceCommit, ok := eventData.Labels[promotionSourceCommitLabel]; ok {
+		source.Type = git.SourceCommit
+		source.Commit = sourceCommit
+	}
+
+	if sourceType, ok := eventData.Labels[promotionSourceLabel]; ok {
+		source.Type = git.PromotionSourceType(sourceType)
+	}
+
+	if verify, ok := eventData.Labels[promotionVerifyLabel]; ok {
+		verifySource, err := strconv.ParseBool(verify)
+		if err != nil {
+			return source, fmt.Errorf("Invalid value '%v' for label %v", verify, promotionVerifyLabel)
+		}
+		source.VerifyAgainstTag = verifySource
+	}
+
+	if source.Type == git.SourceStage && source.Stage == eventData.Stage {
+		return source, fmt.Errorf("Stage %v cannot be promoted from itself", eventData.Stage)
+	}
+
+	return source, source.Validate()
+}
+
+// checkPromotionPolicies evaluates the gates of every service, the promotion is denied if the gates of any service deny
+// it. Errors of single services are added to servicesErr. The policy file and the promotion histories are read at most
+// once for all services.
+func (eh *PromotionHandler) checkPromotionPolicies(credentials git.GitCredentials, eventData *PromotionTriggeredEventData, stage git.Stage, services []ServicePromotion, serviceConfigs []*config.Config, servicesErr git.ServicesError) error {
+	gates := make([]*policy.Gates, len(services))
+	var serviceDirs []string
+	var promotionPolicy *policy.Policy
+	for i, service := range services {
+		if serviceConfigs[i].Gates != nil {
+			gates[i] = serviceConfigs[i].Gates
+		} else {
+			if promotionPolicy == nil {
+				var err error
+				if promotionPolicy, err = eh.loadPromotionPolicy(credentials); err != nil {
+					servicesErr[service.Service] = err
+					return singleServiceError(git.ServicesError{service.Service: err}, services)
+				}
+			}
+			gates[i] = promotionPolicy.GatesFor(eventData.Stage)
+		}
+		if gates[i] != nil && gates[i].MaxPromotionsPerDay > 0 {
+			serviceDirs = append(serviceDirs, serviceConfigs[i].Target(service.Service).Dir())
+		}
+	}
+
+	var histories map[string]*git.History
+	if len(serviceDirs) > 0 {
+		var err error
+		if histories, err = eh.GitHandler.ReadHistories(credentials, stage, serviceDirs); err != nil {
+			return err
+		}
+	}
+
+	denied := policy.DeniedError{Stage: eventData.Stage}
+	now := time.Now()
+	for i, service := range services {
+		if gates[i] == nil {
+			continue
+		}
+		err := gates[i].Evaluate(eventData.Stage, promotionInput(eventData, gates[i], histories[serviceConfigs[i].Target(service.Service).Dir()], now))
+		if err == nil {
+			continue
+		}
+		servicesErr[service.Service] = err
+
+		deniedErr := policy.DeniedError{}
+		if !errors.As(err, &deniedErr) {
+			return singleServiceError(git.ServicesError{service.Service: err}, services)
+		}
+		for _, reason := range deniedErr.Reasons {
+			if len(services) > 1 {
+				reason = service.Service + ": " + reason
+			}
+			denied.Reasons = append(denied.Reasons, reason)
+		}
+	}
+
+	if len(denied.Reasons) > 0 {
+		return denied
+	}
+	return nil
+}
+
+// promotionInput returns the input of the gates of a service, history is only needed for MaxPromotionsPerDay
+func promotionInput(eventData *PromotionTriggeredEventData, gates *policy.Gates, history *git.History, now time.Time) policy.Input {
+	input := policy.Input{
+		Labels: eventData.Labels,
+		Now:    now,
+	}
+
+	if eventData.Evaluation != nil {
+		input.Evaluation = &policy.Evaluation{
+			Result: eventData.Evaluation.Result,
+			Score:  eventData.Evaluation.Score,
+		}
+	}
+
+	if gates.MaxPromotionsPerDay > 0 && history != nil {
+		input.PromotionsToday = history.CountSince(gates.StartOfDay(now))
+	}
+	return input
+}
+
+// loadPromotionPolicy reads the policy file from the default branch, an empty policy if there is none
+func (eh *PromotionHandler) loadPromotionPolicy(credentials git.GitCredentials) (*policy.Policy, error) {
+	content, err := eh.GitHandler.ReadFile(credentials, "", policy.FileName)
+	if os.IsNotExist(err) {
+		return &policy.Policy{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return policy.Parse(content)
+}
+
 func (eh *PromotionHandler) sendPromotionStartedEvent() error {
 	eventData := keptnv2.EventData{
 		Status: keptnv2.StatusSucceeded,
@@ -93,23 +606,49 @@ func (eh *PromotionHandler) sendPromotionStartedEvent() error {
 	return err
 }
 
-func (eh *PromotionHandler) sendPromotionFinishedWithSuccessEvent() error {
+func (eh *PromotionHandler) sendPromotionFinishedWithSuccessEvent(services []ServicePromotion) error {
 	eventData := keptnv2.EventData{
 		Status: keptnv2.StatusSucceeded,
 		Result: keptnv2.ResultPass,
 	}
 
-	_, err := eh.KeptnHandler.SendTaskFinishedEvent(&eventData, serviceName)
-	return err
+	return eh.sendPromotionFinishedEvent(eventData, services)
 }
 
-func (eh *PromotionHandler) sendPromotionFinishedWithErrorEvent(message string) error {
+func (eh *PromotionHandler) sendPromotionFinishedWithFailedEvent(message string, services []ServicePromotion) error {
+	eventData := keptnv2.EventData{
+		Status:  keptnv2.StatusSucceeded,
+		Result:  keptnv2.ResultFailed,
+		Message: message,
+	}
+
+	return eh.sendPromotionFinishedEvent(eventData, services)
+}
+
+func (eh *PromotionHandler) sendPromotionFinishedWithErrorEvent(message string, services []ServicePromotion) error {
 	eventData := keptnv2.EventData{
 		Status:  keptnv2.StatusErrored,
 		Result:  keptnv2.ResultFailed,
 		Message: message,
 	}
 
-	_, err := eh.KeptnHandler.SendTaskFinishedEvent(&eventData, serviceName)
+	return eh.sendPromotionFinishedEvent(eventData, services)
+}
+
+// sendPromotionFinishedEvent sends the finished event with the outcome of each service, if the services are known, and
+// notifies the notifiers of the services about the outcome
+func (eh *PromotionHandler) sendPromotionFinishedEvent(eventData keptnv2.EventData, services []ServicePromotion) error {
+	finishedData := PromotionFinishedEventData{EventData: eventData}
+	if services != nil {
+		finishedData.Promotion = &PromotionData{Services: services}
+	}
+
+	phase := notify.PhaseSucceeded
+	if eventData.Result != keptnv2.ResultPass {
+		phase = notify.PhaseFailed
+	}
+	eh.notify(phase, eventData.Message)
+
+	_, err := eh.KeptnHandler.SendTaskFinishedEvent(&finishedData, serviceName)
 	return err
 }
@@ -1,9 +1,11 @@
 package eventhandler
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
@@ -15,10 +17,18 @@ import (
 
 	cloudevents "github.com/cloudevents/sdk-go/v2" // make sure to use v2 cloudevents here
 	"github.com/cloudevents/sdk-go/v2/types"
+	"github.com/keptn-sandbox/keptn-git-toolbox/promotion-service/config"
+	"github.com/keptn-sandbox/keptn-git-toolbox/promotion-service/deadletter"
 	githandler_mock "github.com/keptn-sandbox/keptn-git-toolbox/promotion-service/eventhandler/fake"
 	"github.com/keptn-sandbox/keptn-git-toolbox/promotion-service/git"
+	"github.com/keptn-sandbox/keptn-git-toolbox/promotion-service/lock"
+	"github.com/keptn-sandbox/keptn-git-toolbox/promotion-service/metrics"
+	"github.com/keptn-sandbox/keptn-git-toolbox/promotion-service/notify"
+	"github.com/keptn-sandbox/keptn-git-toolbox/promotion-service/policy"
 	keptncommon "github.com/keptn/go-utils/pkg/lib/keptn"
 	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	keptnfake "github.com/keptn/go-utils/pkg/lib/v0_2_0/fake"
+	"gotest.tools/assert"
 )
 
 func TestHandlePromotionTriggeredEvent(t *testing.T) {
@@ -60,9 +70,11 @@ func TestHandlePromotionTriggeredEvent(t *testing.T) {
 
 	////////// TEST DEFINITION ///////////
 	type fields struct {
-		Logger     *keptncommon.Logger
-		Event      cloudevents.Event
-		GitHandler git.GitHandlerInterface
+		Logger       *keptncommon.Logger
+		Event        cloudevents.Event
+		GitHandler   git.GitHandlerInterface
+		Locker       lock.Locker
+		ConfigLoader config.Loader
 	}
 
 	tests := []struct {
@@ -77,16 +89,20 @@ func TestHandlePromotionTriggeredEvent(t *testing.T) {
 			fields: fields{
 				Logger: keptncommon.NewLogger("", "", ""),
 				Event:  getPromotionTriggeredEvent(true),
+				Locker: lock.NewKeyedQueue(),
 				GitHandler: &githandler_mock.GitHandlerInterfaceMock{
-					GetGitSecretFunc: func(project string, namespace string) (git.GitCredentials, error) {
+					GetGitSecretFunc: func(ctx context.Context, project string, namespace string) (git.GitCredentials, error) {
 						return git.GitCredentials{
 							User:      "",
 							Token:     "",
 							RemoteURI: "",
 						}, nil
 					},
-					UpdateGitRepoFunc: func(credentials git.GitCredentials, stage string, service string, version string) error {
-						return nil
+					ReadFileFunc: func(credentials git.GitCredentials, branch string, file string) ([]byte, error) {
+						return nil, os.ErrNotExist
+					},
+					UpdateGitRepoFunc: func(ctx context.Context, credentials git.GitCredentials, stage git.Stage, promotions []git.ServicePromotion, metadata git.PromotionMetadata) (string, error) {
+						return "", nil
 					},
 				},
 			},
@@ -149,7 +165,7 @@ func TestHandlePromotionTriggeredEvent(t *testing.T) {
 				Logger: keptncommon.NewLogger("", "", ""),
 				Event:  getPromotionTriggeredEvent(true),
 				GitHandler: &githandler_mock.GitHandlerInterfaceMock{
-					GetGitSecretFunc: func(project string, namespace string) (git.GitCredentials, error) {
+					GetGitSecretFunc: func(ctx context.Context, project string, namespace string) (git.GitCredentials, error) {
 						return git.GitCredentials{}, errors.New("kubernetes secret error")
 					},
 				},
@@ -184,15 +200,18 @@ func TestHandlePromotionTriggeredEvent(t *testing.T) {
 				Logger: keptncommon.NewLogger("", "", ""),
 				Event:  getPromotionTriggeredEvent(true),
 				GitHandler: &githandler_mock.GitHandlerInterfaceMock{
-					GetGitSecretFunc: func(project string, namespace string) (git.GitCredentials, error) {
+					GetGitSecretFunc: func(ctx context.Context, project string, namespace string) (git.GitCredentials, error) {
 						return git.GitCredentials{
 							User:      "",
 							Token:     "",
 							RemoteURI: "",
 						}, nil
 					},
-					UpdateGitRepoFunc: func(credentials git.GitCredentials, stage string, service string, version string) error {
-						return errors.New("git push error")
+					ReadFileFunc: func(credentials git.GitCredentials, branch string, file string) ([]byte, error) {
+						return nil, os.ErrNotExist
+					},
+					UpdateGitRepoFunc: func(ctx context.Context, credentials git.GitCredentials, stage git.Stage, promotions []git.ServicePromotion, metadata git.PromotionMetadata) (string, error) {
+						return "", errors.New("git push error")
 					},
 				},
 			},
@@ -220,6 +239,188 @@ func TestHandlePromotionTriggeredEvent(t *testing.T) {
 			wantErr:        true,
 			wantErrMessage: "git push error",
 		},
+		{
+			name: "Promotion lock not acquirable - send promotion.started and failed promotion.finished event",
+			fields: fields{
+				Logger:     keptncommon.NewLogger("", "", ""),
+				Event:      getPromotionTriggeredEvent(true),
+				GitHandler: &githandler_mock.GitHandlerInterfaceMock{},
+				Locker:     &failingLocker{err: errors.New("lease timeout")},
+			},
+			wantEvents: []channelEvent{
+				{
+					Type: keptnv2.GetStartedEventType(promotionTaskName),
+					Data: struct {
+						Status string `json:"status"`
+						Result string `json:"result"`
+					}{
+						Status: "succeeded",
+					},
+				},
+				{
+					Type: keptnv2.GetFinishedEventType(promotionTaskName),
+					Data: struct {
+						Status string `json:"status"`
+						Result string `json:"result"`
+					}{
+						Status: "errored",
+						Result: "fail",
+					},
+				},
+			},
+			wantErr:        true,
+			wantErrMessage: "lease timeout",
+		},
+		{
+			name: "Promotion lock lost during the promotion - send promotion.started and failed promotion.finished event",
+			fields: fields{
+				Logger: keptncommon.NewLogger("", "", ""),
+				Event:  getPromotionTriggeredEvent(true),
+				Locker: &lostLocker{err: errors.New("Lost lease promotion.sockshop.staging while holding it")},
+				GitHandler: &githandler_mock.GitHandlerInterfaceMock{
+					GetGitSecretFunc: func(ctx context.Context, project string, namespace string) (git.GitCredentials, error) {
+						return git.GitCredentials{}, nil
+					},
+					ReadFileFunc: func(credentials git.GitCredentials, branch string, file string) ([]byte, error) {
+						return nil, os.ErrNotExist
+					},
+					UpdateGitRepoFunc: func(ctx context.Context, credentials git.GitCredentials, stage git.Stage, promotions []git.ServicePromotion, metadata git.PromotionMetadata) (string, error) {
+						return "", nil
+					},
+				},
+			},
+			wantEvents: []channelEvent{
+				{
+					Type: keptnv2.GetStartedEventType(promotionTaskName),
+					Data: struct {
+						Status string `json:"status"`
+						Result string `json:"result"`
+					}{
+						Status: "succeeded",
+					},
+				},
+				{
+					Type: keptnv2.GetFinishedEventType(promotionTaskName),
+					Data: struct {
+						Status string `json:"status"`
+						Result string `json:"result"`
+					}{
+						Status: "errored",
+						Result: "fail",
+					},
+				},
+			},
+			wantErr:        true,
+			wantErrMessage: "Lost lease promotion.sockshop.staging while holding it",
+		},
+		{
+			name: "Promotion denied by policy - send promotion.started and failed promotion.finished event",
+			fields: fields{
+				Logger: keptncommon.NewLogger("", "", ""),
+				Event:  getPromotionTriggeredEvent(true),
+				GitHandler: &githandler_mock.GitHandlerInterfaceMock{
+					GetGitSecretFunc: func(ctx context.Context, project string, namespace string) (git.GitCredentials, error) {
+						return git.GitCredentials{}, nil
+					},
+					ReadFileFunc: func(credentials git.GitCredentials, branch string, file string) ([]byte, error) {
+						return []byte("stages:\n  staging:\n    requiredLabels:\n      - name: approvedBy\n"), nil
+					},
+				},
+			},
+			wantEvents: []channelEvent{
+				{
+					Type: keptnv2.GetStartedEventType(promotionTaskName),
+					Data: struct {
+						Status string `json:"status"`
+						Result string `json:"result"`
+					}{
+						Status: "succeeded",
+					},
+				},
+				{
+					Type: keptnv2.GetFinishedEventType(promotionTaskName),
+					Data: struct {
+						Status string `json:"status"`
+						Result string `json:"result"`
+					}{
+						Status: "succeeded",
+						Result: "fail",
+					},
+				},
+			},
+			wantErr:        true,
+			wantErrMessage: "Promotion into stage staging denied: label approvedBy is required",
+		},
+		{
+			name: "Promotion denied by gates of promotion.yaml - send promotion.started and failed promotion.finished event",
+			fields: fields{
+				Logger: keptncommon.NewLogger("", "", ""),
+				Event:  getPromotionTriggeredEvent(true),
+				GitHandler: &githandler_mock.GitHandlerInterfaceMock{
+					GetGitSecretFunc: func(ctx context.Context, project string, namespace string) (git.GitCredentials, error) {
+						return git.GitCredentials{}, nil
+					},
+				},
+				ConfigLoader: &fakeConfigLoader{config: &config.Config{
+					Gates: &policy.Gates{RequiredLabels: []policy.RequiredLabel{{Name: "ticket"}}},
+				}},
+			},
+			wantEvents: []channelEvent{
+				{
+					Type: keptnv2.GetStartedEventType(promotionTaskName),
+					Data: struct {
+						Status string `json:"status"`
+						Result string `json:"result"`
+					}{
+						Status: "succeeded",
+					},
+				},
+				{
+					Type: keptnv2.GetFinishedEventType(promotionTaskName),
+					Data: struct {
+						Status string `json:"status"`
+						Result string `json:"result"`
+					}{
+						Status: "succeeded",
+						Result: "fail",
+					},
+				},
+			},
+			wantErr:        true,
+			wantErrMessage: "Promotion into stage staging denied: label ticket is required",
+		},
+		{
+			name: "promotion.yaml not loadable - send promotion.started and failed promotion.finished event",
+			fields: fields{
+				Logger:       keptncommon.NewLogger("", "", ""),
+				Event:        getPromotionTriggeredEvent(true),
+				GitHandler:   &githandler_mock.GitHandlerInterfaceMock{},
+				ConfigLoader: &fakeConfigLoader{err: errors.New("Invalid promotion.yaml: unknown service format jsonnet")},
+			},
+			wantEvents: []channelEvent{
+				{
+					Type: keptnv2.GetStartedEventType(promotionTaskName),
+					Data: struct {
+						Status string `json:"status"`
+						Result string `json:"result"`
+					}{
+						Status: "succeeded",
+					},
+				},
+				{
+					Type: keptnv2.GetFinishedEventType(promotionTaskName),
+					Data: struct {
+						Status string `json:"status"`
+						Result string `json:"result"`
+					}{
+						Status: "errored",
+						Result: "fail",
+					},
+				},
+			},
+			wantErr:        true,
+			wantErrMessage: "Invalid promotion.yaml: unknown service format jsonnet",
+		},
 	}
 
 	////////// TEST EXECUTION ///////////
@@ -233,9 +434,11 @@ func TestHandlePromotionTriggeredEvent(t *testing.T) {
 				Event:        tt.fields.Event,
 				KeptnHandler: keptnHandler,
 				GitHandler:   tt.fields.GitHandler,
+				Locker:       tt.fields.Locker,
+				ConfigLoader: tt.fields.ConfigLoader,
 			}
 
-			err := eh.HandlePromotionTriggeredEvent()
+			err := eh.HandlePromotionTriggeredEvent(context.Background())
 			if (err != nil) != tt.wantErr {
 				t.Errorf("HandlePromotionTriggeredEvent() error = %v, wantErr %v, wantErrMessage %v", err, tt.wantErr, tt.wantErrMessage)
 				return
@@ -307,6 +510,611 @@ func getPromotionTriggeredEvent(appendLabel bool) cloudevents.Event {
 	}
 }
 
+const testMultiServiceEventData = `
+    "project": "sockshop",
+    "stage": "staging",
+    "service": "carts",
+    "promotion": {
+      "services": [
+        {"service": "carts", "version": "1"},
+        {"service": "orders", "version": "2"}
+      ]
+    }`
+
+func getMultiServicePromotionTriggeredEvent() cloudevents.Event {
+	event := getPromotionTriggeredEvent(false)
+	event.DataEncoded = []byte("{" + testMultiServiceEventData + "\n  }")
+	return event
+}
+
+func TestHandlePromotionTriggeredEvent_MultipleServices(t *testing.T) {
+	tests := []struct {
+		name          string
+		updateGitRepo func(ctx context.Context, credentials git.GitCredentials, stage git.Stage, promotions []git.ServicePromotion, metadata git.PromotionMetadata) (string, error)
+		configs       map[string]*config.Config
+		wantErr       string
+		wantStatus    keptnv2.StatusType
+		wantResult    keptnv2.ResultType
+		wantServices  []ServicePromotion
+	}{
+		{
+			name: "all services promoted",
+			updateGitRepo: func(ctx context.Context, credentials git.GitCredentials, stage git.Stage, promotions []git.ServicePromotion, metadata git.PromotionMetadata) (string, error) {
+				return "", nil
+			},
+			wantStatus: keptnv2.StatusSucceeded,
+			wantResult: keptnv2.ResultPass,
+			wantServices: []ServicePromotion{
+				{Service: "carts", Version: "1", Result: keptnv2.ResultPass},
+				{Service: "orders", Version: "2", Result: keptnv2.ResultPass},
+			},
+		},
+		{
+			name: "one service fails",
+			updateGitRepo: func(ctx context.Context, credentials git.GitCredentials, stage git.Stage, promotions []git.ServicePromotion, metadata git.PromotionMetadata) (string, error) {
+				return "", git.ServicesError{"orders": errors.New("tag orders-2 not found")}
+			},
+			wantErr:    "orders: tag orders-2 not found",
+			wantStatus: keptnv2.StatusErrored,
+			wantResult: keptnv2.ResultFailed,
+			wantServices: []ServicePromotion{
+				{Service: "carts", Version: "1", Result: keptnv2.ResultFailed, Message: "Not promoted because other services of the promotion failed"},
+				{Service: "orders", Version: "2", Result: keptnv2.ResultFailed, Message: "tag orders-2 not found"},
+			},
+		},
+		{
+			name: "one service denied by its gates",
+			configs: map[string]*config.Config{
+				"orders": {Gates: &policy.Gates{RequiredLabels: []policy.RequiredLabel{{Name: "ticket"}}}},
+			},
+			wantErr:    "Promotion into stage staging denied: orders: label ticket is required",
+			wantStatus: keptnv2.StatusSucceeded,
+			wantResult: keptnv2.ResultFailed,
+			wantServices: []ServicePromotion{
+				{Service: "carts", Version: "1", Result: keptnv2.ResultFailed, Message: "Not promoted because other services of the promotion failed"},
+				{Service: "orders", Version: "2", Result: keptnv2.ResultFailed, Message: "Promotion into stage staging denied: label ticket is required"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := getMultiServicePromotionTriggeredEvent()
+			sender := &keptnfake.EventSender{}
+			keptnHandler, err := keptnv2.NewKeptn(&event, keptncommon.KeptnOpts{EventSender: sender})
+			assert.NilError(t, err)
+
+			gitHandler := &githandler_mock.GitHandlerInterfaceMock{
+				GetGitSecretFunc: func(ctx context.Context, project string, namespace string) (git.GitCredentials, error) {
+					return git.GitCredentials{}, nil
+				},
+				ReadFileFunc: func(credentials git.GitCredentials, branch string, file string) ([]byte, error) {
+					return nil, os.ErrNotExist
+				},
+				UpdateGitRepoFunc: tt.updateGitRepo,
+			}
+			configs := map[string]*config.Config{}
+			for service, serviceConfig := range tt.configs {
+				configs[service] = serviceConfig
+			}
+			eh := &PromotionHandler{
+				Event:        event,
+				KeptnHandler: keptnHandler,
+				GitHandler:   gitHandler,
+				ConfigLoader: &serviceConfigLoader{configs: configs},
+			}
+
+			err = eh.HandlePromotionTriggeredEvent(context.Background())
+			if tt.wantErr == "" {
+				assert.NilError(t, err)
+				calls := gitHandler.UpdateGitRepoCalls()
+				assert.Equal(t, len(calls), 1)
+				assert.DeepEqual(t, calls[0].Promotions, []git.ServicePromotion{
+					{Target: git.ServiceTarget{Name: "carts"}, Version: "1", Source: git.PromotionSource{Type: git.SourceTag}},
+					{Target: git.ServiceTarget{Name: "orders"}, Version: "2", Source: git.PromotionSource{Type: git.SourceTag}},
+				})
+			} else {
+				assert.Error(t, err, tt.wantErr)
+			}
+
+			assert.NilError(t, sender.AssertSentEventTypes([]string{
+				keptnv2.GetStartedEventType(promotionTaskName),
+				keptnv2.GetFinishedEventType(promotionTaskName),
+			}))
+			finished := &PromotionFinishedEventData{}
+			assert.NilError(t, sender.SentEvents[1].DataAs(finished))
+			assert.Equal(t, finished.Status, tt.wantStatus)
+			assert.Equal(t, finished.Result, tt.wantResult)
+			assert.Assert(t, finished.Promotion != nil)
+			assert.DeepEqual(t, finished.Promotion.Services, tt.wantServices)
+		})
+	}
+}
+
+func TestHandlePromotionTriggeredEvent_PolicyReadOnce(t *testing.T) {
+	event := getMultiServicePromotionTriggeredEvent()
+	sender := &keptnfake.EventSender{}
+	keptnHandler, err := keptnv2.NewKeptn(&event, keptncommon.KeptnOpts{EventSender: sender})
+	assert.NilError(t, err)
+
+	gitHandler := &githandler_mock.GitHandlerInterfaceMock{
+		GetGitSecretFunc: func(ctx context.Context, project string, namespace string) (git.GitCredentials, error) {
+			return git.GitCredentials{}, nil
+		},
+		ReadFileFunc: func(credentials git.GitCredentials, branch string, file string) ([]byte, error) {
+			return []byte("stages:\n  staging:\n    maxPromotionsPerDay: 1\n"), nil
+		},
+		ReadHistoriesFunc: func(credentials git.GitCredentials, stage git.Stage, serviceDirs []string) (map[string]*git.History, error) {
+			return map[string]*git.History{
+				"carts":  {},
+				"orders": {Promotions: []git.HistoryEntry{{Version: "1", Timestamp: time.Now()}}},
+			}, nil
+		},
+	}
+	eh := &PromotionHandler{
+		Event:        event,
+		KeptnHandler: keptnHandler,
+		GitHandler:   gitHandler,
+		ConfigLoader: &serviceConfigLoader{configs: map[string]*config.Config{}},
+	}
+
+	err = eh.HandlePromotionTriggeredEvent(context.Background())
+	assert.Error(t, err, "Promotion into stage staging denied: orders: maximum of 1 promotions per day reached")
+
+	// the policy and the histories of all services are read only once
+	assert.Equal(t, len(gitHandler.ReadFileCalls()), 1)
+	calls := gitHandler.ReadHistoriesCalls()
+	assert.Equal(t, len(calls), 1)
+	assert.DeepEqual(t, calls[0].ServiceDirs, []string{"carts", "orders"})
+}
+
+func TestHandlePromotionTriggeredEvent_Notifications(t *testing.T) {
+	tests := []struct {
+		name       string
+		gates      *policy.Gates
+		wantPhases []notify.Phase
+		wantCommit string
+		wantMsg    string
+	}{
+		{
+			name:       "promotion succeeded",
+			wantPhases: []notify.Phase{notify.PhaseStarted, notify.PhaseSucceeded},
+			wantCommit: "https://github.com/keptn-sandbox/sockshop/commit/1c7a2f0",
+		},
+		{
+			name:       "promotion denied",
+			gates:      &policy.Gates{RequiredLabels: []policy.RequiredLabel{{Name: "ticket"}}},
+			wantPhases: []notify.Phase{notify.PhaseFailed},
+			wantMsg:    "Promotion into stage staging denied: label ticket is required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var notifications []notify.Notification
+			receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				notification := notify.Notification{}
+				assert.NilError(t, json.NewDecoder(r.Body).Decode(&notification))
+				notifications = append(notifications, notification)
+			}))
+			defer receiver.Close()
+
+			event := getPromotionTriggeredEvent(true)
+			keptnHandler, err := keptnv2.NewKeptn(&event, keptncommon.KeptnOpts{EventSender: &keptnfake.EventSender{}})
+			assert.NilError(t, err)
+
+			eh := &PromotionHandler{
+				Event:        event,
+				KeptnHandler: keptnHandler,
+				GitHandler: &githandler_mock.GitHandlerInterfaceMock{
+					GetGitSecretFunc: func(ctx context.Context, project string, namespace string) (git.GitCredentials, error) {
+						return git.GitCredentials{RemoteURI: "https://github.com/keptn-sandbox/sockshop.git"}, nil
+					},
+					ReadFileFunc: func(credentials git.GitCredentials, branch string, file string) ([]byte, error) {
+						return nil, os.ErrNotExist
+					},
+					UpdateGitRepoFunc: func(ctx context.Context, credentials git.GitCredentials, stage git.Stage, promotions []git.ServicePromotion, metadata git.PromotionMetadata) (string, error) {
+						return "1c7a2f0", nil
+					},
+				},
+				ConfigLoader: &fakeConfigLoader{config: &config.Config{
+					Gates:         tt.gates,
+					Notifications: []notify.Config{{Type: notify.TypeWebhook, URL: receiver.URL}},
+				}},
+			}
+			_ = eh.HandlePromotionTriggeredEvent(context.Background())
+
+			assert.Equal(t, len(notifications), len(tt.wantPhases))
+			for i, phase := range tt.wantPhases {
+				assert.Equal(t, notifications[i].Phase, phase)
+				assert.Equal(t, notifications[i].Project, "sockshop")
+				assert.Equal(t, notifications[i].Stage, "staging")
+				assert.Equal(t, notifications[i].KeptnContext, "my-context")
+				assert.DeepEqual(t, notifications[i].Services, []notify.Service{{Service: "carts", Version: "1"}})
+			}
+			last := notifications[len(notifications)-1]
+			assert.Equal(t, last.CommitURL, tt.wantCommit)
+			assert.Equal(t, last.Message, tt.wantMsg)
+		})
+	}
+}
+
+func TestHandlePromotionTriggeredEvent_DefaultNotifications(t *testing.T) {
+	tests := []struct {
+		name         string
+		withVersion  bool
+		loaderErr    error
+		wantServices []notify.Service
+		wantMsg      string
+	}{
+		{
+			name:    "invalid event",
+			wantMsg: "No version label given",
+		},
+		{
+			name:         "promotion.yaml cannot be read",
+			withVersion:  true,
+			loaderErr:    errors.New("Could not read promotion.yaml"),
+			wantServices: []notify.Service{{Service: "carts", Version: "1"}},
+			wantMsg:      "Could not read promotion.yaml",
+		},
+		{
+			name:        "notifiers of the services are used",
+			withVersion: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var notifications []notify.Notification
+			receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				notification := notify.Notification{}
+				assert.NilError(t, json.NewDecoder(r.Body).Decode(&notification))
+				notifications = append(notifications, notification)
+			}))
+			defer receiver.Close()
+
+			event := getPromotionTriggeredEvent(tt.withVersion)
+			keptnHandler, err := keptnv2.NewKeptn(&event, keptncommon.KeptnOpts{EventSender: &keptnfake.EventSender{}})
+			assert.NilError(t, err)
+
+			eh := &PromotionHandler{
+				Event:        event,
+				KeptnHandler: keptnHandler,
+				GitHandler: &githandler_mock.GitHandlerInterfaceMock{
+					GetGitSecretFunc: func(ctx context.Context, project string, namespace string) (git.GitCredentials, error) {
+						return git.GitCredentials{}, nil
+					},
+					ReadFileFunc: func(credentials git.GitCredentials, branch string, file string) ([]byte, error) {
+						return nil, os.ErrNotExist
+					},
+					UpdateGitRepoFunc: func(ctx context.Context, credentials git.GitCredentials, stage git.Stage, promotions []git.ServicePromotion, metadata git.PromotionMetadata) (string, error) {
+						return "1c7a2f0", nil
+					},
+				},
+				ConfigLoader:         &fakeConfigLoader{config: &config.Config{}, err: tt.loaderErr},
+				DefaultNotifications: []notify.Config{{Type: notify.TypeWebhook, URL: receiver.URL}},
+			}
+			_ = eh.HandlePromotionTriggeredEvent(context.Background())
+
+			if tt.wantMsg == "" {
+				assert.Equal(t, len(notifications), 0)
+				return
+			}
+			assert.Equal(t, len(notifications), 1)
+			assert.Equal(t, notifications[0].Phase, notify.PhaseFailed)
+			assert.Equal(t, notifications[0].Project, "sockshop")
+			assert.Equal(t, notifications[0].Stage, "staging")
+			assert.Equal(t, notifications[0].KeptnContext, "my-context")
+			assert.DeepEqual(t, notifications[0].Services, tt.wantServices)
+			assert.Equal(t, notifications[0].Message, tt.wantMsg)
+		})
+	}
+}
+
+func TestHandlePromotionTriggeredEvent_Retries(t *testing.T) {
+	transientErr := fmt.Errorf("Could not push staging: %w", io.ErrUnexpectedEOF)
+	permanentErr := errors.New("tag carts-1 not found")
+
+	tests := []struct {
+		name           string
+		retries        int
+		errors         []error
+		wantCalls      int
+		wantAttempts   int
+		wantErr        string
+		wantDeadLetter bool
+	}{
+		{
+			name:      "transient error is retried",
+			retries:   2,
+			errors:    []error{transientErr},
+			wantCalls: 2,
+		},
+		{
+			name:      "permanent error is not retried",
+			retries:   2,
+			errors:    []error{permanentErr},
+			wantCalls: 1,
+			wantErr:   "tag carts-1 not found",
+		},
+		{
+			name:           "retries exhausted",
+			retries:        1,
+			errors:         []error{transientErr, transientErr},
+			wantCalls:      2,
+			wantAttempts:   2,
+			wantErr:        "Could not push staging: unexpected EOF",
+			wantDeadLetter: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "test_dead_letters")
+			assert.NilError(t, err)
+			defer os.RemoveAll(dir)
+			store := &deadletter.FileStore{Dir: dir}
+
+			event := getPromotionTriggeredEvent(true)
+			event.SetID("event-1")
+			event.SetSource("test")
+			keptnHandler, err := keptnv2.NewKeptn(&event, keptncommon.KeptnOpts{EventSender: &keptnfake.EventSender{}})
+			assert.NilError(t, err)
+
+			calls := 0
+			eh := &PromotionHandler{
+				Event:        event,
+				KeptnHandler: keptnHandler,
+				GitHandler: &githandler_mock.GitHandlerInterfaceMock{
+					GetGitSecretFunc: func(ctx context.Context, project string, namespace string) (git.GitCredentials, error) {
+						return git.GitCredentials{}, nil
+					},
+					ReadFileFunc: func(credentials git.GitCredentials, branch string, file string) ([]byte, error) {
+						return nil, os.ErrNotExist
+					},
+					UpdateGitRepoFunc: func(ctx context.Context, credentials git.GitCredentials, stage git.Stage, promotions []git.ServicePromotion, metadata git.PromotionMetadata) (string, error) {
+						calls++
+						if calls <= len(tt.errors) {
+							return "", tt.errors[calls-1]
+						}
+						return "1c7a2f0", nil
+					},
+				},
+				Retries:      tt.retries,
+				RetryBackoff: time.Millisecond,
+				DeadLetters:  store,
+			}
+			err = eh.HandlePromotionTriggeredEvent(context.Background())
+			assert.Equal(t, calls, tt.wantCalls)
+
+			entry, getErr := store.Get("event-1")
+			if tt.wantErr == "" {
+				assert.NilError(t, err)
+				assert.Equal(t, getErr, deadletter.ErrNotFound)
+				return
+			}
+			assert.Error(t, err, tt.wantErr)
+			if !tt.wantDeadLetter {
+				// a replay would fail with the same error
+				assert.Equal(t, getErr, deadletter.ErrNotFound)
+				return
+			}
+			assert.NilError(t, getErr)
+			assert.Equal(t, entry.Attempts, tt.wantAttempts)
+			assert.Equal(t, entry.Error, tt.wantErr)
+			assert.Equal(t, entry.Service, "carts")
+
+			// a successful replay removes the dead letter
+			eh.GitHandler.(*githandler_mock.GitHandlerInterfaceMock).UpdateGitRepoFunc = func(ctx context.Context, credentials git.GitCredentials, stage git.Stage, promotions []git.ServicePromotion, metadata git.PromotionMetadata) (string, error) {
+				return "1c7a2f0", nil
+			}
+			assert.NilError(t, eh.HandlePromotionTriggeredEvent(context.Background()))
+			_, getErr = store.Get("event-1")
+			assert.Equal(t, getErr, deadletter.ErrNotFound)
+		})
+	}
+}
+
+func TestProjectNotifications(t *testing.T) {
+	slack := notify.Config{Type: notify.TypeSlack, URL: "https://hooks.slack.com/services/T0/B0/X"}
+	teams := notify.Config{Type: notify.TypeTeams, URL: "https://example.webhook.office.com/webhookb2/1"}
+
+	notifications := projectNotifications([]*config.Config{
+		{Notifications: []notify.Config{slack}},
+		nil,
+		{Notifications: []notify.Config{slack, teams}},
+	})
+	assert.DeepEqual(t, notifications, []notify.Config{slack, teams})
+}
+
+func TestGetServices(t *testing.T) {
+	services, err := getServices(&PromotionTriggeredEventData{
+		EventData: keptnv2.EventData{Service: "carts", Labels: map[string]string{"version": "1"}},
+	})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, services, []ServicePromotion{{Service: "carts", Version: "1"}})
+
+	_, err = getServices(&PromotionTriggeredEventData{EventData: keptnv2.EventData{Service: "carts"}})
+	assert.Error(t, err, "No version label given")
+
+	_, err = getServices(&PromotionTriggeredEventData{
+		EventData: keptnv2.EventData{Service: "carts"},
+		Promotion: &PromotionData{Services: []ServicePromotion{{Service: "carts", Version: "1"}, {Service: "orders"}}},
+	})
+	assert.Error(t, err, "Service and version are required for every service of the promotion")
+}
+
+func TestPromotionStage(t *testing.T) {
+	eh := &PromotionHandler{StageLayout: git.StageLayout{Branch: "env/{{ .Stage }}"}}
+	services := []ServicePromotion{{Service: "carts", Version: "1"}, {Service: "orders", Version: "2"}}
+	singleBranch := &git.StageLayout{Branch: "main", Directory: "stages-rendered/{{ .Stage }}"}
+
+	stage, branch, err := eh.promotionStage("prod", services, []*config.Config{{}, {}})
+	assert.NilError(t, err)
+	assert.Equal(t, stage, git.Stage{Name: "prod", Layout: eh.StageLayout})
+	assert.Equal(t, branch, "env/prod")
+
+	stage, branch, err = eh.promotionStage("prod", services, []*config.Config{{Stages: singleBranch}, {Stages: singleBranch}})
+	assert.NilError(t, err)
+	assert.Equal(t, stage, git.Stage{Name: "prod", Layout: *singleBranch})
+	assert.Equal(t, branch, "main")
+
+	_, _, err = eh.promotionStage("prod", services, []*config.Config{{}, {Stages: singleBranch}})
+	assert.Error(t, err, "Services carts and orders declare different stage layouts")
+}
+
+type serviceConfigLoader struct {
+	configs map[string]*config.Config
+}
+
+func (l *serviceConfigLoader) Load(project string, stage string, service string) (*config.Config, error) {
+	if serviceConfig, ok := l.configs[service]; ok {
+		return serviceConfig, nil
+	}
+	return &config.Config{}, nil
+}
+
+type failingLocker struct {
+	err error
+}
+
+func (l *failingLocker) Acquire(key string) (lock.ReleaseFunc, error) {
+	return nil, l.err
+}
+
+// lostLocker acquires the lock but reports on release that it was lost
+type lostLocker struct {
+	err error
+}
+
+func (l *lostLocker) Acquire(key string) (lock.ReleaseFunc, error) {
+	return func() error {
+		return l.err
+	}, nil
+}
+
+type fakeConfigLoader struct {
+	config *config.Config
+	err    error
+}
+
+func (l *fakeConfigLoader) Load(project string, stage string, service string) (*config.Config, error) {
+	return l.config, l.err
+}
+
 func stringp(s string) *string {
 	return &s
 }
+
+func boolp(b bool) *bool {
+	return &b
+}
+
+func TestGetPromotionSource(t *testing.T) {
+	tests := []struct {
+		name         string
+		sourceStages map[string]string
+		verifySource bool
+		config       *config.Config
+		labels       map[string]string
+		want         git.PromotionSource
+		wantErr      bool
+	}{
+		{
+			name: "Default - promote from tag",
+			want: git.PromotionSource{Type: git.SourceTag},
+		},
+		{
+			name:         "Stage configured to be promoted from previous stage",
+			sourceStages: map[string]string{"prod": "staging"},
+			verifySource: true,
+			want:         git.PromotionSource{Type: git.SourceStage, Stage: "staging", VerifyAgainstTag: true},
+		},
+		{
+			name:         "Label overrides configured source stage",
+			sourceStages: map[string]string{"prod": "staging"},
+			labels:       map[string]string{"promotionSource": "tag"},
+			want:         git.PromotionSource{Type: git.SourceTag, Stage: "staging"},
+		},
+		{
+			name:         "promotion.yaml overrides configured source stage",
+			sourceStages: map[string]string{"prod": "staging"},
+			verifySource: true,
+			config:       &config.Config{Source: &config.Source{Type: git.SourceStage, Stage: "preprod", Verify: boolp(false)}},
+			want:         git.PromotionSource{Type: git.SourceStage, Stage: "preprod"},
+		},
+		{
+			name:   "Label overrides source of promotion.yaml",
+			config: &config.Config{Source: &config.Source{Type: git.SourceStage, Stage: "staging"}},
+			labels: map[string]string{"promotionSource": "tag"},
+			want:   git.PromotionSource{Type: git.SourceTag, Stage: "staging"},
+		},
+		{
+			name:   "Explicit commit via label",
+			labels: map[string]string{"promotionSourceCommit": "4fd2c4d4d3f1e4e1e8b8e4f5b6c7d8e9f0a1b2c3", "promotionVerify": "true"},
+			want:   git.PromotionSource{Type: git.SourceCommit, Commit: "4fd2c4d4d3f1e4e1e8b8e4f5b6c7d8e9f0a1b2c3", VerifyAgainstTag: true},
+		},
+		{
+			name:    "Invalid commit",
+			labels:  map[string]string{"promotionSourceCommit": "main"},
+			wantErr: true,
+		},
+		{
+			name:    "Promotion from the same stage",
+			labels:  map[string]string{"promotionSourceStage": "prod"},
+			wantErr: true,
+		},
+		{
+			name:    "Invalid verify label",
+			labels:  map[string]string{"promotionVerify": "maybe"},
+			wantErr: true,
+		},
+		{
+			name:    "Unknown source",
+			labels:  map[string]string{"promotionSource": "branch"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eh := &PromotionHandler{
+				SourceStages: tt.sourceStages,
+				VerifySource: tt.verifySource,
+			}
+			eventData := &keptnv2.EventData{
+				Project: "sockshop",
+				Stage:   "prod",
+				Service: "carts",
+				Labels:  tt.labels,
+			}
+
+			serviceConfig := tt.config
+			if serviceConfig == nil {
+				serviceConfig = &config.Config{}
+			}
+
+			source, err := eh.getPromotionSource(eventData, serviceConfig)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("getPromotionSource() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil && source != tt.want {
+				t.Errorf("getPromotionSource() = %+v, want %+v", source, tt.want)
+			}
+		})
+	}
+}
+
+func TestPromotionResult(t *testing.T) {
+	if result := promotionResult(nil); result != metrics.ResultPass {
+		t.Errorf("promotionResult(nil) = %v, want %v", result, metrics.ResultPass)
+	}
+	if result := promotionResult(policy.DeniedError{Stage: "prod"}); result != metrics.ResultFail {
+		t.Errorf("promotionResult(DeniedError) = %v, want %v", result, metrics.ResultFail)
+	}
+	if result := promotionResult(errors.New("push failed")); result != metrics.ResultError {
+		t.Errorf("promotionResult(error) = %v, want %v", result, metrics.ResultError)
+	}
+}
@@ -14,6 +14,23 @@ const PromotionFinishedEventType = "sh.keptn.event.promotion.finished"
 // EchoTriggeredEventData is the data of an echo triggered event
 type PromotionTriggeredEventData struct {
 	v0_2_0.EventData
+	// Evaluation is the result of a preceding evaluation task of the sequence
+	Evaluation *v0_2_0.EvaluationDetails `json:"evaluation,omitempty"`
+	// Promotion lists services which are promoted together instead of the service of the event
+	Promotion *PromotionData `json:"promotion,omitempty"`
+}
+
+// PromotionData lists the services of a promotion
+type PromotionData struct {
+	Services []ServicePromotion `json:"services"`
+}
+
+// ServicePromotion is the promotion of a version of a service, the result is only set in finished events
+type ServicePromotion struct {
+	Service string            `json:"service"`
+	Version string            `json:"version"`
+	Result  v0_2_0.ResultType `json:"result,omitempty"`
+	Message string            `json:"message,omitempty"`
 }
 
 // EchoStartedEventData is the data of an echo started event
@@ -24,4 +41,6 @@ type PromotionStartedEventData struct {
 // EchoFinishedEventData is the data of an echo finished event
 type PromotionFinishedEventData struct {
 	v0_2_0.EventData
+	// Promotion contains the outcome of each service, if the services could be determined
+	Promotion *PromotionData `json:"promotion,omitempty"`
 }
@@ -4,6 +4,7 @@
 package githandler_mock
 
 import (
+	"context"
 	"github.com/keptn-sandbox/keptn-git-toolbox/promotion-service/git"
 	"sync"
 )
@@ -14,10 +15,16 @@ import (
 //
 // 		// make and configure a mocked git.GitHandlerInterface
 // 		mockedGitHandlerInterface := &GitHandlerInterfaceMock{
-// 			GetGitSecretFunc: func(project string, namespace string) (git.GitCredentials, error) {
+// 			GetGitSecretFunc: func(ctx context.Context, project string, namespace string) (git.GitCredentials, error) {
 // 				panic("mock out the GetGitSecret method")
 // 			},
-// 			UpdateGitRepoFunc: func(credentials git.GitCredentials, stage string, service string, version string) error {
+// 			ReadFileFunc: func(credentials git.GitCredentials, branch string, file string) ([]byte, error) {
+// 				panic("mock out the ReadFile method")
+// 			},
+// 			ReadHistoriesFunc: func(credentials git.GitCredentials, stage git.Stage, serviceDirs []string) (map[string]*git.History, error) {
+// 				panic("mock out the ReadHistories method")
+// 			},
+// 			UpdateGitRepoFunc: func(ctx context.Context, credentials git.GitCredentials, stage git.Stage, promotions []git.ServicePromotion, metadata git.PromotionMetadata) (string, error) {
 // 				panic("mock out the UpdateGitRepo method")
 // 			},
 // 		}
@@ -28,62 +35,96 @@ import (
 // 	}
 type GitHandlerInterfaceMock struct {
 	// GetGitSecretFunc mocks the GetGitSecret method.
-	GetGitSecretFunc func(project string, namespace string) (git.GitCredentials, error)
+	GetGitSecretFunc func(ctx context.Context, project string, namespace string) (git.GitCredentials, error)
+
+	// ReadFileFunc mocks the ReadFile method.
+	ReadFileFunc func(credentials git.GitCredentials, branch string, file string) ([]byte, error)
+
+	// ReadHistoriesFunc mocks the ReadHistories method.
+	ReadHistoriesFunc func(credentials git.GitCredentials, stage git.Stage, serviceDirs []string) (map[string]*git.History, error)
 
 	// UpdateGitRepoFunc mocks the UpdateGitRepo method.
-	UpdateGitRepoFunc func(credentials git.GitCredentials, stage string, service string, version string) error
+	UpdateGitRepoFunc func(ctx context.Context, credentials git.GitCredentials, stage git.Stage, promotions []git.ServicePromotion, metadata git.PromotionMetadata) (string, error)
 
 	// calls tracks calls to the methods.
 	calls struct {
 		// GetGitSecret holds details about calls to the GetGitSecret method.
 		GetGitSecret []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
 			// Project is the project argument value.
 			Project string
 			// Namespace is the namespace argument value.
 			Namespace string
 		}
+		// ReadFile holds details about calls to the ReadFile method.
+		ReadFile []struct {
+			// Credentials is the credentials argument value.
+			Credentials git.GitCredentials
+			// Branch is the branch argument value.
+			Branch string
+			// File is the file argument value.
+			File string
+		}
+		// ReadHistories holds details about calls to the ReadHistories method.
+		ReadHistories []struct {
+			// Credentials is the credentials argument value.
+			Credentials git.GitCredentials
+			// Stage is the stage argument value.
+			Stage git.Stage
+			// ServiceDirs is the serviceDirs argument value.
+			ServiceDirs []string
+		}
 		// UpdateGitRepo holds details about calls to the UpdateGitRepo method.
 		UpdateGitRepo []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
 			// Credentials is the credentials argument value.
 			Credentials git.GitCredentials
 			// Stage is the stage argument value.
-			Stage string
-			// Service is the service argument value.
-			Service string
-			// Version is the version argument value.
-			Version string
+			Stage git.Stage
+			// Promotions is the promotions argument value.
+			Promotions []git.ServicePromotion
+			// Metadata is the metadata argument value.
+			Metadata git.PromotionMetadata
 		}
 	}
 	lockGetGitSecret  sync.RWMutex
+	lockReadFile      sync.RWMutex
+	lockReadHistories sync.RWMutex
 	lockUpdateGitRepo sync.RWMutex
 }
 
 // GetGitSecret calls GetGitSecretFunc.
-func (mock *GitHandlerInterfaceMock) GetGitSecret(project string, namespace string) (git.GitCredentials, error) {
+func (mock *GitHandlerInterfaceMock) GetGitSecret(ctx context.Context, project string, namespace string) (git.GitCredentials, error) {
 	if mock.GetGitSecretFunc == nil {
 		panic("GitHandlerInterfaceMock.GetGitSecretFunc: method is nil but GitHandlerInterface.GetGitSecret was just called")
 	}
 	callInfo := struct {
+		Ctx       context.Context
 		Project   string
 		Namespace string
 	}{
+		Ctx:       ctx,
 		Project:   project,
 		Namespace: namespace,
 	}
 	mock.lockGetGitSecret.Lock()
 	mock.calls.GetGitSecret = append(mock.calls.GetGitSecret, callInfo)
 	mock.lockGetGitSecret.Unlock()
-	return mock.GetGitSecretFunc(project, namespace)
+	return mock.GetGitSecretFunc(ctx, project, namespace)
 }
 
 // GetGitSecretCalls gets all the calls that were made to GetGitSecret.
 // Check the length with:
 //     len(mockedGitHandlerInterface.GetGitSecretCalls())
 func (mock *GitHandlerInterfaceMock) GetGitSecretCalls() []struct {
+	Ctx       context.Context
 	Project   string
 	Namespace string
 } {
 	var calls []struct {
+		Ctx       context.Context
 		Project   string
 		Namespace string
 	}
@@ -93,42 +134,124 @@ func (mock *GitHandlerInterfaceMock) GetGitSecretCalls() []struct {
 	return calls
 }
 
+// ReadFile calls ReadFileFunc.
+func (mock *GitHandlerInterfaceMock) ReadFile(credentials git.GitCredentials, branch string, file string) ([]byte, error) {
+	if mock.ReadFileFunc == nil {
+		panic("GitHandlerInterfaceMock.ReadFileFunc: method is nil but GitHandlerInterface.ReadFile was just called")
+	}
+	callInfo := struct {
+		Credentials git.GitCredentials
+		Branch      string
+		File        string
+	}{
+		Credentials: credentials,
+		Branch:      branch,
+		File:        file,
+	}
+	mock.lockReadFile.Lock()
+	mock.calls.ReadFile = append(mock.calls.ReadFile, callInfo)
+	mock.lockReadFile.Unlock()
+	return mock.ReadFileFunc(credentials, branch, file)
+}
+
+// ReadFileCalls gets all the calls that were made to ReadFile.
+// Check the length with:
+//     len(mockedGitHandlerInterface.ReadFileCalls())
+func (mock *GitHandlerInterfaceMock) ReadFileCalls() []struct {
+	Credentials git.GitCredentials
+	Branch      string
+	File        string
+} {
+	var calls []struct {
+		Credentials git.GitCredentials
+		Branch      string
+		File        string
+	}
+	mock.lockReadFile.RLock()
+	calls = mock.calls.ReadFile
+	mock.lockReadFile.RUnlock()
+	return calls
+}
+
+// ReadHistories calls ReadHistoriesFunc.
+func (mock *GitHandlerInterfaceMock) ReadHistories(credentials git.GitCredentials, stage git.Stage, serviceDirs []string) (map[string]*git.History, error) {
+	if mock.ReadHistoriesFunc == nil {
+		panic("GitHandlerInterfaceMock.ReadHistoriesFunc: method is nil but GitHandlerInterface.ReadHistories was just called")
+	}
+	callInfo := struct {
+		Credentials git.GitCredentials
+		Stage       git.Stage
+		ServiceDirs []string
+	}{
+		Credentials: credentials,
+		Stage:       stage,
+		ServiceDirs: serviceDirs,
+	}
+	mock.lockReadHistories.Lock()
+	mock.calls.ReadHistories = append(mock.calls.ReadHistories, callInfo)
+	mock.lockReadHistories.Unlock()
+	return mock.ReadHistoriesFunc(credentials, stage, serviceDirs)
+}
+
+// ReadHistoriesCalls gets all the calls that were made to ReadHistories.
+// Check the length with:
+//     len(mockedGitHandlerInterface.ReadHistoriesCalls())
+func (mock *GitHandlerInterfaceMock) ReadHistoriesCalls() []struct {
+	Credentials git.GitCredentials
+	Stage       git.Stage
+	ServiceDirs []string
+} {
+	var calls []struct {
+		Credentials git.GitCredentials
+		Stage       git.Stage
+		ServiceDirs []string
+	}
+	mock.lockReadHistories.RLock()
+	calls = mock.calls.ReadHistories
+	mock.lockReadHistories.RUnlock()
+	return calls
+}
+
 // UpdateGitRepo calls UpdateGitRepoFunc.
-func (mock *GitHandlerInterfaceMock) UpdateGitRepo(credentials git.GitCredentials, stage string, service string, version string) error {
+func (mock *GitHandlerInterfaceMock) UpdateGitRepo(ctx context.Context, credentials git.GitCredentials, stage git.Stage, promotions []git.ServicePromotion, metadata git.PromotionMetadata) (string, error) {
 	if mock.UpdateGitRepoFunc == nil {
 		panic("GitHandlerInterfaceMock.UpdateGitRepoFunc: method is nil but GitHandlerInterface.UpdateGitRepo was just called")
 	}
 	callInfo := struct {
+		Ctx         context.Context
 		Credentials git.GitCredentials
-		Stage       string
-		Service     string
-		Version     string
+		Stage       git.Stage
+		Promotions  []git.ServicePromotion
+		Metadata    git.PromotionMetadata
 	}{
+		Ctx:         ctx,
 		Credentials: credentials,
 		Stage:       stage,
-		Service:     service,
-		Version:     version,
+		Promotions:  promotions,
+		Metadata:    metadata,
 	}
 	mock.lockUpdateGitRepo.Lock()
 	mock.calls.UpdateGitRepo = append(mock.calls.UpdateGitRepo, callInfo)
 	mock.lockUpdateGitRepo.Unlock()
-	return mock.UpdateGitRepoFunc(credentials, stage, service, version)
+	return mock.UpdateGitRepoFunc(ctx, credentials, stage, promotions, metadata)
 }
 
 // UpdateGitRepoCalls gets all the calls that were made to UpdateGitRepo.
 // Check the length with:
 //     len(mockedGitHandlerInterface.UpdateGitRepoCalls())
 func (mock *GitHandlerInterfaceMock) UpdateGitRepoCalls() []struct {
+	Ctx         context.Context
 	Credentials git.GitCredentials
-	Stage       string
-	Service     string
-	Version     string
+	Stage       git.Stage
+	Promotions  []git.ServicePromotion
+	Metadata    git.PromotionMetadata
 } {
 	var calls []struct {
+		Ctx         context.Context
 		Credentials git.GitCredentials
-		Stage       string
-		Service     string
-		Version     string
+		Stage       git.Stage
+		Promotions  []git.ServicePromotion
+		Metadata    git.PromotionMetadata
 	}
 	mock.lockUpdateGitRepo.RLock()
 	calls = mock.calls.UpdateGitRepo
@@ -0,0 +1,122 @@
+package git
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	keptnutils "github.com/keptn/kubernetes-utils/pkg"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Sources of git credentials
+const (
+	CredentialsKubernetes = "kubernetes"
+	CredentialsEnv        = "env"
+	CredentialsFile       = "file"
+)
+
+const (
+	credentialsSecretPrefix = "git-credentials-"
+	credentialsSecretKey    = "git-credentials"
+	credentialsEnvVarName   = "GIT_CREDENTIALS"
+)
+
+// CredentialsProvider returns the credentials of the git repository of a project
+type CredentialsProvider interface {
+	GetCredentials(ctx context.Context, project string) (GitCredentials, error)
+}
+
+// NewCredentialsProvider creates the provider for the given source, namespace is used by the Kubernetes provider and
+// dir by the file provider
+func NewCredentialsProvider(source string, namespace string, dir string) (CredentialsProvider, error) {
+	switch source {
+	case "", CredentialsKubernetes:
+		return &KubernetesCredentialsProvider{Namespace: namespace}, nil
+	case CredentialsEnv:
+		return &EnvCredentialsProvider{}, nil
+	case CredentialsFile:
+		if dir == "" {
+			return nil, fmt.Errorf("No directory given for git credentials source %v", source)
+		}
+		return &FileCredentialsProvider{Dir: dir}, nil
+	}
+	return nil, fmt.Errorf("Unknown git credentials source %v", source)
+}
+
+// KubernetesCredentialsProvider reads the credentials from the git-credentials-<project> secret created by Keptn
+type KubernetesCredentialsProvider struct {
+	Namespace string
+}
+
+func (p *KubernetesCredentialsProvider) GetCredentials(ctx context.Context, project string) (GitCredentials, error) {
+	clientset, err := keptnutils.GetClientset(true)
+	if err != nil {
+		return GitCredentials{}, err
+	}
+
+	gitSecret, err := clientset.CoreV1().Secrets(p.Namespace).Get(ctx, credentialsSecretPrefix+project, metav1.GetOptions{})
+	if err != nil {
+		return GitCredentials{}, err
+	}
+	return parseCredentials(gitSecret.Data[credentialsSecretKey])
+}
+
+// EnvCredentialsProvider reads the credentials in the format of the git-credentials secret from the
+// GIT_CREDENTIALS_<PROJECT> environment variable, or GIT_CREDENTIALS for all projects
+type EnvCredentialsProvider struct{}
+
+func (p *EnvCredentialsProvider) GetCredentials(ctx context.Context, project string) (GitCredentials, error) {
+	projectEnvVarName := credentialsEnvVarName + "_" + strings.ToUpper(strings.Replace(project, "-", "_", -1))
+	for _, name := range []string{projectEnvVarName, credentialsEnvVarName} {
+		if value := os.Getenv(name); value != "" {
+			return parseCredentials([]byte(value))
+		}
+	}
+	return GitCredentials{}, fmt.Errorf("Neither %v nor %v is set", projectEnvVarName, credentialsEnvVarName)
+}
+
+// FileCredentialsProvider reads the credentials in the format of the git-credentials secret from
+// <Dir>/git-credentials-<project>, e.g. mounted secrets
+type FileCredentialsProvider struct {
+	Dir string
+}
+
+func (p *FileCredentialsProvider) GetCredentials(ctx context.Context, project string) (GitCredentials, error) {
+	content, err := ioutil.ReadFile(filepath.Join(p.Dir, credentialsSecretPrefix+project))
+	if err != nil {
+		return GitCredentials{}, err
+	}
+	return parseCredentials(content)
+}
+
+func parseCredentials(content []byte) (GitCredentials, error) {
+	credentials := GitCredentials{}
+	if err := json.Unmarshal(content, &credentials); err != nil {
+		return GitCredentials{}, fmt.Errorf("Could not parse git credentials: %v", err)
+	}
+	if credentials.RemoteURI == "" {
+		return GitCredentials{}, fmt.Errorf("Git credentials do not contain a remoteURI")
+	}
+	return credentials, nil
+}
+
+// authMethod returns the authentication for the remote, nil for local repositories and remotes without credentials
+func (c GitCredentials) authMethod() transport.AuthMethod {
+	if c.User == "" && c.Token == "" {
+		return nil
+	}
+	if endpoint, err := transport.NewEndpoint(c.RemoteURI); err == nil && endpoint.Protocol == "file" {
+		return nil
+	}
+	return &http.BasicAuth{
+		Username: c.User,
+		Password: c.Token,
+	}
+}
@@ -0,0 +1,84 @@
+package git
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"gotest.tools/assert"
+)
+
+func TestNewCredentialsProvider(t *testing.T) {
+	provider, err := NewCredentialsProvider("", "keptn", "")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, provider, &KubernetesCredentialsProvider{Namespace: "keptn"})
+
+	provider, err = NewCredentialsProvider(CredentialsEnv, "keptn", "")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, provider, &EnvCredentialsProvider{})
+
+	provider, err = NewCredentialsProvider(CredentialsFile, "keptn", "/etc/git")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, provider, &FileCredentialsProvider{Dir: "/etc/git"})
+
+	_, err = NewCredentialsProvider(CredentialsFile, "keptn", "")
+	assert.ErrorContains(t, err, "No directory")
+
+	_, err = NewCredentialsProvider("vault", "keptn", "")
+	assert.ErrorContains(t, err, "Unknown git credentials source vault")
+}
+
+func TestEnvCredentialsProvider(t *testing.T) {
+	defer os.Unsetenv("GIT_CREDENTIALS")
+	defer os.Unsetenv("GIT_CREDENTIALS_SOCK_SHOP")
+	provider := &EnvCredentialsProvider{}
+
+	_, err := provider.GetCredentials(context.Background(), "sock-shop")
+	assert.ErrorContains(t, err, "Neither GIT_CREDENTIALS_SOCK_SHOP nor GIT_CREDENTIALS is set")
+
+	os.Setenv("GIT_CREDENTIALS", `{"remoteURI": "https://example.com/all.git", "user": "keptn", "token": "secret"}`)
+	credentials, err := provider.GetCredentials(context.Background(), "sock-shop")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, credentials, GitCredentials{RemoteURI: "https://example.com/all.git", User: "keptn", Token: "secret"})
+
+	os.Setenv("GIT_CREDENTIALS_SOCK_SHOP", `{"remoteURI": "https://example.com/sock-shop.git"}`)
+	credentials, err = provider.GetCredentials(context.Background(), "sock-shop")
+	assert.NilError(t, err)
+	assert.Equal(t, credentials.RemoteURI, "https://example.com/sock-shop.git")
+
+	os.Setenv("GIT_CREDENTIALS_SOCK_SHOP", `{"user": "keptn"}`)
+	_, err = provider.GetCredentials(context.Background(), "sock-shop")
+	assert.ErrorContains(t, err, "do not contain a remoteURI")
+}
+
+func TestFileCredentialsProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test_credentials")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+	provider := &FileCredentialsProvider{Dir: dir}
+
+	_, err = provider.GetCredentials(context.Background(), "sockshop")
+	assert.Assert(t, os.IsNotExist(err))
+
+	err = ioutil.WriteFile(filepath.Join(dir, "git-credentials-sockshop"), []byte("not json"), 0644)
+	assert.NilError(t, err)
+	_, err = provider.GetCredentials(context.Background(), "sockshop")
+	assert.ErrorContains(t, err, "Could not parse git credentials")
+
+	err = ioutil.WriteFile(filepath.Join(dir, "git-credentials-sockshop"), []byte(`{"remoteURI": "file:///srv/git/sockshop.git"}`), 0644)
+	assert.NilError(t, err)
+	credentials, err := provider.GetCredentials(context.Background(), "sockshop")
+	assert.NilError(t, err)
+	assert.Equal(t, credentials.RemoteURI, "file:///srv/git/sockshop.git")
+}
+
+func TestGitCredentials_AuthMethod(t *testing.T) {
+	assert.Assert(t, GitCredentials{RemoteURI: "https://example.com/repo.git"}.authMethod() == nil)
+	assert.Assert(t, GitCredentials{RemoteURI: "file:///srv/git/repo.git", User: "keptn", Token: "secret"}.authMethod() == nil)
+	assert.Assert(t, GitCredentials{RemoteURI: "/srv/git/repo.git", User: "keptn", Token: "secret"}.authMethod() == nil)
+	assert.DeepEqual(t, GitCredentials{RemoteURI: "https://example.com/repo.git", User: "keptn", Token: "secret"}.authMethod(),
+		&http.BasicAuth{Username: "keptn", Password: "secret"})
+}
@@ -0,0 +1,343 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v3"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// versionPlaceholder is replaced with the promoted version in the rendered service configuration
+const versionPlaceholder = "{{ keptn/ImageVersion }}"
+
+var kustomizationFileNames = []string{"kustomization.yaml", "kustomization.yml", "Kustomization"}
+
+// ServiceFormat renders the configuration of a service for a stage
+type ServiceFormat interface {
+	// Name returns the name used to declare the format in the configuration
+	Name() string
+	// Detect checks if the service configuration in sourceDir is in this format
+	Detect(fs afero.Fs, sourceDir string, stage string, service string) bool
+	// Render writes the content of the service for the stage to <destinationDir>/<service>
+	Render(fs afero.Fs, sourceDir string, destinationDir string, stage string, service string, version string) error
+}
+
+// serviceFormats contains all known formats, in the order in which they are detected
+var serviceFormats = []ServiceFormat{
+	&HelmFormat{},
+	&KustomizeFormat{},
+	&RawFormat{},
+}
+
+// RegisterServiceFormat adds a format, it is detected before the built-in formats
+func RegisterServiceFormat(format ServiceFormat) {
+	serviceFormats = append([]ServiceFormat{format}, serviceFormats...)
+}
+
+// GetServiceFormat returns the format with the given name
+func GetServiceFormat(name string) (ServiceFormat, error) {
+	for _, format := range serviceFormats {
+		if format.Name() == name {
+			return format, nil
+		}
+	}
+	return nil, fmt.Errorf("Unknown service format %v", name)
+}
+
+// DetectServiceFormat returns the first format which detects the service configuration, raw manifests otherwise
+func DetectServiceFormat(fs afero.Fs, sourceDir string, stage string, service string) ServiceFormat {
+	for _, format := range serviceFormats {
+		if format.Detect(fs, sourceDir, stage, service) {
+			return format
+		}
+	}
+	return &RawFormat{}
+}
+
+// serviceFormat returns the format of the target, the format declared for the service or detects it from the source
+func (gh *GitHandler) serviceFormat(fs afero.Fs, sourceDir string, stage string, service ServiceTarget) (ServiceFormat, error) {
+	if service.Format != "" {
+		return GetServiceFormat(service.Format)
+	}
+	if name, ok := gh.ServiceFormats[service.Name]; ok && name != "" {
+		return GetServiceFormat(name)
+	}
+	return DetectServiceFormat(fs, sourceDir, stage, service.Name), nil
+}
+
+func baseServiceDir(sourceDir string, service string) string {
+	return filepath.Join(sourceDir, "base", service)
+}
+
+func stageServiceDir(sourceDir string, stage string, service string) string {
+	return filepath.Join(sourceDir, "stages", stage, service)
+}
+
+// HelmFormat renders a Helm chart in <service>/helm/<service> and merges the stage values into the base values
+type HelmFormat struct{}
+
+func (f *HelmFormat) Name() string {
+	return "helm"
+}
+
+func (f *HelmFormat) Detect(fs afero.Fs, sourceDir string, stage string, service string) bool {
+	baseExists, _ := afero.DirExists(fs, filepath.Join(baseServiceDir(sourceDir, service), "helm"))
+	stageExists, _ := afero.DirExists(fs, filepath.Join(stageServiceDir(sourceDir, stage, service), "helm"))
+	return baseExists || stageExists
+}
+
+func (f *HelmFormat) Render(fs afero.Fs, sourceDir string, destinationDir string, stage string, service string, version string) error {
+	err := mergeHelmValues(fs, service, stage, sourceDir, destinationDir)
+	if err != nil {
+		log.Println("Couldn't Merge Helm Values", err)
+	}
+
+	err = performFileMove(fs, service, stage, sourceDir, destinationDir)
+	if err != nil {
+		return err
+	}
+
+	// Replace Version in the Values File
+	err = ReplaceInFile(filepath.Join(destinationDir, service, "helm", service, "values.yaml"), versionPlaceholder, version)
+	if err != nil {
+		log.Println("Couldn't Replace Version in values.yaml")
+	}
+	return nil
+}
+
+// KustomizeFormat renders the base to <service>/base and the stage overlay to <service>, the image tag is set in the
+// images field of the overlay kustomization and its references to the base are rewritten to base
+type KustomizeFormat struct{}
+
+func (f *KustomizeFormat) Name() string {
+	return "kustomize"
+}
+
+func (f *KustomizeFormat) Detect(fs afero.Fs, sourceDir string, stage string, service string) bool {
+	return findKustomization(fs, baseServiceDir(sourceDir, service)) != "" ||
+		findKustomization(fs, stageServiceDir(sourceDir, stage, service)) != ""
+}
+
+func (f *KustomizeFormat) Render(fs afero.Fs, sourceDir string, destinationDir string, stage string, service string, version string) error {
+	serviceDestinationDir := filepath.Join(destinationDir, service)
+
+	err := moveDirectory(fs, baseServiceDir(sourceDir, service), filepath.Join(serviceDestinationDir, "base"))
+	if err != nil {
+		return err
+	}
+
+	err = moveDirectory(fs, stageServiceDir(sourceDir, stage, service), serviceDestinationDir)
+	if err != nil {
+		return err
+	}
+
+	kustomization := findKustomization(fs, serviceDestinationDir)
+	if kustomization == "" {
+		kustomization = filepath.Join(serviceDestinationDir, kustomizationFileNames[0])
+		err = afero.WriteFile(fs, kustomization, []byte("resources:\n  - base\n"), 0644)
+		if err != nil {
+			return fmt.Errorf("Could not write %v: %v", kustomization, err)
+		}
+	}
+
+	return renderKustomization(fs, kustomization, stageServiceDir(sourceDir, stage, service), baseServiceDir(sourceDir, service), service, version)
+}
+
+// RawFormat renders plain manifests from base and stage into <service> and replaces the version placeholder in all of them
+type RawFormat struct{}
+
+func (f *RawFormat) Name() string {
+	return "raw"
+}
+
+func (f *RawFormat) Detect(fs afero.Fs, sourceDir string, stage string, service string) bool {
+	return false
+}
+
+func (f *RawFormat) Render(fs afero.Fs, sourceDir string, destinationDir string, stage string, service string, version string) error {
+	serviceDestinationDir := filepath.Join(destinationDir, service)
+
+	err := moveDirectory(fs, baseServiceDir(sourceDir, service), serviceDestinationDir)
+	if err != nil {
+		return err
+	}
+
+	err = moveDirectory(fs, stageServiceDir(sourceDir, stage, service), serviceDestinationDir)
+	if err != nil {
+		return err
+	}
+
+	return afero.Walk(fs, serviceDestinationDir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		extension := filepath.Ext(file)
+		if info.IsDir() || (extension != ".yaml" && extension != ".yml") {
+			return nil
+		}
+
+		content, err := afero.ReadFile(fs, file)
+		if err != nil {
+			return err
+		}
+		return afero.WriteFile(fs, file, bytes.Replace(content, []byte(versionPlaceholder), []byte(version), -1), info.Mode())
+	})
+}
+
+func findKustomization(fs afero.Fs, dir string) string {
+	for _, name := range kustomizationFileNames {
+		if exists, _ := afero.Exists(fs, filepath.Join(dir, name)); exists {
+			return filepath.Join(dir, name)
+		}
+	}
+	return ""
+}
+
+// moveDirectory moves the content of sourceDir into destinationDir, existing files are overwritten
+func moveDirectory(fs afero.Fs, sourceDir string, destinationDir string) error {
+	if exists, _ := afero.DirExists(fs, sourceDir); !exists {
+		return fs.MkdirAll(destinationDir, os.ModePerm)
+	}
+
+	return afero.Walk(fs, sourceDir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relativePath, err := filepath.Rel(sourceDir, file)
+		if err != nil {
+			return err
+		}
+		destination := filepath.Join(destinationDir, relativePath)
+
+		if info.IsDir() {
+			return fs.MkdirAll(destination, 0700)
+		}
+
+		log.Printf("Moving file %s from '%s' to '%s'\n", info.Name(), sourceDir, destinationDir)
+		return fs.Rename(file, destination)
+	})
+}
+
+// renderKustomization rebases the resources of the overlay from overlayDir in the source and sets the image tag
+func renderKustomization(fs afero.Fs, kustomization string, overlayDir string, baseDir string, service string, version string) error {
+	content, err := afero.ReadFile(fs, kustomization)
+	if err != nil {
+		return fmt.Errorf("Could not read %v: %v", kustomization, err)
+	}
+
+	document := yaml.Node{}
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return fmt.Errorf("Could not parse %v: %v", kustomization, err)
+	}
+	if len(document.Content) == 0 {
+		document = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+
+	root := document.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("Could not parse %v: not a mapping", kustomization)
+	}
+
+	if err := rebaseKustomizeResources(root, overlayDir, baseDir); err != nil {
+		return fmt.Errorf("Could not render %v: %v", kustomization, err)
+	}
+	setKustomizeImageTag(root, service, version)
+
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&document); err != nil {
+		return fmt.Errorf("Could not write %v: %v", kustomization, err)
+	}
+	return afero.WriteFile(fs, kustomization, out.Bytes(), 0644)
+}
+
+// rebaseKustomizeResources rewrites the resources and bases of the overlay which refer to the base of the service
+// relative to the overlay in the source, e.g. ../../../base/carts, to the base next to the rendered overlay. Other
+// relative paths outside of the overlay can not be resolved in the stage branch.
+func rebaseKustomizeResources(root *yaml.Node, overlayDir string, baseDir string) error {
+	for _, field := range []string{"resources", "bases"} {
+		entries := mappingValue(root, field)
+		if entries == nil || entries.Kind != yaml.SequenceNode {
+			continue
+		}
+		for _, entry := range entries.Content {
+			if entry.Kind != yaml.ScalarNode || (entry.Value != ".." && !strings.HasPrefix(entry.Value, "../")) {
+				continue
+			}
+			relativePath, err := filepath.Rel(baseDir, filepath.Join(overlayDir, entry.Value))
+			if err != nil || relativePath == ".." || strings.HasPrefix(relativePath, "../") {
+				return fmt.Errorf("%v %v refers to a directory outside of the service which is not promoted, only the base of the service can be referenced", field, entry.Value)
+			}
+			entry.Value = path.Join("base", filepath.ToSlash(relativePath))
+		}
+	}
+	return nil
+}
+
+// setKustomizeImageTag sets newTag of all images of the service in the kustomization, or adds an image for the service
+func setKustomizeImageTag(root *yaml.Node, service string, version string) {
+	images := mappingValue(root, "images")
+	if images == nil {
+		images = &yaml.Node{Kind: yaml.SequenceNode}
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "images"}, images)
+	}
+
+	updated := false
+	for _, image := range images.Content {
+		name := mappingValue(image, "name")
+		newTag := mappingValue(image, "newTag")
+		if name == nil {
+			continue
+		}
+		if (newTag != nil && newTag.Value == versionPlaceholder) || imageMatchesService(name.Value, service) {
+			setMappingValue(image, "newTag", version)
+			updated = true
+		}
+	}
+
+	if !updated {
+		image := &yaml.Node{Kind: yaml.MappingNode}
+		setMappingValue(image, "name", service)
+		setMappingValue(image, "newTag", version)
+		images.Content = append(images.Content, image)
+	}
+}
+
+func imageMatchesService(image string, service string) bool {
+	if index := strings.LastIndex(image, ":"); index > strings.LastIndex(image, "/") {
+		image = image[:index]
+	}
+	return path.Base(image) == service
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func setMappingValue(node *yaml.Node, key string, value string) {
+	if existing := mappingValue(node, key); existing != nil {
+		existing.Kind = yaml.ScalarNode
+		existing.Tag = "!!str"
+		existing.Value = value
+		existing.Style = 0
+		return
+	}
+	node.Content = append(node.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Value: key},
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value},
+	)
+}
@@ -0,0 +1,130 @@
+package git
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/afero"
+	"gotest.tools/assert"
+)
+
+const testKustomization = `# overlay for staging
+resources:
+  - base
+images:
+  - name: docker.io/sockshop/carts
+    newTag: latest # replaced on promotion
+  - name: mongo
+    newTag: "4.4"
+`
+
+const expectedKustomization = `# overlay for staging
+resources:
+  - base
+images:
+  - name: docker.io/sockshop/carts
+    newTag: 1.2.3 # replaced on promotion
+  - name: mongo
+    newTag: "4.4"
+`
+
+func TestDetectServiceFormat(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	writeTestFile(t, fs, filepath.Join("source", "base", "carts", "helm", "carts", "Chart.yaml"), "name: carts")
+	writeTestFile(t, fs, filepath.Join("source", "stages", "dev", "orders", "kustomization.yaml"), testKustomization)
+	writeTestFile(t, fs, filepath.Join("source", "base", "users", "deployment.yaml"), "kind: Deployment")
+
+	assert.Equal(t, DetectServiceFormat(fs, "source", "dev", "carts").Name(), "helm")
+	assert.Equal(t, DetectServiceFormat(fs, "source", "dev", "orders").Name(), "kustomize")
+	assert.Equal(t, DetectServiceFormat(fs, "source", "dev", "users").Name(), "raw")
+}
+
+func TestGitHandler_DeclaredServiceFormat(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	writeTestFile(t, fs, filepath.Join("source", "base", "carts", "helm", "carts", "Chart.yaml"), "name: carts")
+
+	gh := &GitHandler{ServiceFormats: map[string]string{"carts": "raw", "orders": "jsonnet"}}
+
+	format, err := gh.serviceFormat(fs, "source", "dev", ServiceTarget{Name: "carts"})
+	assert.NilError(t, err)
+	assert.Equal(t, format.Name(), "raw")
+
+	format, err = gh.serviceFormat(fs, "source", "dev", ServiceTarget{Name: "carts", Format: "kustomize"})
+	assert.NilError(t, err)
+	assert.Equal(t, format.Name(), "kustomize")
+
+	_, err = gh.serviceFormat(fs, "source", "dev", ServiceTarget{Name: "orders"})
+	assert.Error(t, err, "Unknown service format jsonnet")
+}
+
+func TestKustomizeFormat_Render(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	writeTestFile(t, fs, filepath.Join("source", "base", "carts", "kustomization.yaml"), "resources:\n  - deployment.yaml\n")
+	writeTestFile(t, fs, filepath.Join("source", "base", "carts", "deployment.yaml"), "kind: Deployment")
+	writeTestFile(t, fs, filepath.Join("source", "stages", "staging", "carts", "kustomization.yaml"), testKustomization)
+	writeTestFile(t, fs, filepath.Join("source", "stages", "staging", "carts", "replicas.yaml"), "replicas: 2")
+
+	err := (&KustomizeFormat{}).Render(fs, "source", "dest", "staging", "carts", "1.2.3")
+	assert.NilError(t, err)
+
+	assertFileExists(t, fs, filepath.Join("dest", "carts", "base", "kustomization.yaml"))
+	assertFileExists(t, fs, filepath.Join("dest", "carts", "base", "deployment.yaml"))
+	assertFileExists(t, fs, filepath.Join("dest", "carts", "replicas.yaml"))
+
+	kustomization, err := afero.ReadFile(fs, filepath.Join("dest", "carts", "kustomization.yaml"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(kustomization), expectedKustomization)
+}
+
+func TestKustomizeFormat_RenderWithoutOverlay(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	writeTestFile(t, fs, filepath.Join("source", "base", "carts", "kustomization.yaml"), "resources:\n  - deployment.yaml\n")
+
+	err := (&KustomizeFormat{}).Render(fs, "source", "dest", "staging", "carts", "2")
+	assert.NilError(t, err)
+
+	kustomization, err := afero.ReadFile(fs, filepath.Join("dest", "carts", "kustomization.yaml"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(kustomization), "resources:\n  - base\nimages:\n  - name: carts\n    newTag: \"2\"\n")
+}
+
+func TestKustomizeFormat_RenderOverlayReferencingBase(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	writeTestFile(t, fs, filepath.Join("source", "base", "carts", "kustomization.yaml"), "resources:\n  - deployment.yaml\n")
+	writeTestFile(t, fs, filepath.Join("source", "base", "carts", "service.yaml"), "kind: Service")
+	writeTestFile(t, fs, filepath.Join("source", "stages", "staging", "carts", "kustomization.yaml"),
+		"resources:\n  - ../../../base/carts\n  - replicas.yaml\nbases:\n  - ../../../base/carts/service.yaml\n")
+
+	err := (&KustomizeFormat{}).Render(fs, "source", "dest", "staging", "carts", "1.2.3")
+	assert.NilError(t, err)
+
+	kustomization, err := afero.ReadFile(fs, filepath.Join("dest", "carts", "kustomization.yaml"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(kustomization), "resources:\n  - base\n  - replicas.yaml\nbases:\n  - base/service.yaml\nimages:\n  - name: carts\n    newTag: 1.2.3\n")
+}
+
+func TestKustomizeFormat_RenderOverlayReferencingOtherDirectory(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	writeTestFile(t, fs, filepath.Join("source", "stages", "staging", "carts", "kustomization.yaml"), "resources:\n  - ../../../common\n")
+
+	err := (&KustomizeFormat{}).Render(fs, "source", "dest", "staging", "carts", "1.2.3")
+	assert.ErrorContains(t, err, "resources ../../../common refers to a directory outside of the service which is not promoted")
+}
+
+func TestRawFormat_Render(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	writeTestFile(t, fs, filepath.Join("source", "base", "carts", "deployment.yaml"), "image: carts:{{ keptn/ImageVersion }}")
+	writeTestFile(t, fs, filepath.Join("source", "base", "carts", "service.yaml"), "kind: Service")
+	writeTestFile(t, fs, filepath.Join("source", "stages", "prod", "carts", "service.yaml"), "kind: Service\ntype: LoadBalancer")
+
+	err := (&RawFormat{}).Render(fs, "source", "dest", "prod", "carts", "1.2.3")
+	assert.NilError(t, err)
+
+	deployment, err := afero.ReadFile(fs, filepath.Join("dest", "carts", "deployment.yaml"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(deployment), "image: carts:1.2.3")
+
+	service, err := afero.ReadFile(fs, filepath.Join("dest", "carts", "service.yaml"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(service), "kind: Service\ntype: LoadBalancer")
+}
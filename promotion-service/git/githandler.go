@@ -3,23 +3,26 @@ package git
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/go-git/go-git/v5"
-	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
-	"github.com/go-git/go-git/v5/plumbing/transport/http"
-	keptnutils "github.com/keptn/kubernetes-utils/pkg"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/keptn-sandbox/keptn-git-toolbox/promotion-service/metrics"
+	"github.com/keptn-sandbox/keptn-git-toolbox/promotion-service/tracing"
 	"github.com/spf13/afero"
+	"go.opentelemetry.io/otel/attribute"
 	"gopkg.in/yaml.v3"
 	"helm.sh/helm/v3/pkg/chart"
 	"io/ioutil"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"log"
+	"net/url"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 )
@@ -30,126 +33,498 @@ type GitCredentials struct {
 	RemoteURI string `json:"remoteURI,omitempty"`
 }
 
+// ServiceTarget describes how a service is promoted into the stage branches
+type ServiceTarget struct {
+	// Name is the name of the service
+	Name string
+	// Path is the directory of the service in the stage branches, the name of the service if empty
+	Path string
+	// Format is the format of the service, declared in ServiceFormats or detected if empty
+	Format string
+}
+
+// Dir returns the directory of the service relative to the root of a stage branch
+func (t ServiceTarget) Dir() string {
+	if t.Path == "" {
+		return t.Name
+	}
+	return t.Path
+}
+
+// ServicePromotion is the promotion of a version of a service into a stage
+type ServicePromotion struct {
+	Target  ServiceTarget
+	Version string
+	Source  PromotionSource
+}
+
+// ServicesError contains the errors of all services which could not be promoted, by service name
+type ServicesError map[string]error
+
+func (e ServicesError) Error() string {
+	var messages []string
+	for service, err := range e {
+		messages = append(messages, service+": "+err.Error())
+	}
+	sort.Strings(messages)
+	return strings.Join(messages, "; ")
+}
+
+// validatePromotions checks that there is at least one service, and that no service or directory is promoted twice
+func validatePromotions(promotions []ServicePromotion) error {
+	if len(promotions) == 0 {
+		return errors.New("No services to promote")
+	}
+
+	names := map[string]bool{}
+	dirs := map[string]bool{}
+	for _, promotion := range promotions {
+		if names[promotion.Target.Name] {
+			return fmt.Errorf("Service %v is promoted more than once", promotion.Target.Name)
+		}
+		if dirs[promotion.Target.Dir()] {
+			return fmt.Errorf("Directory %v is used by more than one service", promotion.Target.Dir())
+		}
+		names[promotion.Target.Name] = true
+		dirs[promotion.Target.Dir()] = true
+
+		if err := promotion.Source.Validate(); err != nil {
+			return fmt.Errorf("Invalid source of service %v: %v", promotion.Target.Name, err)
+		}
+	}
+	return nil
+}
+
+// commitMessage returns "Updated to version <version>" for a single service and
+// "Updated to version <service>-<version>, ..." if several services are promoted together
+func commitMessage(promotions []ServicePromotion) string {
+	if len(promotions) == 1 {
+		return promotionCommitMessage + promotions[0].Version
+	}
+
+	var versions []string
+	for _, promotion := range promotions {
+		versions = append(versions, promotion.Target.Name+"-"+promotion.Version)
+	}
+	return promotionCommitMessage + strings.Join(versions, ", ")
+}
+
+func servicesAttribute(promotions []ServicePromotion) string {
+	var names []string
+	for _, promotion := range promotions {
+		names = append(names, promotion.Target.Name)
+	}
+	return strings.Join(names, ",")
+}
+
 //go:generate moq -pkg githandler_mock -skip-ensure -out ../eventhandler/fake/githandler_mock.go . GitHandlerInterface
 type GitHandlerInterface interface {
-	GetGitSecret(project string, namespace string) (GitCredentials, error)
-	UpdateGitRepo(credentials GitCredentials, stage string, service string, version string) error
+	GetGitSecret(ctx context.Context, project string, namespace string) (GitCredentials, error)
+	UpdateGitRepo(ctx context.Context, credentials GitCredentials, stage Stage, promotions []ServicePromotion, metadata PromotionMetadata) (string, error)
+	ReadFile(credentials GitCredentials, branch string, file string) ([]byte, error)
+	ReadHistories(credentials GitCredentials, stage Stage, serviceDirs []string) (map[string]*History, error)
 }
 
+// promotionCommitMessage is the message prefix of all commits created by a promotion
+const promotionCommitMessage = "Updated to version "
+
 type GitHandler struct {
+	// ServiceFormats declares the format of a service, services without entry are detected automatically
+	ServiceFormats map[string]string
+	// AuthorName and AuthorEmail set the identity of promotion commits, defaults are used if empty
+	AuthorName  string
+	AuthorEmail string
+	// Signer signs promotion commits if set
+	Signer Signer
+	// Credentials provides the git credentials of projects, they are read from Kubernetes secrets if nil
+	Credentials CredentialsProvider
 }
 
-func (gh *GitHandler) GetGitSecret(project string, namespace string) (GitCredentials, error) {
-	secret := GitCredentials{}
-	clientset, err := keptnutils.GetClientset(true)
-	if err != nil {
-		return GitCredentials{}, err
-	}
+const (
+	defaultAuthorName  = "Keptn Promotion Service"
+	defaultAuthorEmail = "noreply@keptn.sh"
+)
 
-	gitSecret, err := clientset.CoreV1().Secrets(namespace).Get(context.TODO(), "git-credentials-"+project, metav1.GetOptions{})
-	if err != nil {
-		return GitCredentials{}, err
+func (gh *GitHandler) commitAuthor() *object.Signature {
+	author := &object.Signature{
+		Name:  defaultAuthorName,
+		Email: defaultAuthorEmail,
+		When:  time.Now(),
+	}
+	if gh.AuthorName != "" {
+		author.Name = gh.AuthorName
+	}
+	if gh.AuthorEmail != "" {
+		author.Email = gh.AuthorEmail
 	}
+	return author
+}
 
-	err = json.Unmarshal(gitSecret.Data["git-credentials"], &secret)
-	if err != nil {
-		return GitCredentials{}, err
+// GetGitSecret returns the git credentials of the project from the configured provider, from the git-credentials-<project>
+// secret in the namespace if there is none
+func (gh *GitHandler) GetGitSecret(ctx context.Context, project string, namespace string) (_ GitCredentials, err error) {
+	ctx, span := tracing.StartSpan(ctx, "GetGitSecret", tracing.ProjectKey.String(project))
+	defer func() { tracing.EndSpan(span, err) }()
+
+	provider := gh.Credentials
+	if provider == nil {
+		provider = &KubernetesCredentialsProvider{Namespace: namespace}
 	}
-	return secret, nil
+	return provider.GetCredentials(ctx, project)
 }
 
-func (gh *GitHandler) UpdateGitRepo(credentials GitCredentials, stage string, service string, version string) error {
-	authentication := &http.BasicAuth{
-		Username: credentials.User,
-		Password: credentials.Token,
+// UpdateGitRepo promotes all services into the stage branch with a single commit and returns the hash of the commit.
+// The stage branch is only updated if the promotion of every service succeeds, otherwise a ServicesError is returned.
+func (gh *GitHandler) UpdateGitRepo(ctx context.Context, credentials GitCredentials, stage Stage, promotions []ServicePromotion, metadata PromotionMetadata) (_ string, err error) {
+	ctx, span := tracing.StartSpan(ctx, "UpdateGitRepo",
+		tracing.StageKey.String(stage.Name),
+		tracing.ServiceKey.String(servicesAttribute(promotions)),
+	)
+	if len(promotions) == 1 {
+		span.SetAttributes(
+			tracing.VersionKey.String(promotions[0].Version),
+			attribute.String("promotion.source", string(promotions[0].Source.Type)),
+		)
 	}
+	defer func() { tracing.EndSpan(span, err) }()
 
-	cloneOptionsMaster := git.CloneOptions{
-		URL:           credentials.RemoteURI,
-		Auth:          authentication,
-		ReferenceName: plumbing.ReferenceName("refs/tags/" + service + "-" + version),
-		SingleBranch:  true,
+	if err = validatePromotions(promotions); err != nil {
+		return "", err
+	}
+
+	branch, stageDir, err := stage.Layout.Location(stage.Name)
+	if err != nil {
+		return "", err
 	}
+	span.SetAttributes(attribute.String("git.branch", branch))
+
+	authentication := credentials.authMethod()
 
 	cloneOptionsStage := git.CloneOptions{
 		URL:           credentials.RemoteURI,
 		Auth:          authentication,
-		ReferenceName: plumbing.ReferenceName("refs/heads/" + stage),
+		ReferenceName: branchReference(branch),
 		SingleBranch:  true,
 	}
 
 	commitOptions := git.CommitOptions{
-		Author: &object.Signature{
-			Name:  "Keptn Promotion Service",
-			Email: "noreply@keptn.sh",
-			When:  time.Now(),
-		},
+		Author: gh.commitAuthor(),
 	}
 
-	dirMaster, _ := ioutil.TempDir("", "temp_dir_master")
-	dirStage, _ := ioutil.TempDir("", "temp_dir_"+stage)
-
-	_, err := git.PlainClone(dirMaster, false, &cloneOptionsMaster)
-	if err != nil {
-		log.Println("Could not checkout "+credentials.RemoteURI+"/master", err)
-		return err
-	}
+	dirStage, _ := ioutil.TempDir("", "temp_dir_"+stage.Name)
+	defer os.RemoveAll(dirStage)
 
+	cloneStart := time.Now()
+	_, cloneSpan := tracing.StartSpan(ctx, "clone", attribute.String("git.reference", cloneOptionsStage.ReferenceName.String()))
 	stageRepo, err := git.PlainClone(dirStage, false, &cloneOptionsStage)
+	tracing.EndSpan(cloneSpan, err)
+	metrics.ObservePhase(metrics.PhaseClone, cloneStart)
 	if err != nil {
-		log.Println("Could not checkout "+credentials.RemoteURI+"/"+stage, err)
-		return err
+		metrics.GitError(metrics.OperationClone)
+		log.Println("Could not checkout "+credentials.RemoteURI+"/"+branch, err)
+		return "", err
 	}
 
 	w, err := stageRepo.Worktree()
 	if err != nil {
 		fmt.Printf("%v", err)
-		return err
+		return "", err
 	}
 
-	// Remove service directory
-	os.RemoveAll(filepath.Join(dirStage, service))
-
 	fs := afero.NewOsFs()
 
-	err = mergeHelmValues(fs, service, stage, dirMaster, dirStage)
+	// all services are promoted into the checkout before anything is committed, so that either all or none are promoted
+	servicesErr := ServicesError{}
+	for _, promotion := range promotions {
+		if err := gh.promoteService(ctx, fs, credentials.RemoteURI, authentication, filepath.Join(dirStage, stageDir), stage, promotion, metadata); err != nil {
+			log.Printf("Could not promote service %v: %v", promotion.Target.Name, err)
+			servicesErr[promotion.Target.Name] = err
+		}
+	}
+	if len(servicesErr) > 0 {
+		return "", servicesErr
+	}
+
+	err = gh.commit(ctx, stageRepo, w, dirStage, branch, commitMessage(promotions), commitOptions)
 	if err != nil {
-		log.Println("Couldn't Merge Helm Values", err)
+		return "", err
 	}
 
-	err = performFileMove(fs, service, stage, dirMaster, dirStage)
+	pushStart := time.Now()
+	_, pushSpan := tracing.StartSpan(ctx, "push")
+	err = stageRepo.Push(&git.PushOptions{
+		RemoteName: "origin",
+		Auth:       authentication,
+	})
+	if err == git.NoErrAlreadyUpToDate {
+		err = nil
+	}
+	tracing.EndSpan(pushSpan, err)
+	metrics.ObservePhase(metrics.PhasePush, pushStart)
 	if err != nil {
+		metrics.GitError(metrics.OperationPush)
+		log.Println("Couldn't push "+branch, err)
+		return "", fmt.Errorf("Could not push %v: %w", branch, err)
+	}
+
+	return headCommit(dirStage)
+}
+
+// promoteService replaces the directory of the service in dirStage, the directory of the stage in the checkout of the
+// stage branch, and records the promotion in its history
+func (gh *GitHandler) promoteService(ctx context.Context, fs afero.Fs, remoteURI string, auth transport.AuthMethod, dirStage string, stage Stage, promotion ServicePromotion, metadata PromotionMetadata) error {
+	service := promotion.Target
+	version := promotion.Version
+	source := promotion.Source
+
+	dirSource, _ := ioutil.TempDir("", "temp_dir_source")
+	dirRender, _ := ioutil.TempDir("", "temp_dir_render")
+	defer os.RemoveAll(dirSource)
+	defer os.RemoveAll(dirRender)
+
+	history, err := readHistory(fs, dirStage, service.Dir())
+	if err != nil {
+		log.Println("Could not read promotion history of "+service.Name, err)
 		return err
 	}
 
-	// Replace Version in the Values File
-	err = ReplaceInFile(filepath.Join(dirStage, service, "helm", service, "values.yaml"), "{{ keptn/ImageVersion }}", version)
+	// the new content of the service is prepared in <dirRender>/<service> before it replaces the service directory
+	switch source.Type {
+	case SourceStage:
+		err = gh.promoteFromStage(ctx, fs, remoteURI, auth, dirSource, dirRender, Stage{Name: source.Stage, Layout: stage.Layout}, service, version, source)
+	case SourceCommit:
+		err = gh.promoteFromCommit(ctx, fs, remoteURI, auth, dirSource, dirRender, stage.Name, service, version, source)
+	default:
+		err = cloneSource(ctx, dirSource, remoteURI, auth, tagReference(service.Name, version), "")
+		if err == nil {
+			err = gh.renderService(ctx, fs, dirSource, dirRender, stage.Name, service, version)
+		}
+	}
 	if err != nil {
-		log.Println("Couldn't Replace Version in values.yaml")
+		return err
 	}
 
+	serviceDir := filepath.Join(dirStage, service.Dir())
+	if err = fs.RemoveAll(serviceDir); err != nil {
+		return fmt.Errorf("Could not delete service %v from %v: %v", service.Name, service.Dir(), err)
+	}
+	if err = fs.MkdirAll(filepath.Dir(serviceDir), os.ModePerm); err != nil {
+		return err
+	}
+	if err = fs.Rename(filepath.Join(dirRender, service.Name), serviceDir); err != nil {
+		return fmt.Errorf("Could not move service %v to %v: %v", service.Name, service.Dir(), err)
+	}
+
+	sourceCommit, err := headCommit(dirSource)
+	if err != nil {
+		return fmt.Errorf("Could not determine source commit: %v", err)
+	}
+
+	history.Promotions = append(history.Promotions, newHistoryEntry(version, source, sourceCommit, metadata, time.Now()))
+	err = writeHistory(fs, dirStage, service.Dir(), history)
+	if err != nil {
+		return fmt.Errorf("Could not write promotion history: %v", err)
+	}
+	return nil
+}
+
+// commit adds all changes of the stage checkout to a promotion commit and signs it if a signer is configured
+func (gh *GitHandler) commit(ctx context.Context, stageRepo *git.Repository, w *git.Worktree, dirStage string, branch string, message string, commitOptions git.CommitOptions) (err error) {
+	_, span := tracing.StartSpan(ctx, "commit")
+	defer func() { tracing.EndSpan(span, err) }()
+
 	cmd := exec.Command("git", "add", ".")
 	cmd.Dir = dirStage
 	err = cmd.Run()
 	if err != nil {
 		log.Println("Could not add files")
+		return fmt.Errorf("Could not add files: %v", err)
 	}
 
-	_, err = w.Commit("Updated to version "+version, &commitOptions)
+	_, err = w.Commit(message, &commitOptions)
 	if err != nil {
-		log.Println("Couldn't commit "+stage, err)
+		metrics.GitError(metrics.OperationCommit)
+		log.Println("Couldn't commit "+branch, err)
+		return fmt.Errorf("Could not commit %v: %v", branch, err)
 	}
 
-	err = stageRepo.Push(&git.PushOptions{
-		RemoteName: "origin",
-		Auth:       authentication,
+	if gh.Signer != nil {
+		err = signHead(stageRepo, gh.Signer)
+		if err != nil {
+			metrics.GitError(metrics.OperationSign)
+			log.Println("Couldn't sign commit for "+branch, err)
+			return fmt.Errorf("Could not sign commit for %v: %v", branch, err)
+		}
+	}
+
+	return nil
+}
+
+// CommitURL returns the link to the commit in the web interface of GitHub, GitLab, Gitea and similar hosts, which
+// serve commits under <repository>/commit/<hash>. It is empty if the repository URL cannot be derived from remoteURI.
+func CommitURL(remoteURI string, hash string) string {
+	if hash == "" {
+		return ""
+	}
+
+	repository := strings.TrimSuffix(remoteURI, ".git")
+	if strings.HasPrefix(repository, "git@") && strings.Contains(repository, ":") {
+		// scp-like SSH remotes, e.g. git@github.com:org/repo.git
+		repository = "https://" + strings.Replace(strings.TrimPrefix(repository, "git@"), ":", "/", 1)
+	}
+
+	repositoryURL, err := url.Parse(repository)
+	if err != nil || (repositoryURL.Scheme != "https" && repositoryURL.Scheme != "http") || repositoryURL.Host == "" {
+		return ""
+	}
+	repositoryURL.User = nil
+	return strings.TrimSuffix(repositoryURL.String(), "/") + "/commit/" + hash
+}
+
+// ReadFile returns the content of a file on the branch, or on the default branch if branch is empty
+func (gh *GitHandler) ReadFile(credentials GitCredentials, branch string, file string) ([]byte, error) {
+	cloneOptions := git.CloneOptions{
+		URL:          credentials.RemoteURI,
+		Auth:         credentials.authMethod(),
+		SingleBranch: true,
+		Depth:        1,
+	}
+	if branch != "" {
+		cloneOptions.ReferenceName = branchReference(branch)
+	}
+
+	dir, _ := ioutil.TempDir("", "temp_dir_read")
+	defer os.RemoveAll(dir)
+
+	_, err := git.PlainClone(dir, false, &cloneOptions)
+	if err != nil {
+		metrics.GitError(metrics.OperationClone)
+		log.Println("Could not checkout "+credentials.RemoteURI+"/"+branch, err)
+		return nil, err
+	}
+
+	return ioutil.ReadFile(filepath.Join(dir, file))
+}
+
+// ReadHistories returns the promotion histories of the services in serviceDirs in the stage, keyed by the service
+// directory. All histories are read from a single shallow clone of the stage branch, services without a history get an
+// empty one.
+func (gh *GitHandler) ReadHistories(credentials GitCredentials, stage Stage, serviceDirs []string) (map[string]*History, error) {
+	branch, stageDir, err := stage.Layout.Location(stage.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	repo, err := git.Clone(memory.NewStorage(), nil, &git.CloneOptions{
+		URL:           credentials.RemoteURI,
+		Auth:          credentials.authMethod(),
+		ReferenceName: branchReference(branch),
+		SingleBranch:  true,
+		NoCheckout:    true,
+		Depth:         1,
 	})
 	if err != nil {
-		log.Println("Couldn't push "+stage, err)
+		metrics.GitError(metrics.OperationClone)
+		log.Println("Could not checkout "+credentials.RemoteURI+"/"+branch, err)
+		return nil, err
 	}
-	defer os.RemoveAll(dirMaster)
-	defer os.RemoveAll(dirStage)
 
+	head, err := repo.Head()
+	if err != nil {
+		return nil, err
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	histories := map[string]*History{}
+	for _, serviceDir := range serviceDirs {
+		file, err := tree.File(path.Join(stageDir, HistoryFile(serviceDir)))
+		if errors.Is(err, object.ErrFileNotFound) {
+			histories[serviceDir] = &History{}
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		content, err := file.Contents()
+		if err != nil {
+			return nil, err
+		}
+		if histories[serviceDir], err = ParseHistory([]byte(content)); err != nil {
+			return nil, err
+		}
+	}
+	return histories, nil
+}
+
+// promoteFromStage copies the service directory exactly as it is on the source stage branch to <destinationDir>/<service>
+func (gh *GitHandler) promoteFromStage(ctx context.Context, fs afero.Fs, remoteURI string, auth transport.AuthMethod, dirSource string, destinationDir string, sourceStage Stage, service ServiceTarget, version string, source PromotionSource) error {
+	branch, stageDir, err := sourceStage.Layout.Location(sourceStage.Name)
+	if err != nil {
+		return err
+	}
+
+	err = cloneSource(ctx, dirSource, remoteURI, auth, branchReference(branch), "")
+	if err != nil {
+		return err
+	}
+
+	serviceSourceDir := filepath.Join(dirSource, stageDir, service.Dir())
+	if exists, _ := afero.DirExists(fs, serviceSourceDir); !exists {
+		return fmt.Errorf("Service %v does not exist on stage branch %v", service.Name, source.Stage)
+	}
+
+	if source.VerifyAgainstTag {
+		err = gh.verifyAgainstTag(ctx, fs, remoteURI, auth, serviceSourceDir, source.Stage, service, version)
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Copying service %s from stage branch %s\n", service.Name, source.Stage)
+	return fs.Rename(serviceSourceDir, filepath.Join(destinationDir, service.Name))
+}
+
+// promoteFromCommit renders the service for the stage from an explicit commit instead of the version tag
+func (gh *GitHandler) promoteFromCommit(ctx context.Context, fs afero.Fs, remoteURI string, auth transport.AuthMethod, dirSource string, destinationDir string, stage string, service ServiceTarget, version string, source PromotionSource) error {
+	err := cloneSource(ctx, dirSource, remoteURI, auth, "", source.Commit)
+	if err != nil {
+		return err
+	}
+
+	err = gh.renderService(ctx, fs, dirSource, destinationDir, stage, service, version)
+	if err != nil {
+		return err
+	}
+
+	if source.VerifyAgainstTag {
+		return gh.verifyAgainstTag(ctx, fs, remoteURI, auth, filepath.Join(destinationDir, service.Name), stage, service, version)
+	}
+	return nil
+}
+
+// verifyAgainstTag fails if the content of serviceDir differs from what the version tag produces for the stage
+func (gh *GitHandler) verifyAgainstTag(ctx context.Context, fs afero.Fs, remoteURI string, auth transport.AuthMethod, serviceDir string, stage string, service ServiceTarget, version string) error {
+	dirExpected, _ := ioutil.TempDir("", "temp_dir_verify")
+	defer os.RemoveAll(dirExpected)
+
+	err := gh.renderServiceFromTag(ctx, fs, remoteURI, auth, dirExpected, stage, service, version)
+	if err != nil {
+		return err
+	}
+
+	diff, err := diffDirectories(fs, filepath.Join(dirExpected, service.Name), serviceDir)
+	if err != nil {
+		return err
+	}
+	if len(diff) > 0 {
+		return fmt.Errorf("Content of service %v differs from tag %v-%v for stage %v: %v", service.Name, service.Name, version, stage, strings.Join(diff, ", "))
+	}
 	return nil
 }
 
@@ -0,0 +1,372 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"gopkg.in/yaml.v3"
+	"gotest.tools/assert"
+)
+
+// testRemote is a bare repository with the configuration of the carts and orders services on the default branch, the
+// tags carts-1 and orders-2 and the stage branches dev and prod, as well as env/dev and env/prod
+type testRemote struct {
+	dir     string
+	tagHash plumbing.Hash
+}
+
+func newTestRemote(t *testing.T) *testRemote {
+	bareDir, err := ioutil.TempDir("", "test_remote")
+	assert.NilError(t, err)
+	workDir, err := ioutil.TempDir("", "test_work")
+	assert.NilError(t, err)
+	defer os.RemoveAll(workDir)
+
+	_, err = git.PlainInit(bareDir, true)
+	assert.NilError(t, err)
+
+	work, err := git.PlainInit(workDir, false)
+	assert.NilError(t, err)
+	_, err = work.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{"file://" + bareDir}})
+	assert.NilError(t, err)
+	w, err := work.Worktree()
+	assert.NilError(t, err)
+
+	commit := func(message string, files map[string]string) plumbing.Hash {
+		for name, content := range files {
+			path := filepath.Join(workDir, name)
+			assert.NilError(t, os.MkdirAll(filepath.Dir(path), 0755))
+			assert.NilError(t, ioutil.WriteFile(path, []byte(content), 0644))
+			_, err := w.Add(name)
+			assert.NilError(t, err)
+		}
+		hash, err := w.Commit(message, &git.CommitOptions{
+			Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+		})
+		assert.NilError(t, err)
+		return hash
+	}
+
+	initial := commit("Initial commit", map[string]string{"README.md": "# sockshop"})
+	for _, branch := range []string{"dev", "prod", "env/dev", "env/prod"} {
+		assert.NilError(t, work.Storer.SetReference(plumbing.NewHashReference(branchReference(branch), initial)))
+	}
+
+	tagHash := commit("Add carts", map[string]string{
+		"base/carts/helm/carts/Chart.yaml":         "name: carts\nversion: 0.1.0\n",
+		"base/carts/helm/carts/values.yaml":        "image: carts:{{ keptn/ImageVersion }}\nreplicas: 1\n",
+		"stages/dev/carts/helm/carts/values.yaml":  "replicas: 2\n",
+		"stages/prod/carts/helm/carts/values.yaml": "replicas: 3\n",
+		"base/orders/deployment.yaml":              "image: orders:{{ keptn/ImageVersion }}\n",
+	})
+	for _, tag := range []string{"carts-1", "orders-2"} {
+		_, err = work.CreateTag(tag, tagHash, nil)
+		assert.NilError(t, err)
+	}
+
+	err = work.Push(&git.PushOptions{
+		RemoteName: "origin",
+		RefSpecs:   []config.RefSpec{"refs/heads/*:refs/heads/*", "refs/tags/*:refs/tags/*"},
+	})
+	assert.NilError(t, err)
+
+	return &testRemote{dir: bareDir, tagHash: tagHash}
+}
+
+func (r *testRemote) credentials() GitCredentials {
+	return GitCredentials{RemoteURI: "file://" + r.dir}
+}
+
+// branch returns the hash of the head and the content of all files of a branch
+func (r *testRemote) branch(t *testing.T, branch string) (plumbing.Hash, map[string]string) {
+	head, files := r.branchCommit(t, branch)
+	return head.Hash, files
+}
+
+// branchCommit returns the head commit and the content of all files of a branch
+func (r *testRemote) branchCommit(t *testing.T, branch string) (*object.Commit, map[string]string) {
+	repo, err := git.Clone(memory.NewStorage(), nil, &git.CloneOptions{
+		URL:           r.credentials().RemoteURI,
+		ReferenceName: branchReference(branch),
+		SingleBranch:  true,
+		NoCheckout:    true,
+	})
+	assert.NilError(t, err)
+
+	head, err := repo.Head()
+	assert.NilError(t, err)
+	commit, err := repo.CommitObject(head.Hash())
+	assert.NilError(t, err)
+	files, err := commit.Files()
+	assert.NilError(t, err)
+
+	contents := map[string]string{}
+	err = files.ForEach(func(file *object.File) error {
+		content, err := file.Contents()
+		contents[file.Name] = content
+		return err
+	})
+	assert.NilError(t, err)
+	return commit, contents
+}
+
+func testPromotion(service ServiceTarget, version string, source PromotionSource) []ServicePromotion {
+	return []ServicePromotion{{Target: service, Version: version, Source: source}}
+}
+
+func parseTestValues(t *testing.T, content string) map[string]interface{} {
+	values := map[string]interface{}{}
+	assert.NilError(t, yaml.Unmarshal([]byte(content), &values))
+	return values
+}
+
+func TestUpdateGitRepo_EndToEnd(t *testing.T) {
+	remote := newTestRemote(t)
+	defer os.RemoveAll(remote.dir)
+
+	credentialsDir, err := ioutil.TempDir("", "test_credentials")
+	assert.NilError(t, err)
+	defer os.RemoveAll(credentialsDir)
+	err = ioutil.WriteFile(filepath.Join(credentialsDir, "git-credentials-sockshop"), []byte(`{"remoteURI": "file://`+remote.dir+`"}`), 0644)
+	assert.NilError(t, err)
+
+	ctx := context.Background()
+	gh := &GitHandler{Credentials: &FileCredentialsProvider{Dir: credentialsDir}}
+
+	credentials, err := gh.GetGitSecret(ctx, "sockshop", "keptn")
+	assert.NilError(t, err)
+
+	// promote the version tag into dev
+	commit, err := gh.UpdateGitRepo(ctx, credentials, Stage{Name: "dev"}, testPromotion(ServiceTarget{Name: "carts"}, "1", PromotionSource{Type: SourceTag}), PromotionMetadata{
+		KeptnContext: "ctx-1",
+		TriggeredID:  "event-1",
+		Labels:       map[string]string{"version": "1"},
+	})
+	assert.NilError(t, err)
+
+	devHead, dev := remote.branch(t, "dev")
+	assert.Equal(t, commit, devHead.String())
+	assert.Equal(t, len(dev), 4)
+	assert.Equal(t, dev["README.md"], "# sockshop")
+	assert.Equal(t, dev["carts/helm/carts/Chart.yaml"], "name: carts\nversion: 0.1.0\n")
+	assert.DeepEqual(t, parseTestValues(t, dev["carts/helm/carts/values.yaml"]), map[string]interface{}{"image": "carts:1", "replicas": 2})
+
+	history, err := ParseHistory([]byte(dev["carts/"+HistoryFileName]))
+	assert.NilError(t, err)
+	assert.Equal(t, len(history.Promotions), 1)
+	assert.Equal(t, history.Promotions[0].Version, "1")
+	assert.Equal(t, history.Promotions[0].Source, SourceTag)
+	assert.Equal(t, history.Promotions[0].SourceCommit, remote.tagHash.String())
+	assert.Equal(t, history.Promotions[0].KeptnContext, "ctx-1")
+	assert.Equal(t, history.Promotions[0].TriggeredID, "event-1")
+
+	// promote the content of dev into prod, verified against the tag
+	_, err = gh.UpdateGitRepo(ctx, credentials, Stage{Name: "prod"}, testPromotion(ServiceTarget{Name: "carts"}, "1", PromotionSource{Type: SourceStage, Stage: "dev", VerifyAgainstTag: true}), PromotionMetadata{KeptnContext: "ctx-2"})
+	assert.NilError(t, err)
+
+	_, prod := remote.branch(t, "prod")
+	assert.Equal(t, prod["carts/helm/carts/values.yaml"], dev["carts/helm/carts/values.yaml"])
+
+	history, err = ParseHistory([]byte(prod["carts/"+HistoryFileName]))
+	assert.NilError(t, err)
+	assert.Equal(t, len(history.Promotions), 1)
+	assert.Equal(t, history.Promotions[0].Source, SourceStage)
+	assert.Equal(t, history.Promotions[0].SourceStage, "dev")
+	assert.Equal(t, history.Promotions[0].SourceCommit, devHead.String())
+	assert.Equal(t, history.Promotions[0].KeptnContext, "ctx-2")
+
+	// the promotions can be read back
+	content, err := gh.ReadFile(credentials, "dev", HistoryFile("carts"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), dev["carts/"+HistoryFileName])
+
+	histories, err := gh.ReadHistories(credentials, Stage{Name: "dev"}, []string{"carts", "orders"})
+	assert.NilError(t, err)
+	assert.Equal(t, histories["carts"].CountSince(time.Now().Add(-time.Hour)), 1)
+	assert.Equal(t, histories["carts"].CountSince(time.Now().Add(time.Hour)), 0)
+	assert.Equal(t, len(histories["orders"].Promotions), 0)
+}
+
+func TestUpdateGitRepo_EndToEnd_MissingTag(t *testing.T) {
+	remote := newTestRemote(t)
+	defer os.RemoveAll(remote.dir)
+
+	gh := &GitHandler{}
+	_, err := gh.UpdateGitRepo(context.Background(), remote.credentials(), Stage{Name: "dev"}, testPromotion(ServiceTarget{Name: "carts"}, "2", PromotionSource{Type: SourceTag}), PromotionMetadata{})
+	assert.ErrorContains(t, err, "refs/tags/carts-2")
+
+	_, dev := remote.branch(t, "dev")
+	assert.DeepEqual(t, dev, map[string]string{"README.md": "# sockshop"})
+}
+
+func TestUpdateGitRepo_EndToEnd_TargetPath(t *testing.T) {
+	remote := newTestRemote(t)
+	defer os.RemoveAll(remote.dir)
+
+	ctx := context.Background()
+	gh := &GitHandler{}
+	target := ServiceTarget{Name: "carts", Path: "apps/carts", Format: "raw"}
+
+	for _, stage := range []string{"dev", "prod"} {
+		source := PromotionSource{Type: SourceTag}
+		if stage == "prod" {
+			source = PromotionSource{Type: SourceStage, Stage: "dev"}
+		}
+		_, err := gh.UpdateGitRepo(ctx, remote.credentials(), Stage{Name: stage}, testPromotion(target, "1", source), PromotionMetadata{})
+		assert.NilError(t, err)
+
+		_, files := remote.branch(t, stage)
+		assert.Equal(t, len(files), 4)
+		// the raw format replaces the base values with the stage values instead of merging them
+		assert.Equal(t, files["apps/carts/helm/carts/values.yaml"], "replicas: 2\n")
+		assert.Equal(t, files["apps/carts/helm/carts/Chart.yaml"], "name: carts\nversion: 0.1.0\n")
+		assert.Assert(t, files["apps/carts/"+HistoryFileName] != "")
+
+		histories, err := gh.ReadHistories(remote.credentials(), Stage{Name: stage}, []string{target.Dir()})
+		assert.NilError(t, err)
+		assert.Equal(t, histories[target.Dir()].CountSince(time.Now().Add(-time.Hour)), 1)
+	}
+}
+
+func TestUpdateGitRepo_EndToEnd_BranchTemplate(t *testing.T) {
+	remote := newTestRemote(t)
+	defer os.RemoveAll(remote.dir)
+
+	ctx := context.Background()
+	gh := &GitHandler{}
+	layout := StageLayout{Branch: "env/{{ .Stage }}"}
+
+	_, err := gh.UpdateGitRepo(ctx, remote.credentials(), Stage{Name: "dev", Layout: layout}, testPromotion(ServiceTarget{Name: "carts"}, "1", PromotionSource{Type: SourceTag}), PromotionMetadata{})
+	assert.NilError(t, err)
+	_, err = gh.UpdateGitRepo(ctx, remote.credentials(), Stage{Name: "prod", Layout: layout}, testPromotion(ServiceTarget{Name: "carts"}, "1", PromotionSource{Type: SourceStage, Stage: "dev"}), PromotionMetadata{})
+	assert.NilError(t, err)
+
+	_, envDev := remote.branch(t, "env/dev")
+	_, envProd := remote.branch(t, "env/prod")
+	assert.Equal(t, parseTestValues(t, envDev["carts/helm/carts/values.yaml"])["replicas"], 2)
+	assert.DeepEqual(t, envProd["carts/helm/carts/values.yaml"], envDev["carts/helm/carts/values.yaml"])
+
+	// the branches named like the stages are not touched
+	_, dev := remote.branch(t, "dev")
+	assert.DeepEqual(t, dev, map[string]string{"README.md": "# sockshop"})
+
+	histories, err := gh.ReadHistories(remote.credentials(), Stage{Name: "prod", Layout: layout}, []string{"carts"})
+	assert.NilError(t, err)
+	assert.Equal(t, histories["carts"].CountSince(time.Now().Add(-time.Hour)), 1)
+}
+
+func TestUpdateGitRepo_EndToEnd_SingleBranch(t *testing.T) {
+	remote := newTestRemote(t)
+	defer os.RemoveAll(remote.dir)
+
+	ctx := context.Background()
+	gh := &GitHandler{}
+	layout := StageLayout{Branch: "master", Directory: "stages-rendered/{{ .Stage }}"}
+
+	_, err := gh.UpdateGitRepo(ctx, remote.credentials(), Stage{Name: "dev", Layout: layout}, testPromotion(ServiceTarget{Name: "carts"}, "1", PromotionSource{Type: SourceTag}), PromotionMetadata{})
+	assert.NilError(t, err)
+	_, err = gh.UpdateGitRepo(ctx, remote.credentials(), Stage{Name: "prod", Layout: layout}, testPromotion(ServiceTarget{Name: "carts"}, "1", PromotionSource{Type: SourceStage, Stage: "dev"}), PromotionMetadata{})
+	assert.NilError(t, err)
+
+	_, files := remote.branch(t, "master")
+	// the configuration on the branch is kept next to the rendered stages
+	assert.Equal(t, files["base/carts/helm/carts/Chart.yaml"], "name: carts\nversion: 0.1.0\n")
+	assert.Equal(t, parseTestValues(t, files["stages-rendered/dev/carts/helm/carts/values.yaml"])["replicas"], 2)
+	assert.Equal(t, files["stages-rendered/prod/carts/helm/carts/values.yaml"], files["stages-rendered/dev/carts/helm/carts/values.yaml"])
+	assert.Assert(t, files["stages-rendered/prod/carts/"+HistoryFileName] != "")
+
+	for _, stage := range []string{"dev", "prod"} {
+		histories, err := gh.ReadHistories(remote.credentials(), Stage{Name: stage, Layout: layout}, []string{"carts"})
+		assert.NilError(t, err)
+		assert.Equal(t, histories["carts"].CountSince(time.Now().Add(-time.Hour)), 1)
+	}
+}
+
+func TestUpdateGitRepo_EndToEnd_MultipleServices(t *testing.T) {
+	remote := newTestRemote(t)
+	defer os.RemoveAll(remote.dir)
+
+	initial, _ := remote.branch(t, "dev")
+	gh := &GitHandler{}
+	promotions := []ServicePromotion{
+		{Target: ServiceTarget{Name: "carts"}, Version: "1", Source: PromotionSource{Type: SourceTag}},
+		{Target: ServiceTarget{Name: "orders"}, Version: "2", Source: PromotionSource{Type: SourceTag}},
+	}
+
+	_, err := gh.UpdateGitRepo(context.Background(), remote.credentials(), Stage{Name: "dev"}, promotions, PromotionMetadata{KeptnContext: "ctx-1"})
+	assert.NilError(t, err)
+
+	head, dev := remote.branchCommit(t, "dev")
+	assert.Equal(t, head.Message, "Updated to version carts-1, orders-2")
+	assert.DeepEqual(t, head.ParentHashes, []plumbing.Hash{initial})
+	assert.Equal(t, dev["orders/deployment.yaml"], "image: orders:2\n")
+	assert.DeepEqual(t, parseTestValues(t, dev["carts/helm/carts/values.yaml"]), map[string]interface{}{"image": "carts:1", "replicas": 2})
+
+	for _, service := range []string{"carts", "orders"} {
+		history, err := ParseHistory([]byte(dev[HistoryFile(service)]))
+		assert.NilError(t, err)
+		assert.Equal(t, len(history.Promotions), 1)
+		assert.Equal(t, history.Promotions[0].KeptnContext, "ctx-1")
+	}
+}
+
+func TestUpdateGitRepo_EndToEnd_MultipleServices_AllOrNothing(t *testing.T) {
+	remote := newTestRemote(t)
+	defer os.RemoveAll(remote.dir)
+
+	gh := &GitHandler{}
+	promotions := []ServicePromotion{
+		{Target: ServiceTarget{Name: "carts"}, Version: "1", Source: PromotionSource{Type: SourceTag}},
+		{Target: ServiceTarget{Name: "orders"}, Version: "3", Source: PromotionSource{Type: SourceTag}},
+	}
+
+	_, err := gh.UpdateGitRepo(context.Background(), remote.credentials(), Stage{Name: "dev"}, promotions, PromotionMetadata{})
+	servicesErr, ok := err.(ServicesError)
+	assert.Assert(t, ok, "unexpected error %v", err)
+	assert.Equal(t, len(servicesErr), 1)
+	assert.ErrorContains(t, servicesErr["orders"], "refs/tags/orders-3")
+
+	_, dev := remote.branch(t, "dev")
+	assert.DeepEqual(t, dev, map[string]string{"README.md": "# sockshop"})
+}
+
+func TestUpdateGitRepo_InvalidPromotions(t *testing.T) {
+	gh := &GitHandler{}
+	ctx := context.Background()
+
+	_, err := gh.UpdateGitRepo(ctx, GitCredentials{}, Stage{Name: "dev"}, nil, PromotionMetadata{})
+	assert.Error(t, err, "No services to promote")
+
+	_, err = gh.UpdateGitRepo(ctx, GitCredentials{}, Stage{Name: "dev"}, []ServicePromotion{
+		{Target: ServiceTarget{Name: "carts"}, Version: "1"},
+		{Target: ServiceTarget{Name: "carts"}, Version: "2"},
+	}, PromotionMetadata{})
+	assert.Error(t, err, "Service carts is promoted more than once")
+
+	_, err = gh.UpdateGitRepo(ctx, GitCredentials{}, Stage{Name: "dev"}, []ServicePromotion{
+		{Target: ServiceTarget{Name: "carts", Path: "apps/shop"}, Version: "1"},
+		{Target: ServiceTarget{Name: "orders", Path: "apps/shop"}, Version: "2"},
+	}, PromotionMetadata{})
+	assert.Error(t, err, "Directory apps/shop is used by more than one service")
+
+	_, err = gh.UpdateGitRepo(ctx, GitCredentials{}, Stage{Name: "dev"}, testPromotion(ServiceTarget{Name: "carts"}, "1", PromotionSource{Type: SourceStage}), PromotionMetadata{})
+	assert.Error(t, err, "Invalid source of service carts: No source stage given for promotion source stage")
+}
+
+func TestServicesError(t *testing.T) {
+	err := ServicesError{
+		"orders": errors.New("tag not found"),
+		"carts":  errors.New("invalid values"),
+	}
+	assert.Error(t, err, "carts: invalid values; orders: tag not found")
+}
@@ -0,0 +1,122 @@
+package git
+
+import (
+	"fmt"
+	"github.com/go-git/go-git/v5"
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// HistoryFileName is the name of the promotion history file in the service directory of a stage branch
+const HistoryFileName = ".promotion-history.yaml"
+
+// PromotionMetadata describes the event which triggered a promotion
+type PromotionMetadata struct {
+	KeptnContext string
+	TriggeredID  string
+	Labels       map[string]string
+}
+
+// History contains all promotions of a service into a stage, oldest first
+type History struct {
+	Promotions []HistoryEntry `json:"promotions" yaml:"promotions"`
+}
+
+// HistoryEntry records a single promotion of a service into a stage
+type HistoryEntry struct {
+	Version      string              `json:"version" yaml:"version"`
+	Source       PromotionSourceType `json:"source" yaml:"source"`
+	SourceStage  string              `json:"sourceStage,omitempty" yaml:"sourceStage,omitempty"`
+	SourceCommit string              `json:"sourceCommit" yaml:"sourceCommit"`
+	KeptnContext string              `json:"keptnContext" yaml:"keptnContext"`
+	TriggeredID  string              `json:"triggeredId" yaml:"triggeredId"`
+	Timestamp    time.Time           `json:"timestamp" yaml:"timestamp"`
+	Labels       map[string]string   `json:"labels,omitempty" yaml:"labels,omitempty"`
+}
+
+// newHistoryEntry records a promotion of the version from the source at the given time
+func newHistoryEntry(version string, source PromotionSource, sourceCommit string, metadata PromotionMetadata, now time.Time) HistoryEntry {
+	entry := HistoryEntry{
+		Version:      version,
+		Source:       source.Type,
+		SourceCommit: sourceCommit,
+		KeptnContext: metadata.KeptnContext,
+		TriggeredID:  metadata.TriggeredID,
+		Timestamp:    now.UTC(),
+		Labels:       metadata.Labels,
+	}
+	if entry.Source == "" {
+		entry.Source = SourceTag
+	}
+	if entry.Source == SourceStage {
+		entry.SourceStage = source.Stage
+	}
+	return entry
+}
+
+// CountSince returns the number of promotions at or after the given time
+func (history *History) CountSince(since time.Time) int {
+	count := 0
+	for _, entry := range history.Promotions {
+		if !entry.Timestamp.Before(since) {
+			count++
+		}
+	}
+	return count
+}
+
+// HistoryFile returns the path of the promotion history file of the service in serviceDir relative to the root of a stage branch
+func HistoryFile(serviceDir string) string {
+	return serviceDir + "/" + HistoryFileName
+}
+
+// ParseHistory parses the content of a promotion history file
+func ParseHistory(content []byte) (*History, error) {
+	history := &History{}
+	if err := yaml.Unmarshal(content, history); err != nil {
+		return nil, fmt.Errorf("Could not parse promotion history: %v", err)
+	}
+	return history, nil
+}
+
+// readHistory reads the promotion history of the service in serviceDir from a checkout of a stage branch, an empty
+// history if there is none
+func readHistory(fs afero.Fs, stageDir string, serviceDir string) (*History, error) {
+	content, err := afero.ReadFile(fs, filepath.Join(stageDir, serviceDir, HistoryFileName))
+	if os.IsNotExist(err) {
+		return &History{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return ParseHistory(content)
+}
+
+// writeHistory writes the promotion history of the service in serviceDir to a checkout of a stage branch
+func writeHistory(fs afero.Fs, stageDir string, serviceDir string, history *History) error {
+	out, err := yaml.Marshal(history)
+	if err != nil {
+		return fmt.Errorf("Could not create promotion history: %v", err)
+	}
+
+	dir := filepath.Join(stageDir, serviceDir)
+	if err := fs.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	return afero.WriteFile(fs, filepath.Join(dir, HistoryFileName), out, 0644)
+}
+
+// headCommit returns the hash of the commit checked out in dir
+func headCommit(dir string) (string, error) {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return "", err
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return "", err
+	}
+	return head.Hash().String(), nil
+}
@@ -0,0 +1,67 @@
+package git
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"gotest.tools/assert"
+)
+
+func TestHistory_ReadAndWrite(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	history, err := readHistory(fs, "stage", "carts")
+	assert.NilError(t, err)
+	assert.Equal(t, len(history.Promotions), 0)
+
+	metadata := PromotionMetadata{
+		KeptnContext: "ctx-1",
+		TriggeredID:  "event-1",
+		Labels:       map[string]string{"version": "1", "approvedBy": "jane@example.com"},
+	}
+	history.Promotions = append(history.Promotions, newHistoryEntry("1", PromotionSource{}, "abc", metadata, now))
+	assert.NilError(t, writeHistory(fs, "stage", "carts", history))
+
+	history, err = readHistory(fs, "stage", "carts")
+	assert.NilError(t, err)
+	history.Promotions = append(history.Promotions, newHistoryEntry("1", PromotionSource{Type: SourceStage, Stage: "staging"}, "def", PromotionMetadata{KeptnContext: "ctx-2"}, now.Add(time.Hour)))
+	assert.NilError(t, writeHistory(fs, "stage", "carts", history))
+
+	content, err := afero.ReadFile(fs, filepath.Join("stage", "carts", HistoryFileName))
+	assert.NilError(t, err)
+	history, err = ParseHistory(content)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, history.Promotions, []HistoryEntry{
+		{
+			Version:      "1",
+			Source:       SourceTag,
+			SourceCommit: "abc",
+			KeptnContext: "ctx-1",
+			TriggeredID:  "event-1",
+			Timestamp:    now,
+			Labels:       map[string]string{"version": "1", "approvedBy": "jane@example.com"},
+		},
+		{
+			Version:      "1",
+			Source:       SourceStage,
+			SourceStage:  "staging",
+			SourceCommit: "def",
+			KeptnContext: "ctx-2",
+			Timestamp:    now.Add(time.Hour),
+		},
+	})
+}
+
+func TestDiffDirectories_IgnoresHistory(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	writeTestFile(t, fs, filepath.Join("expected", "values.yaml"), "image: carts:1")
+	writeTestFile(t, fs, filepath.Join("actual", "values.yaml"), "image: carts:1")
+	writeTestFile(t, fs, filepath.Join("actual", HistoryFileName), "promotions: []")
+
+	diff, err := diffDirectories(fs, "expected", "actual")
+	assert.NilError(t, err)
+	assert.Equal(t, len(diff), 0)
+}
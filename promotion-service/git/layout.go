@@ -0,0 +1,90 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strings"
+	"text/template"
+)
+
+// DefaultBranchTemplate names the stage branches exactly like the stages
+const DefaultBranchTemplate = "{{ .Stage }}"
+
+// StageLayout defines where the services of each stage are stored in the repository. Both fields are Go templates
+// which are executed with the name of the stage as {{ .Stage }}.
+type StageLayout struct {
+	// Branch is the template of the stage branch names, DefaultBranchTemplate if empty
+	Branch string `yaml:"branch,omitempty"`
+	// Directory is the template of the directory containing the services in the stage branch, the root of the
+	// branch if empty. Several stages can share a branch if they are stored in different directories.
+	Directory string `yaml:"directory,omitempty"`
+}
+
+// Stage is a stage of a project together with the layout of the stages in the repository of the project
+type Stage struct {
+	Name   string
+	Layout StageLayout
+}
+
+type layoutData struct {
+	Stage string
+}
+
+// Validate checks that both templates are valid and that different stages are stored in different locations
+func (l StageLayout) Validate() error {
+	branchA, dirA, err := l.Location("a")
+	if err != nil {
+		return err
+	}
+	branchB, dirB, err := l.Location("b")
+	if err != nil {
+		return err
+	}
+	if branchA == branchB && dirA == dirB {
+		return fmt.Errorf("Branch %v and directory %v do not depend on the stage, all stages would be stored in the same location", l.Branch, l.Directory)
+	}
+	return nil
+}
+
+// Location returns the branch of the stage and the directory of its services relative to the root of that branch,
+// the directory is empty if the services are stored at the root
+func (l StageLayout) Location(stage string) (branch string, dir string, err error) {
+	branchTemplate := l.Branch
+	if branchTemplate == "" {
+		branchTemplate = DefaultBranchTemplate
+	}
+
+	branch, err = executeLayoutTemplate("branch", branchTemplate, stage)
+	if err != nil {
+		return "", "", err
+	}
+	if branch == "" || strings.ContainsAny(branch, " ~^:?*[\\") || strings.Contains(branch, "..") || strings.HasPrefix(branch, "/") || strings.HasSuffix(branch, "/") {
+		return "", "", fmt.Errorf("Invalid branch '%v' for stage %v", branch, stage)
+	}
+
+	if l.Directory == "" {
+		return branch, "", nil
+	}
+	dir, err = executeLayoutTemplate("directory", l.Directory, stage)
+	if err != nil {
+		return "", "", err
+	}
+	if dir != "" && (path.IsAbs(dir) || path.Clean(dir) != dir || dir == "." || strings.HasPrefix(dir, "..")) {
+		return "", "", fmt.Errorf("Invalid directory '%v' for stage %v, it has to be a clean relative path", dir, stage)
+	}
+	return branch, dir, nil
+}
+
+func executeLayoutTemplate(name string, text string, stage string) (string, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("Could not parse %v template: %v", name, err)
+	}
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, layoutData{Stage: stage}); err != nil {
+		return "", fmt.Errorf("Could not execute %v template: %v", name, err)
+	}
+	return strings.TrimSpace(out.String()), nil
+}
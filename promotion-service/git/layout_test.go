@@ -0,0 +1,82 @@
+package git
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestStageLayout_Location(t *testing.T) {
+	tests := []struct {
+		name       string
+		layout     StageLayout
+		wantBranch string
+		wantDir    string
+	}{
+		{
+			name:       "default",
+			layout:     StageLayout{},
+			wantBranch: "prod",
+		},
+		{
+			name:       "branch template",
+			layout:     StageLayout{Branch: "env/{{ .Stage }}"},
+			wantBranch: "env/prod",
+		},
+		{
+			name:       "single branch",
+			layout:     StageLayout{Branch: "main", Directory: "stages-rendered/{{ .Stage }}"},
+			wantBranch: "main",
+			wantDir:    "stages-rendered/prod",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.NilError(t, tt.layout.Validate())
+
+			branch, dir, err := tt.layout.Location("prod")
+			assert.NilError(t, err)
+			assert.Equal(t, branch, tt.wantBranch)
+			assert.Equal(t, dir, tt.wantDir)
+		})
+	}
+}
+
+func TestStageLayout_Validate(t *testing.T) {
+	tests := []struct {
+		name   string
+		layout StageLayout
+		want   string
+	}{
+		{
+			name:   "invalid template",
+			layout: StageLayout{Branch: "env/{{ .Stage"},
+			want:   "Could not parse branch template",
+		},
+		{
+			name:   "unknown field",
+			layout: StageLayout{Branch: "env/{{ .Project }}"},
+			want:   "Could not execute branch template",
+		},
+		{
+			name:   "invalid branch",
+			layout: StageLayout{Branch: "env/{{ .Stage }}/"},
+			want:   "Invalid branch 'env/a/' for stage a",
+		},
+		{
+			name:   "directory outside of the branch",
+			layout: StageLayout{Branch: "main", Directory: "../{{ .Stage }}"},
+			want:   "Invalid directory '../a' for stage a",
+		},
+		{
+			name:   "same location for all stages",
+			layout: StageLayout{Branch: "main", Directory: "stages-rendered"},
+			want:   "all stages would be stored in the same location",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ErrorContains(t, tt.layout.Validate(), tt.want)
+		})
+	}
+}
@@ -0,0 +1,233 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	keptnutils "github.com/keptn/kubernetes-utils/pkg"
+	"golang.org/x/crypto/ssh"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	signingKeySecretKey        = "signing-key"
+	signingPassphraseSecretKey = "passphrase"
+
+	sshSignatureNamespace = "git"
+	sshSignatureHash      = "sha512"
+)
+
+// Signer creates the armored signature stored in the gpgsig header of commits and tags
+type Signer interface {
+	Sign(content []byte) (string, error)
+}
+
+// NewSigner creates a GPG or SSH signer depending on the format of the private key
+func NewSigner(key []byte, passphrase string) (Signer, error) {
+	if bytes.Contains(key, []byte("BEGIN PGP PRIVATE KEY BLOCK")) {
+		return newGPGSigner(key, passphrase)
+	}
+	return newSSHSigner(key, passphrase)
+}
+
+// LoadSigningKeyFromSecret reads the signing key and its optional passphrase from a Kubernetes secret
+func LoadSigningKeyFromSecret(name string, namespace string) ([]byte, string, error) {
+	clientset, err := keptnutils.GetClientset(true)
+	if err != nil {
+		return nil, "", err
+	}
+
+	secret, err := clientset.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, "", err
+	}
+
+	key, ok := secret.Data[signingKeySecretKey]
+	if !ok {
+		return nil, "", fmt.Errorf("Secret %v does not contain %v", name, signingKeySecretKey)
+	}
+	return key, string(secret.Data[signingPassphraseSecretKey]), nil
+}
+
+// LoadSigningKeyFromFile reads the signing key from a file, e.g. a mounted secret
+func LoadSigningKeyFromFile(file string) ([]byte, error) {
+	return ioutil.ReadFile(file)
+}
+
+type gpgSigner struct {
+	entity *openpgp.Entity
+}
+
+func newGPGSigner(key []byte, passphrase string) (*gpgSigner, error) {
+	entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(key))
+	if err != nil {
+		return nil, fmt.Errorf("Could not read GPG key: %v", err)
+	}
+	if len(entities) == 0 || entities[0].PrivateKey == nil {
+		return nil, errors.New("GPG key does not contain a private key")
+	}
+
+	entity := entities[0]
+	if entity.PrivateKey.Encrypted {
+		if err := entity.PrivateKey.Decrypt([]byte(passphrase)); err != nil {
+			return nil, fmt.Errorf("Could not decrypt GPG key: %v", err)
+		}
+	}
+	for _, subkey := range entity.Subkeys {
+		if subkey.PrivateKey != nil && subkey.PrivateKey.Encrypted {
+			if err := subkey.PrivateKey.Decrypt([]byte(passphrase)); err != nil {
+				return nil, fmt.Errorf("Could not decrypt GPG subkey: %v", err)
+			}
+		}
+	}
+	return &gpgSigner{entity: entity}, nil
+}
+
+func (s *gpgSigner) Sign(content []byte) (string, error) {
+	var signature bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&signature, s.entity, bytes.NewReader(content), nil); err != nil {
+		return "", err
+	}
+	return signature.String(), nil
+}
+
+type sshSigner struct {
+	signer ssh.Signer
+}
+
+func newSSHSigner(key []byte, passphrase string) (*sshSigner, error) {
+	var signer ssh.Signer
+	var err error
+	if passphrase != "" {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(passphrase))
+	} else {
+		signer, err = ssh.ParsePrivateKey(key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Could not read SSH key: %v", err)
+	}
+	return &sshSigner{signer: signer}, nil
+}
+
+// Sign creates a signature in the SSHSIG format used by git with gpg.format=ssh
+func (s *sshSigner) Sign(content []byte) (string, error) {
+	signedData := sshSignedData(content)
+
+	var signature *ssh.Signature
+	var err error
+	if algorithmSigner, ok := s.signer.(ssh.AlgorithmSigner); ok && s.signer.PublicKey().Type() == ssh.KeyAlgoRSA {
+		signature, err = algorithmSigner.SignWithAlgorithm(rand.Reader, signedData, ssh.SigAlgoRSASHA2512)
+	} else {
+		signature, err = s.signer.Sign(rand.Reader, signedData)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	blob := ssh.Marshal(struct {
+		Magic         [6]byte
+		Version       uint32
+		PublicKey     string
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Signature     string
+	}{
+		Magic:         [6]byte{'S', 'S', 'H', 'S', 'I', 'G'},
+		Version:       1,
+		PublicKey:     string(s.signer.PublicKey().Marshal()),
+		Namespace:     sshSignatureNamespace,
+		HashAlgorithm: sshSignatureHash,
+		Signature:     string(ssh.Marshal(signature)),
+	})
+
+	return armorSSHSignature(blob), nil
+}
+
+// sshSignedData returns the data an SSHSIG signature is computed over
+func sshSignedData(content []byte) []byte {
+	hash := sha512.Sum512(content)
+	return ssh.Marshal(struct {
+		Magic         [6]byte
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Hash          string
+	}{
+		Magic:         [6]byte{'S', 'S', 'H', 'S', 'I', 'G'},
+		Namespace:     sshSignatureNamespace,
+		HashAlgorithm: sshSignatureHash,
+		Hash:          string(hash[:]),
+	})
+}
+
+func armorSSHSignature(blob []byte) string {
+	encoded := base64.StdEncoding.EncodeToString(blob)
+
+	var armored strings.Builder
+	armored.WriteString("-----BEGIN SSH SIGNATURE-----\n")
+	for len(encoded) > 70 {
+		armored.WriteString(encoded[:70] + "\n")
+		encoded = encoded[70:]
+	}
+	armored.WriteString(encoded + "\n")
+	armored.WriteString("-----END SSH SIGNATURE-----\n")
+	return armored.String()
+}
+
+// signHead replaces the commit HEAD points to with a signed copy of it
+func signHead(repo *git.Repository, signer Signer) error {
+	head, err := repo.Head()
+	if err != nil {
+		return err
+	}
+
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return err
+	}
+
+	unsigned := repo.Storer.NewEncodedObject()
+	if err := commit.EncodeWithoutSignature(unsigned); err != nil {
+		return err
+	}
+	content, err := readEncodedObject(unsigned)
+	if err != nil {
+		return err
+	}
+
+	commit.PGPSignature, err = signer.Sign(content)
+	if err != nil {
+		return fmt.Errorf("Could not sign commit: %v", err)
+	}
+
+	signed := repo.Storer.NewEncodedObject()
+	if err := commit.Encode(signed); err != nil {
+		return err
+	}
+	hash, err := repo.Storer.SetEncodedObject(signed)
+	if err != nil {
+		return err
+	}
+
+	return repo.Storer.SetReference(plumbing.NewHashReference(head.Name(), hash))
+}
+
+func readEncodedObject(o plumbing.EncodedObject) ([]byte, error) {
+	reader, err := o.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return ioutil.ReadAll(reader)
+}
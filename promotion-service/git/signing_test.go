@@ -0,0 +1,117 @@
+package git
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"golang.org/x/crypto/ssh"
+	"gotest.tools/assert"
+)
+
+func createTestCommit(t *testing.T) *git.Repository {
+	repo, err := git.Init(memory.NewStorage(), memfs.New())
+	assert.NilError(t, err)
+
+	w, err := repo.Worktree()
+	assert.NilError(t, err)
+	_, err = w.Commit(promotionCommitMessage+"1.0.0", &git.CommitOptions{
+		Author: &object.Signature{Name: defaultAuthorName, Email: defaultAuthorEmail, When: time.Now()},
+	})
+	assert.NilError(t, err)
+	return repo
+}
+
+func TestSignHead_GPG(t *testing.T) {
+	entity, err := openpgp.NewEntity("Keptn Promotion Service", "", defaultAuthorEmail, nil)
+	assert.NilError(t, err)
+
+	var privateKey bytes.Buffer
+	w, err := armor.Encode(&privateKey, openpgp.PrivateKeyType, nil)
+	assert.NilError(t, err)
+	assert.NilError(t, entity.SerializePrivate(w, nil))
+	assert.NilError(t, w.Close())
+
+	var publicKey bytes.Buffer
+	w, err = armor.Encode(&publicKey, openpgp.PublicKeyType, nil)
+	assert.NilError(t, err)
+	assert.NilError(t, entity.Serialize(w))
+	assert.NilError(t, w.Close())
+
+	signer, err := NewSigner(privateKey.Bytes(), "")
+	assert.NilError(t, err)
+
+	repo := createTestCommit(t)
+	assert.NilError(t, signHead(repo, signer))
+
+	head, err := repo.Head()
+	assert.NilError(t, err)
+	commit, err := repo.CommitObject(head.Hash())
+	assert.NilError(t, err)
+	assert.Equal(t, commit.Message, promotionCommitMessage+"1.0.0")
+
+	_, err = commit.Verify(publicKey.String())
+	assert.NilError(t, err)
+}
+
+func TestSignHead_SSH(t *testing.T) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NilError(t, err)
+	key, err := ssh.NewSignerFromKey(privateKey)
+	assert.NilError(t, err)
+
+	repo := createTestCommit(t)
+	assert.NilError(t, signHead(repo, &sshSigner{signer: key}))
+
+	head, err := repo.Head()
+	assert.NilError(t, err)
+	commit, err := repo.CommitObject(head.Hash())
+	assert.NilError(t, err)
+	assert.Assert(t, strings.HasPrefix(commit.PGPSignature, "-----BEGIN SSH SIGNATURE-----\n"))
+
+	unsigned := repo.Storer.NewEncodedObject()
+	assert.NilError(t, commit.EncodeWithoutSignature(unsigned))
+	content, err := readEncodedObject(unsigned)
+	assert.NilError(t, err)
+
+	verifySSHSignature(t, key.PublicKey(), commit.PGPSignature, content)
+}
+
+func verifySSHSignature(t *testing.T, publicKey ssh.PublicKey, armored string, content []byte) {
+	lines := strings.Split(strings.TrimSpace(armored), "\n")
+	blob, err := base64.StdEncoding.DecodeString(strings.Join(lines[1:len(lines)-1], ""))
+	assert.NilError(t, err)
+
+	var parsed struct {
+		Magic         [6]byte
+		Version       uint32
+		PublicKey     string
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Signature     string
+	}
+	assert.NilError(t, ssh.Unmarshal(blob, &parsed))
+	assert.Equal(t, parsed.Namespace, sshSignatureNamespace)
+	assert.Assert(t, bytes.Equal([]byte(parsed.PublicKey), publicKey.Marshal()))
+
+	signature := &ssh.Signature{}
+	assert.NilError(t, ssh.Unmarshal([]byte(parsed.Signature), signature))
+
+	assert.NilError(t, publicKey.Verify(sshSignedData(content), signature))
+}
+
+func TestNewSigner_InvalidKey(t *testing.T) {
+	_, err := NewSigner([]byte("not a key"), "")
+	assert.ErrorContains(t, err, "Could not read SSH key")
+}
@@ -0,0 +1,71 @@
+package git
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"gotest.tools/assert"
+)
+
+// signingTestVectors contains keys, a commit payload and the signatures ssh-keygen -Y sign -n git created for it, the
+// same vectors are used by the tests of the signing code of the ci-connect-cli
+const signingTestVectors = "testdata/signing"
+
+func readTestVector(t *testing.T, name string) []byte {
+	content, err := ioutil.ReadFile(filepath.Join(signingTestVectors, name))
+	assert.NilError(t, err)
+	return content
+}
+
+func TestSigner_SSHTestVectors(t *testing.T) {
+	payload := readTestVector(t, "payload")
+	for key, passphrase := range map[string]string{"ssh_ed25519": "", "ssh_rsa": "", "ssh_ed25519_passphrase": "secret"} {
+		signer, err := NewSigner(readTestVector(t, key), passphrase)
+		assert.NilError(t, err, key)
+		signature, err := signer.Sign(payload)
+		assert.NilError(t, err, key)
+		assert.Equal(t, signature, string(readTestVector(t, key+".sig")), key)
+	}
+}
+
+func TestSigner_GPGTestVectors(t *testing.T) {
+	payload := readTestVector(t, "payload")
+	_, err := NewSigner(readTestVector(t, "gpg_passphrase.asc"), "wrong")
+	assert.ErrorContains(t, err, "Could not decrypt GPG key")
+
+	signer, err := NewSigner(readTestVector(t, "gpg_passphrase.asc"), "secret")
+	assert.NilError(t, err)
+	signature, err := signer.Sign(payload)
+	assert.NilError(t, err)
+	assert.Assert(t, strings.HasPrefix(signature, "-----BEGIN PGP SIGNATURE-----\n"))
+
+	keyring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(readTestVector(t, "gpg_passphrase.pub.asc")))
+	assert.NilError(t, err)
+	_, err = openpgp.CheckArmoredDetachedSignature(keyring, bytes.NewReader(payload), strings.NewReader(signature), nil)
+	assert.NilError(t, err)
+}
+
+// TestSigner_TestVectorsInSync fails if the vectors differ from the ones of the ci-connect-cli, the signing code
+// of both has to produce the same signatures
+func TestSigner_TestVectorsInSync(t *testing.T) {
+	otherVectors := filepath.Join("..", "..", "ci-connect-cli", "cmd", signingTestVectors)
+	if _, err := os.Stat(otherVectors); os.IsNotExist(err) {
+		t.Skip("The ci-connect-cli is not checked out next to this module")
+	}
+
+	files, err := ioutil.ReadDir(signingTestVectors)
+	assert.NilError(t, err)
+	otherFiles, err := ioutil.ReadDir(otherVectors)
+	assert.NilError(t, err)
+	assert.Equal(t, len(files), len(otherFiles))
+	for _, file := range files {
+		other, err := ioutil.ReadFile(filepath.Join(otherVectors, file.Name()))
+		assert.NilError(t, err)
+		assert.Assert(t, bytes.Equal(readTestVector(t, file.Name()), other), "%v differs from %v", file.Name(), otherVectors)
+	}
+}
@@ -0,0 +1,196 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/keptn-sandbox/keptn-git-toolbox/promotion-service/metrics"
+	"github.com/keptn-sandbox/keptn-git-toolbox/promotion-service/tracing"
+	"github.com/spf13/afero"
+	"go.opentelemetry.io/otel/attribute"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// PromotionSourceType defines where the content of a promotion is taken from
+type PromotionSourceType string
+
+const (
+	// SourceTag renders the stage content from the <service>-<version> tag (default)
+	SourceTag PromotionSourceType = "tag"
+	// SourceStage copies the rendered service directory from another stage branch
+	SourceStage PromotionSourceType = "stage"
+	// SourceCommit renders the stage content from an explicit commit
+	SourceCommit PromotionSourceType = "commit"
+)
+
+// PromotionSource describes where the content of a promotion is taken from
+type PromotionSource struct {
+	Type PromotionSourceType
+	// Stage is the stage branch to copy from if Type is SourceStage
+	Stage string
+	// Commit is the commit hash to render from if Type is SourceCommit
+	Commit string
+	// VerifyAgainstTag fails the promotion if the promoted content differs from what the version tag produces
+	VerifyAgainstTag bool
+}
+
+// Validate checks that all fields required by the source type are set
+func (s PromotionSource) Validate() error {
+	switch s.Type {
+	case "", SourceTag:
+		return nil
+	case SourceStage:
+		if s.Stage == "" {
+			return fmt.Errorf("No source stage given for promotion source %v", s.Type)
+		}
+	case SourceCommit:
+		if !plumbing.IsHash(s.Commit) {
+			return fmt.Errorf("Invalid source commit '%v' for promotion source %v", s.Commit, s.Type)
+		}
+	default:
+		return fmt.Errorf("Unknown promotion source %v", s.Type)
+	}
+	return nil
+}
+
+func tagReference(service string, version string) plumbing.ReferenceName {
+	return plumbing.ReferenceName("refs/tags/" + service + "-" + version)
+}
+
+func branchReference(stage string) plumbing.ReferenceName {
+	return plumbing.ReferenceName("refs/heads/" + stage)
+}
+
+// cloneSource clones the given reference, or the given commit if reference is empty, into dir
+func cloneSource(ctx context.Context, dir string, remoteURI string, auth transport.AuthMethod, reference plumbing.ReferenceName, commit string) (err error) {
+	_, span := tracing.StartSpan(ctx, "clone", attribute.String("git.reference", reference.String()), attribute.String("git.commit", commit))
+	defer func() { tracing.EndSpan(span, err) }()
+	defer metrics.ObservePhase(metrics.PhaseClone, time.Now())
+
+	if reference != "" {
+		_, err := git.PlainClone(dir, false, &git.CloneOptions{
+			URL:           remoteURI,
+			Auth:          auth,
+			ReferenceName: reference,
+			SingleBranch:  true,
+		})
+		if err != nil {
+			metrics.GitError(metrics.OperationClone)
+			log.Println("Could not checkout "+remoteURI+"/"+reference.Short(), err)
+		}
+		return err
+	}
+
+	repo, err := git.PlainClone(dir, false, &git.CloneOptions{
+		URL:  remoteURI,
+		Auth: auth,
+	})
+	if err != nil {
+		metrics.GitError(metrics.OperationClone)
+		log.Println("Could not clone "+remoteURI, err)
+		return err
+	}
+
+	w, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+
+	err = w.Checkout(&git.CheckoutOptions{Hash: plumbing.NewHash(commit)})
+	if err != nil {
+		metrics.GitError(metrics.OperationClone)
+		log.Println("Could not checkout commit "+commit, err)
+		return fmt.Errorf("Could not checkout commit %v: %v", commit, err)
+	}
+	return nil
+}
+
+// renderService builds the content of the service for a stage from a checkout of the base and stage configuration
+// and writes it to <destinationDir>/<service>
+func (gh *GitHandler) renderService(ctx context.Context, fs afero.Fs, sourceDir string, destinationDir string, stage string, service ServiceTarget, version string) (err error) {
+	format, err := gh.serviceFormat(fs, sourceDir, stage, service)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Rendering service %s for stage %s using format %s\n", service.Name, stage, format.Name())
+	_, span := tracing.StartSpan(ctx, "merge", attribute.String("service.format", format.Name()))
+	defer func() { tracing.EndSpan(span, err) }()
+	defer metrics.ObservePhase(metrics.PhaseMerge, time.Now())
+	return format.Render(fs, sourceDir, destinationDir, stage, service.Name, version)
+}
+
+// renderServiceFromTag clones the version tag and renders the service for the stage into <destinationDir>/<service>
+func (gh *GitHandler) renderServiceFromTag(ctx context.Context, fs afero.Fs, remoteURI string, auth transport.AuthMethod, destinationDir string, stage string, service ServiceTarget, version string) error {
+	dirTag, _ := ioutil.TempDir("", "temp_dir_tag")
+	defer os.RemoveAll(dirTag)
+
+	err := cloneSource(ctx, dirTag, remoteURI, auth, tagReference(service.Name, version), "")
+	if err != nil {
+		return err
+	}
+	return gh.renderService(ctx, fs, dirTag, destinationDir, stage, service, version)
+}
+
+// diffDirectories returns the relative paths of all files which differ between the two directories
+func diffDirectories(fs afero.Fs, dirA string, dirB string) ([]string, error) {
+	filesA, err := readDirectoryContents(fs, dirA)
+	if err != nil {
+		return nil, err
+	}
+	filesB, err := readDirectoryContents(fs, dirB)
+	if err != nil {
+		return nil, err
+	}
+
+	var diff []string
+	for name, contentA := range filesA {
+		contentB, ok := filesB[name]
+		if !ok || !bytes.Equal(contentA, contentB) {
+			diff = append(diff, name)
+		}
+	}
+	for name := range filesB {
+		if _, ok := filesA[name]; !ok {
+			diff = append(diff, name)
+		}
+	}
+	sort.Strings(diff)
+	return diff, nil
+}
+
+func readDirectoryContents(fs afero.Fs, dir string) (map[string][]byte, error) {
+	contents := map[string][]byte{}
+	if exists, _ := afero.DirExists(fs, dir); !exists {
+		return contents, nil
+	}
+
+	err := afero.Walk(fs, dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		// the promotion history differs between stages by design
+		if info.IsDir() || info.Name() == HistoryFileName {
+			return nil
+		}
+		relativePath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		content, err := afero.ReadFile(fs, path)
+		if err != nil {
+			return err
+		}
+		contents[filepath.ToSlash(relativePath)] = content
+		return nil
+	})
+	return contents, err
+}
@@ -0,0 +1,52 @@
+package git
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/afero"
+	"gotest.tools/assert"
+)
+
+func TestDiffDirectories(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	writeTestFile(t, fs, filepath.Join("expected", "helm", "Chart.yaml"), "name: carts")
+	writeTestFile(t, fs, filepath.Join("expected", "helm", "values.yaml"), "image: carts:1")
+	writeTestFile(t, fs, filepath.Join("expected", "helm", "templates", "service.yaml"), "kind: Service")
+	writeTestFile(t, fs, filepath.Join("actual", "helm", "Chart.yaml"), "name: carts")
+	writeTestFile(t, fs, filepath.Join("actual", "helm", "values.yaml"), "image: carts:2")
+	writeTestFile(t, fs, filepath.Join("actual", "helm", "templates", "ingress.yaml"), "kind: Ingress")
+
+	diff, err := diffDirectories(fs, "expected", "actual")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, diff, []string{"helm/templates/ingress.yaml", "helm/templates/service.yaml", "helm/values.yaml"})
+}
+
+func TestDiffDirectories_Equal(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	writeTestFile(t, fs, filepath.Join("expected", "helm", "values.yaml"), "image: carts:1")
+	writeTestFile(t, fs, filepath.Join("actual", "helm", "values.yaml"), "image: carts:1")
+
+	diff, err := diffDirectories(fs, "expected", "actual")
+	assert.NilError(t, err)
+	assert.Equal(t, len(diff), 0)
+}
+
+func TestPromotionSource_Validate(t *testing.T) {
+	assert.NilError(t, PromotionSource{}.Validate())
+	assert.NilError(t, PromotionSource{Type: SourceTag}.Validate())
+	assert.NilError(t, PromotionSource{Type: SourceStage, Stage: "staging"}.Validate())
+	assert.NilError(t, PromotionSource{Type: SourceCommit, Commit: "4fd2c4d4d3f1e4e1e8b8e4f5b6c7d8e9f0a1b2c3"}.Validate())
+
+	assert.Error(t, PromotionSource{Type: SourceStage}.Validate(), "No source stage given for promotion source stage")
+	assert.Error(t, PromotionSource{Type: SourceCommit, Commit: "abc"}.Validate(), "Invalid source commit 'abc' for promotion source commit")
+	assert.Error(t, PromotionSource{Type: "branch"}.Validate(), "Unknown promotion source branch")
+}
+
+func writeTestFile(t *testing.T, fs afero.Fs, file string, content string) {
+	err := fs.MkdirAll(filepath.Dir(file), 0700)
+	assert.NilError(t, err)
+
+	err = afero.WriteFile(fs, file, []byte(content), 0644)
+	assert.NilError(t, err)
+}
@@ -0,0 +1,60 @@
+package git
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// IsTransient returns true if the error is likely to go away when the promotion is retried, e.g. a network error, a
+// server error of the git host or a push rejected because the stage branch was updated concurrently. Errors of a
+// multi-service promotion are only transient if the errors of all services are.
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var servicesErr ServicesError
+	if errors.As(err, &servicesErr) {
+		for _, serviceErr := range servicesErr {
+			if !IsTransient(serviceErr) {
+				return false
+			}
+		}
+		return len(servicesErr) > 0
+	}
+
+	switch {
+	case errors.Is(err, transport.ErrAuthenticationRequired),
+		errors.Is(err, transport.ErrAuthorizationFailed),
+		errors.Is(err, transport.ErrRepositoryNotFound),
+		errors.Is(err, plumbing.ErrReferenceNotFound):
+		return false
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	// go-git wraps unexpected HTTP responses without supporting errors.Unwrap
+	var unexpectedErr *plumbing.UnexpectedError
+	if errors.As(err, &unexpectedErr) {
+		err = unexpectedErr.Err
+	}
+	var httpErr *githttp.Err
+	if errors.As(err, &httpErr) && httpErr.Response != nil {
+		return httpErr.Response.StatusCode >= http.StatusInternalServerError || httpErr.Response.StatusCode == http.StatusTooManyRequests
+	}
+
+	message := err.Error()
+	return strings.Contains(message, "non-fast-forward") || strings.Contains(message, "connection reset by peer")
+}
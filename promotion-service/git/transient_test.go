@@ -0,0 +1,41 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"gotest.tools/assert"
+)
+
+func TestIsTransient(t *testing.T) {
+	timeout := &net.OpError{Op: "dial", Net: "tcp", Err: context.DeadlineExceeded}
+	serverError := githttp.NewErr(&http.Response{StatusCode: http.StatusBadGateway, Request: &http.Request{}})
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "no error", err: nil, want: false},
+		{name: "network error", err: fmt.Errorf("Could not push dev: %w", timeout), want: true},
+		{name: "server error", err: serverError, want: true},
+		{name: "concurrent update", err: fmt.Errorf("Could not push dev: %w", errors.New("non-fast-forward update: refs/heads/dev")), want: true},
+		{name: "authentication", err: transport.ErrAuthenticationRequired, want: false},
+		{name: "missing tag", err: plumbing.ErrReferenceNotFound, want: false},
+		{name: "invalid content", err: errors.New("Content of service carts differs from tag carts-1"), want: false},
+		{name: "all services transient", err: ServicesError{"carts": timeout, "orders": serverError}, want: true},
+		{name: "one service not transient", err: ServicesError{"carts": timeout, "orders": plumbing.ErrReferenceNotFound}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, IsTransient(tt.err), tt.want)
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package health
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	keptnutils "github.com/keptn/kubernetes-utils/pkg"
+)
+
+// Paths of the liveness and readiness endpoints
+const (
+	LivenessPath  = "/healthz"
+	ReadinessPath = "/readyz"
+)
+
+// Check returns an error if a dependency of the service is not available
+type Check func() error
+
+// LivenessHandler reports that the service is running
+func LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+}
+
+// ReadinessHandler reports whether all checks pass, failed checks are listed in the response
+func ReadinessHandler(checks map[string]Check) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var failed []string
+		for name, check := range checks {
+			if err := check(); err != nil {
+				log.Printf("Readiness check %v failed: %v", name, err)
+				failed = append(failed, fmt.Sprintf("%v: %v", name, err))
+			}
+		}
+
+		if len(failed) > 0 {
+			sort.Strings(failed)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintln(w, strings.Join(failed, "\n"))
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+}
+
+// KubernetesAPICheck checks that the Kubernetes API, from which the git credentials are read, is reachable
+func KubernetesAPICheck() error {
+	clientset, err := keptnutils.GetClientset(true)
+	if err != nil {
+		return err
+	}
+	_, err = clientset.Discovery().ServerVersion()
+	return err
+}
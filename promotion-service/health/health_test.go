@@ -0,0 +1,51 @@
+package health
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestLivenessHandler(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	LivenessHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, LivenessPath, nil))
+	assert.Equal(t, recorder.Code, http.StatusOK)
+}
+
+func TestReadinessHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		checks     map[string]Check
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name: "all checks pass",
+			checks: map[string]Check{
+				"kubernetes": func() error { return nil },
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   "ok\n",
+		},
+		{
+			name: "check fails",
+			checks: map[string]Check{
+				"kubernetes": func() error { return errors.New("connection refused") },
+				"other":      func() error { return nil },
+			},
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   "kubernetes: connection refused\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			ReadinessHandler(tt.checks).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, ReadinessPath, nil))
+			assert.Equal(t, recorder.Code, tt.wantStatus)
+			assert.Equal(t, recorder.Body.String(), tt.wantBody)
+		})
+	}
+}
@@ -0,0 +1,233 @@
+package lock
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const leaseNamePrefix = "promotion."
+
+// LeaseLocker serializes promotions across replicas by holding a Kubernetes Lease per key
+type LeaseLocker struct {
+	Client         kubernetes.Interface
+	Namespace      string
+	Identity       string
+	LeaseDuration  time.Duration
+	RetryPeriod    time.Duration
+	AcquireTimeout time.Duration
+}
+
+// NewLeaseLocker creates a LeaseLocker, the lease duration is stored in whole seconds and has to be at least 1s
+func NewLeaseLocker(client kubernetes.Interface, namespace string, identity string, leaseDuration time.Duration, retryPeriod time.Duration, acquireTimeout time.Duration) (*LeaseLocker, error) {
+	locker := &LeaseLocker{
+		Client:         client,
+		Namespace:      namespace,
+		Identity:       identity,
+		LeaseDuration:  leaseDuration,
+		RetryPeriod:    retryPeriod,
+		AcquireTimeout: acquireTimeout,
+	}
+	if err := locker.validate(); err != nil {
+		return nil, err
+	}
+	return locker, nil
+}
+
+func (l *LeaseLocker) validate() error {
+	if l.LeaseDuration < time.Second {
+		return fmt.Errorf("Lease duration has to be at least 1s, not %v", l.LeaseDuration)
+	}
+	return nil
+}
+
+// leaseHold is the state of an acquired lease, lost is set by the renewal if another replica took the lease over
+type leaseHold struct {
+	mutex sync.Mutex
+	lost  error
+}
+
+func (h *leaseHold) setLost(err error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.lost = err
+}
+
+func (h *leaseHold) getLost() error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.lost
+}
+
+// Acquire blocks until the lease for the key could be taken or AcquireTimeout is exceeded. The returned ReleaseFunc
+// reports an error if the lease was lost while it was held.
+func (l *LeaseLocker) Acquire(key string) (ReleaseFunc, error) {
+	if err := l.validate(); err != nil {
+		return nil, err
+	}
+	name := leaseName(key)
+	deadline := time.Now().Add(l.AcquireTimeout)
+
+	for {
+		acquired, err := l.tryAcquire(name)
+		if err != nil {
+			return nil, err
+		}
+		if acquired {
+			break
+		}
+		if l.AcquireTimeout > 0 && time.Now().After(deadline) {
+			return nil, fmt.Errorf("Timed out waiting for lease %v", name)
+		}
+		time.Sleep(l.RetryPeriod)
+	}
+
+	hold := &leaseHold{}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		l.renew(name, hold, stop)
+	}()
+
+	// the lease is released only once, a later call must not release the lease of the next holder with the same
+	// identity, e.g. the next promotion of this replica
+	var once sync.Once
+	var lost error
+	return func() error {
+		once.Do(func() {
+			close(stop)
+			<-done
+			lost = hold.getLost()
+			if lost == nil {
+				l.release(name)
+			}
+		})
+		return lost
+	}, nil
+}
+
+func (l *LeaseLocker) tryAcquire(name string) (bool, error) {
+	leases := l.Client.CoordinationV1().Leases(l.Namespace)
+	now := metav1.NewMicroTime(time.Now())
+	durationSeconds := int32(l.LeaseDuration.Seconds())
+
+	lease, err := leases.Get(context.TODO(), name, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		_, err = leases.Create(context.TODO(), &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: l.Namespace,
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &l.Identity,
+				LeaseDurationSeconds: &durationSeconds,
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}, metav1.CreateOptions{})
+		if k8serrors.IsAlreadyExists(err) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if !l.isAvailable(lease) {
+		return false, nil
+	}
+
+	lease.Spec.HolderIdentity = &l.Identity
+	lease.Spec.LeaseDurationSeconds = &durationSeconds
+	lease.Spec.AcquireTime = &now
+	lease.Spec.RenewTime = &now
+	_, err = leases.Update(context.TODO(), lease, metav1.UpdateOptions{})
+	if k8serrors.IsConflict(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (l *LeaseLocker) isAvailable(lease *coordinationv1.Lease) bool {
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity == "" || *lease.Spec.HolderIdentity == l.Identity {
+		return true
+	}
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return true
+	}
+	expiry := lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second)
+	return time.Now().After(expiry)
+}
+
+// renew renews the lease until it is released. It stops if another replica took the lease over or the lease could not
+// be renewed before it expired, the lease is lost then.
+func (l *LeaseLocker) renew(name string, hold *leaseHold, stop chan struct{}) {
+	ticker := time.NewTicker(l.LeaseDuration / 2)
+	defer ticker.Stop()
+	renewed := time.Now()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			leases := l.Client.CoordinationV1().Leases(l.Namespace)
+			lease, err := leases.Get(context.TODO(), name, metav1.GetOptions{})
+			if err == nil && (lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != l.Identity) {
+				holder := ""
+				if lease.Spec.HolderIdentity != nil {
+					holder = *lease.Spec.HolderIdentity
+				}
+				hold.setLost(fmt.Errorf("Lost lease %v while holding it, it is held by '%v' now", name, holder))
+				log.Printf("Lost lease %v to '%v'", name, holder)
+				return
+			}
+			if err == nil {
+				now := metav1.NewMicroTime(time.Now())
+				lease.Spec.RenewTime = &now
+				_, err = leases.Update(context.TODO(), lease, metav1.UpdateOptions{})
+			}
+			if err != nil {
+				log.Printf("Could not renew lease %v: %v", name, err)
+				if time.Since(renewed) > l.LeaseDuration {
+					hold.setLost(fmt.Errorf("Lost lease %v while holding it, it could not be renewed: %v", name, err))
+					return
+				}
+				continue
+			}
+			renewed = time.Now()
+		}
+	}
+}
+
+func (l *LeaseLocker) release(name string) {
+	leases := l.Client.CoordinationV1().Leases(l.Namespace)
+	lease, err := leases.Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		log.Printf("Could not release lease %v: %v", name, err)
+		return
+	}
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != l.Identity {
+		return
+	}
+	lease.Spec.HolderIdentity = nil
+	lease.Spec.AcquireTime = nil
+	lease.Spec.RenewTime = nil
+	if _, err := leases.Update(context.TODO(), lease, metav1.UpdateOptions{}); err != nil {
+		log.Printf("Could not release lease %v: %v", name, err)
+	}
+}
+
+func leaseName(key string) string {
+	return leaseNamePrefix + strings.ReplaceAll(strings.ToLower(key), "/", ".")
+}
@@ -0,0 +1,130 @@
+package lock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestLeaseLocker(client *fake.Clientset, identity string) *LeaseLocker {
+	return &LeaseLocker{
+		Client:         client,
+		Namespace:      "keptn",
+		Identity:       identity,
+		LeaseDuration:  time.Minute,
+		RetryPeriod:    10 * time.Millisecond,
+		AcquireTimeout: 100 * time.Millisecond,
+	}
+}
+
+func TestLeaseLocker_AcquireAndRelease(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	locker := newTestLeaseLocker(client, "replica-1")
+
+	release, err := locker.Acquire("sockshop/staging")
+	assert.NilError(t, err)
+
+	lease, err := client.CoordinationV1().Leases("keptn").Get(context.TODO(), "promotion.sockshop.staging", metav1.GetOptions{})
+	assert.NilError(t, err)
+	assert.Equal(t, *lease.Spec.HolderIdentity, "replica-1")
+
+	release()
+
+	lease, err = client.CoordinationV1().Leases("keptn").Get(context.TODO(), "promotion.sockshop.staging", metav1.GetOptions{})
+	assert.NilError(t, err)
+	assert.Check(t, lease.Spec.HolderIdentity == nil)
+}
+
+func TestLeaseLocker_HeldByOtherReplica(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	other := newTestLeaseLocker(client, "replica-1")
+	locker := newTestLeaseLocker(client, "replica-2")
+
+	release, err := other.Acquire("sockshop/staging")
+	assert.NilError(t, err)
+
+	_, err = locker.Acquire("sockshop/staging")
+	assert.Error(t, err, "Timed out waiting for lease promotion.sockshop.staging")
+
+	release()
+
+	release, err = locker.Acquire("sockshop/staging")
+	assert.NilError(t, err)
+	release()
+}
+
+func TestLeaseLocker_ExpiredLease(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	other := newTestLeaseLocker(client, "replica-1")
+	other.LeaseDuration = time.Second
+	locker := newTestLeaseLocker(client, "replica-2")
+	locker.AcquireTimeout = 3 * time.Second
+
+	// simulate a crashed replica which never releases its lease
+	_, err := other.tryAcquire(leaseName("sockshop/staging"))
+	assert.NilError(t, err)
+
+	release, err := locker.Acquire("sockshop/staging")
+	assert.NilError(t, err)
+	release()
+}
+
+func TestLeaseLocker_LostLease(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	locker := newTestLeaseLocker(client, "replica-1")
+	locker.LeaseDuration = time.Second
+
+	release, err := locker.Acquire("sockshop/staging")
+	assert.NilError(t, err)
+
+	// simulate another replica which took the lease over after it expired
+	leases := client.CoordinationV1().Leases("keptn")
+	lease, err := leases.Get(context.TODO(), "promotion.sockshop.staging", metav1.GetOptions{})
+	assert.NilError(t, err)
+	other := "replica-2"
+	lease.Spec.HolderIdentity = &other
+	_, err = leases.Update(context.TODO(), lease, metav1.UpdateOptions{})
+	assert.NilError(t, err)
+
+	time.Sleep(1200 * time.Millisecond)
+	assert.Error(t, release(), "Lost lease promotion.sockshop.staging while holding it, it is held by 'replica-2' now")
+
+	lease, err = leases.Get(context.TODO(), "promotion.sockshop.staging", metav1.GetOptions{})
+	assert.NilError(t, err)
+	assert.Equal(t, *lease.Spec.HolderIdentity, "replica-2", "the lease of the other replica is neither renewed nor released")
+}
+
+func TestNewLeaseLocker_InvalidDuration(t *testing.T) {
+	for _, duration := range []time.Duration{0, -time.Second, time.Nanosecond} {
+		_, err := NewLeaseLocker(fake.NewSimpleClientset(), "keptn", "replica-1", duration, time.Second, time.Minute)
+		assert.Error(t, err, "Lease duration has to be at least 1s, not "+duration.String())
+	}
+
+	locker := newTestLeaseLocker(fake.NewSimpleClientset(), "replica-1")
+	locker.LeaseDuration = 0
+	_, err := locker.Acquire("sockshop/staging")
+	assert.Error(t, err, "Lease duration has to be at least 1s, not 0s")
+}
+
+func TestLeaseLocker_ReleaseTwiceAfterHandover(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	locker := &ChainedLocker{Lockers: []Locker{NewKeyedQueue(), newTestLeaseLocker(client, "replica-1")}}
+
+	release, err := locker.Acquire("sockshop/staging")
+	assert.NilError(t, err)
+	assert.NilError(t, release())
+
+	// the next promotion of the same replica takes the lease over before the first one releases it again
+	next, err := locker.Acquire("sockshop/staging")
+	assert.NilError(t, err)
+	assert.NilError(t, release())
+
+	lease, err := client.CoordinationV1().Leases("keptn").Get(context.TODO(), "promotion.sockshop.staging", metav1.GetOptions{})
+	assert.NilError(t, err)
+	assert.Equal(t, *lease.Spec.HolderIdentity, "replica-1", "the lease of the next promotion is not released")
+	assert.NilError(t, next())
+}
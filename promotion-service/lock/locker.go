@@ -0,0 +1,99 @@
+package lock
+
+import (
+	"sync"
+)
+
+// ReleaseFunc releases a previously acquired lock, it returns an error if the lock was lost while it was held and the
+// work done under the lock might have run concurrently to another holder
+type ReleaseFunc func() error
+
+// Locker serializes work for a given key
+type Locker interface {
+	Acquire(key string) (ReleaseFunc, error)
+}
+
+// Key returns the lock key for promotions into the given stage branch of a project
+func Key(project string, branch string) string {
+	return project + "/" + branch
+}
+
+type queueEntry struct {
+	tail    chan struct{}
+	waiters int
+}
+
+// KeyedQueue serializes callers per key in the order in which they called Acquire
+type KeyedQueue struct {
+	mutex   sync.Mutex
+	entries map[string]*queueEntry
+}
+
+// NewKeyedQueue creates a new KeyedQueue
+func NewKeyedQueue() *KeyedQueue {
+	return &KeyedQueue{
+		entries: map[string]*queueEntry{},
+	}
+}
+
+// Acquire blocks until all previous holders of the key have released it
+func (q *KeyedQueue) Acquire(key string) (ReleaseFunc, error) {
+	q.mutex.Lock()
+	entry, ok := q.entries[key]
+	if !ok {
+		entry = &queueEntry{}
+		q.entries[key] = entry
+	}
+	previous := entry.tail
+	current := make(chan struct{})
+	entry.tail = current
+	entry.waiters++
+	q.mutex.Unlock()
+
+	if previous != nil {
+		<-previous
+	}
+
+	var once sync.Once
+	return func() error {
+		once.Do(func() {
+			q.mutex.Lock()
+			defer q.mutex.Unlock()
+			close(current)
+			entry.waiters--
+			if entry.waiters == 0 {
+				delete(q.entries, key)
+			}
+		})
+		return nil
+	}, nil
+}
+
+// ChainedLocker acquires all given lockers in order and releases them in reverse order
+type ChainedLocker struct {
+	Lockers []Locker
+}
+
+// Acquire acquires the key on all lockers of the chain
+func (c *ChainedLocker) Acquire(key string) (ReleaseFunc, error) {
+	var releases []ReleaseFunc
+	releaseAll := func() error {
+		var lost error
+		for i := len(releases) - 1; i >= 0; i-- {
+			if err := releases[i](); err != nil && lost == nil {
+				lost = err
+			}
+		}
+		return lost
+	}
+
+	for _, locker := range c.Lockers {
+		release, err := locker.Acquire(key)
+		if err != nil {
+			releaseAll()
+			return nil, err
+		}
+		releases = append(releases, release)
+	}
+	return releaseAll, nil
+}
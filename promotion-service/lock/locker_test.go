@@ -0,0 +1,75 @@
+package lock
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func TestKeyedQueue_ArrivalOrder(t *testing.T) {
+	queue := NewKeyedQueue()
+
+	release, err := queue.Acquire("sockshop/staging")
+	assert.NilError(t, err)
+
+	var mutex sync.Mutex
+	var order []int
+	var wg sync.WaitGroup
+
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rel, err := queue.Acquire("sockshop/staging")
+			assert.NilError(t, err)
+			mutex.Lock()
+			order = append(order, i)
+			mutex.Unlock()
+			rel()
+		}(i)
+		// make sure the goroutines queue up in a deterministic order
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	release()
+	wg.Wait()
+
+	assert.DeepEqual(t, order, []int{0, 1, 2, 3, 4})
+	assert.Equal(t, len(queue.entries), 0)
+}
+
+func TestKeyedQueue_IndependentKeys(t *testing.T) {
+	queue := NewKeyedQueue()
+
+	release, err := queue.Acquire("sockshop/staging")
+	assert.NilError(t, err)
+	defer release()
+
+	done := make(chan struct{})
+	go func() {
+		rel, _ := queue.Acquire("sockshop/prod")
+		rel()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Errorf("Lock for another stage was blocked")
+	}
+}
+
+func TestKeyedQueue_ReleaseTwice(t *testing.T) {
+	queue := NewKeyedQueue()
+
+	release, err := queue.Acquire("sockshop/staging")
+	assert.NilError(t, err)
+	release()
+	release()
+
+	release, err = queue.Acquire("sockshop/staging")
+	assert.NilError(t, err)
+	release()
+}
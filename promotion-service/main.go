@@ -5,18 +5,53 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"net/url"
 	"os"
+	"time"
 
 	cloudevents "github.com/cloudevents/sdk-go/v2" // make sure to use v2 cloudevents here
 	"github.com/kelseyhightower/envconfig"
+	apiutils "github.com/keptn/go-utils/pkg/api/utils"
 	"github.com/keptn/go-utils/pkg/lib/keptn"
 	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"github.com/keptn-sandbox/keptn-git-toolbox/promotion-service/api"
+	"github.com/keptn-sandbox/keptn-git-toolbox/promotion-service/common"
+	"github.com/keptn-sandbox/keptn-git-toolbox/promotion-service/config"
+	"github.com/keptn-sandbox/keptn-git-toolbox/promotion-service/deadletter"
 	"github.com/keptn-sandbox/keptn-git-toolbox/promotion-service/eventhandler"
 	"github.com/keptn-sandbox/keptn-git-toolbox/promotion-service/git"
+	"github.com/keptn-sandbox/keptn-git-toolbox/promotion-service/health"
+	"github.com/keptn-sandbox/keptn-git-toolbox/promotion-service/lock"
+	"github.com/keptn-sandbox/keptn-git-toolbox/promotion-service/metrics"
+	"github.com/keptn-sandbox/keptn-git-toolbox/promotion-service/notify"
+	"github.com/keptn-sandbox/keptn-git-toolbox/promotion-service/tracing"
+	keptnutils "github.com/keptn/kubernetes-utils/pkg"
 )
 
 var keptnOptions = keptn.KeptnOpts{}
 
+// serviceEnv holds the environment configuration the service was started with
+var serviceEnv envConfig
+
+// promotionLocker serializes promotions into the same project stage branch
+var promotionLocker lock.Locker
+
+// commitSigner signs promotion commits, nil if signing is disabled
+var commitSigner git.Signer
+
+// gitCredentials provides the credentials of the git repositories of projects
+var gitCredentials git.CredentialsProvider
+
+// configLoader reads the promotion.yaml of services
+var configLoader config.Loader
+
+// deadLetters keeps failed promotions for a replay, nil if they are not recorded
+var deadLetters deadletter.Store
+
+// defaultNotifications are notified about promotions which fail before the promotion.yaml of their services was read
+var defaultNotifications []notify.Config
+
 type envConfig struct {
 	// Port on which to listen for cloudevents
 	Port int `envconfig:"RCV_PORT" default:"8080"`
@@ -26,6 +61,58 @@ type envConfig struct {
 	Env string `envconfig:"ENV" default:"local"`
 	// URL of the Keptn configuration service (this is where we can fetch files from the config repo)
 	ConfigurationServiceUrl string `envconfig:"CONFIGURATION_SERVICE" default:""`
+	// Directory containing the promotion.yaml files of projects, stages and services if running locally
+	LocalConfigDir string `envconfig:"LOCAL_CONFIG_DIR" default:"."`
+	// Whether promotions should additionally be serialized across replicas using Kubernetes Leases
+	LeaseLocking bool `envconfig:"LEASE_LOCKING" default:"false"`
+	// Duration after which a lease of a crashed replica is considered expired
+	LeaseDuration time.Duration `envconfig:"LEASE_DURATION" default:"60s"`
+	// Maximum time to wait for a lease held by another replica
+	LeaseAcquireTimeout time.Duration `envconfig:"LEASE_ACQUIRE_TIMEOUT" default:"10m"`
+	// Name of the pod, used as lease holder identity
+	PodName string `envconfig:"POD_NAME" default:""`
+	// Stages which are promoted from another stage branch instead of the version tag, e.g. "prod:staging"
+	PromotionSourceStages map[string]string `envconfig:"PROMOTION_SOURCE_STAGES" default:""`
+	// Whether promoted content is verified against the content the version tag produces
+	VerifyPromotionSource bool `envconfig:"VERIFY_PROMOTION_SOURCE" default:"false"`
+	// Template of the stage branch names, e.g. "env/{{ .Stage }}"
+	StageBranchTemplate string `envconfig:"STAGE_BRANCH_TEMPLATE" default:"{{ .Stage }}"`
+	// Template of the directory containing the services in the stage branch, e.g. "stages-rendered/{{ .Stage }}"
+	StageDirectoryTemplate string `envconfig:"STAGE_DIRECTORY_TEMPLATE" default:""`
+	// Format of services which should not be detected automatically, e.g. "carts:kustomize"
+	ServiceFormats map[string]string `envconfig:"SERVICE_FORMATS" default:""`
+	// Name and email used as author and committer of promotion commits
+	CommitAuthorName  string `envconfig:"COMMIT_AUTHOR_NAME" default:"Keptn Promotion Service"`
+	CommitAuthorEmail string `envconfig:"COMMIT_AUTHOR_EMAIL" default:"noreply@keptn.sh"`
+	// Kubernetes secret containing the GPG or SSH key (signing-key) and passphrase used to sign promotion commits
+	SigningKeySecret string `envconfig:"SIGNING_KEY_SECRET" default:""`
+	// File containing the GPG or SSH key used to sign promotion commits, alternative to SIGNING_KEY_SECRET
+	SigningKeyFile string `envconfig:"SIGNING_KEY_FILE" default:""`
+	// Passphrase of the key in SIGNING_KEY_FILE
+	SigningKeyPassphrase string `envconfig:"SIGNING_KEY_PASSPHRASE" default:""`
+	// Keptn API token required to access the REST API, also used to send requested promotions to KEPTN_API_URL
+	KeptnAPIToken string `envconfig:"KEPTN_API_TOKEN" default:""`
+	// URL of the Keptn API to which promotions requested with the REST API are sent, e.g. http://api-gateway-nginx/api
+	KeptnAPIURL string `envconfig:"KEPTN_API_URL" default:""`
+	// OTLP/HTTP endpoint to which traces are exported, tracing is disabled if empty
+	OTLPEndpoint string `envconfig:"OTEL_EXPORTER_OTLP_ENDPOINT" default:""`
+	// Source of the git credentials of projects: kubernetes, env or file
+	GitCredentialsSource string `envconfig:"GIT_CREDENTIALS_SOURCE" default:"kubernetes"`
+	// Directory containing a git-credentials-<project> file per project, used by the file source
+	GitCredentialsDir string `envconfig:"GIT_CREDENTIALS_DIR" default:""`
+	// Number of additional attempts to update a stage branch after transient git errors
+	PromotionRetries int `envconfig:"PROMOTION_RETRIES" default:"0"`
+	// Delay before the first retry, doubled for every further retry
+	PromotionRetryBackoff time.Duration `envconfig:"PROMOTION_RETRY_BACKOFF" default:"5s"`
+	// Store of failed promotions which can be replayed: configmap or file, failed promotions are not recorded if empty
+	DeadLetterStore string `envconfig:"DEAD_LETTER_STORE" default:""`
+	// Directory of the file store, should be a persistent volume
+	DeadLetterDir string `envconfig:"DEAD_LETTER_DIR" default:"/data/dead-letters"`
+	// Name of the ConfigMap of the configmap store
+	DeadLetterConfigMap string `envconfig:"DEAD_LETTER_CONFIGMAP" default:"promotion-dead-letters"`
+	// Notifier of promotions which fail before the promotion.yaml of their services was read, e.g. with an invalid event
+	DefaultNotificationType string `envconfig:"DEFAULT_NOTIFICATION_TYPE" default:"webhook"`
+	DefaultNotificationURL  string `envconfig:"DEFAULT_NOTIFICATION_URL" default:""`
 }
 
 /**
@@ -33,7 +120,13 @@ type envConfig struct {
  * Depending on the Event Type will call the specific event handler functions, e.g: handleDeploymentFinishedEvent
  * See https://github.com/keptn/spec/blob/0.2.0-alpha/cloudevents.md for details on the payload
  */
-func processKeptnCloudEvent(ctx context.Context, event cloudevents.Event) error {
+func processKeptnCloudEvent(ctx context.Context, event cloudevents.Event) (err error) {
+	ctx, span := tracing.StartSpan(tracing.ExtractEvent(ctx, event), "processKeptnCloudEvent",
+		tracing.EventIDKey.String(event.ID()),
+		tracing.EventTypeKey.String(event.Type()),
+	)
+	defer func() { tracing.EndSpan(span, err) }()
+
 	log.Printf("Initializing Keptn Handler")
 
 	serviceName := "promotion-service"
@@ -42,6 +135,10 @@ func processKeptnCloudEvent(ctx context.Context, event cloudevents.Event) error
 	if err != nil {
 		return errors.New("Could not create Keptn Handler: " + err.Error())
 	}
+	span.SetAttributes(tracing.KeptnContextKey.String(myKeptn.KeptnContext))
+
+	// events sent in response continue the trace of the received event
+	myKeptn.EventSender = &tracing.EventSender{Context: ctx, Sender: myKeptn.EventSender}
 
 	log.Printf("gotEvent(%s): %s - %s", event.Type(), myKeptn.KeptnContext, event.Context.GetID())
 
@@ -53,10 +150,25 @@ func processKeptnCloudEvent(ctx context.Context, event cloudevents.Event) error
 		eh := &eventhandler.PromotionHandler{
 			Event:        event,
 			KeptnHandler: myKeptn,
-			GitHandler:   &git.GitHandler{},
+			GitHandler: &git.GitHandler{
+				ServiceFormats: serviceEnv.ServiceFormats,
+				AuthorName:     serviceEnv.CommitAuthorName,
+				AuthorEmail:    serviceEnv.CommitAuthorEmail,
+				Signer:         commitSigner,
+				Credentials:    gitCredentials,
+			},
+			Locker:               promotionLocker,
+			SourceStages:         serviceEnv.PromotionSourceStages,
+			VerifySource:         serviceEnv.VerifyPromotionSource,
+			StageLayout:          stageLayout(serviceEnv),
+			ConfigLoader:         configLoader,
+			Retries:              serviceEnv.PromotionRetries,
+			RetryBackoff:         serviceEnv.PromotionRetryBackoff,
+			DeadLetters:          deadLetters,
+			DefaultNotifications: defaultNotifications,
 		}
 
-		return eh.HandlePromotionTriggeredEvent()
+		return eh.HandlePromotionTriggeredEvent(ctx)
 	}
 
 	errorMsg := fmt.Sprintf("Unhandled Keptn Cloud Event: %s", event.Type())
@@ -82,9 +194,13 @@ func main() {
 }
 
 /**
- * Opens up a listener on localhost:port/path and passes incoming requests to gotEvent
+ * Opens up a listener on localhost:port/path and passes incoming requests to gotEvent,
+ * the REST API is served on localhost:port/projects if a Keptn API token is configured,
+ * probes on localhost:port/healthz and localhost:port/readyz and metrics on localhost:port/metrics
  */
 func _main(args []string, env envConfig) int {
+	serviceEnv = env
+
 	// configure keptn options
 	if env.Env == "local" {
 		log.Println("env=local: Running with local filesystem to fetch resources")
@@ -92,6 +208,50 @@ func _main(args []string, env envConfig) int {
 	}
 
 	keptnOptions.ConfigurationServiceURL = env.ConfigurationServiceUrl
+	configLoader = config.NewLoader(keptnOptions.UseLocalFileSystem, env.LocalConfigDir, env.ConfigurationServiceUrl)
+
+	if err := stageLayout(env).Validate(); err != nil {
+		log.Fatalf("invalid stage layout, %v", err)
+	}
+
+	locker, err := newPromotionLocker(env)
+	if err != nil {
+		log.Fatalf("failed to create promotion locker, %v", err)
+	}
+	promotionLocker = locker
+
+	signer, err := newCommitSigner(env)
+	if err != nil {
+		log.Fatalf("failed to load signing key, %v", err)
+	}
+	commitSigner = signer
+
+	credentials, err := git.NewCredentialsProvider(env.GitCredentialsSource, common.EnvBasedStringSupplier("POD_NAMESPACE", "keptn")(), env.GitCredentialsDir)
+	if err != nil {
+		log.Fatalf("failed to create git credentials provider, %v", err)
+	}
+	gitCredentials = credentials
+
+	store, err := newDeadLetterStore(env)
+	if err != nil {
+		log.Fatalf("failed to create dead letter store, %v", err)
+	}
+	deadLetters = store
+
+	notifications, err := newDefaultNotifications(env)
+	if err != nil {
+		log.Fatalf("invalid default notifier, %v", err)
+	}
+	defaultNotifications = notifications
+
+	if env.OTLPEndpoint != "" {
+		shutdown, err := tracing.Setup(context.Background(), "promotion-service")
+		if err != nil {
+			log.Fatalf("failed to set up tracing, %v", err)
+		}
+		defer shutdown(context.Background())
+		log.Printf("Exporting traces to %s", env.OTLPEndpoint)
+	}
 
 	log.Println("Starting promotion-service...")
 	log.Printf("    on Port = %d; Path=%s", env.Port, env.Path)
@@ -101,19 +261,177 @@ func _main(args []string, env envConfig) int {
 
 	log.Printf("Creating new http handler")
 
-	// configure http server to receive cloudevents
-	p, err := cloudevents.NewHTTP(cloudevents.WithPath(env.Path), cloudevents.WithPort(env.Port))
-
+	// configure http handler to receive cloudevents
+	p, err := cloudevents.NewHTTP()
 	if err != nil {
 		log.Fatalf("failed to create client, %v", err)
 	}
-	c, err := cloudevents.NewClient(p)
+	receiver, err := cloudevents.NewHTTPReceiveHandler(ctx, p, processKeptnCloudEvent)
 	if err != nil {
-		log.Fatalf("failed to create client, %v", err)
+		log.Fatalf("failed to create receiver, %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(env.Path, receiver)
+
+	if env.KeptnAPIToken == "" {
+		log.Println("KEPTN_API_TOKEN is not set, REST API requests are rejected")
+	}
+	restAPI := &api.API{
+		GitHandler:   &git.GitHandler{Credentials: gitCredentials},
+		Namespace:    common.EnvBasedStringSupplier("POD_NAMESPACE", "keptn")(),
+		Token:        env.KeptnAPIToken,
+		Promote:      processKeptnCloudEvent,
+		ConfigLoader: configLoader,
+		StageLayout:  stageLayout(env),
+		DeadLetters:  deadLetters,
 	}
+	if env.KeptnAPIURL != "" {
+		keptnAPI, err := keptnAPIHandler(env.KeptnAPIURL, env.KeptnAPIToken)
+		if err != nil {
+			log.Fatalf("Invalid KEPTN_API_URL: %v", err)
+		}
+		restAPI.KeptnAPI = keptnAPI
+	} else {
+		log.Println("KEPTN_API_URL is not set, requested promotions are run without a Keptn context")
+	}
+	mux.Handle("/projects/", restAPI)
+	mux.Handle(api.DeadLettersPath, restAPI)
+	mux.Handle(api.DeadLettersPath+"/", restAPI)
+
+	mux.Handle(health.LivenessPath, health.LivenessHandler())
+	mux.Handle(health.ReadinessPath, health.ReadinessHandler(map[string]health.Check{
+		"kubernetes": health.KubernetesAPICheck,
+	}))
+	mux.Handle(metrics.Path, metrics.Handler())
 
 	log.Printf("Starting receiver")
-	log.Fatal(c.StartReceiver(ctx, processKeptnCloudEvent))
+	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", env.Port), mux))
 
 	return 0
 }
+
+/**
+ * Creates the client of the Keptn API to which promotions requested with the REST API are sent
+ */
+func keptnAPIHandler(apiURL string, token string) (*apiutils.APIHandler, error) {
+	parsed, err := url.Parse(apiURL)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return nil, fmt.Errorf("%v is not an http or https URL", apiURL)
+	}
+	return apiutils.NewAuthenticatedAPIHandler(apiURL, token, api.TokenHeader, nil, parsed.Scheme), nil
+}
+
+/**
+ * Returns the location of the stages in the repositories of projects which don't declare it in their promotion.yaml
+ */
+func stageLayout(env envConfig) git.StageLayout {
+	return git.StageLayout{
+		Branch:    env.StageBranchTemplate,
+		Directory: env.StageDirectoryTemplate,
+	}
+}
+
+/**
+ * Creates the locker which serializes promotions per project stage branch, optionally backed by Kubernetes Leases
+ */
+func newPromotionLocker(env envConfig) (lock.Locker, error) {
+	queue := lock.NewKeyedQueue()
+	if !env.LeaseLocking {
+		return queue, nil
+	}
+
+	clientset, err := keptnutils.GetClientset(true)
+	if err != nil {
+		return nil, err
+	}
+
+	identity := env.PodName
+	if identity == "" {
+		identity, err = os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	leaseLocker, err := lock.NewLeaseLocker(clientset, common.EnvBasedStringSupplier("POD_NAMESPACE", "keptn")(), identity, env.LeaseDuration, 2*time.Second, env.LeaseAcquireTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid LEASE_DURATION: %v", err)
+	}
+
+	log.Printf("Using Kubernetes Leases for promotion locking as %s", identity)
+	return &lock.ChainedLocker{
+		Lockers: []lock.Locker{
+			queue,
+			leaseLocker,
+		},
+	}, nil
+}
+
+/**
+ * Returns the notifier of promotions which fail before the promotion.yaml of their services was read, if configured
+ */
+func newDefaultNotifications(env envConfig) ([]notify.Config, error) {
+	if env.DefaultNotificationURL == "" {
+		return nil, nil
+	}
+	notification := notify.Config{Type: notify.Type(env.DefaultNotificationType), URL: env.DefaultNotificationURL}
+	if err := notification.Validate(); err != nil {
+		return nil, err
+	}
+	return []notify.Config{notification}, nil
+}
+
+/**
+ * Creates the store of failed promotions, nil if failed promotions are not recorded
+ */
+func newDeadLetterStore(env envConfig) (deadletter.Store, error) {
+	switch env.DeadLetterStore {
+	case "":
+		return nil, nil
+	case deadletter.StoreFile:
+		log.Printf("Recording failed promotions in %s", env.DeadLetterDir)
+		return &deadletter.FileStore{Dir: env.DeadLetterDir}, nil
+	case deadletter.StoreConfigMap:
+		clientset, err := keptnutils.GetClientset(true)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Recording failed promotions in ConfigMap %s", env.DeadLetterConfigMap)
+		return &deadletter.ConfigMapStore{
+			Client:    clientset,
+			Namespace: common.EnvBasedStringSupplier("POD_NAMESPACE", "keptn")(),
+			Name:      env.DeadLetterConfigMap,
+		}, nil
+	default:
+		return nil, fmt.Errorf("Unknown dead letter store %v", env.DeadLetterStore)
+	}
+}
+
+/**
+ * Creates the signer for promotion commits from a Kubernetes secret or a file, nil if no key is configured
+ */
+func newCommitSigner(env envConfig) (git.Signer, error) {
+	var key []byte
+	var passphrase string
+	var err error
+
+	switch {
+	case env.SigningKeySecret != "":
+		key, passphrase, err = git.LoadSigningKeyFromSecret(env.SigningKeySecret, common.EnvBasedStringSupplier("POD_NAMESPACE", "keptn")())
+	case env.SigningKeyFile != "":
+		key, err = git.LoadSigningKeyFromFile(env.SigningKeyFile)
+		passphrase = env.SigningKeyPassphrase
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	log.Println("Signing promotion commits")
+	return git.NewSigner(key, passphrase)
+}
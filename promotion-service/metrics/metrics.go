@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Path is the path under which the metrics are served
+const Path = "/metrics"
+
+const namespace = "promotion_service"
+
+// Results of a promotion
+const (
+	ResultPass  = "pass"
+	ResultFail  = "fail"
+	ResultError = "error"
+)
+
+// Phases of a promotion
+const (
+	PhaseClone = "clone"
+	PhaseMerge = "merge"
+	PhasePush  = "push"
+)
+
+// Git operations which can fail
+const (
+	OperationClone  = "clone"
+	OperationCommit = "commit"
+	OperationSign   = "sign"
+	OperationPush   = "push"
+)
+
+var (
+	promotions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "promotions_total",
+		Help:      "Number of handled promotions by project, stage and result.",
+	}, []string{"project", "stage", "result"})
+
+	promotionsInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "promotions_in_flight",
+		Help:      "Number of promotions which are currently handled.",
+	})
+
+	phaseDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "promotion_phase_duration_seconds",
+		Help:      "Duration of the clone, merge and push phases of promotions.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"phase"})
+
+	gitErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "git_errors_total",
+		Help:      "Number of failed git operations by operation.",
+	}, []string{"operation"})
+)
+
+func init() {
+	prometheus.MustRegister(promotions, promotionsInFlight, phaseDuration, gitErrors)
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// PromotionStarted counts a promotion as in flight until the returned function is called with its result
+func PromotionStarted(project string, stage string) func(result string) {
+	promotionsInFlight.Inc()
+	return func(result string) {
+		promotionsInFlight.Dec()
+		promotions.WithLabelValues(project, stage, result).Inc()
+	}
+}
+
+// ObservePhase records the duration of a promotion phase which started at start
+func ObservePhase(phase string, start time.Time) {
+	phaseDuration.WithLabelValues(phase).Observe(time.Since(start).Seconds())
+}
+
+// GitError counts a failed git operation
+func GitError(operation string) {
+	gitErrors.WithLabelValues(operation).Inc()
+}
@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"gotest.tools/assert"
+)
+
+func TestPromotionStarted(t *testing.T) {
+	finished := PromotionStarted("sockshop", "prod")
+	assert.Equal(t, testutil.ToFloat64(promotionsInFlight), float64(1))
+
+	finished(ResultPass)
+	assert.Equal(t, testutil.ToFloat64(promotionsInFlight), float64(0))
+	assert.Equal(t, testutil.ToFloat64(promotions.WithLabelValues("sockshop", "prod", ResultPass)), float64(1))
+	assert.Equal(t, testutil.ToFloat64(promotions.WithLabelValues("sockshop", "prod", ResultError)), float64(0))
+}
+
+func TestHandler(t *testing.T) {
+	GitError(OperationPush)
+	ObservePhase(PhaseClone, time.Now().Add(-time.Second))
+
+	recorder := httptest.NewRecorder()
+	Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, Path, nil))
+
+	assert.Equal(t, recorder.Code, http.StatusOK)
+	body := recorder.Body.String()
+	assert.Assert(t, strings.Contains(body, `promotion_service_git_errors_total{operation="push"} 1`))
+	assert.Assert(t, strings.Contains(body, `promotion_service_promotion_phase_duration_seconds_count{phase="clone"} 1`))
+}
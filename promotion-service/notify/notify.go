@@ -0,0 +1,310 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Phase is the phase of a promotion a notification is sent for
+type Phase string
+
+const (
+	// PhaseStarted is sent before the stage branch is updated
+	PhaseStarted Phase = "started"
+	// PhaseSucceeded is sent after all services were promoted
+	PhaseSucceeded Phase = "succeeded"
+	// PhaseFailed is sent if the promotion was denied or failed
+	PhaseFailed Phase = "failed"
+)
+
+// Type is the kind of system notifications are sent to
+type Type string
+
+const (
+	// TypeWebhook posts the notification as JSON, or the rendered body template, to any URL
+	TypeWebhook Type = "webhook"
+	// TypeSlack posts a message to a Slack-compatible incoming webhook
+	TypeSlack Type = "slack"
+	// TypeTeams posts a message card to a Microsoft Teams incoming webhook
+	TypeTeams Type = "teams"
+)
+
+// Service is a service of the promotion
+type Service struct {
+	Service string `json:"service"`
+	Version string `json:"version"`
+}
+
+// Notification describes a phase of a promotion
+type Notification struct {
+	Phase        Phase     `json:"phase"`
+	Project      string    `json:"project"`
+	Stage        string    `json:"stage"`
+	Services     []Service `json:"services"`
+	KeptnContext string    `json:"keptnContext"`
+	// CommitURL links to the promotion commit, only set if the promotion succeeded and the remote is a known host
+	CommitURL string `json:"commitURL,omitempty"`
+	// Message is the reason of a failed promotion
+	Message string `json:"message,omitempty"`
+}
+
+// Version returns the version for a single service and "<service>-<version>, ..." if several services are promoted
+func (n Notification) Version() string {
+	if len(n.Services) == 1 {
+		return n.Services[0].Version
+	}
+
+	var versions []string
+	for _, service := range n.Services {
+		versions = append(versions, service.Service+"-"+service.Version)
+	}
+	return strings.Join(versions, ", ")
+}
+
+// Summary returns a one line description of the notification, e.g.
+// "Promotion of carts 1.2.0 into stage prod of project sockshop succeeded"
+func (n Notification) Summary() string {
+	var services []string
+	for _, service := range n.Services {
+		services = append(services, service.Service+" "+service.Version)
+	}
+	return fmt.Sprintf("Promotion of %v into stage %v of project %v %v", strings.Join(services, ", "), n.Stage, n.Project, n.Phase)
+}
+
+// Notifier sends notifications to an external system
+type Notifier interface {
+	Notify(ctx context.Context, notification Notification) error
+}
+
+// Config configures a notifier in the promotion.yaml
+type Config struct {
+	Type Type `yaml:"type"`
+	// URL of the webhook, alternatively URLFromEnv names an environment variable containing it
+	URL        string `yaml:"url,omitempty"`
+	URLFromEnv string `yaml:"urlFromEnv,omitempty"`
+	// Body is a template of the JSON body of webhook notifications, the notification is sent as JSON if empty
+	Body string `yaml:"body,omitempty"`
+	// Headers are added to the requests of webhook notifications
+	Headers map[string]string `yaml:"headers,omitempty"`
+	// Phases the notifier is notified about, all phases if empty
+	Phases []Phase `yaml:"phases,omitempty"`
+}
+
+// Validate checks the type, the URL, the body template and the phases of the notifier
+func (c Config) Validate() error {
+	switch c.Type {
+	case TypeWebhook:
+		if _, err := parseBody(c.Body); err != nil {
+			return err
+		}
+	case TypeSlack, TypeTeams:
+		if c.Body != "" || len(c.Headers) > 0 {
+			return fmt.Errorf("body and headers can only be set for %v notifications", TypeWebhook)
+		}
+	default:
+		return fmt.Errorf("unknown notification type '%v'", c.Type)
+	}
+
+	if (c.URL == "") == (c.URLFromEnv == "") {
+		return fmt.Errorf("either url or urlFromEnv is required for %v notifications", c.Type)
+	}
+
+	for _, phase := range c.Phases {
+		if phase != PhaseStarted && phase != PhaseSucceeded && phase != PhaseFailed {
+			return fmt.Errorf("unknown notification phase '%v'", phase)
+		}
+	}
+	return nil
+}
+
+// notifies returns true if the notifier is notified about the phase
+func (c Config) notifies(phase Phase) bool {
+	if len(c.Phases) == 0 {
+		return true
+	}
+	for _, p := range c.Phases {
+		if p == phase {
+			return true
+		}
+	}
+	return false
+}
+
+// client is used for all notifications, so that an unresponsive system cannot block promotions
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// New creates the notifier configured by c
+func New(c Config) (Notifier, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	url := c.URL
+	if c.URLFromEnv != "" {
+		url = os.Getenv(c.URLFromEnv)
+		if url == "" {
+			return nil, fmt.Errorf("Environment variable %v of the %v notification is not set", c.URLFromEnv, c.Type)
+		}
+	}
+
+	switch c.Type {
+	case TypeSlack:
+		return &SlackNotifier{URL: url}, nil
+	case TypeTeams:
+		return &TeamsNotifier{URL: url}, nil
+	default:
+		body, _ := parseBody(c.Body)
+		return &WebhookNotifier{URL: url, Body: body, Headers: c.Headers}, nil
+	}
+}
+
+// Send notifies all configured notifiers which are interested in the phase of the notification. Notifications are best
+// effort, errors are only logged so that they don't change the outcome of the promotion.
+func Send(ctx context.Context, configs []Config, notification Notification) {
+	for _, c := range configs {
+		if !c.notifies(notification.Phase) {
+			continue
+		}
+
+		notifier, err := New(c)
+		if err == nil {
+			err = notifier.Notify(ctx, notification)
+		}
+		if err != nil {
+			log.Printf("Could not send %v notification: %v", c.Type, err)
+		}
+	}
+}
+
+func parseBody(body string) (*template.Template, error) {
+	if body == "" {
+		return nil, nil
+	}
+	tmpl, err := template.New("body").Option("missingkey=error").Funcs(template.FuncMap{
+		"json": func(value interface{}) (string, error) {
+			content, err := json.Marshal(value)
+			return string(content), err
+		},
+	}).Parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid body template: %v", err)
+	}
+	return tmpl, nil
+}
+
+// post sends the JSON body to the URL and fails if the response status is not 2xx
+func post(ctx context.Context, url string, body []byte, headers map[string]string) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("Unexpected response status %v", response.Status)
+	}
+	return nil
+}
+
+// WebhookNotifier posts the notification as JSON, or the rendered body template, to URL
+type WebhookNotifier struct {
+	URL string
+	// Body is executed with the Notification, the notification is sent as JSON if nil
+	Body    *template.Template
+	Headers map[string]string
+}
+
+// Notify posts the notification to the webhook
+func (n *WebhookNotifier) Notify(ctx context.Context, notification Notification) error {
+	if n.Body == nil {
+		content, err := json.Marshal(notification)
+		if err != nil {
+			return err
+		}
+		return post(ctx, n.URL, content, n.Headers)
+	}
+
+	var body bytes.Buffer
+	if err := n.Body.Execute(&body, notification); err != nil {
+		return fmt.Errorf("Could not render body: %v", err)
+	}
+	if !json.Valid(body.Bytes()) {
+		return errors.New("Rendered body is not valid JSON")
+	}
+	return post(ctx, n.URL, body.Bytes(), n.Headers)
+}
+
+// messageLines returns the details of the notification for chat messages
+func messageLines(notification Notification) []string {
+	lines := []string{notification.Summary()}
+	if notification.Message != "" {
+		lines = append(lines, notification.Message)
+	}
+	if notification.CommitURL != "" {
+		lines = append(lines, "Commit: "+notification.CommitURL)
+	}
+	return append(lines, "Keptn context: "+notification.KeptnContext)
+}
+
+// SlackNotifier posts a message to a Slack-compatible incoming webhook
+type SlackNotifier struct {
+	URL string
+}
+
+// Notify posts the summary and details of the notification as text message
+func (n *SlackNotifier) Notify(ctx context.Context, notification Notification) error {
+	content, err := json.Marshal(map[string]string{
+		"text": strings.Join(messageLines(notification), "\n"),
+	})
+	if err != nil {
+		return err
+	}
+	return post(ctx, n.URL, content, nil)
+}
+
+// TeamsNotifier posts a message card to a Microsoft Teams incoming webhook
+type TeamsNotifier struct {
+	URL string
+}
+
+var teamsColors = map[Phase]string{
+	PhaseStarted:   "0078D7",
+	PhaseSucceeded: "2EB886",
+	PhaseFailed:    "D40E0D",
+}
+
+// Notify posts the notification as message card colored by its phase
+func (n *TeamsNotifier) Notify(ctx context.Context, notification Notification) error {
+	lines := messageLines(notification)
+	content, err := json.Marshal(map[string]string{
+		"@type":      "MessageCard",
+		"@context":   "https://schema.org/extensions",
+		"themeColor": teamsColors[notification.Phase],
+		"summary":    lines[0],
+		"title":      lines[0],
+		// Teams renders the text as markdown, line breaks need two spaces
+		"text": strings.Join(lines[1:], "  \n"),
+	})
+	if err != nil {
+		return err
+	}
+	return post(ctx, n.URL, content, nil)
+}
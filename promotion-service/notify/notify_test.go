@@ -0,0 +1,213 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+// testReceiver is a local stand-in for the notified systems, it records the bodies and headers of all requests
+type testReceiver struct {
+	server  *httptest.Server
+	status  int
+	bodies  []string
+	headers []http.Header
+}
+
+func newTestReceiver() *testReceiver {
+	r := &testReceiver{status: http.StatusOK}
+	r.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		r.bodies = append(r.bodies, string(body))
+		r.headers = append(r.headers, req.Header)
+		w.WriteHeader(r.status)
+	}))
+	return r
+}
+
+var testNotification = Notification{
+	Phase:        PhaseSucceeded,
+	Project:      "sockshop",
+	Stage:        "prod",
+	Services:     []Service{{Service: "carts", Version: "1.2.0"}},
+	KeptnContext: "6a2b7f3c",
+	CommitURL:    "https://github.com/keptn-sandbox/sockshop/commit/1c7a2f0",
+}
+
+func TestNotification_Summary(t *testing.T) {
+	assert.Equal(t, testNotification.Summary(), "Promotion of carts 1.2.0 into stage prod of project sockshop succeeded")
+	assert.Equal(t, testNotification.Version(), "1.2.0")
+
+	notification := testNotification
+	notification.Phase = PhaseFailed
+	notification.Services = []Service{{Service: "carts", Version: "1"}, {Service: "orders", Version: "2"}}
+	assert.Equal(t, notification.Summary(), "Promotion of carts 1, orders 2 into stage prod of project sockshop failed")
+	assert.Equal(t, notification.Version(), "carts-1, orders-2")
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	receiver := newTestReceiver()
+	defer receiver.server.Close()
+
+	notifier, err := New(Config{Type: TypeWebhook, URL: receiver.server.URL, Headers: map[string]string{"Authorization": "Bearer secret"}})
+	assert.NilError(t, err)
+	assert.NilError(t, notifier.Notify(context.Background(), testNotification))
+
+	assert.Equal(t, len(receiver.bodies), 1)
+	sent := Notification{}
+	assert.NilError(t, json.Unmarshal([]byte(receiver.bodies[0]), &sent))
+	assert.DeepEqual(t, sent, testNotification)
+	assert.Equal(t, receiver.headers[0].Get("Authorization"), "Bearer secret")
+	assert.Equal(t, receiver.headers[0].Get("Content-Type"), "application/json")
+}
+
+func TestWebhookNotifier_Body(t *testing.T) {
+	receiver := newTestReceiver()
+	defer receiver.server.Close()
+
+	notifier, err := New(Config{
+		Type: TypeWebhook,
+		URL:  receiver.server.URL,
+		Body: `{"title": {{ json .Summary }}, "version": {{ json .Version }}, "link": {{ json .CommitURL }}}`,
+	})
+	assert.NilError(t, err)
+	assert.NilError(t, notifier.Notify(context.Background(), testNotification))
+
+	assert.Equal(t, receiver.bodies[0], `{"title": "Promotion of carts 1.2.0 into stage prod of project sockshop succeeded", "version": "1.2.0", "link": "https://github.com/keptn-sandbox/sockshop/commit/1c7a2f0"}`)
+}
+
+func TestWebhookNotifier_InvalidBody(t *testing.T) {
+	receiver := newTestReceiver()
+	defer receiver.server.Close()
+
+	notifier, err := New(Config{Type: TypeWebhook, URL: receiver.server.URL, Body: `{"stage": {{ .Stage }}}`})
+	assert.NilError(t, err)
+	assert.Error(t, notifier.Notify(context.Background(), testNotification), "Rendered body is not valid JSON")
+	assert.Equal(t, len(receiver.bodies), 0)
+}
+
+func TestWebhookNotifier_ErrorStatus(t *testing.T) {
+	receiver := newTestReceiver()
+	defer receiver.server.Close()
+	receiver.status = http.StatusInternalServerError
+
+	notifier, err := New(Config{Type: TypeWebhook, URL: receiver.server.URL})
+	assert.NilError(t, err)
+	assert.ErrorContains(t, notifier.Notify(context.Background(), testNotification), "Unexpected response status 500")
+}
+
+func TestSlackNotifier(t *testing.T) {
+	receiver := newTestReceiver()
+	defer receiver.server.Close()
+
+	notifier, err := New(Config{Type: TypeSlack, URL: receiver.server.URL})
+	assert.NilError(t, err)
+	assert.NilError(t, notifier.Notify(context.Background(), testNotification))
+
+	message := map[string]string{}
+	assert.NilError(t, json.Unmarshal([]byte(receiver.bodies[0]), &message))
+	assert.DeepEqual(t, message, map[string]string{
+		"text": "Promotion of carts 1.2.0 into stage prod of project sockshop succeeded\n" +
+			"Commit: https://github.com/keptn-sandbox/sockshop/commit/1c7a2f0\n" +
+			"Keptn context: 6a2b7f3c",
+	})
+}
+
+func TestTeamsNotifier(t *testing.T) {
+	receiver := newTestReceiver()
+	defer receiver.server.Close()
+
+	notification := testNotification
+	notification.Phase = PhaseFailed
+	notification.CommitURL = ""
+	notification.Message = "label ticket is required"
+
+	notifier, err := New(Config{Type: TypeTeams, URL: receiver.server.URL})
+	assert.NilError(t, err)
+	assert.NilError(t, notifier.Notify(context.Background(), notification))
+
+	card := map[string]string{}
+	assert.NilError(t, json.Unmarshal([]byte(receiver.bodies[0]), &card))
+	assert.Equal(t, card["@type"], "MessageCard")
+	assert.Equal(t, card["themeColor"], "D40E0D")
+	assert.Equal(t, card["title"], "Promotion of carts 1.2.0 into stage prod of project sockshop failed")
+	assert.Equal(t, card["text"], "label ticket is required  \nKeptn context: 6a2b7f3c")
+}
+
+func TestSend(t *testing.T) {
+	receiver := newTestReceiver()
+	defer receiver.server.Close()
+	failing := newTestReceiver()
+	defer failing.server.Close()
+	failing.status = http.StatusBadGateway
+
+	os.Setenv("TEST_NOTIFICATION_URL", receiver.server.URL)
+	defer os.Unsetenv("TEST_NOTIFICATION_URL")
+
+	configs := []Config{
+		{Type: TypeWebhook, URL: failing.server.URL},
+		{Type: TypeSlack, URLFromEnv: "TEST_NOTIFICATION_URL"},
+		{Type: TypeTeams, URL: receiver.server.URL, Phases: []Phase{PhaseFailed}},
+	}
+
+	// errors of single notifiers don't prevent the others from being notified
+	Send(context.Background(), configs, testNotification)
+	assert.Equal(t, len(failing.bodies), 1)
+	assert.Equal(t, len(receiver.bodies), 1)
+
+	notification := testNotification
+	notification.Phase = PhaseFailed
+	Send(context.Background(), configs, notification)
+	assert.Equal(t, len(failing.bodies), 2)
+	assert.Equal(t, len(receiver.bodies), 3)
+}
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		want   string
+	}{
+		{
+			name:   "unknown type",
+			config: Config{Type: "email", URL: "https://example.com"},
+			want:   "unknown notification type 'email'",
+		},
+		{
+			name:   "no url",
+			config: Config{Type: TypeSlack},
+			want:   "either url or urlFromEnv is required for slack notifications",
+		},
+		{
+			name:   "url and urlFromEnv",
+			config: Config{Type: TypeSlack, URL: "https://example.com", URLFromEnv: "SLACK_URL"},
+			want:   "either url or urlFromEnv is required for slack notifications",
+		},
+		{
+			name:   "body of slack notification",
+			config: Config{Type: TypeSlack, URL: "https://example.com", Body: "{}"},
+			want:   "body and headers can only be set for webhook notifications",
+		},
+		{
+			name:   "invalid body template",
+			config: Config{Type: TypeWebhook, URL: "https://example.com", Body: "{{ .Stage"},
+			want:   "invalid body template",
+		},
+		{
+			name:   "unknown phase",
+			config: Config{Type: TypeWebhook, URL: "https://example.com", Phases: []Phase{"finished"}},
+			want:   "unknown notification phase 'finished'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ErrorContains(t, tt.config.Validate(), tt.want)
+		})
+	}
+}
@@ -0,0 +1,249 @@
+package policy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileName is the name of the policy file in the root of the default branch of the config repo
+const FileName = "promotion-policy.yaml"
+
+// Policy defines the gates which have to pass before a service is promoted into a stage
+type Policy struct {
+	Stages map[string]Gates `yaml:"stages"`
+}
+
+// Gates are the conditions for promotions into a stage, all configured gates have to pass
+type Gates struct {
+	Timezone            string          `yaml:"timezone,omitempty"`
+	FreezeWindows       []FreezeWindow  `yaml:"freezeWindows,omitempty"`
+	RequiredLabels      []RequiredLabel `yaml:"requiredLabels,omitempty"`
+	MaxPromotionsPerDay int             `yaml:"maxPromotionsPerDay,omitempty"`
+	Evaluation          *EvaluationGate `yaml:"evaluation,omitempty"`
+}
+
+// FreezeWindow blocks promotions either between Start and End, or on the given weekdays between From and To
+type FreezeWindow struct {
+	Start *time.Time `yaml:"start,omitempty"`
+	End   *time.Time `yaml:"end,omitempty"`
+	Days  []string   `yaml:"days,omitempty"`
+	From  string     `yaml:"from,omitempty"`
+	To    string     `yaml:"to,omitempty"`
+}
+
+// RequiredLabel requires a label on the triggering event, optionally matching a regular expression
+type RequiredLabel struct {
+	Name    string `yaml:"name"`
+	Pattern string `yaml:"pattern,omitempty"`
+}
+
+// EvaluationGate requires an evaluation result in the triggering event
+type EvaluationGate struct {
+	Result   string  `yaml:"result,omitempty"`
+	MinScore float64 `yaml:"minScore,omitempty"`
+}
+
+// Evaluation is the result of the evaluation contained in the triggering event
+type Evaluation struct {
+	Result string  `json:"result"`
+	Score  float64 `json:"score"`
+}
+
+// Input is the information about a promotion the gates are evaluated against
+type Input struct {
+	Labels          map[string]string
+	Evaluation      *Evaluation
+	PromotionsToday int
+	Now             time.Time
+}
+
+// DeniedError is returned if at least one gate denies a promotion
+type DeniedError struct {
+	Stage   string
+	Reasons []string
+}
+
+func (e DeniedError) Error() string {
+	return fmt.Sprintf("Promotion into stage %v denied: %v", e.Stage, strings.Join(e.Reasons, "; "))
+}
+
+func (e DeniedError) Is(target error) bool {
+	_, ok := target.(DeniedError)
+	return ok
+}
+
+// Parse reads a policy file and validates it
+func Parse(content []byte) (*Policy, error) {
+	policy := &Policy{}
+	if err := yaml.Unmarshal(content, policy); err != nil {
+		return nil, fmt.Errorf("Could not parse %v: %v", FileName, err)
+	}
+
+	for stage, gates := range policy.Stages {
+		if err := gates.Validate(); err != nil {
+			return nil, fmt.Errorf("Invalid gates for stage %v in %v: %v", stage, FileName, err)
+		}
+	}
+	return policy, nil
+}
+
+// GatesFor returns the gates of the stage, or nil if there are none
+func (p *Policy) GatesFor(stage string) *Gates {
+	if p == nil {
+		return nil
+	}
+	gates, ok := p.Stages[stage]
+	if !ok {
+		return nil
+	}
+	return &gates
+}
+
+// Validate checks that all gates are well-formed
+func (g *Gates) Validate() error {
+	if _, err := g.location(); err != nil {
+		return err
+	}
+	for _, window := range g.FreezeWindows {
+		if (window.Start == nil) != (window.End == nil) {
+			return fmt.Errorf("freeze window needs both start and end")
+		}
+		if window.Start == nil && len(window.Days) == 0 {
+			return fmt.Errorf("freeze window needs either start and end or days")
+		}
+		for _, day := range window.Days {
+			if _, err := parseWeekday(day); err != nil {
+				return err
+			}
+		}
+		for _, clock := range []string{window.From, window.To} {
+			if _, err := parseClock(clock, 0); err != nil {
+				return err
+			}
+		}
+	}
+	for _, label := range g.RequiredLabels {
+		if _, err := regexp.Compile(label.Pattern); err != nil {
+			return fmt.Errorf("invalid pattern for label %v: %v", label.Name, err)
+		}
+	}
+	return nil
+}
+
+// StartOfDay returns the beginning of the day of now in the timezone of the gates
+func (g *Gates) StartOfDay(now time.Time) time.Time {
+	location, _ := g.location()
+	local := now.In(location)
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, location)
+}
+
+// Evaluate checks all gates and returns a DeniedError listing every gate which did not pass
+func (g *Gates) Evaluate(stage string, input Input) error {
+	var reasons []string
+
+	location, _ := g.location()
+	now := input.Now.In(location)
+
+	for _, window := range g.FreezeWindows {
+		if window.contains(now) {
+			reasons = append(reasons, "stage is frozen "+window.String())
+		}
+	}
+
+	for _, label := range g.RequiredLabels {
+		value, ok := input.Labels[label.Name]
+		if !ok || value == "" {
+			reasons = append(reasons, fmt.Sprintf("label %v is required", label.Name))
+		} else if label.Pattern != "" && !regexp.MustCompile(label.Pattern).MatchString(value) {
+			reasons = append(reasons, fmt.Sprintf("label %v does not match %v", label.Name, label.Pattern))
+		}
+	}
+
+	if g.MaxPromotionsPerDay > 0 && input.PromotionsToday >= g.MaxPromotionsPerDay {
+		reasons = append(reasons, fmt.Sprintf("maximum of %v promotions per day reached", g.MaxPromotionsPerDay))
+	}
+
+	if g.Evaluation != nil {
+		if input.Evaluation == nil {
+			reasons = append(reasons, "evaluation result is required")
+		} else {
+			if g.Evaluation.Result != "" && input.Evaluation.Result != g.Evaluation.Result {
+				reasons = append(reasons, fmt.Sprintf("evaluation result is %v, required %v", input.Evaluation.Result, g.Evaluation.Result))
+			}
+			if input.Evaluation.Score < g.Evaluation.MinScore {
+				reasons = append(reasons, fmt.Sprintf("evaluation score %v is below %v", input.Evaluation.Score, g.Evaluation.MinScore))
+			}
+		}
+	}
+
+	if len(reasons) > 0 {
+		return DeniedError{Stage: stage, Reasons: reasons}
+	}
+	return nil
+}
+
+func (g *Gates) location() (*time.Location, error) {
+	if g.Timezone == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(g.Timezone)
+}
+
+func (w FreezeWindow) contains(now time.Time) bool {
+	if w.Start != nil {
+		return !now.Before(*w.Start) && now.Before(*w.End)
+	}
+
+	for _, day := range w.Days {
+		weekday, _ := parseWeekday(day)
+		if now.Weekday() != weekday {
+			continue
+		}
+		minutes := now.Hour()*60 + now.Minute()
+		from, _ := parseClock(w.From, 0)
+		to, _ := parseClock(w.To, 24*60)
+		if minutes >= from && minutes < to {
+			return true
+		}
+	}
+	return false
+}
+
+func (w FreezeWindow) String() string {
+	if w.Start != nil {
+		return fmt.Sprintf("from %v until %v", w.Start.Format(time.RFC3339), w.End.Format(time.RFC3339))
+	}
+	description := "on " + strings.Join(w.Days, ", ")
+	if w.From != "" {
+		description += " from " + w.From
+	}
+	if w.To != "" {
+		description += " until " + w.To
+	}
+	return description
+}
+
+func parseWeekday(day string) (time.Weekday, error) {
+	for weekday := time.Sunday; weekday <= time.Saturday; weekday++ {
+		if strings.EqualFold(weekday.String(), day) || strings.EqualFold(weekday.String()[:3], day) {
+			return weekday, nil
+		}
+	}
+	return time.Sunday, fmt.Errorf("unknown weekday %v", day)
+}
+
+// parseClock returns the minutes since midnight of a HH:MM time, or defaultValue if clock is empty
+func parseClock(clock string, defaultValue int) (int, error) {
+	if clock == "" {
+		return defaultValue, nil
+	}
+	parsed, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %v, expected HH:MM", clock)
+	}
+	return parsed.Hour()*60 + parsed.Minute(), nil
+}
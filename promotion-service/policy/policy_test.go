@@ -0,0 +1,141 @@
+package policy
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+const testPolicy = `
+stages:
+  prod:
+    timezone: Europe/Vienna
+    freezeWindows:
+      - start: 2021-12-24T00:00:00+01:00
+        end: 2021-12-27T00:00:00+01:00
+      - days: [Saturday, Sunday]
+      - days: [Fri]
+        from: "16:00"
+    requiredLabels:
+      - name: approvedBy
+        pattern: "@example.com$"
+    maxPromotionsPerDay: 2
+    evaluation:
+      result: pass
+      minScore: 90
+`
+
+// a tuesday
+var testNow = time.Date(2021, 11, 30, 10, 0, 0, 0, time.UTC)
+
+func validInput() Input {
+	return Input{
+		Labels:          map[string]string{"approvedBy": "jane@example.com"},
+		Evaluation:      &Evaluation{Result: "pass", Score: 95},
+		PromotionsToday: 1,
+		Now:             testNow,
+	}
+}
+
+func parseTestGates(t *testing.T) *Gates {
+	policy, err := Parse([]byte(testPolicy))
+	assert.NilError(t, err)
+
+	gates := policy.GatesFor("prod")
+	assert.Check(t, gates != nil)
+	return gates
+}
+
+func TestParse_NoGatesForStage(t *testing.T) {
+	policy, err := Parse([]byte(testPolicy))
+	assert.NilError(t, err)
+	assert.Check(t, policy.GatesFor("staging") == nil)
+}
+
+func TestParse_Invalid(t *testing.T) {
+	_, err := Parse([]byte("stages:\n  prod:\n    freezeWindows:\n      - days: [Someday]\n"))
+	assert.Error(t, err, "Invalid gates for stage prod in promotion-policy.yaml: unknown weekday Someday")
+
+	_, err = Parse([]byte("stages:\n  prod:\n    timezone: Mars/Olympus\n"))
+	assert.ErrorContains(t, err, "unknown time zone Mars/Olympus")
+}
+
+func TestEvaluate_Pass(t *testing.T) {
+	gates := parseTestGates(t)
+	assert.NilError(t, gates.Evaluate("prod", validInput()))
+}
+
+func TestEvaluate_Denied(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(input *Input)
+		want   string
+	}{
+		{
+			name:   "absolute freeze window",
+			modify: func(input *Input) { input.Now = time.Date(2021, 12, 24, 12, 0, 0, 0, time.UTC) },
+			want:   "stage is frozen from 2021-12-24T00:00:00+01:00 until 2021-12-27T00:00:00+01:00",
+		},
+		{
+			name:   "weekend",
+			modify: func(input *Input) { input.Now = time.Date(2021, 12, 4, 12, 0, 0, 0, time.UTC) },
+			want:   "stage is frozen on Saturday, Sunday",
+		},
+		{
+			name:   "friday afternoon in the timezone of the policy",
+			modify: func(input *Input) { input.Now = time.Date(2021, 12, 3, 15, 30, 0, 0, time.UTC) },
+			want:   "stage is frozen on Fri from 16:00",
+		},
+		{
+			name:   "missing label",
+			modify: func(input *Input) { input.Labels = map[string]string{} },
+			want:   "label approvedBy is required",
+		},
+		{
+			name:   "label not matching",
+			modify: func(input *Input) { input.Labels["approvedBy"] = "someone@elsewhere.com" },
+			want:   "label approvedBy does not match @example.com$",
+		},
+		{
+			name:   "too many promotions",
+			modify: func(input *Input) { input.PromotionsToday = 2 },
+			want:   "maximum of 2 promotions per day reached",
+		},
+		{
+			name:   "no evaluation",
+			modify: func(input *Input) { input.Evaluation = nil },
+			want:   "evaluation result is required",
+		},
+		{
+			name:   "failed evaluation",
+			modify: func(input *Input) { input.Evaluation.Result = "fail" },
+			want:   "evaluation result is fail, required pass",
+		},
+		{
+			name:   "low score",
+			modify: func(input *Input) { input.Evaluation.Score = 80 },
+			want:   "evaluation score 80 is below 90",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gates := parseTestGates(t)
+			input := validInput()
+			tt.modify(&input)
+
+			err := gates.Evaluate("prod", input)
+			assert.Check(t, errors.Is(err, DeniedError{}))
+			assert.Error(t, err, "Promotion into stage prod denied: "+tt.want)
+		})
+	}
+}
+
+func TestStartOfDay(t *testing.T) {
+	gates := parseTestGates(t)
+
+	start := gates.StartOfDay(time.Date(2021, 11, 30, 23, 30, 0, 0, time.UTC))
+	assert.Equal(t, start.Format(time.RFC3339), "2021-12-01T00:00:00+01:00")
+}
@@ -0,0 +1,116 @@
+package tracing
+
+import (
+	"context"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2" // make sure to use v2 cloudevents here
+	"github.com/keptn/go-utils/pkg/lib/keptn"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/keptn-sandbox/keptn-git-toolbox/promotion-service"
+
+// Span attributes describing a promotion
+const (
+	KeptnContextKey = attribute.Key("keptn.context")
+	EventIDKey      = attribute.Key("cloudevents.event_id")
+	EventTypeKey    = attribute.Key("cloudevents.event_type")
+	ProjectKey      = attribute.Key("keptn.project")
+	StageKey        = attribute.Key("keptn.stage")
+	ServiceKey      = attribute.Key("keptn.service")
+	VersionKey      = attribute.Key("keptn.version")
+)
+
+// propagator reads and writes the traceparent and tracestate attributes of the CloudEvents distributed tracing extension
+var propagator = propagation.TraceContext{}
+
+// Setup exports spans via OTLP/HTTP to the endpoint configured with the OTEL_EXPORTER_OTLP_* environment variables,
+// the returned function flushes and stops the export
+func Setup(ctx context.Context, serviceName string) (func(context.Context) error, error) {
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return SetupWithProcessor(sdktrace.NewBatchSpanProcessor(exporter), serviceName).Shutdown, nil
+}
+
+// SetupWithProcessor registers a tracer provider which passes spans to the given processor,
+// e.g. a simple processor with an in-memory exporter in tests
+func SetupWithProcessor(processor sdktrace.SpanProcessor, serviceName string) *sdktrace.TracerProvider {
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(processor),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(serviceName))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagator)
+	return provider
+}
+
+// StartSpan starts a span as child of the span in ctx
+func StartSpan(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// EndSpan records err in the span, if any, and ends it
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// ExtractEvent returns ctx with the remote span of the distributed tracing extension of the event
+func ExtractEvent(ctx context.Context, event cloudevents.Event) context.Context {
+	return propagator.Extract(ctx, eventCarrier{event: &event})
+}
+
+// InjectEvent sets the distributed tracing extension of the event to the span in ctx
+func InjectEvent(ctx context.Context, event *cloudevents.Event) {
+	propagator.Inject(ctx, eventCarrier{event: event})
+}
+
+// EventSender adds the distributed tracing extension to all events sent by a Keptn handler
+type EventSender struct {
+	Context context.Context
+	Sender  keptn.EventSender
+}
+
+// SendEvent injects the span of the sender context into the event and sends it
+func (s *EventSender) SendEvent(event cloudevents.Event) error {
+	InjectEvent(s.Context, &event)
+	return s.Sender.SendEvent(event)
+}
+
+// eventCarrier reads and writes trace context fields as CloudEvents extension attributes
+type eventCarrier struct {
+	event *cloudevents.Event
+}
+
+func (c eventCarrier) Get(key string) string {
+	value, ok := c.event.Extensions()[key].(string)
+	if !ok {
+		return ""
+	}
+	return value
+}
+
+func (c eventCarrier) Set(key string, value string) {
+	c.event.SetExtension(key, value)
+}
+
+func (c eventCarrier) Keys() []string {
+	keys := make([]string, 0, len(c.event.Extensions()))
+	for key := range c.event.Extensions() {
+		keys = append(keys, key)
+	}
+	return keys
+}
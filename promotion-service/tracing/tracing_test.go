@@ -0,0 +1,95 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2" // make sure to use v2 cloudevents here
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"gotest.tools/assert"
+)
+
+type fakeEventSender struct {
+	events []cloudevents.Event
+}
+
+func (s *fakeEventSender) SendEvent(event cloudevents.Event) error {
+	s.events = append(s.events, event)
+	return nil
+}
+
+func newTestEvent() cloudevents.Event {
+	event := cloudevents.NewEvent()
+	event.SetID("event-1")
+	event.SetType("sh.keptn.event.promotion.triggered")
+	event.SetSource("test")
+	event.SetExtension("shkeptncontext", "ctx-1")
+	return event
+}
+
+func TestSpans(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := SetupWithProcessor(sdktrace.NewSimpleSpanProcessor(exporter), "promotion-service")
+	defer provider.Shutdown(context.Background())
+
+	ctx, parent := StartSpan(context.Background(), "processKeptnCloudEvent", KeptnContextKey.String("ctx-1"))
+	_, child := StartSpan(ctx, "UpdateGitRepo", StageKey.String("prod"))
+	EndSpan(child, errors.New("push failed"))
+	EndSpan(parent, nil)
+
+	spans := exporter.GetSpans()
+	assert.Equal(t, len(spans), 2)
+	assert.Equal(t, spans[0].Name, "UpdateGitRepo")
+	assert.Equal(t, spans[0].Parent.SpanID(), spans[1].SpanContext.SpanID())
+	assert.Equal(t, spans[0].Status.Code, codes.Error)
+	assert.Equal(t, spans[0].Status.Description, "push failed")
+	assert.Equal(t, spans[1].Name, "processKeptnCloudEvent")
+	assert.Equal(t, spans[1].Status.Code, codes.Unset)
+}
+
+func TestEventPropagation(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := SetupWithProcessor(sdktrace.NewSimpleSpanProcessor(exporter), "promotion-service")
+	defer provider.Shutdown(context.Background())
+
+	ctx, span := StartSpan(context.Background(), "upstream")
+	event := newTestEvent()
+	InjectEvent(ctx, &event)
+	span.End()
+
+	traceParent, err := event.Context.GetExtension("traceparent")
+	assert.NilError(t, err)
+	assert.Assert(t, traceParent != "")
+
+	extracted := trace.SpanContextFromContext(ExtractEvent(context.Background(), event))
+	assert.Equal(t, extracted.TraceID(), span.SpanContext().TraceID())
+	assert.Equal(t, extracted.SpanID(), span.SpanContext().SpanID())
+	assert.Assert(t, extracted.IsRemote())
+}
+
+func TestExtractEvent_WithoutExtension(t *testing.T) {
+	ctx := ExtractEvent(context.Background(), newTestEvent())
+	assert.Assert(t, !trace.SpanContextFromContext(ctx).IsValid())
+}
+
+func TestEventSender(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := SetupWithProcessor(sdktrace.NewSimpleSpanProcessor(exporter), "promotion-service")
+	defer provider.Shutdown(context.Background())
+
+	ctx, span := StartSpan(context.Background(), "processKeptnCloudEvent")
+	defer span.End()
+
+	fake := &fakeEventSender{}
+	sender := &EventSender{Context: ctx, Sender: fake}
+	assert.NilError(t, sender.SendEvent(newTestEvent()))
+
+	assert.Equal(t, len(fake.events), 1)
+	sent := trace.SpanContextFromContext(ExtractEvent(context.Background(), fake.events[0]))
+	assert.Equal(t, sent.TraceID(), span.SpanContext().TraceID())
+	assert.Equal(t, sent.SpanID(), span.SpanContext().SpanID())
+}